@@ -0,0 +1,344 @@
+// Package applehealth reads the export of Apple's Health app ("Export All
+// Health Data"): an export.zip holding export.xml and the GPX routes of
+// workouts. The XML grows to several gigabytes, so it is read as a stream
+// and every record is handed to a callback as soon as it is parsed.
+package applehealth
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Source is the source of every metric and night of sleep imported from an
+// Apple Health export.
+const Source = "apple_health"
+
+// ErrNotExport is returned for files that are not an Apple Health export.
+var ErrNotExport = errors.New("not an Apple Health export (expected export.zip or export.xml)")
+
+// dateLayout is the format of every date in export.xml.
+const dateLayout = "2006-01-02 15:04:05 -0700"
+
+// Handler receives the data of an export as it is read. A callback returning
+// an error stops the import; nil callbacks skip that kind of data.
+type Handler struct {
+	Metric  func(metric *models.HealthMetric) error
+	Sleep   func(sleep *models.SleepData) error
+	Workout func(workout *Workout) error
+}
+
+// Summary counts what an import read.
+type Summary struct {
+	Metrics  int `json:"metrics"`
+	Sleep    int `json:"sleep"`
+	Workouts int `json:"workouts"`
+	Skipped  int `json:"skipped"` // records of types that are not imported
+}
+
+// IsExport reports whether the start of a file is an Apple Health
+// export.xml.
+func IsExport(head []byte) bool {
+	return bytes.Contains(head, []byte("<HealthData"))
+}
+
+// Parse reads a bare export.xml. Workouts are reported without routes,
+// which are only part of the export.zip.
+func Parse(r io.Reader, handler Handler) (Summary, error) {
+	return parse(r, nil, handler)
+}
+
+// ParseArchive reads an export.zip, reading export.xml from it as a stream
+// and each workout's route when the workout is reached.
+func ParseArchive(r io.ReaderAt, size int64, handler Handler) (Summary, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return Summary{}, fmt.Errorf("invalid ZIP file: %v", err)
+	}
+
+	// The export is in apple_health_export/, or at the top when re-zipped
+	var export *zip.File
+	files := make(map[string]*zip.File)
+	for _, file := range archive.File {
+		files[file.Name] = file
+		if path.Base(file.Name) == "export.xml" && (export == nil || len(file.Name) < len(export.Name)) {
+			export = file
+		}
+	}
+	if export == nil {
+		return Summary{}, ErrNotExport
+	}
+
+	dir := path.Dir(export.Name)
+	route := func(name string) ([]byte, error) {
+		file, ok := files[path.Join(dir, name)]
+		if !ok {
+			return nil, nil
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
+	reader, err := export.Open()
+	if err != nil {
+		return Summary{}, err
+	}
+	defer reader.Close()
+	return parse(reader, route, handler)
+}
+
+// routeFunc returns the route file a workout references, or nil when the
+// export does not include it.
+type routeFunc func(name string) ([]byte, error)
+
+type xmlMetadata struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+func parse(r io.Reader, route routeFunc, handler Handler) (Summary, error) {
+	var summary Summary
+	var segments []sleepSegment
+	root := false
+
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("invalid export.xml: %v", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "HealthData":
+			root = true
+			continue // read its children
+		case "Record":
+			record := readRecord(start)
+			if err := decoder.Skip(); err != nil {
+				return summary, fmt.Errorf("invalid export.xml: %v", err)
+			}
+			if record.Type == sleepAnalysis {
+				if segment, ok := record.sleepSegment(); ok {
+					segments = append(segments, segment)
+				}
+				continue
+			}
+			metric, ok := record.metric()
+			if !ok {
+				summary.Skipped++
+				continue
+			}
+			if handler.Metric != nil {
+				if err := handler.Metric(metric); err != nil {
+					return summary, err
+				}
+			}
+			summary.Metrics++
+		case "Workout":
+			var w xmlWorkout
+			if err := decoder.DecodeElement(&w, &start); err != nil {
+				return summary, fmt.Errorf("invalid export.xml: %v", err)
+			}
+			workout, err := w.workout(route)
+			if err != nil {
+				return summary, err
+			}
+			if workout == nil {
+				summary.Skipped++
+				continue
+			}
+			if handler.Workout != nil {
+				if err := handler.Workout(workout); err != nil {
+					return summary, err
+				}
+			}
+			summary.Workouts++
+		default:
+			// Correlations repeat the records they group, so they are
+			// skipped along with everything else
+			if err := decoder.Skip(); err != nil {
+				return summary, fmt.Errorf("invalid export.xml: %v", err)
+			}
+		}
+	}
+	if !root {
+		return summary, ErrNotExport
+	}
+
+	// Sleep is reported per night once every segment has been read
+	for _, sleep := range nights(segments) {
+		if handler.Sleep != nil {
+			if err := handler.Sleep(sleep); err != nil {
+				return summary, err
+			}
+		}
+		summary.Sleep++
+	}
+	return summary, nil
+}
+
+// record is a <Record> element's attributes. Its child elements (metadata
+// and beat-to-beat heart rates) are not used.
+type record struct {
+	Type, Unit, Value, Source, StartDate, EndDate string
+}
+
+func readRecord(start xml.StartElement) record {
+	var r record
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "type":
+			r.Type = attr.Value
+		case "unit":
+			r.Unit = attr.Value
+		case "value":
+			r.Value = attr.Value
+		case "sourceName":
+			r.Source = attr.Value
+		case "startDate":
+			r.StartDate = attr.Value
+		case "endDate":
+			r.EndDate = attr.Value
+		}
+	}
+	return r
+}
+
+// metric converts a quantity record to a health metric, reporting false for
+// types that are not imported or records that cannot be read.
+func (r record) metric() (*models.HealthMetric, bool) {
+	quantity, ok := quantityTypes[r.Type]
+	if !ok {
+		return nil, false
+	}
+	value, err := strconv.ParseFloat(r.Value, 64)
+	if err != nil {
+		return nil, false
+	}
+	if value, err = convert(value, r.Unit, quantity.appleUnit); err != nil {
+		return nil, false
+	}
+	timestamp, err := time.Parse(dateLayout, r.StartDate)
+	if err != nil {
+		return nil, false
+	}
+
+	// The ID is derived from the record, so importing a newer export of the
+	// same data overwrites the metrics imported before instead of adding
+	// them again
+	sum := sha256.Sum256([]byte(r.Type + "|" + r.Source + "|" + r.StartDate + "|" + r.EndDate + "|" + r.Value))
+	return &models.HealthMetric{
+		ID:        "health_apple_" + hex.EncodeToString(sum[:10]),
+		Type:      quantity.metric,
+		Value:     value,
+		Unit:      quantity.unit,
+		Timestamp: timestamp,
+		Source:    Source,
+	}, true
+}
+
+// quantityTypes maps the HealthKit quantity types that are imported onto
+// metric types. Values are converted to appleUnit, written as unit.
+var quantityTypes = map[string]struct{ metric, unit, appleUnit string }{
+	"HKQuantityTypeIdentifierHeartRate":                     {"heart_rate", "bpm", "count/min"},
+	"HKQuantityTypeIdentifierRestingHeartRate":              {"resting_heart_rate", "bpm", "count/min"},
+	"HKQuantityTypeIdentifierWalkingHeartRateAverage":       {"walking_heart_rate", "bpm", "count/min"},
+	"HKQuantityTypeIdentifierHeartRateVariabilitySDNN":      {"hrv", "ms", "ms"},
+	"HKQuantityTypeIdentifierRespiratoryRate":               {"respiratory_rate", "breaths/min", "count/min"},
+	"HKQuantityTypeIdentifierOxygenSaturation":              {"oxygen_saturation", "%", "%"},
+	"HKQuantityTypeIdentifierVO2Max":                        {"vo2_max", "mL/kg/min", "mL/min·kg"},
+	"HKQuantityTypeIdentifierStepCount":                     {"steps", "count", "count"},
+	"HKQuantityTypeIdentifierFlightsClimbed":                {"flights_climbed", "count", "count"},
+	"HKQuantityTypeIdentifierDistanceWalkingRunning":        {"distance_walking_running", "m", "m"},
+	"HKQuantityTypeIdentifierDistanceCycling":               {"distance_cycling", "m", "m"},
+	"HKQuantityTypeIdentifierActiveEnergyBurned":            {"active_energy", "kcal", "kcal"},
+	"HKQuantityTypeIdentifierBasalEnergyBurned":             {"basal_energy", "kcal", "kcal"},
+	"HKQuantityTypeIdentifierAppleExerciseTime":             {"exercise_time", "min", "min"},
+	"HKQuantityTypeIdentifierAppleStandTime":                {"stand_time", "min", "min"},
+	"HKQuantityTypeIdentifierBodyMass":                      {"weight", "kg", "kg"},
+	"HKQuantityTypeIdentifierLeanBodyMass":                  {"lean_body_mass", "kg", "kg"},
+	"HKQuantityTypeIdentifierBodyFatPercentage":             {"body_fat", "%", "%"},
+	"HKQuantityTypeIdentifierBodyMassIndex":                 {"bmi", "count", "count"},
+	"HKQuantityTypeIdentifierHeight":                        {"height", "cm", "cm"},
+	"HKQuantityTypeIdentifierBodyTemperature":               {"body_temperature", "°C", "degC"},
+	"HKQuantityTypeIdentifierAppleSleepingWristTemperature": {"wrist_temperature", "°C", "degC"},
+	"HKQuantityTypeIdentifierBloodPressureSystolic":         {"blood_pressure_systolic", "mmHg", "mmHg"},
+	"HKQuantityTypeIdentifierBloodPressureDiastolic":        {"blood_pressure_diastolic", "mmHg", "mmHg"},
+	"HKQuantityTypeIdentifierDietaryWater":                  {"water", "mL", "mL"},
+}
+
+// units are the HealthKit units values are converted between, as a factor
+// to the base unit of their dimension.
+var units = map[string]struct {
+	dimension string
+	factor    float64
+}{
+	"count":     {"count", 1},
+	"count/min": {"frequency", 1},
+	"count/s":   {"frequency", 60},
+	"m":         {"length", 1},
+	"cm":        {"length", 0.01},
+	"km":        {"length", 1000},
+	"in":        {"length", 0.0254},
+	"ft":        {"length", 0.3048},
+	"yd":        {"length", 0.9144},
+	"mi":        {"length", 1609.344},
+	"g":         {"mass", 0.001},
+	"kg":        {"mass", 1},
+	"oz":        {"mass", 0.028349523125},
+	"lb":        {"mass", 0.45359237},
+	"kcal":      {"energy", 1},
+	"Cal":       {"energy", 1},
+	"kJ":        {"energy", 1 / 4.184},
+	"ms":        {"time", 0.001},
+	"s":         {"time", 1},
+	"min":       {"time", 60},
+	"hr":        {"time", 3600},
+	"mL":        {"volume", 0.001},
+	"L":         {"volume", 1},
+	"fl_oz_us":  {"volume", 0.0295735295625},
+	"mmHg":      {"pressure", 1},
+	"mL/min·kg": {"vo2", 1},
+}
+
+// convert converts a value between HealthKit units. HealthKit writes
+// percentages as fractions, so "%" values are scaled to 0-100.
+func convert(value float64, from, to string) (float64, error) {
+	switch {
+	case to == "%" && from == "%":
+		return value * 100, nil
+	case from == to:
+		return value, nil
+	case from == "degF" && to == "degC":
+		return (value - 32) * 5 / 9, nil
+	case from == "degC" && to == "degF":
+		return value*9/5 + 32, nil
+	}
+	f, fromOK := units[from]
+	t, toOK := units[to]
+	if !fromOK || !toOK || f.dimension != t.dimension {
+		return 0, fmt.Errorf("cannot convert %s to %s", from, to)
+	}
+	return value * f.factor / t.factor, nil
+}
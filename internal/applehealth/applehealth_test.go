@@ -0,0 +1,216 @@
+package applehealth
+
+import (
+	"archive/zip"
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+const sampleExport = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE HealthData [
+<!ELEMENT HealthData (ExportDate,Me,(Record|Correlation|Workout|ActivitySummary)*)>
+]>
+<HealthData locale="en_US">
+ <ExportDate value="2024-05-03 09:00:00 +0200"/>
+ <Me HKCharacteristicTypeIdentifierBiologicalSex="HKBiologicalSexNotSet"/>
+ <Record type="HKQuantityTypeIdentifierHeartRate" sourceName="Watch" unit="count/min" creationDate="2024-05-01 08:00:10 +0200" startDate="2024-05-01 08:00:00 +0200" endDate="2024-05-01 08:00:00 +0200" value="62">
+  <MetadataEntry key="HKMetadataKeyHeartRateMotionContext" value="0"/>
+ </Record>
+ <Record type="HKQuantityTypeIdentifierBodyMass" sourceName="Scale" unit="lb" startDate="2024-05-01 07:00:00 +0200" endDate="2024-05-01 07:00:00 +0200" value="165"/>
+ <Record type="HKQuantityTypeIdentifierOxygenSaturation" sourceName="Watch" unit="%" startDate="2024-05-01 03:00:00 +0200" endDate="2024-05-01 03:00:00 +0200" value="0.97"/>
+ <Record type="HKQuantityTypeIdentifierBodyTemperature" sourceName="Thermometer" unit="degF" startDate="2024-05-01 07:05:00 +0200" endDate="2024-05-01 07:05:00 +0200" value="98.6"/>
+ <Record type="HKQuantityTypeIdentifierHeartRateVariabilitySDNN" sourceName="Watch" unit="ms" startDate="2024-05-01 04:00:00 +0200" endDate="2024-05-01 04:01:00 +0200" value="48.5">
+  <HeartRateVariabilityMetadataList>
+   <InstantaneousBeatsPerMinute bpm="61" time="4:00:01.00 AM"/>
+  </HeartRateVariabilityMetadataList>
+ </Record>
+ <Record type="HKQuantityTypeIdentifierDietaryCaffeine" sourceName="App" unit="mg" startDate="2024-05-01 09:00:00 +0200" endDate="2024-05-01 09:00:00 +0200" value="95"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="iPhone" startDate="2024-04-30 22:30:00 +0200" endDate="2024-05-01 06:45:00 +0200" value="HKCategoryValueSleepAnalysisInBed"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-04-30 23:00:00 +0200" endDate="2024-05-01 01:00:00 +0200" value="HKCategoryValueSleepAnalysisAsleepCore"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-05-01 01:00:00 +0200" endDate="2024-05-01 02:30:00 +0200" value="HKCategoryValueSleepAnalysisAsleepDeep"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-05-01 02:30:00 +0200" endDate="2024-05-01 02:40:00 +0200" value="HKCategoryValueSleepAnalysisAwake"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-05-01 02:40:00 +0200" endDate="2024-05-01 04:10:00 +0200" value="HKCategoryValueSleepAnalysisAsleepREM"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-05-01 04:10:00 +0200" endDate="2024-05-01 06:30:00 +0200" value="HKCategoryValueSleepAnalysisAsleepCore"/>
+ <Record type="HKCategoryTypeIdentifierSleepAnalysis" sourceName="Watch" startDate="2024-05-01 14:00:00 +0200" endDate="2024-05-01 14:20:00 +0200" value="HKCategoryValueSleepAnalysisAsleepUnspecified"/>
+ <Correlation type="HKCorrelationTypeIdentifierBloodPressure" sourceName="Cuff" startDate="2024-05-01 08:00:00 +0200" endDate="2024-05-01 08:00:00 +0200">
+  <Record type="HKQuantityTypeIdentifierBloodPressureSystolic" sourceName="Cuff" unit="mmHg" startDate="2024-05-01 08:00:00 +0200" endDate="2024-05-01 08:00:00 +0200" value="120"/>
+ </Correlation>
+ <Workout workoutActivityType="HKWorkoutActivityTypeRunning" duration="30" durationUnit="min" sourceName="Watch" startDate="2024-05-01 18:00:00 +0200" endDate="2024-05-01 18:31:00 +0200">
+  <MetadataEntry key="HKIndoorWorkout" value="0"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierDistanceWalkingRunning" startDate="2024-05-01 18:00:00 +0200" endDate="2024-05-01 18:31:00 +0200" sum="3.1" unit="mi"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierActiveEnergyBurned" startDate="2024-05-01 18:00:00 +0200" endDate="2024-05-01 18:31:00 +0200" sum="1250" unit="kJ"/>
+  <WorkoutStatistics type="HKQuantityTypeIdentifierHeartRate" startDate="2024-05-01 18:00:00 +0200" endDate="2024-05-01 18:31:00 +0200" average="151.4" minimum="98" maximum="172" unit="count/min"/>
+  <WorkoutRoute sourceName="Watch" startDate="2024-05-01 18:00:00 +0200" endDate="2024-05-01 18:31:00 +0200">
+   <FileReference path="/workout-routes/route_2024-05-01_6.00pm.gpx"/>
+  </WorkoutRoute>
+ </Workout>
+ <Workout workoutActivityType="HKWorkoutActivityTypeTraditionalStrengthTraining" duration="45" durationUnit="min" totalEnergyBurned="210" totalEnergyBurnedUnit="kcal" sourceName="Watch" startDate="2024-05-02 07:00:00 +0200" endDate="2024-05-02 07:45:00 +0200"/>
+ <ActivitySummary dateComponents="2024-05-01" activeEnergyBurned="500"/>
+</HealthData>
+`
+
+const sampleRoute = `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Apple Health Export" xmlns="http://www.topografix.com/GPX/1/1">
+ <trk><name>Route 2024-05-01 6:00pm</name><trkseg>
+  <trkpt lat="47.0" lon="8.0"><ele>400</ele><time>2024-05-01T16:00:00Z</time></trkpt>
+  <trkpt lat="47.001" lon="8.0"><ele>401</ele><time>2024-05-01T16:00:30Z</time></trkpt>
+  <trkpt lat="47.002" lon="8.0"><ele>402</ele><time>2024-05-01T16:01:00Z</time></trkpt>
+ </trkseg></trk>
+</gpx>
+`
+
+// collected records everything a parse reports.
+type collected struct {
+	metrics  []*models.HealthMetric
+	sleep    []*models.SleepData
+	workouts []*Workout
+}
+
+func (c *collected) handler() Handler {
+	return Handler{
+		Metric:  func(m *models.HealthMetric) error { c.metrics = append(c.metrics, m); return nil },
+		Sleep:   func(s *models.SleepData) error { c.sleep = append(c.sleep, s); return nil },
+		Workout: func(w *Workout) error { c.workouts = append(c.workouts, w); return nil },
+	}
+}
+
+func TestParse(t *testing.T) {
+	var c collected
+	summary, err := Parse(strings.NewReader(sampleExport), c.handler())
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	expected := Summary{Metrics: 5, Sleep: 1, Workouts: 2, Skipped: 1}
+	if summary != expected {
+		t.Errorf("Summary = %+v, expected %+v", summary, expected)
+	}
+
+	tests := []struct {
+		metricType string
+		value      float64
+		unit       string
+	}{
+		{"heart_rate", 62, "bpm"},
+		{"weight", 74.84, "kg"},
+		{"oxygen_saturation", 97, "%"},
+		{"body_temperature", 37, "°C"},
+		{"hrv", 48.5, "ms"},
+	}
+	for i, tt := range tests {
+		m := c.metrics[i]
+		if m.Type != tt.metricType || math.Abs(m.Value-tt.value) > 0.01 || m.Unit != tt.unit || m.Source != Source {
+			t.Errorf("Metric %d = %+v, expected %s %v %s", i, m, tt.metricType, tt.value, tt.unit)
+		}
+	}
+	if got := c.metrics[0].Timestamp; !got.Equal(time.Date(2024, 5, 1, 6, 0, 0, 0, time.UTC)) {
+		t.Errorf("Timestamp = %v", got)
+	}
+
+	// The watch's staged night wins over the phone's time in bed, and the
+	// nap later that day is dropped for it
+	sleep := c.sleep[0]
+	if sleep.DeepSleep != 90 || sleep.REMSleep != 90 || sleep.LightSleep != 260 || sleep.TotalSleep != 440 {
+		t.Errorf("Sleep stages = %+v", sleep)
+	}
+	if sleep.Date.Format("2006-01-02") != "2024-05-01" || sleep.Bedtime.Hour() != 23 || sleep.WakeTime.Hour() != 6 {
+		t.Errorf("Sleep times = %v %v %v", sleep.Date, sleep.Bedtime, sleep.WakeTime)
+	}
+
+	run := c.workouts[0]
+	if run.Route != nil {
+		t.Error("A bare export.xml has no routes")
+	}
+	activity := run.Activity
+	if activity.Type != gpx.TypeRunning || activity.Name != "Running" || activity.Duration != 1800 || activity.ElapsedTime != 1860 {
+		t.Errorf("Run = %+v", activity)
+	}
+	if math.Abs(activity.Distance-4988.97) > 0.1 || activity.Calories != 299 || activity.AvgHeartRate != 151 || activity.MaxHeartRate != 172 {
+		t.Errorf("Run totals = %v m, %d kcal, %d/%d bpm", activity.Distance, activity.Calories, activity.AvgHeartRate, activity.MaxHeartRate)
+	}
+	strength := c.workouts[1].Activity
+	if strength.Name != "Traditional Strength Training" || strength.Type != "traditional_strength_training" || strength.Calories != 210 {
+		t.Errorf("Strength workout = %+v", strength)
+	}
+}
+
+func TestParseArchive(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"apple_health_export/export.xml":                                 sampleExport,
+		"apple_health_export/export_cda.xml":                             "<ClinicalDocument/>",
+		"apple_health_export/workout-routes/route_2024-05-01_6.00pm.gpx": sampleRoute,
+	} {
+		file, _ := archive.Create(name)
+		file.Write([]byte(content))
+	}
+	archive.Close()
+
+	var c collected
+	if _, err := ParseArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), c.handler()); err != nil {
+		t.Fatalf("ParseArchive() error = %v", err)
+	}
+	run := c.workouts[0]
+	if string(run.Route) != sampleRoute || run.RouteName != "workout-routes/route_2024-05-01_6.00pm.gpx" {
+		t.Errorf("Route %q not read from the archive", run.RouteName)
+	}
+	if c.workouts[1].Route != nil {
+		t.Error("Expected no route for the strength workout")
+	}
+
+	// Workout data fills in what the route does not have
+	_, activity, err := gpx.ParseGPX(string(run.Route))
+	if err != nil {
+		t.Fatalf("ParseGPX() error = %v", err)
+	}
+	run.Apply(activity)
+	if activity.Name != "Running" || activity.Type != gpx.TypeRunning || activity.Calories != 299 || activity.AvgHeartRate != 151 {
+		t.Errorf("Applied activity = %+v", activity)
+	}
+}
+
+func TestParseNotExport(t *testing.T) {
+	if _, err := Parse(strings.NewReader(`<gpx></gpx>`), Handler{}); err != ErrNotExport {
+		t.Errorf("Parse() error = %v, expected ErrNotExport", err)
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	file, _ := archive.Create("activities/run.gpx")
+	file.Write([]byte(sampleRoute))
+	archive.Close()
+	if _, err := ParseArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()), Handler{}); err != ErrNotExport {
+		t.Errorf("ParseArchive() error = %v, expected ErrNotExport", err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		value    float64
+		from, to string
+		expected float64
+	}{
+		{10, "km", "m", 10000},
+		{1, "mi", "m", 1609.344},
+		{100, "lb", "kg", 45.359237},
+		{4.184, "kJ", "kcal", 1},
+		{1.5, "hr", "min", 90},
+		{0.21, "%", "%", 21},
+		{212, "degF", "degC", 100},
+	}
+	for _, tt := range tests {
+		got, err := convert(tt.value, tt.from, tt.to)
+		if err != nil || math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("convert(%v, %s, %s) = %v, %v, expected %v", tt.value, tt.from, tt.to, got, err, tt.expected)
+		}
+	}
+	if _, err := convert(1, "kg", "m"); err == nil {
+		t.Error("Expected an error converting mass to length")
+	}
+}
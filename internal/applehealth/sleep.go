@@ -0,0 +1,150 @@
+package applehealth
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+const sleepAnalysis = "HKCategoryTypeIdentifierSleepAnalysis"
+
+// Sleep stages of sleep analysis records. Before iOS 16 asleep time was a
+// single stage, which is counted towards the total only.
+const (
+	stageInBed   = "HKCategoryValueSleepAnalysisInBed"
+	stageAsleep  = "HKCategoryValueSleepAnalysisAsleep"
+	stageUnknown = "HKCategoryValueSleepAnalysisAsleepUnspecified"
+	stageCore    = "HKCategoryValueSleepAnalysisAsleepCore"
+	stageDeep    = "HKCategoryValueSleepAnalysisAsleepDeep"
+	stageREM     = "HKCategoryValueSleepAnalysisAsleepREM"
+	stageAwake   = "HKCategoryValueSleepAnalysisAwake"
+)
+
+// sleepSessionGap is the longest break between segments of one night.
+const sleepSessionGap = 2 * time.Hour
+
+// sleepSegment is one sleep analysis record: a stretch of time in one stage.
+type sleepSegment struct {
+	source     string
+	stage      string
+	start, end time.Time
+}
+
+func (r record) sleepSegment() (sleepSegment, bool) {
+	start, err := time.Parse(dateLayout, r.StartDate)
+	if err != nil {
+		return sleepSegment{}, false
+	}
+	end, err := time.Parse(dateLayout, r.EndDate)
+	if err != nil || !end.After(start) {
+		return sleepSegment{}, false
+	}
+	return sleepSegment{source: r.Source, stage: r.Value, start: start, end: end}, true
+}
+
+// nights groups sleep segments into one SleepData per night, oldest first.
+// Segments of each source (Apple Watch, iPhone, sleep apps) are grouped into
+// sessions separately, as they overlap. When several sessions end on the same
+// day, the one with sleep stages wins, then the longest.
+func nights(segments []sleepSegment) []*models.SleepData {
+	bySource := make(map[string][]sleepSegment)
+	for _, segment := range segments {
+		bySource[segment.source] = append(bySource[segment.source], segment)
+	}
+	sources := make([]string, 0, len(bySource))
+	for source := range bySource {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	best := make(map[string]*models.SleepData)
+	keep := func(session []sleepSegment) {
+		sleep := summarizeSleep(session)
+		if sleep.TotalSleep == 0 {
+			return
+		}
+		key := sleep.Date.Format("2006-01-02")
+		if other, ok := best[key]; !ok || betterSleep(sleep, other) {
+			best[key] = sleep
+		}
+	}
+
+	for _, source := range sources {
+		segments := bySource[source]
+		sort.Slice(segments, func(i, j int) bool {
+			return segments[i].start.Before(segments[j].start)
+		})
+
+		var session []sleepSegment
+		var end time.Time
+		for _, segment := range segments {
+			if len(session) > 0 && segment.start.Sub(end) > sleepSessionGap {
+				keep(session)
+				session = nil
+			}
+			session = append(session, segment)
+			if segment.end.After(end) {
+				end = segment.end
+			}
+		}
+		if len(session) > 0 {
+			keep(session)
+		}
+	}
+
+	result := make([]*models.SleepData, 0, len(best))
+	for _, sleep := range best {
+		result = append(result, sleep)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Date.Before(result[j].Date)
+	})
+	return result
+}
+
+// summarizeSleep adds up the stages of one session. The night is dated by
+// the day it ends.
+func summarizeSleep(session []sleepSegment) *models.SleepData {
+	var bedtime, wakeTime time.Time
+	seconds := make(map[string]float64)
+	for _, segment := range session {
+		if bedtime.IsZero() || segment.start.Before(bedtime) {
+			bedtime = segment.start
+		}
+		if segment.end.After(wakeTime) {
+			wakeTime = segment.end
+		}
+		seconds[segment.stage] += segment.end.Sub(segment.start).Seconds()
+	}
+
+	minutes := func(stages ...string) int {
+		total := 0.0
+		for _, stage := range stages {
+			total += seconds[stage]
+		}
+		return int(math.Round(total / 60))
+	}
+
+	date := time.Date(wakeTime.Year(), wakeTime.Month(), wakeTime.Day(), 0, 0, 0, 0, wakeTime.Location())
+	return &models.SleepData{
+		ID:         "sleep_apple_" + date.Format("20060102"),
+		Date:       date,
+		Bedtime:    bedtime,
+		WakeTime:   wakeTime,
+		TotalSleep: minutes(stageAsleep, stageUnknown, stageCore, stageDeep, stageREM),
+		DeepSleep:  minutes(stageDeep),
+		REMSleep:   minutes(stageREM),
+		LightSleep: minutes(stageCore),
+		Source:     Source,
+	}
+}
+
+func betterSleep(a, b *models.SleepData) bool {
+	aStages, bStages := a.DeepSleep+a.REMSleep > 0, b.DeepSleep+b.REMSleep > 0
+	if aStages != bStages {
+		return aStages
+	}
+	return a.TotalSleep > b.TotalSleep
+}
@@ -0,0 +1,164 @@
+package applehealth
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+// Workout is a workout from the export. Activity holds what export.xml says
+// about it; Route is its GPX route when the export includes one.
+type Workout struct {
+	Activity  *models.Activity
+	Route     []byte
+	RouteName string // path of the route within the export
+}
+
+// Apply copies the workout's name and type onto an activity parsed from its
+// route, and fills in the calories and heart rate the route does not have.
+func (w *Workout) Apply(activity *models.Activity) {
+	activity.Name = w.Activity.Name
+	activity.Type = w.Activity.Type
+	activity.TypeSource = models.TypeSourceFile
+	activity.TypeConfidence = 1
+	if activity.Calories == 0 {
+		activity.Calories = w.Activity.Calories
+	}
+	if activity.AvgHeartRate == 0 {
+		activity.AvgHeartRate = w.Activity.AvgHeartRate
+	}
+	if activity.MaxHeartRate == 0 {
+		activity.MaxHeartRate = w.Activity.MaxHeartRate
+	}
+}
+
+type xmlWorkout struct {
+	ActivityType          string          `xml:"workoutActivityType,attr"`
+	Duration              float64         `xml:"duration,attr"`
+	DurationUnit          string          `xml:"durationUnit,attr"`
+	TotalDistance         float64         `xml:"totalDistance,attr"`
+	TotalDistanceUnit     string          `xml:"totalDistanceUnit,attr"`
+	TotalEnergyBurned     float64         `xml:"totalEnergyBurned,attr"`
+	TotalEnergyBurnedUnit string          `xml:"totalEnergyBurnedUnit,attr"`
+	StartDate             string          `xml:"startDate,attr"`
+	EndDate               string          `xml:"endDate,attr"`
+	Statistics            []xmlStatistics `xml:"WorkoutStatistics"`
+	Routes                []struct {
+		Files []struct {
+			Path string `xml:"path,attr"`
+		} `xml:"FileReference"`
+	} `xml:"WorkoutRoute"`
+}
+
+// xmlStatistics are a workout's totals per quantity type, which newer
+// exports write instead of the total attributes.
+type xmlStatistics struct {
+	Type    string  `xml:"type,attr"`
+	Sum     float64 `xml:"sum,attr"`
+	Average float64 `xml:"average,attr"`
+	Maximum float64 `xml:"maximum,attr"`
+	Unit    string  `xml:"unit,attr"`
+}
+
+// workoutTypes maps HealthKit workout types onto our activity types. Other
+// types become their name in snake_case, e.g. "traditional_strength_training".
+var workoutTypes = map[string]string{
+	"Running": gpx.TypeRunning,
+	"Cycling": gpx.TypeCycling,
+	"Walking": gpx.TypeWalking,
+	"Hiking":  gpx.TypeHiking,
+}
+
+// workout converts a <Workout> element. It returns nil for workouts without
+// valid dates.
+func (w xmlWorkout) workout(route routeFunc) (*Workout, error) {
+	start, err := time.Parse(dateLayout, w.StartDate)
+	if err != nil {
+		return nil, nil
+	}
+	end, err := time.Parse(dateLayout, w.EndDate)
+	if err != nil {
+		return nil, nil
+	}
+
+	name := strings.TrimPrefix(w.ActivityType, "HKWorkoutActivityType")
+	if name == "" {
+		name = "Workout"
+	}
+	activityType, ok := workoutTypes[name]
+	if !ok {
+		activityType = gpx.NormalizeActivityType(splitWords(name))
+	}
+	activity := &models.Activity{
+		Name:           splitWords(name),
+		Type:           activityType,
+		TypeSource:     models.TypeSourceFile,
+		TypeConfidence: 1,
+		StartTime:      start,
+		EndTime:        end,
+		ElapsedTime:    int(end.Sub(start).Seconds()),
+	}
+	if duration, err := convert(w.Duration, w.DurationUnit, "s"); err == nil {
+		activity.Duration = int(math.Round(duration))
+		activity.MovingTime = activity.Duration
+	}
+	if distance, err := convert(w.TotalDistance, w.TotalDistanceUnit, "m"); err == nil {
+		activity.Distance = distance
+	}
+	if calories, err := convert(w.TotalEnergyBurned, w.TotalEnergyBurnedUnit, "kcal"); err == nil {
+		activity.Calories = int(math.Round(calories))
+	}
+	for _, s := range w.Statistics {
+		switch {
+		case strings.HasPrefix(s.Type, "HKQuantityTypeIdentifierDistance") && activity.Distance == 0:
+			if distance, err := convert(s.Sum, s.Unit, "m"); err == nil {
+				activity.Distance = distance
+			}
+		case s.Type == "HKQuantityTypeIdentifierActiveEnergyBurned" && activity.Calories == 0:
+			if calories, err := convert(s.Sum, s.Unit, "kcal"); err == nil {
+				activity.Calories = int(math.Round(calories))
+			}
+		case s.Type == "HKQuantityTypeIdentifierHeartRate":
+			activity.AvgHeartRate = int(math.Round(s.Average))
+			activity.MaxHeartRate = int(math.Round(s.Maximum))
+		}
+	}
+	if activity.Duration > 0 {
+		activity.AvgSpeed = activity.Distance / float64(activity.Duration) * 3.6
+	}
+
+	workout := &Workout{Activity: activity}
+	for _, r := range w.Routes {
+		for _, file := range r.Files {
+			if route == nil || workout.Route != nil {
+				continue
+			}
+			data, err := route(file.Path)
+			if err != nil {
+				return nil, fmt.Errorf("reading route %s: %v", file.Path, err)
+			}
+			if data != nil {
+				workout.Route, workout.RouteName = data, strings.TrimPrefix(file.Path, "/")
+			}
+		}
+	}
+	return workout, nil
+}
+
+// splitWords turns a CamelCase name into words: "TraditionalStrengthTraining"
+// becomes "Traditional Strength Training".
+func splitWords(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
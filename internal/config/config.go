@@ -2,37 +2,74 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"runtime"
 	"strconv"
 )
 
 type Config struct {
-	Port        string
-	DataPath    string
-	UseS3       bool
-	S3Bucket    string
-	AWSRegion   string
-	Environment string
-	
+	Port           string
+	DataPath       string
+	StorageBackend string // "file" (JSON files) or "sqlite"; S3 only applies to "file"
+	SQLitePath     string
+	UseS3          bool
+	S3Bucket       string
+	AWSRegion      string
+	Environment    string
+
 	// Elevation smoothing parameters
-	ElevationSmoothingWindow    int     // Number of points to consider for smoothing
-	ElevationMinGain           float64  // Minimum elevation gain to count (meters)
-	ElevationSmoothingEnabled  bool     // Enable elevation smoothing
+	ElevationSmoothingWindow  int     // Number of points to consider for smoothing
+	ElevationMinGain          float64 // Minimum elevation gain to count (meters)
+	ElevationSmoothingEnabled bool    // Enable elevation smoothing
+
+	// Pause detection parameters
+	PauseDetectionEnabled bool    // Split moving time from elapsed time
+	PauseSpeedThreshold   float64 // Slower than this counts as stopped (km/h)
+	PauseMinDuration      int     // Shortest stop recorded as a pause (seconds)
+	PauseGapThreshold     int     // Longer gaps between points are pauses, e.g. device auto-pause (seconds)
+
+	ImportWorkers int // Files of a bulk import parsed concurrently
+
+	// Watched import folder
+	WatchDir      string // Activity files appearing here are imported automatically; empty disables watching
+	WatchInterval int    // How often the folder is scanned (seconds)
 }
 
 func Load() *Config {
 	return &Config{
-		Port:        getEnvOrDefault("PORT", "8088"),
-		DataPath:    getEnvOrDefault("DATA_PATH", "./data"),
-		UseS3:       getBoolEnvOrDefault("USE_S3", false),
-		S3Bucket:    getEnvOrDefault("S3_BUCKET", ""),
-		AWSRegion:   getEnvOrDefault("AWS_REGION", "us-east-1"),
-		Environment: getEnvOrDefault("ENVIRONMENT", "development"),
-		
+		Port:           getEnvOrDefault("PORT", "8088"),
+		DataPath:       getEnvOrDefault("DATA_PATH", "./data"),
+		StorageBackend: getEnvOrDefault("STORAGE_BACKEND", "file"),
+		SQLitePath:     getEnvOrDefault("SQLITE_PATH", ""),
+		UseS3:          getBoolEnvOrDefault("USE_S3", false),
+		S3Bucket:       getEnvOrDefault("S3_BUCKET", ""),
+		AWSRegion:      getEnvOrDefault("AWS_REGION", "us-east-1"),
+		Environment:    getEnvOrDefault("ENVIRONMENT", "development"),
+
 		// Elevation smoothing defaults (Strava-inspired threshold approach)
-		ElevationSmoothingWindow:   getIntEnvOrDefault("ELEVATION_SMOOTHING_WINDOW", 5),
+		ElevationSmoothingWindow:  getIntEnvOrDefault("ELEVATION_SMOOTHING_WINDOW", 5),
 		ElevationMinGain:          getFloatEnvOrDefault("ELEVATION_MIN_GAIN", 1.0),
 		ElevationSmoothingEnabled: getBoolEnvOrDefault("ELEVATION_SMOOTHING_ENABLED", true),
+
+		PauseDetectionEnabled: getBoolEnvOrDefault("PAUSE_DETECTION_ENABLED", true),
+		PauseSpeedThreshold:   getFloatEnvOrDefault("PAUSE_SPEED_THRESHOLD", 1.0),
+		PauseMinDuration:      getIntEnvOrDefault("PAUSE_MIN_DURATION", 10),
+		PauseGapThreshold:     getIntEnvOrDefault("PAUSE_GAP_THRESHOLD", 30),
+
+		ImportWorkers: getIntEnvOrDefault("IMPORT_WORKERS", runtime.NumCPU()),
+
+		WatchDir:      getEnvOrDefault("WATCH_DIR", ""),
+		WatchInterval: getIntEnvOrDefault("WATCH_INTERVAL", 30),
+	}
+}
+
+// DatabasePath returns the SQLite database location, defaulting to a file
+// inside the data directory.
+func (c *Config) DatabasePath() string {
+	if c.SQLitePath != "" {
+		return c.SQLitePath
 	}
+	return filepath.Join(c.DataPath, "health-hub.db")
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -67,4 +104,4 @@ func getFloatEnvOrDefault(key string, defaultValue float64) float64 {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
@@ -0,0 +1,115 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// TrackFunc loads an activity's stored track. It returns nil and no error for
+// activities recorded without GPS.
+type TrackFunc func(activityID string) (*models.GPXTrack, error)
+
+// summaryHeader are the columns of the archive's activities.csv. The names
+// follow Strava's export, so the archive can be imported again like one.
+var summaryHeader = []string{
+	"Activity ID", "Activity Date", "Activity Name", "Activity Type", "Activity Description",
+	"Elapsed Time", "Moving Time", "Distance", "Elevation Gain", "Average Speed", "Max Speed",
+	"Average Heart Rate", "Max Heart Rate", "Average Cadence", "Average Watts", "Calories", "Filename",
+}
+
+// WriteArchive writes a ZIP of every activity in the given format under
+// activities/, oldest first, and an activities.csv summary. Files are
+// written as they are exported, so w can be an HTTP response. Activities
+// without a start time have no TCX file and are only listed in the summary.
+func WriteArchive(w io.Writer, format string, activities []*models.Activity, track TrackFunc) error {
+	sorted := append([]*models.Activity(nil), activities...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	archive := zip.NewWriter(w)
+	rows := [][]string{summaryHeader}
+	used := make(map[string]bool)
+	for _, activity := range sorted {
+		t, err := track(activity.ID)
+		if err != nil {
+			return fmt.Errorf("loading track of %s: %v", activity.ID, err)
+		}
+
+		// Activities with the same date and name get numbered
+		base := strings.TrimSuffix(Filename(activity, format), "."+format)
+		filename := "activities/" + base + "." + format
+		for n := 2; used[filename]; n++ {
+			filename = fmt.Sprintf("activities/%s_%d.%s", base, n, format)
+		}
+		used[filename] = true
+
+		var data bytes.Buffer
+		err = Write(&data, format, activity, t)
+		if err == ErrNoTimestamps {
+			// Listed in the summary, but without a file
+			rows = append(rows, summaryRow(activity, ""))
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("exporting %s: %v", activity.ID, err)
+		}
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: filename, Method: zip.Deflate, Modified: activity.StartTime})
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(data.Bytes()); err != nil {
+			return err
+		}
+		rows = append(rows, summaryRow(activity, filename))
+	}
+
+	file, err := archive.CreateHeader(&zip.FileHeader{Name: "activities.csv", Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	writer := csv.NewWriter(file)
+	if err := writer.WriteAll(rows); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// summaryRow returns an activity's activities.csv row. Times are seconds,
+// distances meters and speeds km/h.
+func summaryRow(activity *models.Activity, filename string) []string {
+	optional := func(value int) string {
+		if value == 0 {
+			return ""
+		}
+		return strconv.Itoa(value)
+	}
+	return []string{
+		activity.ID,
+		activity.StartTime.UTC().Format(time.RFC3339),
+		activity.Name,
+		activity.Type,
+		activity.Description,
+		strconv.Itoa(activity.ElapsedTime),
+		strconv.Itoa(activity.Duration),
+		strconv.FormatFloat(activity.Distance, 'f', 1, 64),
+		strconv.FormatFloat(activity.TotalElevation, 'f', 1, 64),
+		strconv.FormatFloat(activity.AvgSpeed, 'f', 2, 64),
+		strconv.FormatFloat(activity.MaxSpeed, 'f', 2, 64),
+		optional(activity.AvgHeartRate),
+		optional(activity.MaxHeartRate),
+		optional(activity.AvgCadence),
+		optional(activity.AvgPower),
+		optional(activity.Calories),
+		filename,
+	}
+}
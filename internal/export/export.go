@@ -0,0 +1,126 @@
+// Package export writes stored activities back out as GPX, TCX, GeoJSON or
+// KML files, and a whole account as a ZIP archive.
+package export
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Export formats.
+const (
+	FormatGPX     = "gpx"
+	FormatTCX     = "tcx"
+	FormatGeoJSON = "geojson"
+	FormatKML     = "kml"
+)
+
+// Formats lists the export formats in the order they are offered.
+var Formats = []string{FormatGPX, FormatTCX, FormatGeoJSON, FormatKML}
+
+// ErrUnknownFormat is returned for a format not in Formats.
+var ErrUnknownFormat = errors.New("unknown export format (expected gpx, tcx, geojson or kml)")
+
+// ErrNoTimestamps is returned for a TCX export of an activity without a
+// start time; TCX files identify activities and laps by their start times.
+var ErrNoTimestamps = errors.New("TCX export needs timestamps, and the activity has no start time")
+
+const creator = "Health Hub"
+
+// ParseFormat validates a format name, defaulting to GPX.
+func ParseFormat(format string) (string, error) {
+	format = strings.ToLower(format)
+	if format == "" {
+		return FormatGPX, nil
+	}
+	for _, f := range Formats {
+		if f == format {
+			return f, nil
+		}
+	}
+	return "", ErrUnknownFormat
+}
+
+// ContentType returns the MIME type of a format.
+func ContentType(format string) string {
+	switch format {
+	case FormatGPX:
+		return "application/gpx+xml"
+	case FormatTCX:
+		return "application/vnd.garmin.tcx+xml"
+	case FormatGeoJSON:
+		return "application/geo+json"
+	case FormatKML:
+		return "application/vnd.google-earth.kml+xml"
+	}
+	return "application/octet-stream"
+}
+
+// Write writes an activity and its track in the given format. track may be
+// nil for activities recorded without GPS.
+func Write(w io.Writer, format string, activity *models.Activity, track *models.GPXTrack) error {
+	if track == nil {
+		track = &models.GPXTrack{}
+	}
+	switch format {
+	case FormatGPX:
+		return writeGPX(w, activity, track)
+	case FormatTCX:
+		return writeTCX(w, activity, track)
+	case FormatGeoJSON:
+		return writeGeoJSON(w, activity, track)
+	case FormatKML:
+		return writeKML(w, activity, track)
+	}
+	return ErrUnknownFormat
+}
+
+// Filename returns a file name for an exported activity, such as
+// "2024-05-01_Morning_Run.gpx".
+func Filename(activity *models.Activity, format string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r == ' ':
+			return '_'
+		}
+		return -1
+	}, activity.Name)
+	if name == "" {
+		name = activity.ID
+	}
+	return activity.StartTime.Format("2006-01-02") + "_" + name + "." + format
+}
+
+// segments splits a track's points into its track segments.
+func segments(track *models.GPXTrack) [][]models.GPXPoint {
+	if len(track.Points) == 0 {
+		return nil
+	}
+	starts := []int{0}
+	for _, start := range track.Segments {
+		if start > starts[len(starts)-1] && start < len(track.Points) {
+			starts = append(starts, start)
+		}
+	}
+	starts = append(starts, len(track.Points))
+
+	result := make([][]models.GPXPoint, len(starts)-1)
+	for i := range result {
+		result[i] = track.Points[starts[i]:starts[i+1]]
+	}
+	return result
+}
+
+// formatTime formats a point time, or returns "" for points without one.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
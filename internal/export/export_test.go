@@ -0,0 +1,279 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/gpx"
+	"health-hub/internal/importer"
+	"health-hub/internal/models"
+	"health-hub/internal/tcx"
+)
+
+// sampleActivity returns a run with two track segments of three points each
+// and sensor data on every point.
+func sampleActivity() (*models.Activity, *models.GPXTrack) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	temperature := 18.5
+	track := &models.GPXTrack{Segments: []int{0, 3}}
+	for i := 0; i < 6; i++ {
+		track.Points = append(track.Points, models.GPXPoint{
+			Lat:         47.0 + float64(i)*0.001,
+			Lon:         8.0,
+			Elevation:   400 + float64(i),
+			Time:        start.Add(time.Duration(i) * 10 * time.Second),
+			HeartRate:   140 + i,
+			Cadence:     170,
+			Power:       250,
+			Temperature: &temperature,
+		})
+	}
+	activity := &models.Activity{
+		ID:          "activity_1",
+		Name:        "Morning Run",
+		Type:        gpx.TypeRunning,
+		Description: "Easy pace",
+		StartTime:   start,
+		Duration:    50,
+		Distance:    556,
+		Laps: []models.Lap{
+			{Index: 1, StartTime: start, Duration: 20, Distance: 222},
+			{Index: 2, StartTime: start.Add(30 * time.Second), Duration: 20, Distance: 222},
+			{Index: 3, StartTime: start.Add(10 * time.Second), Duration: 10, Manual: true},
+		},
+	}
+	return activity, track
+}
+
+func TestWriteGPX(t *testing.T) {
+	activity, track := sampleActivity()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGPX, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	parsed, parsedActivity, err := gpx.ParseGPX(buf.String())
+	if err != nil {
+		t.Fatalf("Exported GPX does not parse: %v\n%s", err, buf.String())
+	}
+	if parsedActivity.Name != "Morning Run" || parsedActivity.Type != gpx.TypeRunning {
+		t.Errorf("Name and type = %q, %q", parsedActivity.Name, parsedActivity.Type)
+	}
+	if len(parsed.Points) != 6 || len(parsed.Segments) != 2 {
+		t.Fatalf("Expected 6 points in 2 segments, got %d in %v", len(parsed.Points), parsed.Segments)
+	}
+	for i, p := range parsed.Points {
+		original := track.Points[i]
+		if !p.Time.Equal(original.Time) || p.Elevation != original.Elevation || p.HeartRate != original.HeartRate ||
+			p.Cadence != original.Cadence || p.Power != original.Power || p.Temperature == nil || *p.Temperature != 18.5 {
+			t.Errorf("Point %d = %+v, expected %+v", i, p, original)
+		}
+	}
+}
+
+func TestWriteTCX(t *testing.T) {
+	activity, track := sampleActivity()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatTCX, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	parsed, parsedActivity, err := tcx.ParseTCX(buf.String())
+	if err != nil {
+		t.Fatalf("Exported TCX does not parse: %v\n%s", err, buf.String())
+	}
+	if parsedActivity.Type != gpx.TypeRunning {
+		t.Errorf("Type = %q, expected running", parsedActivity.Type)
+	}
+	// The manual lap overlaps the recorded ones and is left out
+	if len(parsedActivity.Laps) != 2 {
+		t.Errorf("Expected 2 laps, got %d", len(parsedActivity.Laps))
+	}
+	if len(parsed.Points) != 6 {
+		t.Fatalf("Expected 6 points, got %d", len(parsed.Points))
+	}
+	if p := parsed.Points[5]; p.HeartRate != 145 || p.Cadence != 170 || p.Power != 250 {
+		t.Errorf("Last point = %+v", p)
+	}
+	if !strings.Contains(buf.String(), "<Notes>Easy pace</Notes>") {
+		t.Error("Expected the description as notes")
+	}
+}
+
+func TestWriteGeoJSON(t *testing.T) {
+	activity, track := sampleActivity()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatGeoJSON, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+
+	var collection struct {
+		Features []struct {
+			Geometry struct {
+				Type        string        `json:"type"`
+				Coordinates [][][]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Name                 string `json:"name"`
+				CoordinateProperties struct {
+					Times [][]string `json:"times"`
+					Heart [][]int    `json:"heart"`
+					Power [][]int    `json:"power"`
+				} `json:"coordinateProperties"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &collection); err != nil {
+		t.Fatalf("Invalid GeoJSON: %v", err)
+	}
+	feature := collection.Features[0]
+	if feature.Geometry.Type != "MultiLineString" || len(feature.Geometry.Coordinates) != 2 {
+		t.Fatalf("Unexpected geometry %+v", feature.Geometry)
+	}
+	if got := feature.Geometry.Coordinates[1][0]; got[0] != 8.0 || got[1] != 47.003 || got[2] != 403 {
+		t.Errorf("Coordinate = %v, expected [lon lat ele]", got)
+	}
+	properties := feature.Properties.CoordinateProperties
+	if len(properties.Times[1]) != 3 || properties.Times[0][0] != "2024-05-01T08:00:00Z" || properties.Heart[1][2] != 145 {
+		t.Errorf("Unexpected coordinate properties %+v", properties)
+	}
+
+	// Activities without GPS have no geometry
+	buf.Reset()
+	if err := Write(&buf, FormatGeoJSON, activity, nil); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if !strings.Contains(buf.String(), `"geometry": null`) {
+		t.Errorf("Expected a null geometry, got %s", buf.String())
+	}
+}
+
+func TestWriteKML(t *testing.T) {
+	activity, track := sampleActivity()
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatKML, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	kml := buf.String()
+	if n := strings.Count(kml, "<gx:Track>"); n != 2 {
+		t.Errorf("Expected 2 tracks, got %d", n)
+	}
+	if n := strings.Count(kml, "<when>"); n != 6 {
+		t.Errorf("Expected 6 timestamps, got %d", n)
+	}
+	if !strings.Contains(kml, "<gx:coord>8 47.002 402</gx:coord>") || !strings.Contains(kml, `<gx:SimpleArrayData name="heartrate">`) {
+		t.Errorf("Unexpected KML:\n%s", kml)
+	}
+
+	// Without timestamps the track is a plain line
+	for i := range track.Points {
+		track.Points[i].Time = time.Time{}
+	}
+	buf.Reset()
+	if err := Write(&buf, FormatKML, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if strings.Contains(buf.String(), "gx:Track") || strings.Count(buf.String(), "<LineString>") != 2 {
+		t.Errorf("Expected LineStrings, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteTCXUntimed(t *testing.T) {
+	data := `<?xml version="1.0"?>
+<gpx version="1.1" creator="test"><trk><name>Planned Route</name><trkseg>
+<trkpt lat="47.000" lon="8.0"><ele>400</ele></trkpt>
+<trkpt lat="47.001" lon="8.0"><ele>401</ele></trkpt>
+<trkpt lat="47.002" lon="8.0"><ele>402</ele></trkpt>
+</trkseg></trk></gpx>`
+	track, activity, err := gpx.ParseGPX(data)
+	if err != nil {
+		t.Fatalf("ParseGPX() error: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, FormatTCX, activity, track); err != ErrNoTimestamps {
+		t.Fatalf("Write() error = %v, expected ErrNoTimestamps", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Expected nothing written, got %s", buf.String())
+	}
+
+	// Points without a time are left out when the activity has a start time
+	activity.StartTime = time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	track.Points[1].Time = activity.StartTime.Add(10 * time.Second)
+	if err := Write(&buf, FormatTCX, activity, track); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	if strings.Contains(buf.String(), "<Time></Time>") || strings.Count(buf.String(), "<Trackpoint>") != 1 {
+		t.Errorf("Expected only the timed trackpoint:\n%s", buf.String())
+	}
+	if _, _, err := tcx.ParseTCX(buf.String()); err != nil {
+		t.Errorf("Exported TCX does not parse: %v", err)
+	}
+
+	// The account archive lists the untimed activity without a file
+	activity.StartTime = time.Time{}
+	buf.Reset()
+	err = WriteArchive(&buf, FormatTCX, []*models.Activity{activity}, func(string) (*models.GPXTrack, error) {
+		return track, nil
+	})
+	if err != nil {
+		t.Fatalf("WriteArchive() error: %v", err)
+	}
+	if strings.Contains(buf.String(), ".tcx") {
+		t.Error("Expected no TCX file in the archive")
+	}
+}
+
+func TestWriteArchive(t *testing.T) {
+	first, track := sampleActivity()
+	second := *first
+	second.ID = "activity_2"
+	second.Description = ""
+	indoor := &models.Activity{ID: "activity_3", Name: "Trainer", Type: gpx.TypeCycling, StartTime: first.StartTime.AddDate(0, 0, -1)}
+
+	tracks := map[string]*models.GPXTrack{"activity_1": track, "activity_2": track}
+	var buf bytes.Buffer
+	err := WriteArchive(&buf, FormatGPX, []*models.Activity{first, &second, indoor}, func(id string) (*models.GPXTrack, error) {
+		return tracks[id], nil
+	})
+	if err != nil {
+		t.Fatalf("WriteArchive() error: %v", err)
+	}
+
+	// The archive imports again like a Strava export
+	archive, err := importer.OpenArchive(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("OpenArchive() error: %v", err)
+	}
+	defer archive.Close()
+	var names []string
+	for _, file := range archive.Files {
+		names = append(names, file.Name)
+		if file.Metadata == nil {
+			t.Errorf("No activities.csv entry for %s", file.Name)
+		}
+	}
+	expected := "activities/2024-04-30_Trainer.gpx activities/2024-05-01_Morning_Run.gpx activities/2024-05-01_Morning_Run_2.gpx"
+	if got := strings.Join(names, " "); got != expected {
+		t.Errorf("Archive holds %s, expected %s", got, expected)
+	}
+	if archive.Files[1].Metadata.Description != "Easy pace" || archive.Files[0].Metadata.Type != gpx.TypeCycling {
+		t.Errorf("Unexpected metadata %+v, %+v", archive.Files[1].Metadata, archive.Files[0].Metadata)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]string{"": FormatGPX, "TCX": FormatTCX, "geojson": FormatGeoJSON, "kml": FormatKML}
+	for input, expected := range tests {
+		if got, err := ParseFormat(input); err != nil || got != expected {
+			t.Errorf("ParseFormat(%q) = %q, %v, expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := ParseFormat("fit"); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
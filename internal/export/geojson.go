@@ -0,0 +1,108 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+
+	"health-hub/internal/models"
+)
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   *geoJSONGeometry       `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONGeometry struct {
+	Type        string        `json:"type"`
+	Coordinates [][][]float64 `json:"coordinates"`
+}
+
+// writeGeoJSON writes the track as a MultiLineString feature, one line per
+// track segment, with [lon, lat, elevation] coordinates. Timestamps and
+// sensor data go in coordinateProperties, as togeojson writes them; the
+// activity's totals are properties.
+func writeGeoJSON(w io.Writer, activity *models.Activity, track *models.GPXTrack) error {
+	properties := map[string]interface{}{
+		"name":           activity.Name,
+		"type":           activity.Type,
+		"start_time":     formatTime(activity.StartTime),
+		"distance":       activity.Distance,
+		"duration":       activity.Duration,
+		"elapsed_time":   activity.ElapsedTime,
+		"elevation_gain": activity.TotalElevation,
+	}
+	if activity.Description != "" {
+		properties["description"] = activity.Description
+	}
+
+	var geometry *geoJSONGeometry // null for activities without GPS
+	if parts := segments(track); len(parts) > 0 {
+		geometry = &geoJSONGeometry{Type: "MultiLineString"}
+		for _, points := range parts {
+			line := make([][]float64, len(points))
+			for i, p := range points {
+				line[i] = []float64{p.Lon, p.Lat, p.Elevation}
+			}
+			geometry.Coordinates = append(geometry.Coordinates, line)
+		}
+		properties["coordinateProperties"] = coordinateProperties(parts)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(geoJSONCollection{
+		Type: "FeatureCollection",
+		Features: []geoJSONFeature{{
+			Type:       "Feature",
+			Geometry:   geometry,
+			Properties: properties,
+		}},
+	})
+}
+
+// pointProperties are the per-point values written to coordinateProperties.
+// A property is only written when some point has a value for it.
+var pointProperties = []struct {
+	name    string
+	value   func(p models.GPXPoint) interface{}
+	present func(p models.GPXPoint) bool
+}{
+	{"times", func(p models.GPXPoint) interface{} { return formatTime(p.Time) }, func(p models.GPXPoint) bool { return !p.Time.IsZero() }},
+	{"heart", func(p models.GPXPoint) interface{} { return p.HeartRate }, func(p models.GPXPoint) bool { return p.HeartRate > 0 }},
+	{"cadence", func(p models.GPXPoint) interface{} { return p.Cadence }, func(p models.GPXPoint) bool { return p.Cadence > 0 }},
+	{"power", func(p models.GPXPoint) interface{} { return p.Power }, func(p models.GPXPoint) bool { return p.Power > 0 }},
+	{"temperature", func(p models.GPXPoint) interface{} { return p.Temperature }, func(p models.GPXPoint) bool { return p.Temperature != nil }},
+}
+
+// coordinateProperties returns, for each kind of data the points have, an
+// array per track segment with a value per point.
+func coordinateProperties(parts [][]models.GPXPoint) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, property := range pointProperties {
+		found := false
+		for _, points := range parts {
+			for _, p := range points {
+				found = found || property.present(p)
+			}
+		}
+		if !found {
+			continue
+		}
+
+		lines := make([][]interface{}, len(parts))
+		for i, points := range parts {
+			lines[i] = make([]interface{}, len(points))
+			for j, p := range points {
+				lines[i][j] = property.value(p)
+			}
+		}
+		result[property.name] = lines
+	}
+	return result
+}
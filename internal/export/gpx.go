@@ -0,0 +1,104 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+
+	"health-hub/internal/models"
+)
+
+type gpxFile struct {
+	XMLName  xml.Name    `xml:"gpx"`
+	Version  string      `xml:"version,attr"`
+	Creator  string      `xml:"creator,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsTPX string      `xml:"xmlns:gpxtpx,attr"`
+	Metadata gpxMetadata `xml:"metadata"`
+	Track    gpxTrack    `xml:"trk"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+type gpxTrack struct {
+	Name        string       `xml:"name,omitempty"`
+	Description string       `xml:"desc,omitempty"`
+	Type        string       `xml:"type,omitempty"`
+	Segments    []gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Elevation  float64        `xml:"ele,omitempty"`
+	Time       string         `xml:"time,omitempty"`
+	Extensions *gpxExtensions `xml:"extensions"`
+}
+
+// gpxExtensions carries sensor data the way Garmin devices write it, with
+// power as Strava writes it, so other apps and our own importer read it back.
+type gpxExtensions struct {
+	Power      int                  `xml:"power,omitempty"`
+	TrackPoint *gpxTrackPointSensor `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointSensor struct {
+	Temperature *float64 `xml:"gpxtpx:atemp"`
+	HeartRate   int      `xml:"gpxtpx:hr,omitempty"`
+	Cadence     int      `xml:"gpxtpx:cad,omitempty"`
+}
+
+func writeGPX(w io.Writer, activity *models.Activity, track *models.GPXTrack) error {
+	file := gpxFile{
+		Version:  "1.1",
+		Creator:  creator,
+		Xmlns:    "http://www.topografix.com/GPX/1/1",
+		XmlnsTPX: "http://www.garmin.com/xmlschemas/TrackPointExtension/v1",
+		Metadata: gpxMetadata{Name: activity.Name, Time: formatTime(activity.StartTime)},
+		Track: gpxTrack{
+			Name:        activity.Name,
+			Description: activity.Description,
+			Type:        activity.Type,
+		},
+	}
+	for _, points := range segments(track) {
+		var segment gpxSegment
+		for _, p := range points {
+			point := gpxPoint{Lat: p.Lat, Lon: p.Lon, Elevation: p.Elevation, Time: formatTime(p.Time)}
+			if p.HeartRate > 0 || p.Cadence > 0 || p.Power > 0 || p.Temperature != nil {
+				point.Extensions = &gpxExtensions{Power: p.Power}
+				if p.HeartRate > 0 || p.Cadence > 0 || p.Temperature != nil {
+					point.Extensions.TrackPoint = &gpxTrackPointSensor{
+						Temperature: p.Temperature,
+						HeartRate:   p.HeartRate,
+						Cadence:     p.Cadence,
+					}
+				}
+			}
+			segment.Points = append(segment.Points, point)
+		}
+		file.Track.Segments = append(file.Track.Segments, segment)
+	}
+
+	return writeXML(w, file)
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(w io.Writer, v interface{}) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
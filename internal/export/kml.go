@@ -0,0 +1,163 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"health-hub/internal/models"
+)
+
+type kmlFile struct {
+	XMLName  xml.Name    `xml:"kml"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	XmlnsGX  string      `xml:"xmlns:gx,attr"`
+	Document kmlDocument `xml:"Document"`
+}
+
+type kmlDocument struct {
+	Name      string       `xml:"name"`
+	Schema    *kmlSchema   `xml:"Schema"`
+	Placemark kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlSchema struct {
+	ID     string          `xml:"id,attr"`
+	Fields []kmlArrayField `xml:"gx:SimpleArrayField"`
+}
+
+type kmlArrayField struct {
+	Name        string `xml:"name,attr"`
+	Type        string `xml:"type,attr"`
+	DisplayName string `xml:"displayName"`
+}
+
+type kmlPlacemark struct {
+	Name          string            `xml:"name"`
+	Description   string            `xml:"description,omitempty"`
+	MultiTrack    *kmlMultiTrack    `xml:"gx:MultiTrack"`
+	MultiGeometry *kmlMultiGeometry `xml:"MultiGeometry"`
+}
+
+type kmlMultiTrack struct {
+	AltitudeMode string     `xml:"altitudeMode"`
+	Tracks       []kmlTrack `xml:"gx:Track"`
+}
+
+type kmlTrack struct {
+	When         []string         `xml:"when"`
+	Coords       []string         `xml:"gx:coord"`
+	ExtendedData *kmlExtendedData `xml:"ExtendedData"`
+}
+
+type kmlExtendedData struct {
+	SchemaData kmlSchemaData `xml:"SchemaData"`
+}
+
+type kmlSchemaData struct {
+	SchemaURL string         `xml:"schemaUrl,attr"`
+	Arrays    []kmlArrayData `xml:"gx:SimpleArrayData"`
+}
+
+type kmlArrayData struct {
+	Name   string   `xml:"name,attr"`
+	Values []string `xml:"gx:value"`
+}
+
+type kmlMultiGeometry struct {
+	LineStrings []kmlLineString `xml:"LineString"`
+}
+
+type kmlLineString struct {
+	AltitudeMode string `xml:"altitudeMode"`
+	Coordinates  string `xml:"coordinates"`
+}
+
+// kmlSensors are the sensor arrays written alongside gx:Track coordinates.
+var kmlSensors = []struct {
+	name, displayName string
+	value             func(p models.GPXPoint) int
+}{
+	{"heartrate", "Heart Rate", func(p models.GPXPoint) int { return p.HeartRate }},
+	{"cadence", "Cadence", func(p models.GPXPoint) int { return p.Cadence }},
+	{"power", "Power", func(p models.GPXPoint) int { return p.Power }},
+}
+
+// writeKML writes the track as a gx:Track per segment, which keeps
+// timestamps and sensor data and plays back in Google Earth. Tracks without
+// timestamps are written as plain LineStrings.
+func writeKML(w io.Writer, activity *models.Activity, track *models.GPXTrack) error {
+	file := kmlFile{
+		Xmlns:   "http://www.opengis.net/kml/2.2",
+		XmlnsGX: "http://www.google.com/kml/ext/2.2",
+		Document: kmlDocument{
+			Name:      activity.Name,
+			Placemark: kmlPlacemark{Name: activity.Name, Description: activity.Description},
+		},
+	}
+
+	parts := segments(track)
+	timed := len(parts) > 0
+	for _, p := range track.Points {
+		timed = timed && !p.Time.IsZero()
+	}
+
+	if timed {
+		// Only sensors some point recorded get an array
+		var sensors []int
+		for i, sensor := range kmlSensors {
+			for _, p := range track.Points {
+				if sensor.value(p) > 0 {
+					sensors = append(sensors, i)
+					break
+				}
+			}
+		}
+		if len(sensors) > 0 {
+			file.Document.Schema = &kmlSchema{ID: "sensors"}
+			for _, i := range sensors {
+				file.Document.Schema.Fields = append(file.Document.Schema.Fields,
+					kmlArrayField{Name: kmlSensors[i].name, Type: "int", DisplayName: kmlSensors[i].displayName})
+			}
+		}
+
+		multiTrack := &kmlMultiTrack{AltitudeMode: "absolute"}
+		for _, points := range parts {
+			var t kmlTrack
+			for _, p := range points {
+				t.When = append(t.When, formatTime(p.Time))
+				t.Coords = append(t.Coords, fmt.Sprintf("%s %s %s", formatFloat(p.Lon), formatFloat(p.Lat), formatFloat(p.Elevation)))
+			}
+			if len(sensors) > 0 {
+				t.ExtendedData = &kmlExtendedData{SchemaData: kmlSchemaData{SchemaURL: "#sensors"}}
+				for _, i := range sensors {
+					data := kmlArrayData{Name: kmlSensors[i].name}
+					for _, p := range points {
+						data.Values = append(data.Values, strconv.Itoa(kmlSensors[i].value(p)))
+					}
+					t.ExtendedData.SchemaData.Arrays = append(t.ExtendedData.SchemaData.Arrays, data)
+				}
+			}
+			multiTrack.Tracks = append(multiTrack.Tracks, t)
+		}
+		file.Document.Placemark.MultiTrack = multiTrack
+	} else if len(parts) > 0 {
+		geometry := &kmlMultiGeometry{}
+		for _, points := range parts {
+			coords := make([]string, len(points))
+			for i, p := range points {
+				coords[i] = formatFloat(p.Lon) + "," + formatFloat(p.Lat) + "," + formatFloat(p.Elevation)
+			}
+			geometry.LineStrings = append(geometry.LineStrings, kmlLineString{AltitudeMode: "absolute", Coordinates: strings.Join(coords, " ")})
+		}
+		file.Document.Placemark.MultiGeometry = geometry
+	}
+
+	return writeXML(w, file)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,219 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"math"
+	"time"
+
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+type tcxFile struct {
+	XMLName    xml.Name      `xml:"TrainingCenterDatabase"`
+	Xmlns      string        `xml:"xmlns,attr"`
+	XmlnsNS3   string        `xml:"xmlns:ns3,attr"`
+	XmlnsXSI   string        `xml:"xmlns:xsi,attr"`
+	Activities []tcxActivity `xml:"Activities>Activity"`
+}
+
+type tcxActivity struct {
+	Sport   string      `xml:"Sport,attr"`
+	ID      string      `xml:"Id"`
+	Laps    []tcxLap    `xml:"Lap"`
+	Notes   string      `xml:"Notes,omitempty"`
+	Creator *tcxCreator `xml:"Creator"`
+}
+
+type tcxLap struct {
+	StartTime        string           `xml:"StartTime,attr"`
+	TotalTimeSeconds float64          `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64          `xml:"DistanceMeters"`
+	MaximumSpeed     float64          `xml:"MaximumSpeed,omitempty"` // m/s
+	Calories         int              `xml:"Calories"`
+	AverageHeartRate *tcxValue        `xml:"AverageHeartRateBpm"`
+	MaximumHeartRate *tcxValue        `xml:"MaximumHeartRateBpm"`
+	Intensity        string           `xml:"Intensity"`
+	Cadence          int              `xml:"Cadence,omitempty"`
+	TriggerMethod    string           `xml:"TriggerMethod"`
+	Trackpoints      []tcxTrackpoint  `xml:"Track>Trackpoint"`
+	Extensions       *tcxLapExtension `xml:"Extensions>ns3:LX"`
+}
+
+type tcxLapExtension struct {
+	AvgSpeed      float64 `xml:"ns3:AvgSpeed,omitempty"` // m/s
+	AvgRunCadence int     `xml:"ns3:AvgRunCadence,omitempty"`
+	AvgWatts      int     `xml:"ns3:AvgWatts,omitempty"`
+	MaxWatts      int     `xml:"ns3:MaxWatts,omitempty"`
+}
+
+type tcxTrackpoint struct {
+	Time           string                  `xml:"Time"`
+	Position       tcxPosition             `xml:"Position"`
+	AltitudeMeters float64                 `xml:"AltitudeMeters,omitempty"`
+	DistanceMeters float64                 `xml:"DistanceMeters"`
+	HeartRate      *tcxValue               `xml:"HeartRateBpm"`
+	Cadence        int                     `xml:"Cadence,omitempty"`
+	Extensions     *tcxTrackpointExtension `xml:"Extensions>ns3:TPX"`
+}
+
+type tcxPosition struct {
+	Lat float64 `xml:"LatitudeDegrees"`
+	Lon float64 `xml:"LongitudeDegrees"`
+}
+
+type tcxTrackpointExtension struct {
+	Watts      int `xml:"ns3:Watts,omitempty"`
+	RunCadence int `xml:"ns3:RunCadence,omitempty"`
+}
+
+type tcxValue struct {
+	Value int `xml:"Value"`
+}
+
+type tcxCreator struct {
+	Type      string `xml:"xsi:type,attr"`
+	Name      string `xml:"Name"`
+	UnitID    string `xml:"UnitId"`
+	ProductID int    `xml:"ProductID"`
+	Version   struct {
+		Major int `xml:"VersionMajor"`
+		Minor int `xml:"VersionMinor"`
+	} `xml:"Version"`
+}
+
+// tcxSports maps our activity types onto the three sports TCX knows.
+var tcxSports = map[string]string{
+	gpx.TypeRunning: "Running",
+	gpx.TypeCycling: "Biking",
+}
+
+func writeTCX(w io.Writer, activity *models.Activity, track *models.GPXTrack) error {
+	if activity.StartTime.IsZero() {
+		return ErrNoTimestamps
+	}
+	sport, ok := tcxSports[activity.Type]
+	if !ok {
+		sport = "Other"
+	}
+	running := sport == "Running"
+	tcx := tcxActivity{
+		Sport: sport,
+		ID:    formatTime(activity.StartTime),
+		Notes: activity.Description,
+	}
+	if activity.Device != nil {
+		tcx.Creator = &tcxCreator{Type: "Device_t", Name: activity.Device.Name(), UnitID: activity.Device.SerialNumber}
+	}
+
+	// Trackpoints carry the distance covered so far. TCX requires a time on
+	// every trackpoint, so points recorded without one are left out.
+	var trackpoints []tcxTrackpoint
+	var times []time.Time
+	distance := 0.0
+	for i, p := range track.Points {
+		if i > 0 {
+			distance += gpx.Distance(track.Points[i-1], p)
+		}
+		if p.Time.IsZero() {
+			continue
+		}
+		tp := tcxTrackpoint{
+			Time:           formatTime(p.Time),
+			Position:       tcxPosition{Lat: p.Lat, Lon: p.Lon},
+			AltitudeMeters: p.Elevation,
+			DistanceMeters: math.Round(distance*10) / 10,
+		}
+		if p.HeartRate > 0 {
+			tp.HeartRate = &tcxValue{Value: p.HeartRate}
+		}
+		// Garmin writes running cadence as an extension
+		runCadence := 0
+		if running {
+			runCadence = p.Cadence
+		} else {
+			tp.Cadence = p.Cadence
+		}
+		if p.Power > 0 || runCadence > 0 {
+			tp.Extensions = &tcxTrackpointExtension{Watts: p.Power, RunCadence: runCadence}
+		}
+		trackpoints = append(trackpoints, tp)
+		times = append(times, p.Time)
+	}
+
+	laps := tcxLaps(activity)
+	for _, lap := range laps {
+		l := tcxLap{
+			StartTime:        formatTime(lap.StartTime),
+			TotalTimeSeconds: float64(lap.Duration),
+			DistanceMeters:   lap.Distance,
+			MaximumSpeed:     lap.MaxSpeed / 3.6,
+			Calories:         lap.Calories,
+			Intensity:        "Active",
+			TriggerMethod:    "Manual",
+		}
+		if lap.AvgHeartRate > 0 {
+			l.AverageHeartRate = &tcxValue{Value: lap.AvgHeartRate}
+		}
+		if lap.MaxHeartRate > 0 {
+			l.MaximumHeartRate = &tcxValue{Value: lap.MaxHeartRate}
+		}
+		extension := tcxLapExtension{AvgSpeed: lap.AvgSpeed / 3.6, AvgWatts: lap.AvgPower, MaxWatts: lap.MaxPower}
+		if running {
+			extension.AvgRunCadence = lap.AvgCadence
+		} else {
+			l.Cadence = lap.AvgCadence
+		}
+		if extension != (tcxLapExtension{}) {
+			l.Extensions = &extension
+		}
+
+		tcx.Laps = append(tcx.Laps, l)
+	}
+
+	// Each lap holds the trackpoints up to the next lap's start
+	current := 0
+	for i, tp := range trackpoints {
+		t := times[i]
+		for current+1 < len(laps) && !t.Before(laps[current+1].StartTime) {
+			current++
+		}
+		tcx.Laps[current].Trackpoints = append(tcx.Laps[current].Trackpoints, tp)
+	}
+
+	return writeXML(w, tcxFile{
+		Xmlns:      "http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2",
+		XmlnsNS3:   "http://www.garmin.com/xmlschemas/ActivityExtension/v2",
+		XmlnsXSI:   "http://www.w3.org/2001/XMLSchema-instance",
+		Activities: []tcxActivity{tcx},
+	})
+}
+
+// tcxLaps returns the laps to write: the activity's recorded laps, which
+// cover it end to end unlike manual laps, or one lap for the whole activity.
+func tcxLaps(activity *models.Activity) []models.Lap {
+	var laps []models.Lap
+	for _, lap := range activity.Laps {
+		if !lap.Manual {
+			laps = append(laps, lap)
+		}
+	}
+	if len(laps) > 0 {
+		return laps
+	}
+	return []models.Lap{{
+		Index:        1,
+		StartTime:    activity.StartTime,
+		Duration:     activity.Duration,
+		Distance:     activity.Distance,
+		AvgSpeed:     activity.AvgSpeed,
+		MaxSpeed:     activity.MaxSpeed,
+		Calories:     activity.Calories,
+		AvgHeartRate: activity.AvgHeartRate,
+		MaxHeartRate: activity.MaxHeartRate,
+		AvgCadence:   activity.AvgCadence,
+		AvgPower:     activity.AvgPower,
+		MaxPower:     activity.MaxPower,
+	}}
+}
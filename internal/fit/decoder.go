@@ -0,0 +1,327 @@
+// Package fit decodes Garmin FIT activity files into the same track and
+// activity models produced by the gpx package.
+package fit
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ErrNotFIT is returned for data that does not start with a FIT header.
+var ErrNotFIT = errors.New("not a FIT file")
+
+// IsFIT reports whether data starts with a FIT file header.
+func IsFIT(data []byte) bool {
+	return len(data) >= 12 && int(data[0]) >= 12 && string(data[8:12]) == ".FIT"
+}
+
+type fieldDef struct {
+	num      byte
+	size     byte
+	baseType byte
+}
+
+// definition describes the layout of the data messages that follow it for
+// one local message type.
+type definition struct {
+	global  uint16
+	order   binary.ByteOrder
+	fields  []fieldDef
+	devSize int // total size of developer fields, which we skip
+}
+
+// message is one decoded data message. Invalid (unset) fields are omitted;
+// numeric values are stored unscaled.
+type message struct {
+	num     uint16
+	values  map[byte]float64
+	strings map[byte]string
+}
+
+func (m message) value(field byte) (float64, bool) {
+	v, ok := m.values[field]
+	return v, ok
+}
+
+// int returns a numeric field, or 0 when it is unset.
+func (m message) int(field byte) int {
+	return int(m.values[field])
+}
+
+// decode reads every data message of a FIT file, checking the file CRC.
+// Chained files are not supported; only the first file is read.
+func decode(data []byte) ([]message, error) {
+	if !IsFIT(data) {
+		return nil, ErrNotFIT
+	}
+	headerSize := int(data[0])
+	dataSize := int(binary.LittleEndian.Uint32(data[4:8]))
+	end := headerSize + dataSize
+	if len(data) < end+2 {
+		return nil, fmt.Errorf("FIT file is truncated: expected %d bytes, got %d", end+2, len(data))
+	}
+	if crc(data[:end]) != binary.LittleEndian.Uint16(data[end:end+2]) {
+		return nil, errors.New("FIT file checksum mismatch")
+	}
+
+	var messages []message
+	var definitions [16]*definition
+	var lastTimestamp uint32
+
+	pos := headerSize
+	for pos < end {
+		header := data[pos]
+		pos++
+
+		if header&0x80 != 0 {
+			// Compressed timestamp header: 5-bit offset from the last timestamp
+			local := (header >> 5) & 0x03
+			offset := uint32(header & 0x1F)
+			timestamp := lastTimestamp&^0x1F + offset
+			if offset < lastTimestamp&0x1F {
+				timestamp += 0x20
+			}
+			lastTimestamp = timestamp
+
+			def := definitions[local]
+			if def == nil {
+				return nil, fmt.Errorf("data message for undefined local type %d at byte %d", local, pos-1)
+			}
+			msg, size, err := readMessage(data[pos:end], def)
+			if err != nil {
+				return nil, err
+			}
+			pos += size
+			msg.values[fieldTimestamp] = float64(timestamp)
+			messages = append(messages, msg)
+			continue
+		}
+
+		local := header & 0x0F
+		if header&0x40 != 0 {
+			def, size, err := readDefinition(data[pos:end], header&0x20 != 0)
+			if err != nil {
+				return nil, err
+			}
+			definitions[local] = def
+			pos += size
+			continue
+		}
+
+		def := definitions[local]
+		if def == nil {
+			return nil, fmt.Errorf("data message for undefined local type %d at byte %d", local, pos-1)
+		}
+		msg, size, err := readMessage(data[pos:end], def)
+		if err != nil {
+			return nil, err
+		}
+		pos += size
+		if timestamp, ok := msg.value(fieldTimestamp); ok {
+			lastTimestamp = uint32(timestamp)
+		}
+		messages = append(messages, msg)
+	}
+
+	return messages, nil
+}
+
+func readDefinition(b []byte, hasDevFields bool) (*definition, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errors.New("FIT definition message is truncated")
+	}
+	def := &definition{order: binary.LittleEndian}
+	if b[1] == 1 {
+		def.order = binary.BigEndian
+	}
+	def.global = def.order.Uint16(b[2:4])
+
+	count := int(b[4])
+	pos := 5
+	if len(b) < pos+count*3 {
+		return nil, 0, errors.New("FIT definition message is truncated")
+	}
+	for i := 0; i < count; i++ {
+		def.fields = append(def.fields, fieldDef{num: b[pos], size: b[pos+1], baseType: b[pos+2]})
+		pos += 3
+	}
+
+	if hasDevFields {
+		if len(b) < pos+1 {
+			return nil, 0, errors.New("FIT definition message is truncated")
+		}
+		devCount := int(b[pos])
+		pos++
+		if len(b) < pos+devCount*3 {
+			return nil, 0, errors.New("FIT definition message is truncated")
+		}
+		for i := 0; i < devCount; i++ {
+			def.devSize += int(b[pos+1])
+			pos += 3
+		}
+	}
+
+	return def, pos, nil
+}
+
+func readMessage(b []byte, def *definition) (message, int, error) {
+	msg := message{num: def.global, values: map[byte]float64{}, strings: map[byte]string{}}
+	pos := 0
+	for _, field := range def.fields {
+		size := int(field.size)
+		if len(b) < pos+size {
+			return msg, 0, fmt.Errorf("FIT message %d is truncated", def.global)
+		}
+		raw := b[pos : pos+size]
+		pos += size
+
+		if field.baseType&0x1F == baseString {
+			if s := readString(raw); s != "" {
+				msg.strings[field.num] = s
+			}
+			continue
+		}
+		if v, ok := readValue(raw, field.baseType, def.order); ok {
+			msg.values[field.num] = v
+		}
+	}
+	if len(b) < pos+def.devSize {
+		return msg, 0, fmt.Errorf("FIT message %d is truncated", def.global)
+	}
+	return msg, pos + def.devSize, nil
+}
+
+// FIT base type numbers (the low five bits of the base type byte).
+const (
+	baseEnum    = 0
+	baseSint8   = 1
+	baseUint8   = 2
+	baseSint16  = 3
+	baseUint16  = 4
+	baseSint32  = 5
+	baseUint32  = 6
+	baseString  = 7
+	baseFloat32 = 8
+	baseFloat64 = 9
+	baseUint8z  = 10
+	baseUint16z = 11
+	baseUint32z = 12
+	baseByte    = 13
+	baseSint64  = 14
+	baseUint64  = 15
+	baseUint64z = 16
+)
+
+// readValue decodes the first element of a numeric field. It returns false
+// for the base type's invalid value and for fields too short to hold one.
+func readValue(b []byte, baseType byte, order binary.ByteOrder) (float64, bool) {
+	switch baseType & 0x1F {
+	case baseEnum, baseUint8, baseByte:
+		if len(b) < 1 || b[0] == 0xFF {
+			return 0, false
+		}
+		return float64(b[0]), true
+	case baseUint8z:
+		if len(b) < 1 || b[0] == 0 {
+			return 0, false
+		}
+		return float64(b[0]), true
+	case baseSint8:
+		if len(b) < 1 || b[0] == 0x7F {
+			return 0, false
+		}
+		return float64(int8(b[0])), true
+	case baseUint16, baseUint16z:
+		if len(b) < 2 {
+			return 0, false
+		}
+		v := order.Uint16(b)
+		if (baseType&0x1F == baseUint16 && v == 0xFFFF) || (baseType&0x1F == baseUint16z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case baseSint16:
+		if len(b) < 2 {
+			return 0, false
+		}
+		v := int16(order.Uint16(b))
+		if v == math.MaxInt16 {
+			return 0, false
+		}
+		return float64(v), true
+	case baseUint32, baseUint32z:
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := order.Uint32(b)
+		if (baseType&0x1F == baseUint32 && v == 0xFFFFFFFF) || (baseType&0x1F == baseUint32z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	case baseSint32:
+		if len(b) < 4 {
+			return 0, false
+		}
+		v := int32(order.Uint32(b))
+		if v == math.MaxInt32 {
+			return 0, false
+		}
+		return float64(v), true
+	case baseFloat32:
+		if len(b) < 4 || order.Uint32(b) == 0xFFFFFFFF {
+			return 0, false
+		}
+		return float64(math.Float32frombits(order.Uint32(b))), true
+	case baseFloat64:
+		if len(b) < 8 || order.Uint64(b) == math.MaxUint64 {
+			return 0, false
+		}
+		return math.Float64frombits(order.Uint64(b)), true
+	case baseSint64:
+		if len(b) < 8 || int64(order.Uint64(b)) == math.MaxInt64 {
+			return 0, false
+		}
+		return float64(int64(order.Uint64(b))), true
+	case baseUint64, baseUint64z:
+		if len(b) < 8 {
+			return 0, false
+		}
+		v := order.Uint64(b)
+		if (baseType&0x1F == baseUint64 && v == math.MaxUint64) || (baseType&0x1F == baseUint64z && v == 0) {
+			return 0, false
+		}
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func readString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+var crcTable = [16]uint16{
+	0x0000, 0xCC01, 0xD801, 0x1400, 0xF001, 0x3C00, 0x2800, 0xE401,
+	0xA001, 0x6C00, 0x7800, 0xB401, 0x5000, 0x9C01, 0x8801, 0x4400,
+}
+
+// crc computes the FIT CRC-16 of b.
+func crc(b []byte) uint16 {
+	var sum uint16
+	for _, c := range b {
+		tmp := crcTable[sum&0xF]
+		sum = (sum >> 4) & 0x0FFF
+		sum = sum ^ tmp ^ crcTable[c&0xF]
+
+		tmp = crcTable[sum&0xF]
+		sum = (sum >> 4) & 0x0FFF
+		sum = sum ^ tmp ^ crcTable[(c>>4)&0xF]
+	}
+	return sum
+}
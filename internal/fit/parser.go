@@ -0,0 +1,207 @@
+package fit
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+// ParseFIT decodes a FIT activity file using the current configuration.
+func ParseFIT(data []byte) (*models.GPXTrack, *models.Activity, error) {
+	cfg := config.Load()
+	return ParseFITWithConfig(data, cfg)
+}
+
+// ParseFITWithConfig decodes a FIT activity file into a track and activity.
+// Stats are computed from the records the same way as for GPX files; the
+// device's session totals only fill in what the records cannot provide, such
+// as distance for indoor activities without GPS.
+func ParseFITWithConfig(data []byte, cfg *config.Config) (*models.GPXTrack, *models.Activity, error) {
+	messages, err := decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	track := &models.GPXTrack{
+		Points: []models.GPXPoint{},
+	}
+
+	var records []models.GPXPoint // every record, with or without a position
+	var laps []models.Lap
+	var session *message
+	var sport int
+	var fileDevice, creatorDevice *models.Device
+
+	for i := range messages {
+		msg := messages[i]
+		switch msg.num {
+		case mesgFileID:
+			if fileType, ok := msg.value(fileIDType); ok && int(fileType) != fileTypeActivity {
+				return nil, nil, fmt.Errorf("FIT file is not an activity (file type %d)", int(fileType))
+			}
+			fileDevice = device(msg, fileIDManufacturer, fileIDProduct, fileIDProductName, fileIDSerialNumber)
+
+		case mesgDeviceInfo:
+			if index, ok := msg.value(deviceInfoDeviceIndex); ok && int(index) == deviceIndexCreator {
+				creatorDevice = device(msg, deviceInfoManufacturer, deviceInfoProduct, deviceInfoProductName, deviceInfoSerialNumber)
+				if version, ok := msg.value(deviceInfoSoftwareVersion); ok {
+					creatorDevice.SoftwareVersion = strconv.FormatFloat(version/100, 'f', 2, 64)
+				}
+			}
+
+		case mesgRecord:
+			point, hasPosition := recordPoint(msg)
+			records = append(records, point)
+			if hasPosition {
+				track.Points = append(track.Points, point)
+			}
+
+		case mesgLap:
+			laps = append(laps, lap(msg, len(laps)+1))
+
+		case mesgSession:
+			if session == nil {
+				session = &messages[i]
+				sport = msg.int(sessionSport)
+			}
+
+		case mesgSport:
+			if sport == 0 {
+				sport = msg.int(sportSport)
+			}
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("FIT file has no activity records")
+	}
+
+	activity := gpx.Summarize(track.Points, cfg)
+	// Indoor activities have sensor data without positions
+	gpx.ApplySensorStats(activity, records)
+	gpx.ApplyRecordTimes(activity, records)
+	if len(track.Points) == 0 {
+		// Power efforts from indoor sessions
+		activity.BestEfforts = gpx.BestEfforts(records)
+	}
+
+	if session != nil {
+		if activity.Distance == 0 {
+			activity.Distance = session.values[sessionTotalDistance] / 100
+		}
+		if activity.StartTime.IsZero() {
+			if start, ok := session.value(sessionStartTime); ok {
+				activity.StartTime = fitTime(start)
+				activity.EndTime = activity.StartTime.Add(time.Duration(session.values[sessionTotalElapsedTime]) * time.Millisecond)
+			}
+		}
+		// Without GPS there is nothing to detect pauses from, so trust the device timer
+		if len(track.Points) == 0 {
+			if timer, ok := session.value(sessionTotalTimerTime); ok {
+				activity.MovingTime = int(timer / 1000)
+				activity.Duration = activity.MovingTime
+			}
+			if elapsed, ok := session.value(sessionTotalElapsedTime); ok {
+				activity.ElapsedTime = int(elapsed / 1000)
+			}
+		}
+		if activity.AvgSpeed == 0 && activity.Duration > 0 {
+			activity.AvgSpeed = activity.Distance / float64(activity.Duration) * 3.6
+		}
+		activity.Calories = session.int(sessionTotalCalories)
+	}
+
+	if name, ok := sportNames[sport]; ok {
+		activity.Type = gpx.NormalizeActivityType(name)
+		activity.TypeSource = models.TypeSourceFile
+		activity.TypeConfidence = 1
+	}
+	gpx.DetectType(activity, track.Points)
+
+	activity.Laps = laps
+	activity.Device = creatorDevice
+	if activity.Device == nil {
+		activity.Device = fileDevice
+	}
+
+	return track, activity, nil
+}
+
+// recordPoint converts a record message. It reports whether the record has a
+// GPS position; records without one still carry sensor data.
+func recordPoint(msg message) (models.GPXPoint, bool) {
+	var point models.GPXPoint
+	lat, hasLat := msg.value(recordPositionLat)
+	lon, hasLon := msg.value(recordPositionLong)
+	if hasLat && hasLon {
+		point.Lat = semicircles(lat)
+		point.Lon = semicircles(lon)
+	}
+
+	if altitude, ok := msg.value(recordEnhancedAltitude); ok {
+		point.Elevation = altitude/5 - 500
+	} else if altitude, ok := msg.value(recordAltitude); ok {
+		point.Elevation = altitude/5 - 500
+	}
+	if timestamp, ok := msg.value(fieldTimestamp); ok {
+		point.Time = fitTime(timestamp)
+	}
+	point.HeartRate = msg.int(recordHeartRate)
+	point.Cadence = msg.int(recordCadence)
+	point.Power = msg.int(recordPower)
+	if temperature, ok := msg.value(recordTemperature); ok {
+		point.Temperature = &temperature
+	}
+
+	return point, hasLat && hasLon
+}
+
+func lap(msg message, index int) models.Lap {
+	l := models.Lap{
+		Index:          index,
+		Duration:       int(msg.values[lapTotalTimerTime] / 1000),
+		ElapsedTime:    int(msg.values[lapTotalElapsedTime] / 1000),
+		Distance:       msg.values[lapTotalDistance] / 100,
+		AvgSpeed:       msg.values[lapAvgSpeed] / 1000 * 3.6,
+		MaxSpeed:       msg.values[lapMaxSpeed] / 1000 * 3.6,
+		TotalElevation: msg.values[lapTotalAscent],
+		Calories:       msg.int(lapTotalCalories),
+		AvgHeartRate:   msg.int(lapAvgHeartRate),
+		MaxHeartRate:   msg.int(lapMaxHeartRate),
+		AvgCadence:     msg.int(lapAvgCadence),
+		AvgPower:       msg.int(lapAvgPower),
+		MaxPower:       msg.int(lapMaxPower),
+	}
+	if start, ok := msg.value(lapStartTime); ok {
+		l.StartTime = fitTime(start)
+	}
+	return l
+}
+
+// device builds a Device from the manufacturer, product and serial number
+// fields of a file_id or device_info message.
+func device(msg message, manufacturerField, productField, productNameField, serialField byte) *models.Device {
+	manufacturer, ok := msg.value(manufacturerField)
+	if !ok {
+		return nil
+	}
+
+	d := &models.Device{Manufacturer: manufacturerNames[int(manufacturer)]}
+	if d.Manufacturer == "" {
+		d.Manufacturer = fmt.Sprintf("Manufacturer %d", int(manufacturer))
+	}
+	if name, ok := msg.strings[productNameField]; ok {
+		d.Product = name
+	} else if product, ok := msg.value(productField); ok {
+		d.Product = fmt.Sprintf("(product %d)", int(product))
+	}
+	if serial, ok := msg.value(serialField); ok {
+		d.SerialNumber = strconv.FormatFloat(serial, 'f', 0, 64)
+	}
+	return d
+}
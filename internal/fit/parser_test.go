@@ -0,0 +1,274 @@
+package fit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// fitBuilder writes minimal little-endian FIT files for tests.
+type fitBuilder struct {
+	body bytes.Buffer
+}
+
+func (b *fitBuilder) define(local byte, global uint16, fields ...fieldDef) {
+	b.body.WriteByte(0x40 | local)
+	b.body.Write([]byte{0, 0})
+	binary.Write(&b.body, binary.LittleEndian, global)
+	b.body.WriteByte(byte(len(fields)))
+	for _, f := range fields {
+		b.body.Write([]byte{f.num, f.size, f.baseType})
+	}
+}
+
+func (b *fitBuilder) data(local byte, values ...interface{}) {
+	b.body.WriteByte(local)
+	b.write(values...)
+}
+
+// compressed writes a data message with a compressed timestamp header.
+func (b *fitBuilder) compressed(local byte, offset byte, values ...interface{}) {
+	b.body.WriteByte(0x80 | local<<5 | offset&0x1F)
+	b.write(values...)
+}
+
+func (b *fitBuilder) write(values ...interface{}) {
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			field := make([]byte, 16)
+			copy(field, s)
+			b.body.Write(field)
+			continue
+		}
+		binary.Write(&b.body, binary.LittleEndian, v)
+	}
+}
+
+func (b *fitBuilder) bytes() []byte {
+	header := make([]byte, 12)
+	header[0] = 12
+	header[1] = 0x20
+	binary.LittleEndian.PutUint16(header[2:4], 2100)
+	binary.LittleEndian.PutUint32(header[4:8], uint32(b.body.Len()))
+	copy(header[8:12], ".FIT")
+
+	file := append(header, b.body.Bytes()...)
+	return binary.LittleEndian.AppendUint16(file, crc(file))
+}
+
+func fitTimestamp(t time.Time) uint32 {
+	return uint32(t.Sub(fitEpoch).Seconds())
+}
+
+func toSemicircles(degrees float64) int32 {
+	return int32(degrees * 2147483648.0 / 180.0)
+}
+
+var (
+	fileIDFields = []fieldDef{
+		{fileIDType, 1, baseEnum},
+		{fileIDManufacturer, 2, baseUint16},
+		{fileIDProduct, 2, baseUint16},
+		{fileIDSerialNumber, 4, baseUint32z},
+	}
+	recordFields = []fieldDef{
+		{fieldTimestamp, 4, baseUint32},
+		{recordPositionLat, 4, baseSint32},
+		{recordPositionLong, 4, baseSint32},
+		{recordEnhancedAltitude, 4, baseUint32},
+		{recordHeartRate, 1, baseUint8},
+		{recordCadence, 1, baseUint8},
+		{recordPower, 2, baseUint16},
+		{recordTemperature, 1, baseSint8},
+	}
+	lapFields = []fieldDef{
+		{fieldTimestamp, 4, baseUint32},
+		{lapStartTime, 4, baseUint32},
+		{lapTotalElapsedTime, 4, baseUint32},
+		{lapTotalTimerTime, 4, baseUint32},
+		{lapTotalDistance, 4, baseUint32},
+		{lapAvgSpeed, 2, baseUint16},
+		{lapAvgHeartRate, 1, baseUint8},
+		{lapAvgPower, 2, baseUint16},
+		{lapTotalAscent, 2, baseUint16},
+	}
+	sessionFields = []fieldDef{
+		{sessionStartTime, 4, baseUint32},
+		{sessionSport, 1, baseEnum},
+		{sessionTotalElapsedTime, 4, baseUint32},
+		{sessionTotalTimerTime, 4, baseUint32},
+		{sessionTotalDistance, 4, baseUint32},
+		{sessionTotalCalories, 2, baseUint16},
+	}
+)
+
+func outdoorRide(start time.Time) []byte {
+	var b fitBuilder
+	b.define(0, mesgFileID, fileIDFields...)
+	b.data(0, uint8(fileTypeActivity), uint16(1), uint16(3121), uint32(12345))
+
+	b.define(1, mesgDeviceInfo,
+		fieldDef{deviceInfoDeviceIndex, 1, baseUint8},
+		fieldDef{deviceInfoManufacturer, 2, baseUint16},
+		fieldDef{deviceInfoSoftwareVersion, 2, baseUint16},
+		fieldDef{deviceInfoProductName, 16, baseString},
+	)
+	b.data(1, uint8(deviceIndexCreator), uint16(1), uint16(950), "Edge 530")
+
+	// 60 records 10s apart heading north at ~25 km/h, climbing 1m each
+	b.define(2, mesgRecord, recordFields...)
+	for i := 0; i < 60; i++ {
+		b.data(2,
+			fitTimestamp(start.Add(time.Duration(i)*10*time.Second)),
+			toSemicircles(45+float64(i)*0.000625),
+			toSemicircles(7),
+			uint32((100+float64(i)+500)*5),
+			uint8(140+i%10),
+			uint8(90),
+			uint16(200+i),
+			int8(-2),
+		)
+	}
+	// One more record using a compressed timestamp 5s after the last one
+	b.define(3, mesgRecord, recordFields[1:]...)
+	last := fitTimestamp(start.Add(590 * time.Second))
+	b.compressed(3, byte((last+5)&0x1F), toSemicircles(45+60*0.000625), toSemicircles(7), uint32(660*5), uint8(150), uint8(90), uint16(260), int8(-2))
+
+	b.define(4, mesgLap, lapFields...)
+	for i := 0; i < 2; i++ {
+		lapStart := start.Add(time.Duration(i) * 300 * time.Second)
+		b.data(4, fitTimestamp(lapStart.Add(300*time.Second)), fitTimestamp(lapStart), uint32(300000), uint32(295000), uint32(208400), uint16(7000), uint8(145), uint16(230), uint16(30))
+	}
+
+	b.define(5, mesgSession, sessionFields...)
+	b.data(5, fitTimestamp(start), uint8(2), uint32(595000), uint32(590000), uint32(416800), uint16(420))
+
+	return b.bytes()
+}
+
+func TestParseFITOutdoorActivity(t *testing.T) {
+	start := time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC)
+	track, activity, err := ParseFITWithConfig(outdoorRide(start), &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseFITWithConfig() error = %v", err)
+	}
+
+	if len(track.Points) != 61 {
+		t.Fatalf("Expected 61 points, got %d", len(track.Points))
+	}
+	first := track.Points[0]
+	if math.Abs(first.Lat-45) > 1e-6 || math.Abs(first.Lon-7) > 1e-6 || first.Elevation != 100 {
+		t.Errorf("Unexpected first point %+v", first)
+	}
+	if first.HeartRate != 140 || first.Cadence != 90 || first.Power != 200 || first.Temperature == nil || *first.Temperature != -2 {
+		t.Errorf("Unexpected first point sensors %+v", first)
+	}
+	if last := track.Points[60]; !last.Time.Equal(start.Add(595 * time.Second)) {
+		t.Errorf("Compressed timestamp = %v, expected %v", last.Time, start.Add(595*time.Second))
+	}
+
+	if activity.Type != "cycling" || activity.TypeSource != models.TypeSourceFile {
+		t.Errorf("Expected cycling from the file, got %q from %q", activity.Type, activity.TypeSource)
+	}
+	if !activity.StartTime.Equal(start) || activity.Duration != 595 {
+		t.Errorf("Unexpected start %v and duration %d", activity.StartTime, activity.Duration)
+	}
+	if math.Abs(activity.Distance-4169) > 10 {
+		t.Errorf("Distance = %.0f, expected about 4169m from the GPS track", activity.Distance)
+	}
+	if activity.Calories != 420 || activity.MaxHeartRate != 150 || activity.MaxPower != 260 {
+		t.Errorf("Unexpected calories %d, max HR %d, max power %d", activity.Calories, activity.MaxHeartRate, activity.MaxPower)
+	}
+
+	if len(activity.Laps) != 2 {
+		t.Fatalf("Expected 2 laps, got %d", len(activity.Laps))
+	}
+	lap := activity.Laps[1]
+	if lap.Index != 2 || !lap.StartTime.Equal(start.Add(300*time.Second)) || lap.Duration != 295 || lap.ElapsedTime != 300 {
+		t.Errorf("Unexpected lap timing %+v", lap)
+	}
+	if lap.Distance != 2084 || math.Abs(lap.AvgSpeed-25.2) > 1e-9 || lap.AvgHeartRate != 145 || lap.AvgPower != 230 || lap.TotalElevation != 30 {
+		t.Errorf("Unexpected lap stats %+v", lap)
+	}
+
+	if activity.Device == nil || activity.Device.Name() != "Garmin Edge 530" || activity.Device.SoftwareVersion != "9.50" {
+		t.Errorf("Unexpected device %+v", activity.Device)
+	}
+}
+
+func TestParseFITIndoorActivity(t *testing.T) {
+	start := time.Date(2024, 6, 2, 18, 0, 0, 0, time.UTC)
+
+	var b fitBuilder
+	b.define(0, mesgFileID, fileIDFields...)
+	b.data(0, uint8(fileTypeActivity), uint16(260), uint16(1), uint32(0))
+	b.define(1, mesgRecord,
+		fieldDef{fieldTimestamp, 4, baseUint32},
+		fieldDef{recordHeartRate, 1, baseUint8},
+		fieldDef{recordPower, 2, baseUint16},
+	)
+	for i := 0; i < 30; i++ {
+		b.data(1, fitTimestamp(start.Add(time.Duration(i)*time.Minute)), uint8(120+i), uint16(150))
+	}
+	b.define(2, mesgSession, sessionFields...)
+	b.data(2, fitTimestamp(start), uint8(2), uint32(1740000), uint32(1740000), uint32(1500000), uint16(350))
+
+	track, activity, err := ParseFITWithConfig(b.bytes(), &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseFITWithConfig() error = %v", err)
+	}
+
+	if len(track.Points) != 0 {
+		t.Errorf("Expected no track points without GPS, got %d", len(track.Points))
+	}
+	if activity.Distance != 15000 {
+		t.Errorf("Distance = %v, expected 15000 from the session", activity.Distance)
+	}
+	if !activity.StartTime.Equal(start) || activity.Duration != 1740 {
+		t.Errorf("Unexpected start %v and duration %d", activity.StartTime, activity.Duration)
+	}
+	if activity.AvgHeartRate != 135 || activity.MaxHeartRate != 149 || activity.AvgPower != 150 {
+		t.Errorf("Unexpected sensor stats: HR %d/%d, power %d", activity.AvgHeartRate, activity.MaxHeartRate, activity.AvgPower)
+	}
+	if activity.Device == nil || activity.Device.Manufacturer != "Zwift" {
+		t.Errorf("Expected the file_id manufacturer, got %+v", activity.Device)
+	}
+}
+
+func TestParseFITErrors(t *testing.T) {
+	valid := outdoorRide(time.Date(2024, 6, 1, 7, 0, 0, 0, time.UTC))
+
+	corrupt := append([]byte(nil), valid...)
+	corrupt[40] ^= 0xFF
+
+	var course fitBuilder
+	course.define(0, mesgFileID, fileIDFields...)
+	course.data(0, uint8(6), uint16(1), uint16(1), uint32(1))
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not a FIT file", []byte(`<?xml version="1.0"?><gpx></gpx>`)},
+		{"bad checksum", corrupt},
+		{"truncated", valid[:len(valid)-10]},
+		{"not an activity", course.bytes()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := ParseFITWithConfig(tt.data, &config.Config{}); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	if _, _, err := ParseFITWithConfig([]byte("plain text, definitely not FIT"), &config.Config{}); err != ErrNotFIT {
+		t.Errorf("Expected ErrNotFIT, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package fit
+
+import "time"
+
+// Global message numbers from the FIT profile.
+const (
+	mesgFileID     = 0
+	mesgSport      = 12
+	mesgSession    = 18
+	mesgLap        = 19
+	mesgRecord     = 20
+	mesgDeviceInfo = 23
+)
+
+// fieldTimestamp is the timestamp field number shared by every message.
+const fieldTimestamp = 253
+
+// file_id fields
+const (
+	fileIDType         = 0
+	fileIDManufacturer = 1
+	fileIDProduct      = 2
+	fileIDSerialNumber = 3
+	fileIDProductName  = 8
+
+	fileTypeActivity = 4
+)
+
+// record fields
+const (
+	recordPositionLat      = 0
+	recordPositionLong     = 1
+	recordAltitude         = 2 // scale 5, offset 500, m
+	recordHeartRate        = 3
+	recordCadence          = 4
+	recordPower            = 7
+	recordTemperature      = 13
+	recordEnhancedAltitude = 78 // scale 5, offset 500, m
+)
+
+// lap fields
+const (
+	lapStartTime        = 2
+	lapTotalElapsedTime = 7  // scale 1000, s
+	lapTotalTimerTime   = 8  // scale 1000, s
+	lapTotalDistance    = 9  // scale 100, m
+	lapTotalCalories    = 11 // kcal
+	lapAvgSpeed         = 13 // scale 1000, m/s
+	lapMaxSpeed         = 14 // scale 1000, m/s
+	lapAvgHeartRate     = 15
+	lapMaxHeartRate     = 16
+	lapAvgCadence       = 17
+	lapAvgPower         = 19
+	lapMaxPower         = 20
+	lapTotalAscent      = 21 // m
+)
+
+// session fields
+const (
+	sessionStartTime        = 2
+	sessionSport            = 5
+	sessionTotalElapsedTime = 7 // scale 1000, s
+	sessionTotalTimerTime   = 8 // scale 1000, s
+	sessionTotalDistance    = 9 // scale 100, m
+	sessionTotalCalories    = 11
+)
+
+// sport fields
+const (
+	sportSport = 0
+)
+
+// device_info fields
+const (
+	deviceInfoDeviceIndex     = 0
+	deviceInfoManufacturer    = 2
+	deviceInfoSerialNumber    = 3
+	deviceInfoProduct         = 4
+	deviceInfoSoftwareVersion = 5 // scale 100
+	deviceInfoProductName     = 27
+
+	deviceIndexCreator = 0
+)
+
+// fitEpoch is the FIT timestamp origin, 1989-12-31T00:00:00Z.
+var fitEpoch = time.Date(1989, 12, 31, 0, 0, 0, 0, time.UTC)
+
+func fitTime(seconds float64) time.Time {
+	return fitEpoch.Add(time.Duration(seconds) * time.Second)
+}
+
+// semicircles converts a FIT position to degrees.
+func semicircles(v float64) float64 {
+	return v * (180.0 / 2147483648.0)
+}
+
+// sportNames maps FIT sport enum values to names understood by
+// gpx.NormalizeActivityType. Generic (0) is left out so those activities
+// fall back to type detection.
+var sportNames = map[int]string{
+	1:  "running",
+	2:  "cycling",
+	3:  "transition",
+	4:  "fitness_equipment",
+	5:  "swimming",
+	6:  "basketball",
+	7:  "soccer",
+	8:  "tennis",
+	9:  "american_football",
+	10: "training",
+	11: "walking",
+	12: "cross_country_skiing",
+	13: "alpine_skiing",
+	14: "snowboarding",
+	15: "rowing",
+	16: "mountaineering",
+	17: "hiking",
+	18: "multisport",
+	19: "paddling",
+}
+
+// manufacturerNames covers the manufacturers whose devices and apps commonly
+// produce activity files.
+var manufacturerNames = map[int]string{
+	1:   "Garmin",
+	23:  "Suunto",
+	32:  "Wahoo",
+	123: "Polar",
+	255: "Development",
+	260: "Zwift",
+	265: "Strava",
+	294: "COROS",
+}
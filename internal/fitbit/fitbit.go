@@ -0,0 +1,359 @@
+// Package fitbit reads the Fitbit data export ("Export Your Account
+// Archive", or Fitbit in Google Takeout). Its Global Export Data folder holds
+// JSON files named after their data and first day, like
+// steps-2024-05-01.json, covering a day or a month each.
+//
+// Minute data (steps and heart rate) is timestamped in UTC, while sleep and
+// weight are in the user's local time without a zone.
+package fitbit
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"health-hub/internal/health"
+	"health-hub/internal/models"
+)
+
+// Source is the source of everything imported from a Fitbit export.
+const Source = "fitbit"
+
+// Export is the data of a Fitbit export. Steps are daily totals and heart
+// rate hourly averages; IDs are derived from the day, hour or weight log, so
+// importing an overlapping export again replaces them.
+type Export struct {
+	Sleep     []*models.SleepData
+	HeartRate []*models.HeartRateData
+	Metrics   []*models.HealthMetric
+	// Skipped counts naps, nights and days that did not pass validation.
+	Skipped int
+}
+
+// dataFile matches the export's JSON files that are read.
+var dataFile = regexp.MustCompile(`^(steps|heart_rate|resting_heart_rate|sleep|weight)-\d{4}-\d{2}-\d{2}\.json$`)
+
+// minuteLayout is the format of minute data timestamps and weight dates.
+const minuteLayout = "01/02/06 15:04:05"
+
+// IsExport reports whether a ZIP archive is a Fitbit export.
+func IsExport(archive *zip.Reader) bool {
+	for _, file := range archive.File {
+		if dataFile.MatchString(path.Base(file.Name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseArchive reads a Fitbit export. Days and local times are read in loc,
+// and weights in weightUnit ("kg" or "lb"), as the export follows the
+// account's unit setting without saying which it is.
+func ParseArchive(archive *zip.Reader, loc *time.Location, weightUnit string) (*Export, error) {
+	p := &parser{
+		loc:        loc,
+		weightUnit: weightUnit,
+		steps:      make(map[time.Time]float64),
+		heartRate:  make(map[time.Time]*average),
+		nights:     make(map[time.Time]*models.SleepData),
+		scores:     make(map[time.Time]int),
+		export:     &Export{},
+	}
+	for _, file := range archive.File {
+		name := path.Base(file.Name)
+		var err error
+		switch {
+		case dataFile.MatchString(name):
+			err = p.readFile(file, strings.SplitN(name, "-", 2)[0])
+		case name == "sleep_score.csv":
+			err = p.readSleepScores(file)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", file.Name, err)
+		}
+	}
+	return p.finish(), nil
+}
+
+type average struct {
+	sum   float64
+	count int
+}
+
+type parser struct {
+	loc        *time.Location
+	weightUnit string
+	steps      map[time.Time]float64  // by day
+	heartRate  map[time.Time]*average // by hour
+	nights     map[time.Time]*models.SleepData
+	scores     map[time.Time]int // sleep scores by day
+	export     *Export
+}
+
+func (p *parser) readFile(file *zip.File, kind string) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoder := json.NewDecoder(reader)
+
+	switch kind {
+	case "steps":
+		var entries []struct {
+			DateTime string      `json:"dateTime"`
+			Value    json.Number `json:"value"`
+		}
+		if err := decoder.Decode(&entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			t, err := time.Parse(minuteLayout, e.DateTime)
+			steps, _ := e.Value.Float64()
+			if err == nil && steps > 0 {
+				p.steps[day(t.In(p.loc))] += steps
+			}
+		}
+
+	case "heart_rate":
+		var entries []struct {
+			DateTime string `json:"dateTime"`
+			Value    struct {
+				BPM float64 `json:"bpm"`
+			} `json:"value"`
+		}
+		if err := decoder.Decode(&entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			t, err := time.Parse(minuteLayout, e.DateTime)
+			if err != nil || e.Value.BPM <= 0 {
+				continue
+			}
+			t = t.In(p.loc)
+			hour := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, p.loc)
+			if p.heartRate[hour] == nil {
+				p.heartRate[hour] = &average{}
+			}
+			p.heartRate[hour].sum += e.Value.BPM
+			p.heartRate[hour].count++
+		}
+
+	case "resting_heart_rate":
+		var entries []struct {
+			Value struct {
+				Date  string  `json:"date"`
+				Value float64 `json:"value"`
+			} `json:"value"`
+		}
+		if err := decoder.Decode(&entries); err != nil {
+			return err
+		}
+		for _, e := range entries {
+			date, err := time.ParseInLocation("01/02/06", e.Value.Date, p.loc)
+			if err != nil || e.Value.Value == 0 {
+				continue
+			}
+			hr := &models.HeartRateData{
+				ID:        health.DailyID("hr", Source, date),
+				RestingHR: int(math.Round(e.Value.Value)),
+				Date:      date,
+				Source:    Source,
+			}
+			if health.ValidateHeartRate(hr) == nil {
+				p.export.HeartRate = append(p.export.HeartRate, hr)
+			} else {
+				p.export.Skipped++
+			}
+		}
+
+	case "sleep":
+		var logs []sleepLog
+		if err := decoder.Decode(&logs); err != nil {
+			return err
+		}
+		for _, log := range logs {
+			p.addSleep(log)
+		}
+
+	case "weight":
+		var logs []struct {
+			LogID  int64   `json:"logId"`
+			Weight float64 `json:"weight"`
+			BMI    float64 `json:"bmi"`
+			Fat    float64 `json:"fat"`
+			Date   string  `json:"date"`
+			Time   string  `json:"time"`
+		}
+		if err := decoder.Decode(&logs); err != nil {
+			return err
+		}
+		for _, log := range logs {
+			t, err := time.ParseInLocation(minuteLayout, log.Date+" "+log.Time, p.loc)
+			if err != nil {
+				continue
+			}
+			id := strconv.FormatInt(log.LogID, 10)
+			p.metric("weight", log.Weight, p.weightUnit, t, id)
+			p.metric("bmi", log.BMI, "count", t, id)
+			p.metric("body_fat", log.Fat, "%", t, id)
+		}
+	}
+	return nil
+}
+
+// sleepLog is one sleep of a sleep file. Logs of type "stages" have deep,
+// light and REM minutes; "classic" logs only asleep, restless and awake.
+type sleepLog struct {
+	DateOfSleep   string `json:"dateOfSleep"`
+	StartTime     string `json:"startTime"`
+	EndTime       string `json:"endTime"`
+	MinutesAsleep int    `json:"minutesAsleep"`
+	MainSleep     bool   `json:"mainSleep"`
+	Levels        struct {
+		Summary map[string]struct {
+			Minutes int `json:"minutes"`
+		} `json:"summary"`
+	} `json:"levels"`
+}
+
+// sleepLayout is the format of sleep start and end times.
+const sleepLayout = "2006-01-02T15:04:05.000"
+
+func (p *parser) addSleep(log sleepLog) {
+	date, err := time.ParseInLocation("2006-01-02", log.DateOfSleep, p.loc)
+	if err != nil || !log.MainSleep {
+		p.export.Skipped++
+		return
+	}
+	bedtime, _ := time.ParseInLocation(sleepLayout, log.StartTime, p.loc)
+	wakeTime, _ := time.ParseInLocation(sleepLayout, log.EndTime, p.loc)
+	levels := log.Levels.Summary
+	sleep := &models.SleepData{
+		ID:         health.DailyID("sleep", Source, date),
+		Date:       date,
+		Bedtime:    bedtime,
+		WakeTime:   wakeTime,
+		TotalSleep: log.MinutesAsleep,
+		DeepSleep:  levels["deep"].Minutes,
+		REMSleep:   levels["rem"].Minutes,
+		LightSleep: levels["light"].Minutes,
+		Source:     Source,
+	}
+	if health.ValidateSleep(sleep) != nil {
+		p.export.Skipped++
+		return
+	}
+	if other, ok := p.nights[date]; !ok || sleep.TotalSleep > other.TotalSleep {
+		p.nights[date] = sleep
+	}
+}
+
+// readSleepScores reads sleep_score.csv, which has the score of each night
+// by the time it ended.
+func (p *parser) readSleepScores(file *zip.File) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	table, err := health.ReadCSV(data)
+	if err != nil {
+		return err
+	}
+
+	timestamp, score := -1, -1
+	for i, name := range table.Header {
+		switch name {
+		case "timestamp":
+			timestamp = i
+		case "overall_score":
+			score = i
+		}
+	}
+	if timestamp < 0 || score < 0 {
+		return nil
+	}
+	for _, row := range table.Rows {
+		if len(row) <= timestamp || len(row) <= score {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, row[timestamp])
+		if err != nil {
+			continue
+		}
+		if value, err := strconv.Atoi(row[score]); err == nil {
+			p.scores[day(t.In(p.loc))] = value
+		}
+	}
+	return nil
+}
+
+// metric adds a health metric. Weights have an ID of their own, as a day can
+// have several.
+func (p *parser) metric(metricType string, value float64, unit string, t time.Time, logID string) {
+	if value <= 0 {
+		return
+	}
+	id := health.DailyID("health_"+metricType, Source, t)
+	if logID != "" {
+		id = "health_" + metricType + "_" + Source + "_" + logID
+	}
+	p.export.Metrics = append(p.export.Metrics, &models.HealthMetric{
+		ID:        id,
+		Type:      metricType,
+		Value:     value,
+		Unit:      unit,
+		Timestamp: t,
+		Source:    Source,
+	})
+}
+
+// finish adds the records collected over all files, oldest first.
+func (p *parser) finish() *Export {
+	for date, steps := range p.steps {
+		p.metric("steps", steps, "count", date, "")
+	}
+	for hour, avg := range p.heartRate {
+		p.export.Metrics = append(p.export.Metrics, &models.HealthMetric{
+			ID:        "health_heart_rate_" + Source + "_" + hour.Format("2006010215"),
+			Type:      "heart_rate",
+			Value:     math.Round(avg.sum / float64(avg.count)),
+			Unit:      "bpm",
+			Timestamp: hour,
+			Source:    Source,
+		})
+	}
+	for date, sleep := range p.nights {
+		sleep.SleepScore = p.scores[date]
+		p.export.Sleep = append(p.export.Sleep, sleep)
+	}
+
+	sort.Slice(p.export.Metrics, func(i, j int) bool {
+		return p.export.Metrics[i].Timestamp.Before(p.export.Metrics[j].Timestamp)
+	})
+	sort.Slice(p.export.Sleep, func(i, j int) bool {
+		return p.export.Sleep[i].Date.Before(p.export.Sleep[j].Date)
+	})
+	sort.Slice(p.export.HeartRate, func(i, j int) bool {
+		return p.export.HeartRate[i].Date.Before(p.export.HeartRate[j].Date)
+	})
+	return p.export
+}
+
+// day returns midnight of t's day in its location.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
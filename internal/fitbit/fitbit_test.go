@@ -0,0 +1,123 @@
+package fitbit
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+// sampleExport is a Fitbit export in the folder layout of the account
+// archive. Minute data is in UTC: 22:30 UTC on May 1 is already May 2 in
+// CEST.
+var sampleExport = map[string]string{
+	"MyFitbitData/Jane/Global Export Data/steps-2024-05-01.json": `[
+		{"dateTime": "05/01/24 10:00:00", "value": "1200"},
+		{"dateTime": "05/01/24 10:01:00", "value": "0"},
+		{"dateTime": "05/01/24 22:30:00", "value": "300"}
+	]`,
+	"MyFitbitData/Jane/Global Export Data/heart_rate-2024-05-01.json": `[
+		{"dateTime": "05/01/24 10:00:05", "value": {"bpm": 70, "confidence": 3}},
+		{"dateTime": "05/01/24 10:30:05", "value": {"bpm": 81, "confidence": 3}},
+		{"dateTime": "05/01/24 11:00:05", "value": {"bpm": 65, "confidence": 2}}
+	]`,
+	"MyFitbitData/Jane/Global Export Data/resting_heart_rate-2024-05-01.json": `[
+		{"dateTime": "05/02/24 00:00:00", "value": {"date": "05/02/24", "value": 52.4, "error": 6.8}},
+		{"dateTime": "05/03/24 00:00:00", "value": {"date": "05/03/24", "value": 0, "error": 0}}
+	]`,
+	"MyFitbitData/Jane/Global Export Data/sleep-2024-05-01.json": `[
+		{"dateOfSleep": "2024-05-02", "startTime": "2024-05-01T23:10:00.000", "endTime": "2024-05-02T07:00:00.000",
+		 "minutesAsleep": 420, "mainSleep": true, "type": "stages",
+		 "levels": {"summary": {"deep": {"minutes": 90}, "rem": {"minutes": 105}, "light": {"minutes": 225}, "wake": {"minutes": 50}}}},
+		{"dateOfSleep": "2024-05-02", "startTime": "2024-05-02T13:00:00.000", "endTime": "2024-05-02T13:40:00.000",
+		 "minutesAsleep": 38, "mainSleep": false, "type": "classic",
+		 "levels": {"summary": {"asleep": {"minutes": 38}}}}
+	]`,
+	"MyFitbitData/Jane/Global Export Data/weight-2024-05-01.json": `[
+		{"logId": 1714550400000, "weight": 176.4, "bmi": 24.1, "fat": 18.5, "date": "05/01/24", "time": "08:00:00"}
+	]`,
+	"MyFitbitData/Jane/Sleep/sleep_score.csv": "sleep_log_entry_id,timestamp,overall_score\n" +
+		"1,2024-05-02T05:00:00Z,84\n",
+	"MyFitbitData/Jane/Global Export Data/exercise-0.json": `[]`,
+}
+
+func archive(t *testing.T, files map[string]string) *zip.Reader {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, _ := writer.Create(name)
+		file.Write([]byte(content))
+	}
+	writer.Close()
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	return reader
+}
+
+func TestParseArchive(t *testing.T) {
+	loc := time.FixedZone("CEST", 2*3600)
+	export, err := ParseArchive(archive(t, sampleExport), loc, "lb")
+	if err != nil {
+		t.Fatalf("ParseArchive() error = %v", err)
+	}
+
+	metrics := make(map[string]float64)
+	for _, metric := range export.Metrics {
+		metrics[metric.ID] = metric.Value
+		if metric.Source != Source {
+			t.Errorf("Metric %s source = %q", metric.ID, metric.Source)
+		}
+	}
+	expected := map[string]float64{
+		"health_steps_fitbit_20240501":         1200,
+		"health_steps_fitbit_20240502":         300,
+		"health_heart_rate_fitbit_2024050112":  76, // (70 + 81) / 2, rounded
+		"health_heart_rate_fitbit_2024050113":  65,
+		"health_weight_fitbit_1714550400000":   176.4,
+		"health_bmi_fitbit_1714550400000":      24.1,
+		"health_body_fat_fitbit_1714550400000": 18.5,
+	}
+	if len(metrics) != len(expected) {
+		t.Errorf("Metrics = %v, expected %v", metrics, expected)
+	}
+	for id, value := range expected {
+		if metrics[id] != value {
+			t.Errorf("Metric %s = %v, expected %v", id, metrics[id], value)
+		}
+	}
+	for _, metric := range export.Metrics {
+		if metric.Type == "weight" && metric.Unit != "lb" {
+			t.Errorf("Weight unit = %q, expected lb", metric.Unit)
+		}
+	}
+
+	if len(export.Sleep) != 1 || export.Skipped != 1 {
+		t.Fatalf("Expected 1 night and the nap skipped, got %d nights and %d skipped", len(export.Sleep), export.Skipped)
+	}
+	sleep := export.Sleep[0]
+	if sleep.ID != "sleep_fitbit_20240502" || sleep.TotalSleep != 420 || sleep.DeepSleep != 90 ||
+		sleep.REMSleep != 105 || sleep.LightSleep != 225 || sleep.SleepScore != 84 {
+		t.Errorf("Night = %+v", sleep)
+	}
+	if expected := time.Date(2024, 5, 1, 23, 10, 0, 0, loc); !sleep.Bedtime.Equal(expected) {
+		t.Errorf("Bedtime = %v, expected %v", sleep.Bedtime, expected)
+	}
+
+	if len(export.HeartRate) != 1 {
+		t.Fatalf("Expected 1 day of heart rate, got %d", len(export.HeartRate))
+	}
+	if hr := export.HeartRate[0]; hr.ID != "hr_fitbit_20240502" || hr.RestingHR != 52 {
+		t.Errorf("Heart rate = %+v", hr)
+	}
+}
+
+func TestIsExport(t *testing.T) {
+	if !IsExport(archive(t, sampleExport)) {
+		t.Error("IsExport() = false for a Fitbit export")
+	}
+	if IsExport(archive(t, map[string]string{"apple_health_export/export.xml": "<HealthData/>"})) {
+		t.Error("IsExport() = true for an Apple Health export")
+	}
+}
@@ -0,0 +1,246 @@
+// Package googlefit reads the Google Fit data of a Google Takeout archive:
+// the daily activity metrics CSV, with one row of totals per day, and the
+// sessions in "All sessions", of which sleep sessions are read.
+//
+// Workouts are in Takeout's Fit/Activities folder as TCX files, which are
+// imported as activity files rather than from here.
+package googlefit
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"health-hub/internal/health"
+	"health-hub/internal/models"
+)
+
+// Source is the source of everything imported from Google Fit.
+const Source = "google_fit"
+
+// Export is the data of the Google Fit part of a Takeout archive. IDs are
+// derived from the day, so importing an overlapping archive again replaces
+// the days instead of adding them twice.
+type Export struct {
+	Sleep   []*models.SleepData
+	Metrics []*models.HealthMetric
+	// Skipped counts sessions that are not sleep, naps and nights that did
+	// not pass validation.
+	Skipped int
+}
+
+// dailyColumns maps the daily activity metrics columns that are read, by
+// their header in snake_case, onto metric types and units.
+var dailyColumns = map[string]struct{ metric, unit string }{
+	"step_count":             {"steps", "count"},
+	"distance_m":             {"distance", "m"},
+	"calories_kcal":          {"calories", "kcal"},
+	"move_minutes_count":     {"move_minutes", "min"},
+	"heart_points":           {"heart_points", "count"},
+	"average_heart_rate_bpm": {"heart_rate", "bpm"},
+	"average_weight_kg":      {"weight", "kg"},
+}
+
+// isDailyMetrics reports whether a file is the daily activity metrics
+// summary rather than one of the per-day files next to it. Older archives
+// call it "Daily Summaries.csv".
+func isDailyMetrics(name string) bool {
+	base := path.Base(name)
+	return base == "Daily activity metrics.csv" || base == "Daily Summaries.csv"
+}
+
+func isSession(name string) bool {
+	return strings.EqualFold(path.Base(path.Dir(name)), "All sessions") && path.Ext(name) == ".json"
+}
+
+// IsExport reports whether a ZIP archive holds Google Fit data.
+func IsExport(archive *zip.Reader) bool {
+	for _, file := range archive.File {
+		if isDailyMetrics(file.Name) || isSession(file.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseArchive reads the Google Fit data of a Takeout archive. The dates of
+// daily metrics, and the day a night of sleep ends, are read in loc.
+func ParseArchive(archive *zip.Reader, loc *time.Location) (*Export, error) {
+	export := &Export{}
+	nights := make(map[time.Time]*models.SleepData)
+	for _, file := range archive.File {
+		var err error
+		switch {
+		case isDailyMetrics(file.Name):
+			err = export.readDailyMetrics(file, loc)
+		case isSession(file.Name):
+			var sleep *models.SleepData
+			if sleep, err = readSession(file, loc); err == nil {
+				export.addSleep(nights, sleep)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", file.Name, err)
+		}
+	}
+
+	for _, sleep := range nights {
+		export.Sleep = append(export.Sleep, sleep)
+	}
+	sort.Slice(export.Sleep, func(i, j int) bool {
+		return export.Sleep[i].Date.Before(export.Sleep[j].Date)
+	})
+	sort.SliceStable(export.Metrics, func(i, j int) bool {
+		return export.Metrics[i].Timestamp.Before(export.Metrics[j].Timestamp)
+	})
+	return export, nil
+}
+
+// addSleep keeps the longest sleep of each day as its night.
+func (e *Export) addSleep(nights map[time.Time]*models.SleepData, sleep *models.SleepData) {
+	if sleep == nil || health.ValidateSleep(sleep) != nil {
+		e.Skipped++
+		return
+	}
+	if other, ok := nights[sleep.Date]; ok {
+		e.Skipped++ // the shorter of the two, a nap
+		if other.TotalSleep >= sleep.TotalSleep {
+			return
+		}
+	}
+	nights[sleep.Date] = sleep
+}
+
+func (e *Export) readDailyMetrics(file *zip.File, loc *time.Location) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	table, err := health.ReadCSV(data)
+	if err != nil {
+		return err
+	}
+
+	dateColumn := -1
+	columns := make(map[int]string)
+	for i, name := range table.Header {
+		name = health.NormalizeType(name)
+		if name == "date" {
+			dateColumn = i
+		} else if _, ok := dailyColumns[name]; ok {
+			columns[i] = name
+		}
+	}
+	if dateColumn < 0 {
+		return fmt.Errorf("no Date column")
+	}
+
+	for _, row := range table.Rows {
+		if dateColumn >= len(row) {
+			continue
+		}
+		date, err := time.ParseInLocation("2006-01-02", row[dateColumn], loc)
+		if err != nil {
+			continue
+		}
+		for i, name := range columns {
+			if i >= len(row) {
+				continue
+			}
+			value, err := strconv.ParseFloat(row[i], 64)
+			if err != nil || value <= 0 {
+				continue
+			}
+			column := dailyColumns[name]
+			e.Metrics = append(e.Metrics, &models.HealthMetric{
+				ID:        health.DailyID("health_"+column.metric, Source, date),
+				Type:      column.metric,
+				Value:     value,
+				Unit:      column.unit,
+				Timestamp: date,
+				Source:    Source,
+			})
+		}
+	}
+	return nil
+}
+
+// session is a session file. Sleep sessions have a segment per sleep stage.
+type session struct {
+	FitnessActivity string `json:"fitnessActivity"`
+	StartTime       string `json:"startTime"`
+	EndTime         string `json:"endTime"`
+	Segment         []struct {
+		FitnessActivity string `json:"fitnessActivity"`
+		StartTime       string `json:"startTime"`
+		EndTime         string `json:"endTime"`
+	} `json:"segment"`
+}
+
+// readSession reads a session file, returning nil for sessions that are not
+// sleep.
+func readSession(file *zip.File, loc *time.Location) (*models.SleepData, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	var s session
+	if err := json.NewDecoder(reader).Decode(&s); err != nil {
+		return nil, err
+	}
+	if s.FitnessActivity != "sleep" {
+		return nil, nil
+	}
+
+	bedtime, err := time.Parse(time.RFC3339, s.StartTime)
+	if err != nil {
+		return nil, nil
+	}
+	wakeTime, err := time.Parse(time.RFC3339, s.EndTime)
+	if err != nil {
+		return nil, nil
+	}
+	bedtime, wakeTime = bedtime.In(loc), wakeTime.In(loc)
+
+	// Sessions without stages count as asleep from start to end
+	minutes := map[string]float64{}
+	for _, segment := range s.Segment {
+		start, err1 := time.Parse(time.RFC3339, segment.StartTime)
+		end, err2 := time.Parse(time.RFC3339, segment.EndTime)
+		if err1 == nil && err2 == nil {
+			minutes[segment.FitnessActivity] += end.Sub(start).Minutes()
+		}
+	}
+	round := func(stage string) int {
+		return int(math.Round(minutes[stage]))
+	}
+	date := time.Date(wakeTime.Year(), wakeTime.Month(), wakeTime.Day(), 0, 0, 0, 0, loc)
+	sleep := &models.SleepData{
+		ID:         health.DailyID("sleep", Source, date),
+		Date:       date,
+		Bedtime:    bedtime,
+		WakeTime:   wakeTime,
+		DeepSleep:  round("sleep.deep"),
+		REMSleep:   round("sleep.rem"),
+		LightSleep: round("sleep.light"),
+		Source:     Source,
+	}
+	sleep.TotalSleep = round("sleep") + sleep.DeepSleep + sleep.REMSleep + sleep.LightSleep
+	if len(minutes) == 0 {
+		sleep.TotalSleep = int(math.Round(wakeTime.Sub(bedtime).Minutes()))
+	}
+	return sleep, nil
+}
@@ -0,0 +1,102 @@
+package googlefit
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+)
+
+var sampleExport = map[string]string{
+	"Takeout/Fit/Daily activity metrics/Daily activity metrics.csv": "Date,Move Minutes count,Calories (kcal),Distance (m),Heart Points,Step count,Average weight (kg)\n" +
+		"2024-05-01,45,2210.5,6120.3,12,8123,\n" +
+		"2024-05-02,,,,,,79.4\n",
+	"Takeout/Fit/Daily activity metrics/2024-05-01.csv": "Start time,End time,Step count\n00:00:00.000+02:00,00:15:00.000+02:00,12\n",
+	// A night with stages, ending on May 2 in CEST
+	"Takeout/Fit/All sessions/2024-05-01T23_10_00+02_00_SLEEP.json": `{
+		"fitnessActivity": "sleep", "startTime": "2024-05-01T21:10:00Z", "endTime": "2024-05-02T05:00:00Z",
+		"segment": [
+			{"fitnessActivity": "sleep.light", "startTime": "2024-05-01T21:10:00Z", "endTime": "2024-05-02T00:55:00Z"},
+			{"fitnessActivity": "sleep.deep", "startTime": "2024-05-02T00:55:00Z", "endTime": "2024-05-02T02:25:00Z"},
+			{"fitnessActivity": "sleep.rem", "startTime": "2024-05-02T02:25:00Z", "endTime": "2024-05-02T04:10:00Z"},
+			{"fitnessActivity": "sleep.awake", "startTime": "2024-05-02T04:10:00Z", "endTime": "2024-05-02T05:00:00Z"}
+		]
+	}`,
+	// A nap on the same day, without stages
+	"Takeout/Fit/All sessions/2024-05-02T13_00_00+02_00_SLEEP.json": `{
+		"fitnessActivity": "sleep", "startTime": "2024-05-02T11:00:00Z", "endTime": "2024-05-02T11:40:00Z"
+	}`,
+	"Takeout/Fit/All sessions/2024-05-02T18_00_00+02_00_RUNNING.json": `{
+		"fitnessActivity": "running", "startTime": "2024-05-02T16:00:00Z", "endTime": "2024-05-02T16:45:00Z"
+	}`,
+}
+
+func archive(t *testing.T, files map[string]string) *zip.Reader {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		file, _ := writer.Create(name)
+		file.Write([]byte(content))
+	}
+	writer.Close()
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("zip.NewReader() error = %v", err)
+	}
+	return reader
+}
+
+func TestParseArchive(t *testing.T) {
+	loc := time.FixedZone("CEST", 2*3600)
+	export, err := ParseArchive(archive(t, sampleExport), loc)
+	if err != nil {
+		t.Fatalf("ParseArchive() error = %v", err)
+	}
+
+	metrics := make(map[string]float64)
+	units := make(map[string]string)
+	for _, metric := range export.Metrics {
+		metrics[metric.ID] = metric.Value
+		units[metric.Type] = metric.Unit
+	}
+	expected := map[string]float64{
+		"health_steps_google_fit_20240501":        8123,
+		"health_distance_google_fit_20240501":     6120.3,
+		"health_calories_google_fit_20240501":     2210.5,
+		"health_move_minutes_google_fit_20240501": 45,
+		"health_heart_points_google_fit_20240501": 12,
+		"health_weight_google_fit_20240502":       79.4,
+	}
+	if len(metrics) != len(expected) {
+		t.Errorf("Metrics = %v, expected %v", metrics, expected)
+	}
+	for id, value := range expected {
+		if metrics[id] != value {
+			t.Errorf("Metric %s = %v, expected %v", id, metrics[id], value)
+		}
+	}
+	if units["distance"] != "m" || units["weight"] != "kg" {
+		t.Errorf("Units = %v", units)
+	}
+
+	// The nap and the run are skipped
+	if len(export.Sleep) != 1 || export.Skipped != 2 {
+		t.Fatalf("Expected 1 night and 2 skipped, got %d nights and %d skipped", len(export.Sleep), export.Skipped)
+	}
+	sleep := export.Sleep[0]
+	if sleep.ID != "sleep_google_fit_20240502" || !sleep.Date.Equal(time.Date(2024, 5, 2, 0, 0, 0, 0, loc)) {
+		t.Errorf("Night = %s on %v", sleep.ID, sleep.Date)
+	}
+	if sleep.TotalSleep != 420 || sleep.LightSleep != 225 || sleep.DeepSleep != 90 || sleep.REMSleep != 105 {
+		t.Errorf("Night = %+v", sleep)
+	}
+}
+
+func TestIsExport(t *testing.T) {
+	if !IsExport(archive(t, sampleExport)) {
+		t.Error("IsExport() = false for a Google Fit export")
+	}
+	if IsExport(archive(t, map[string]string{"Takeout/Fit/Activities/2024-05-02T18_00_00+02_00_RUNNING.tcx": "<TrainingCenterDatabase/>"})) {
+		t.Error("IsExport() = true for activities only")
+	}
+}
@@ -0,0 +1,174 @@
+package gpx
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"health-hub/internal/models"
+)
+
+// Activity types produced by NormalizeActivityType and ClassifyActivity.
+const (
+	TypeRunning = "running"
+	TypeCycling = "cycling"
+	TypeWalking = "walking"
+	TypeHiking  = "hiking"
+	TypeUnknown = "activity"
+)
+
+// ActivityTypes lists the activity types in the order they are offered when
+// editing an activity.
+var ActivityTypes = []string{TypeRunning, TypeCycling, TypeWalking, TypeHiking, TypeUnknown}
+
+// activityTypeAliases maps the sport names written by Strava, Garmin and
+// other exporters onto our activity types. Strava's older GPX exports use
+// numeric codes.
+var activityTypeAliases = map[string]string{
+	"run":               TypeRunning,
+	"running":           TypeRunning,
+	"trail_running":     TypeRunning,
+	"treadmill":         TypeRunning,
+	"treadmill_running": TypeRunning,
+	"street_running":    TypeRunning,
+	"track_running":     TypeRunning,
+	"virtualrun":        TypeRunning,
+	"9":                 TypeRunning,
+	"ride":              TypeCycling,
+	"cycling":           TypeCycling,
+	"biking":            TypeCycling,
+	"road_biking":       TypeCycling,
+	"mountain_biking":   TypeCycling,
+	"gravel_cycling":    TypeCycling,
+	"indoor_cycling":    TypeCycling,
+	"virtualride":       TypeCycling,
+	"ebikeride":         TypeCycling,
+	"1":                 TypeCycling,
+	"walk":              TypeWalking,
+	"walking":           TypeWalking,
+	"casual_walking":    TypeWalking,
+	"speed_walking":     TypeWalking,
+	"10":                TypeWalking,
+	"hike":              TypeHiking,
+	"hiking":            TypeHiking,
+	"4":                 TypeHiking,
+}
+
+// NormalizeActivityType maps a sport name from a GPX <type> element (or any
+// other export) to one of our activity types. Unknown sports are returned
+// lower-cased with spaces replaced by underscores; an empty name stays empty.
+func NormalizeActivityType(raw string) string {
+	name := strings.ToLower(strings.TrimSpace(raw))
+	name = strings.NewReplacer(" ", "_", "-", "_").Replace(name)
+	if name == "" {
+		return ""
+	}
+	if activityType, ok := activityTypeAliases[name]; ok {
+		return activityType
+	}
+	return name
+}
+
+// Thresholds used by ClassifyActivity. Speeds are km/h of moving segments.
+const (
+	classifyMinMovingSpeed = 1.0  // slower segments count as stopped
+	cyclingMedianSpeed     = 20.0 // nobody runs a whole activity this fast
+	cyclingBurstSpeed      = 35.0 // sustained sprints beyond running pace
+	runningMedianSpeed     = 7.0  // faster than a brisk walk
+	ambiguousMedianSpeed   = 16.0 // fast runners and slow cyclists overlap below this
+	hikingClimbPerKm       = 30.0 // meters of gain per km that turns a walk into a hike
+	runningCadence         = 140  // steps/min counting both feet
+	minClassifySamples     = 30
+)
+
+// ClassifyActivity infers the sport from a track's speed distribution,
+// cadence and climbing per kilometer. It returns TypeUnknown with zero
+// confidence when the track has no usable timing data.
+func ClassifyActivity(points []models.GPXPoint, distance, elevationGain float64) (string, float64) {
+	var speeds, cadences []float64
+	for i := 1; i < len(points); i++ {
+		prev, point := points[i-1], points[i]
+		if point.Cadence > 0 {
+			cadences = append(cadences, float64(point.Cadence))
+		}
+		if prev.Time.IsZero() || point.Time.IsZero() {
+			continue
+		}
+		seconds := point.Time.Sub(prev.Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		speed := haversineDistance(prev.Lat, prev.Lon, point.Lat, point.Lon) / seconds * 3.6
+		if speed >= classifyMinMovingSpeed {
+			speeds = append(speeds, speed)
+		}
+	}
+
+	if len(speeds) == 0 {
+		return TypeUnknown, 0
+	}
+
+	sort.Float64s(speeds)
+	medianSpeed := percentile(speeds, 0.5)
+	burstSpeed := percentile(speeds, 0.95)
+
+	var medianCadence float64
+	if len(cadences) > 0 {
+		sort.Float64s(cadences)
+		medianCadence = percentile(cadences, 0.5)
+	}
+
+	var climbPerKm float64
+	if distance > 0 {
+		climbPerKm = elevationGain / (distance / 1000)
+	}
+
+	activityType, confidence := classifyFeatures(medianSpeed, burstSpeed, medianCadence, climbPerKm)
+
+	// Short tracks give noisy speed distributions
+	if len(speeds) < minClassifySamples {
+		confidence *= 0.5
+	}
+	return activityType, math.Round(confidence*100) / 100
+}
+
+func classifyFeatures(medianSpeed, burstSpeed, medianCadence, climbPerKm float64) (string, float64) {
+	// Cadence files record either steps per minute or strides (one foot); a
+	// value above runningCadence can only be a foot cadence, while pedalling
+	// stays well below it.
+	footCadence := medianCadence >= runningCadence
+
+	switch {
+	case medianSpeed >= cyclingMedianSpeed:
+		return TypeCycling, 0.9
+	case burstSpeed >= cyclingBurstSpeed && !footCadence:
+		return TypeCycling, 0.8
+	case medianSpeed >= ambiguousMedianSpeed:
+		if footCadence {
+			return TypeRunning, 0.7
+		}
+		return TypeCycling, 0.7
+	case medianSpeed >= runningMedianSpeed:
+		if footCadence {
+			return TypeRunning, 0.9
+		}
+		if medianCadence > 0 && medianSpeed >= 12 {
+			// Low cadence at tempo-run speed is more likely pedalling
+			return TypeCycling, 0.55
+		}
+		return TypeRunning, 0.7
+	case climbPerKm >= hikingClimbPerKm:
+		return TypeHiking, 0.7
+	default:
+		return TypeWalking, 0.7
+	}
+}
+
+// percentile returns the value at fraction p of an already sorted slice.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	index := int(math.Round(p * float64(len(sorted)-1)))
+	return sorted[index]
+}
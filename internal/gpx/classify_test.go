@@ -0,0 +1,156 @@
+package gpx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// syntheticTrack heads north at a constant speed, one point every 10s,
+// climbing climbPerPoint meters at each point.
+func syntheticTrack(n int, speedKmh, climbPerPoint float64, cadence int) []models.GPXPoint {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	// One degree of latitude is ~111.2km
+	step := speedKmh / 3.6 * 10 / 111195
+	points := make([]models.GPXPoint, n)
+	for i := range points {
+		points[i] = models.GPXPoint{
+			Lat:       45 + float64(i)*step,
+			Lon:       7,
+			Elevation: 500 + float64(i)*climbPerPoint,
+			Time:      start.Add(time.Duration(i) * 10 * time.Second),
+			Cadence:   cadence,
+		}
+	}
+	return points
+}
+
+func trackLength(points []models.GPXPoint) float64 {
+	var distance float64
+	for i := 1; i < len(points); i++ {
+		distance += haversineDistance(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
+	}
+	return distance
+}
+
+func TestNormalizeActivityType(t *testing.T) {
+	tests := []struct {
+		raw      string
+		expected string
+	}{
+		{"running", TypeRunning},
+		{"Trail Running", TypeRunning},
+		{"9", TypeRunning},
+		{"road_biking", TypeCycling},
+		{"Ride", TypeCycling},
+		{"1", TypeCycling},
+		{"10", TypeWalking},
+		{"hiking", TypeHiking},
+		{"Open Water Swimming", "open_water_swimming"},
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeActivityType(tt.raw); got != tt.expected {
+			t.Errorf("NormalizeActivityType(%q) = %q, expected %q", tt.raw, got, tt.expected)
+		}
+	}
+}
+
+func TestClassifyActivity(t *testing.T) {
+	tests := []struct {
+		name          string
+		points        []models.GPXPoint
+		expected      string
+		minConfidence float64
+	}{
+		{"fast ride", syntheticTrack(100, 27, 0, 0), TypeCycling, 0.9},
+		{"easy run", syntheticTrack(100, 10, 0, 0), TypeRunning, 0.7},
+		{"run with step cadence", syntheticTrack(100, 10, 0, 170), TypeRunning, 0.9},
+		{"slow ride with pedal cadence", syntheticTrack(100, 14, 0, 85), TypeCycling, 0.5},
+		{"fast run with step cadence", syntheticTrack(100, 17, 0, 180), TypeRunning, 0.7},
+		{"flat walk", syntheticTrack(100, 5, 0, 0), TypeWalking, 0.7},
+		{"steep hike", syntheticTrack(100, 4, 1, 0), TypeHiking, 0.7},
+		{"short track", syntheticTrack(10, 10, 0, 0), TypeRunning, 0.35},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := trackLength(tt.points)
+			gain := tt.points[len(tt.points)-1].Elevation - tt.points[0].Elevation
+			activityType, confidence := ClassifyActivity(tt.points, distance, gain)
+			if activityType != tt.expected {
+				t.Errorf("ClassifyActivity() type = %q, expected %q", activityType, tt.expected)
+			}
+			if confidence < tt.minConfidence || confidence > 1 {
+				t.Errorf("ClassifyActivity() confidence = %v, expected at least %v", confidence, tt.minConfidence)
+			}
+		})
+	}
+
+	t.Run("no timestamps", func(t *testing.T) {
+		points := syntheticTrack(100, 10, 0, 0)
+		for i := range points {
+			points[i].Time = time.Time{}
+		}
+		if activityType, confidence := ClassifyActivity(points, trackLength(points), 0); activityType != TypeUnknown || confidence != 0 {
+			t.Errorf("ClassifyActivity() = %q, %v, expected %q, 0", activityType, confidence, TypeUnknown)
+		}
+	})
+}
+
+func gpxDocument(trackType string, points []models.GPXPoint) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Test" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1">
+  <trk>
+    <name>Synthetic</name>
+`)
+	if trackType != "" {
+		fmt.Fprintf(&b, "    <type>%s</type>\n", trackType)
+	}
+	b.WriteString("    <trkseg>\n")
+	for _, p := range points {
+		fmt.Fprintf(&b, `      <trkpt lat="%f" lon="%f"><ele>%f</ele><time>%s</time>`, p.Lat, p.Lon, p.Elevation, p.Time.Format(time.RFC3339))
+		if p.Cadence > 0 {
+			fmt.Fprintf(&b, `<extensions><gpxtpx:TrackPointExtension><gpxtpx:cad>%d</gpxtpx:cad></gpxtpx:TrackPointExtension></extensions>`, p.Cadence)
+		}
+		b.WriteString("</trkpt>\n")
+	}
+	b.WriteString("    </trkseg>\n  </trk>\n</gpx>")
+	return b.String()
+}
+
+func TestParseGPXActivityType(t *testing.T) {
+	cfg := &config.Config{ElevationSmoothingEnabled: false}
+
+	t.Run("type element wins over inference", func(t *testing.T) {
+		_, activity, err := ParseGPXWithConfig(gpxDocument("1", syntheticTrack(60, 10, 0, 0)), cfg)
+		if err != nil {
+			t.Fatalf("ParseGPXWithConfig() error = %v", err)
+		}
+		if activity.Type != TypeCycling || activity.TypeSource != models.TypeSourceFile || activity.TypeConfidence != 1 {
+			t.Errorf("Unexpected type %q from %q with confidence %v", activity.Type, activity.TypeSource, activity.TypeConfidence)
+		}
+	})
+
+	t.Run("inferred from cadence and speed", func(t *testing.T) {
+		track, activity, err := ParseGPXWithConfig(gpxDocument("", syntheticTrack(60, 10, 0, 172)), cfg)
+		if err != nil {
+			t.Fatalf("ParseGPXWithConfig() error = %v", err)
+		}
+		if track.Points[0].Cadence != 172 {
+			t.Errorf("Expected cadence 172 from extensions, got %d", track.Points[0].Cadence)
+		}
+		if activity.Type != TypeRunning || activity.TypeSource != models.TypeSourceInferred {
+			t.Errorf("Unexpected type %q from %q", activity.Type, activity.TypeSource)
+		}
+		if activity.TypeConfidence <= 0 || activity.TypeConfidence > 1 {
+			t.Errorf("Expected a confidence in (0, 1], got %v", activity.TypeConfidence)
+		}
+	})
+}
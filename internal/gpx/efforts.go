@@ -0,0 +1,152 @@
+package gpx
+
+import (
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// EffortDistance is a standard distance tracked as a best effort.
+type EffortDistance struct {
+	Name     string
+	Distance float64 // meters
+}
+
+// EffortDistances are the distances best efforts are computed for, shortest
+// first.
+var EffortDistances = []EffortDistance{
+	{"400m", 400},
+	{"1k", 1000},
+	{"1 mile", 1609.344},
+	{"5k", 5000},
+	{"10k", 10000},
+	{"Half marathon", 21097.5},
+	{"Marathon", 42195},
+}
+
+// PowerEffortName and PowerEffortDuration define the power best effort, the
+// highest average power held for 20 minutes as used for FTP tests.
+const (
+	PowerEffortName     = "20 min power"
+	PowerEffortDuration = 20 * 60 // seconds
+)
+
+// BestEfforts finds the fastest time over each of EffortDistances and the
+// best 20-minute average power in points. Both use a sliding window over
+// elapsed time, so a stop during an effort counts against it. Distances
+// longer than the track and power over tracks shorter than 20 minutes or
+// without power data are left out.
+func BestEfforts(points []models.GPXPoint) []models.BestEffort {
+	var timed []models.GPXPoint
+	for _, point := range points {
+		if !point.Time.IsZero() {
+			timed = append(timed, point)
+		}
+	}
+	if len(timed) < 2 {
+		return nil
+	}
+
+	var efforts []models.BestEffort
+	for _, d := range EffortDistances {
+		if effort, ok := fastestDistance(timed, d.Distance); ok {
+			effort.Name = d.Name
+			efforts = append(efforts, effort)
+		}
+	}
+	if effort, ok := bestPower(timed, PowerEffortDuration); ok {
+		efforts = append(efforts, effort)
+	}
+	return efforts
+}
+
+// fastestDistance returns the shortest time to cover distance meters. For
+// each end point the window starts at the latest point that still leaves the
+// full distance, with the start time interpolated to the exact distance.
+func fastestDistance(points []models.GPXPoint, distance float64) (models.BestEffort, bool) {
+	cumulative := make([]float64, len(points))
+	for i := 1; i < len(points); i++ {
+		cumulative[i] = cumulative[i-1] + haversineDistance(points[i-1].Lat, points[i-1].Lon, points[i].Lat, points[i].Lon)
+	}
+	if cumulative[len(cumulative)-1] < distance {
+		return models.BestEffort{}, false
+	}
+
+	var best models.BestEffort
+	found := false
+	start := 0
+	for end := 1; end < len(points); end++ {
+		if cumulative[end] < distance {
+			continue
+		}
+		for cumulative[end]-cumulative[start+1] >= distance {
+			start++
+		}
+
+		// Interpolate where the effort begins between start and start+1
+		from := cumulative[end] - distance
+		startTime := points[start].Time
+		if segment := cumulative[start+1] - cumulative[start]; segment > 0 {
+			f := (from - cumulative[start]) / segment
+			startTime = startTime.Add(time.Duration(f * float64(points[start+1].Time.Sub(points[start].Time))))
+		}
+
+		elapsed := points[end].Time.Sub(startTime)
+		seconds := int(elapsed.Round(time.Second).Seconds())
+		if seconds > 0 && (!found || seconds < best.Duration) {
+			best = models.BestEffort{Distance: distance, Duration: seconds, StartTime: startTime}
+			found = true
+		}
+	}
+	return best, found
+}
+
+// bestPower returns the highest time-weighted average power over windows of
+// at least duration seconds. Each point's power is held from the previous
+// point to it.
+func bestPower(points []models.GPXPoint, duration int) (models.BestEffort, bool) {
+	hasPower := false
+	for _, point := range points {
+		if point.Power > 0 {
+			hasPower = true
+			break
+		}
+	}
+	if !hasPower {
+		return models.BestEffort{}, false
+	}
+
+	window := time.Duration(duration) * time.Second
+	energy := make([]float64, len(points)) // joules up to each point
+	for i := 1; i < len(points); i++ {
+		energy[i] = energy[i-1] + float64(points[i].Power)*points[i].Time.Sub(points[i-1].Time).Seconds()
+	}
+
+	var best models.BestEffort
+	found := false
+	start := 0
+	for end := 1; end < len(points); end++ {
+		if points[end].Time.Sub(points[0].Time) < window {
+			continue
+		}
+		for points[end].Time.Sub(points[start+1].Time) >= window {
+			start++
+		}
+
+		seconds := points[end].Time.Sub(points[start].Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+		power := int((energy[end]-energy[start])/seconds + 0.5)
+		if !found || power > best.Power {
+			best = models.BestEffort{
+				Name:      PowerEffortName,
+				Duration:  duration,
+				Power:     power,
+				StartTime: points[start].Time,
+			}
+			found = true
+		}
+	}
+	return best, found
+}
@@ -0,0 +1,70 @@
+package gpx
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBestEfforts(t *testing.T) {
+	// 1.5km at 10 km/h, then 1.5km at 12 km/h; every point 10s apart
+	points := syntheticTrack(55, 10, 0, 0)
+	fast := syntheticTrack(46, 12, 0, 0)
+	last := points[len(points)-1]
+	for i, point := range fast[1:] {
+		point.Lat += last.Lat - fast[0].Lat
+		point.Time = last.Time.Add(time.Duration(i+1) * 10 * time.Second)
+		points = append(points, point)
+	}
+
+	efforts := BestEfforts(points)
+	byName := make(map[string]int)
+	for _, effort := range efforts {
+		byName[effort.Name] = effort.Duration
+	}
+
+	// The fastest kilometer lies wholly within the 12 km/h half
+	if got := byName["1k"]; got != 300 {
+		t.Errorf("1k = %ds, expected 300", got)
+	}
+	if got := byName["400m"]; got != 120 {
+		t.Errorf("400m = %ds, expected 120", got)
+	}
+	if _, ok := byName["5k"]; ok {
+		t.Error("Expected no 5k effort on a 3km track")
+	}
+	if _, ok := byName[PowerEffortName]; ok {
+		t.Error("Expected no power effort without power data")
+	}
+}
+
+func TestBestEffortsPower(t *testing.T) {
+	// 30 minutes at 200W with 200W extra for ten minutes in the middle
+	points := syntheticTrack(181, 30, 0, 0)
+	for i := range points {
+		points[i].Power = 200
+		if i > 60 && i <= 120 {
+			points[i].Power = 400
+		}
+	}
+
+	var power int
+	for _, effort := range BestEfforts(points) {
+		if effort.Name == PowerEffortName {
+			power = effort.Power
+		}
+	}
+	// Any 20 minute window covers the full ten minutes at 400W
+	if power != 300 {
+		t.Errorf("20 min power = %dW, expected 300", power)
+	}
+}
+
+func TestBestEffortsWithoutTimes(t *testing.T) {
+	points := syntheticTrack(100, 10, 0, 0)
+	for i := range points {
+		points[i].Time = time.Time{}
+	}
+	if efforts := BestEfforts(points); efforts != nil {
+		t.Errorf("Expected no efforts without timestamps, got %+v", efforts)
+	}
+}
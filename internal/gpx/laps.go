@@ -0,0 +1,72 @@
+package gpx
+
+import (
+	"errors"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// LapFromPoints computes a lap's stats from its track points the same way
+// Summarize does for the whole activity, so laps and activity agree. Laps
+// have no splits or best efforts, so those are not computed.
+func LapFromPoints(index int, points []models.GPXPoint, cfg *config.Config) models.Lap {
+	summary := summarizeTrack(points, cfg)
+	return models.Lap{
+		Index:          index,
+		StartTime:      summary.StartTime,
+		Duration:       summary.Duration,
+		ElapsedTime:    summary.ElapsedTime,
+		Distance:       summary.Distance,
+		AvgSpeed:       summary.AvgSpeed,
+		MaxSpeed:       summary.MaxSpeed,
+		TotalElevation: summary.TotalElevation,
+		AvgHeartRate:   summary.AvgHeartRate,
+		MaxHeartRate:   summary.MaxHeartRate,
+		AvgCadence:     summary.AvgCadence,
+		AvgPower:       summary.AvgPower,
+		MaxPower:       summary.MaxPower,
+	}
+}
+
+// SegmentLaps returns one lap per track segment, where segments holds the
+// index of the first point of each segment as in models.GPXTrack.Segments.
+// A track with a single segment has no laps.
+func SegmentLaps(points []models.GPXPoint, segments []int, cfg *config.Config) []models.Lap {
+	if len(segments) < 2 {
+		return nil
+	}
+
+	laps := make([]models.Lap, 0, len(segments))
+	for i, start := range segments {
+		end := len(points)
+		if i+1 < len(segments) {
+			end = segments[i+1]
+		}
+		laps = append(laps, LapFromPoints(i+1, points[start:end], cfg))
+	}
+	return laps
+}
+
+// ErrEmptyLap is returned by TimeRangeLap when fewer than two points fall in
+// the requested range.
+var ErrEmptyLap = errors.New("time range contains fewer than two track points")
+
+// TimeRangeLap computes a manual lap from the points recorded between start
+// and end, inclusive.
+func TimeRangeLap(points []models.GPXPoint, start, end time.Time, cfg *config.Config) (models.Lap, error) {
+	var inRange []models.GPXPoint
+	for _, point := range points {
+		if !point.Time.Before(start) && !point.Time.After(end) {
+			inRange = append(inRange, point)
+		}
+	}
+	if len(inRange) < 2 {
+		return models.Lap{}, ErrEmptyLap
+	}
+
+	lap := LapFromPoints(0, inRange, cfg)
+	lap.Manual = true
+	return lap, nil
+}
@@ -0,0 +1,80 @@
+package gpx
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+)
+
+func TestParseGPXSegmentLaps(t *testing.T) {
+	points := syntheticTrack(40, 10, 0, 0)
+	// Close the segment after the 15th point to make two intervals
+	lines := strings.Split(gpxDocument("", points), "\n")
+	var b strings.Builder
+	trkpts := 0
+	for _, line := range lines {
+		b.WriteString(line + "\n")
+		if strings.Contains(line, "<trkpt") {
+			trkpts++
+			if trkpts == 15 {
+				b.WriteString("    </trkseg>\n    <trkseg>\n")
+			}
+		}
+	}
+
+	track, activity, err := ParseGPXWithConfig(b.String(), &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseGPXWithConfig() error = %v", err)
+	}
+	if len(track.Points) != 40 {
+		t.Fatalf("Expected all 40 points in the track, got %d", len(track.Points))
+	}
+	if len(track.Segments) != 2 || track.Segments[0] != 0 || track.Segments[1] != 15 {
+		t.Errorf("Segments = %v, expected [0 15]", track.Segments)
+	}
+
+	if len(activity.Laps) != 2 {
+		t.Fatalf("Expected 2 laps, got %d", len(activity.Laps))
+	}
+	first, second := activity.Laps[0], activity.Laps[1]
+	if first.Index != 1 || first.Duration != 140 || !first.StartTime.Equal(points[0].Time) {
+		t.Errorf("Unexpected first lap %+v", first)
+	}
+	if second.Index != 2 || second.Duration != 240 || !second.StartTime.Equal(points[15].Time) {
+		t.Errorf("Unexpected second lap %+v", second)
+	}
+	if math.Abs(first.AvgSpeed-10) > 0.1 || math.Abs(second.AvgSpeed-10) > 0.1 {
+		t.Errorf("Expected laps at 10 km/h, got %v and %v", first.AvgSpeed, second.AvgSpeed)
+	}
+}
+
+func TestParseGPXSingleSegmentHasNoLaps(t *testing.T) {
+	track, activity, err := ParseGPXWithConfig(gpxDocument("", syntheticTrack(20, 10, 0, 0)), &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseGPXWithConfig() error = %v", err)
+	}
+	if track.Segments != nil || activity.Laps != nil {
+		t.Errorf("Expected no segments or laps, got %v and %+v", track.Segments, activity.Laps)
+	}
+}
+
+func TestTimeRangeLap(t *testing.T) {
+	points := syntheticTrack(40, 10, 1, 0)
+	start := points[0].Time
+
+	lap, err := TimeRangeLap(points, start.Add(100*time.Second), start.Add(200*time.Second), &config.Config{})
+	if err != nil {
+		t.Fatalf("TimeRangeLap() error = %v", err)
+	}
+	if !lap.Manual || lap.Duration != 100 || !lap.StartTime.Equal(points[10].Time) || lap.TotalElevation != 10 {
+		t.Errorf("Unexpected lap %+v", lap)
+	}
+
+	if _, err := TimeRangeLap(points, start.Add(time.Hour), start.Add(2*time.Hour), &config.Config{}); !errors.Is(err, ErrEmptyLap) {
+		t.Errorf("Expected ErrEmptyLap outside the track, got %v", err)
+	}
+}
@@ -17,6 +17,7 @@ type GPX struct {
 
 type Track struct {
 	Name     string    `xml:"name"`
+	Type     string    `xml:"type"` // sport, e.g. "running" (Garmin) or "9" (Strava)
 	Segments []Segment `xml:"trkseg"`
 }
 
@@ -29,6 +30,26 @@ type TrackPoint struct {
 	Lon       float64 `xml:"lon,attr"`
 	Elevation float64 `xml:"ele,omitempty"`
 	Time      string  `xml:"time,omitempty"`
+	Extensions Extensions `xml:"extensions"`
+}
+
+// Extensions holds per-point sensor data. Garmin writes heart rate, cadence
+// and temperature in a gpxtpx:TrackPointExtension; power is written either as
+// a bare <power> element (Strava, Wahoo) or in a Garmin PowerExtension.
+type Extensions struct {
+	TrackPoint     TrackPointExtension `xml:"TrackPointExtension"`
+	Power          int                 `xml:"power"`
+	PowerExtension PowerExtension      `xml:"PowerExtension"`
+}
+
+type TrackPointExtension struct {
+	HeartRate   int      `xml:"hr"`
+	Cadence     int      `xml:"cad"`
+	Temperature *float64 `xml:"atemp"`
+}
+
+type PowerExtension struct {
+	Watts int `xml:"PowerInWatts"`
 }
 
 func ParseGPX(content string) (*models.GPXTrack, *models.Activity, error) {
@@ -47,96 +68,190 @@ func ParseGPXWithConfig(content string, cfg *config.Config) (*models.GPXTrack, *
 		Points: []models.GPXPoint{},
 	}
 
-	activity := &models.Activity{
-		Type: "activity",
-	}
-
-	var totalDistance float64
-	var totalElevation float64
-	var maxSpeed float64
-	var speeds []float64
-	var startTime, endTime time.Time
-	var prevPoint *models.GPXPoint
-
+	var name, sport string
+	var segments []int
 	for _, trk := range gpx.Tracks {
-		if track.Name == "" {
-			track.Name = trk.Name
-			activity.Name = trk.Name
+		if name == "" {
+			name = trk.Name
+		}
+		if sport == "" {
+			sport = NormalizeActivityType(trk.Type)
 		}
 
 		for _, seg := range trk.Segments {
+			if len(seg.Points) > 0 {
+				segments = append(segments, len(track.Points))
+			}
 			for _, pt := range seg.Points {
 				point := models.GPXPoint{
-					Lat:       pt.Lat,
-					Lon:       pt.Lon,
-					Elevation: pt.Elevation,
+					Lat:         pt.Lat,
+					Lon:         pt.Lon,
+					Elevation:   pt.Elevation,
+					HeartRate:   pt.Extensions.TrackPoint.HeartRate,
+					Cadence:     pt.Extensions.TrackPoint.Cadence,
+					Power:       pt.Extensions.Power,
+					Temperature: pt.Extensions.TrackPoint.Temperature,
+				}
+				if point.Power == 0 {
+					point.Power = pt.Extensions.PowerExtension.Watts
 				}
 
 				// Parse time
 				if pt.Time != "" {
 					if t, err := time.Parse(time.RFC3339, pt.Time); err == nil {
 						point.Time = t
-						if startTime.IsZero() || t.Before(startTime) {
-							startTime = t
-						}
-						if endTime.IsZero() || t.After(endTime) {
-							endTime = t
-						}
-					}
-				}
-
-				// Calculate distance and speed if we have a previous point
-				if prevPoint != nil {
-					dist := haversineDistance(prevPoint.Lat, prevPoint.Lon, point.Lat, point.Lon)
-					totalDistance += dist
-
-					// Note: Elevation calculation moved to after all points are collected
-
-					// Calculate speed if we have time data
-					if !prevPoint.Time.IsZero() && !point.Time.IsZero() {
-						timeDiff := point.Time.Sub(prevPoint.Time).Seconds()
-						if timeDiff > 0 {
-							speed := (dist / timeDiff) * 3.6 // Convert m/s to km/h
-							speeds = append(speeds, speed)
-							if speed > maxSpeed {
-								maxSpeed = speed
-							}
-						}
 					}
 				}
 
 				track.Points = append(track.Points, point)
-				prevPoint = &point
 			}
 		}
 	}
 
-	// Calculate elevation gain using smoothing algorithm
-	totalElevation = calculateSmoothedElevation(track.Points, cfg)
-
-	// Calculate average speed
-	var avgSpeed float64
-	if len(speeds) > 0 {
-		var totalSpeed float64
-		for _, speed := range speeds {
-			totalSpeed += speed
+	track.Name = name
+	activity := Summarize(track.Points, cfg)
+	activity.Name = name
+	// Interval workouts are recorded as one segment (or track) per lap
+	if len(segments) > 1 {
+		track.Segments = segments
+		activity.Laps = SegmentLaps(track.Points, segments, cfg)
+	}
+	if sport != "" {
+		activity.Type = sport
+		activity.TypeSource = models.TypeSourceFile
+		activity.TypeConfidence = 1
+	}
+	DetectType(activity, track.Points)
+
+	return track, activity, nil
+}
+
+// Summarize computes an activity's time, distance, speed, elevation and
+// sensor stats from its track points. The FIT and TCX decoders use it too,
+// so every file format gets the same numbers for the same track.
+//
+// Duration is the moving time: elapsed time minus detected pauses. Average
+// speed is distance over moving time, so stops do not drag it down. Splits
+// are computed per kilometer and per mile, along with the best efforts.
+func Summarize(points []models.GPXPoint, cfg *config.Config) *models.Activity {
+	activity := summarizeTrack(points, cfg)
+	activity.KilometerSplits = computeSplits(points, SplitKilometer, activity.Pauses, cfg)
+	activity.MileSplits = computeSplits(points, SplitMile, activity.Pauses, cfg)
+	activity.BestEfforts = BestEfforts(points)
+
+	return activity
+}
+
+// summarizeTrack computes the stats of Summarize without the splits and best
+// efforts, which laps do not need.
+func summarizeTrack(points []models.GPXPoint, cfg *config.Config) *models.Activity {
+	activity := &models.Activity{
+		Type: TypeUnknown,
+	}
+
+	var totalDistance float64
+	var maxSpeed float64
+	var startTime, endTime time.Time
+
+	for i, point := range points {
+		if !point.Time.IsZero() {
+			if startTime.IsZero() || point.Time.Before(startTime) {
+				startTime = point.Time
+			}
+			if endTime.IsZero() || point.Time.After(endTime) {
+				endTime = point.Time
+			}
+		}
+
+		// Calculate distance and speed if we have a previous point
+		if i > 0 {
+			prevPoint := points[i-1]
+			dist := haversineDistance(prevPoint.Lat, prevPoint.Lon, point.Lat, point.Lon)
+			totalDistance += dist
+
+			// Calculate speed if we have time data
+			if !prevPoint.Time.IsZero() && !point.Time.IsZero() {
+				timeDiff := point.Time.Sub(prevPoint.Time).Seconds()
+				if timeDiff > 0 {
+					speed := (dist / timeDiff) * 3.6 // Convert m/s to km/h
+					if speed > maxSpeed {
+						maxSpeed = speed
+					}
+				}
+			}
 		}
-		avgSpeed = totalSpeed / float64(len(speeds))
 	}
 
 	// Set activity stats
 	activity.StartTime = startTime
 	activity.EndTime = endTime
 	if !startTime.IsZero() && !endTime.IsZero() {
-		activity.Duration = int(endTime.Sub(startTime).Seconds())
+		activity.ElapsedTime = int(endTime.Sub(startTime).Seconds())
+		activity.Pauses = detectPauses(points, cfg)
+		activity.MovingTime = activity.ElapsedTime
+		for _, pause := range activity.Pauses {
+			activity.MovingTime -= pause.Duration
+		}
+		activity.Duration = activity.MovingTime
 	}
 	activity.Distance = totalDistance
-	activity.TotalElevation = totalElevation
+	// Calculate elevation gain using smoothing algorithm
+	activity.TotalElevation = calculateSmoothedElevation(points, cfg)
 	activity.MaxSpeed = maxSpeed
-	activity.AvgSpeed = avgSpeed
-	activity.TotalPoints = len(track.Points)
+	if activity.MovingTime > 0 {
+		activity.AvgSpeed = totalDistance / float64(activity.MovingTime) * 3.6
+	}
+	activity.TotalPoints = len(points)
+	ApplySensorStats(activity, points)
 
-	return track, activity, nil
+	return activity
+}
+
+// ApplyRecordTimes sets the start, end and duration from sensor records when
+// the track has no timestamps, as for indoor activities without GPS.
+func ApplyRecordTimes(activity *models.Activity, records []models.GPXPoint) {
+	if !activity.StartTime.IsZero() {
+		return
+	}
+	for _, point := range records {
+		if point.Time.IsZero() {
+			continue
+		}
+		if activity.StartTime.IsZero() {
+			activity.StartTime = point.Time
+		}
+		activity.EndTime = point.Time
+	}
+	if !activity.StartTime.IsZero() {
+		activity.ElapsedTime = int(activity.EndTime.Sub(activity.StartTime).Seconds())
+		activity.MovingTime = activity.ElapsedTime
+		activity.Duration = activity.MovingTime
+	}
+}
+
+// ElevationGain returns the elevation gain of points using the configured
+// smoothing, for stats over part of a track such as a lap.
+func ElevationGain(points []models.GPXPoint, cfg *config.Config) float64 {
+	return calculateSmoothedElevation(points, cfg)
+}
+
+// DetectType classifies activity from its track unless its type already
+// came from the file or the user.
+func DetectType(activity *models.Activity, points []models.GPXPoint) {
+	if activity.TypeSource != "" {
+		return
+	}
+	activityType, confidence := ClassifyActivity(points, activity.Distance, activity.TotalElevation)
+	if confidence > 0 {
+		activity.Type = activityType
+		activity.TypeSource = models.TypeSourceInferred
+		activity.TypeConfidence = confidence
+	}
+}
+
+// Distance returns the distance in meters between two points.
+func Distance(a, b models.GPXPoint) float64 {
+	return haversineDistance(a.Lat, a.Lon, b.Lat, b.Lon)
 }
 
 // haversineDistance calculates the distance between two points on Earth using the Haversine formula
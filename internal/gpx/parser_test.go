@@ -357,4 +357,84 @@ func BenchmarkCalculateSimpleElevation(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		calculateSimpleElevation(points)
 	}
-}
\ No newline at end of file
+}
+
+func TestParseGPXSensorExtensions(t *testing.T) {
+	testGPX := `<?xml version="1.0" encoding="UTF-8"?>
+<gpx version="1.1" creator="Test" xmlns:gpxtpx="http://www.garmin.com/xmlschemas/TrackPointExtension/v1" xmlns:pwr="http://www.garmin.com/xmlschemas/PowerExtension/v1">
+  <trk>
+    <name>Sensor Ride</name>
+    <trkseg>
+      <trkpt lat="40.7128" lon="-74.0060">
+        <time>2023-01-01T10:00:00Z</time>
+        <extensions>
+          <power>200</power>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:atemp>0</gpxtpx:atemp>
+            <gpxtpx:hr>120</gpxtpx:hr>
+            <gpxtpx:cad>80</gpxtpx:cad>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+      <trkpt lat="40.7138" lon="-74.0060">
+        <time>2023-01-01T10:00:10Z</time>
+        <extensions>
+          <pwr:PowerExtension><pwr:PowerInWatts>0</pwr:PowerInWatts></pwr:PowerExtension>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:hr>131</gpxtpx:hr>
+            <gpxtpx:cad>0</gpxtpx:cad>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+      <trkpt lat="40.7148" lon="-74.0060">
+        <time>2023-01-01T10:00:20Z</time>
+        <extensions>
+          <pwr:PowerExtension><pwr:PowerInWatts>340</pwr:PowerInWatts></pwr:PowerExtension>
+          <gpxtpx:TrackPointExtension>
+            <gpxtpx:atemp>21.5</gpxtpx:atemp>
+            <gpxtpx:hr>150</gpxtpx:hr>
+            <gpxtpx:cad>90</gpxtpx:cad>
+          </gpxtpx:TrackPointExtension>
+        </extensions>
+      </trkpt>
+    </trkseg>
+  </trk>
+</gpx>`
+
+	track, activity, err := ParseGPXWithConfig(testGPX, &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseGPXWithConfig() error = %v", err)
+	}
+
+	first, last := track.Points[0], track.Points[2]
+	if first.HeartRate != 120 || first.Cadence != 80 || first.Power != 200 {
+		t.Errorf("Unexpected first point sensors %+v", first)
+	}
+	if first.Temperature == nil || *first.Temperature != 0 {
+		t.Errorf("Expected a 0°C temperature on the first point, got %v", first.Temperature)
+	}
+	if track.Points[1].Temperature != nil {
+		t.Errorf("Expected no temperature on the second point, got %v", *track.Points[1].Temperature)
+	}
+	if last.Power != 340 || last.Temperature == nil || *last.Temperature != 21.5 {
+		t.Errorf("Unexpected last point sensors %+v", last)
+	}
+
+	tests := []struct {
+		name     string
+		got      int
+		expected int
+	}{
+		{"AvgHeartRate", activity.AvgHeartRate, 134},
+		{"MaxHeartRate", activity.MaxHeartRate, 150},
+		{"AvgCadence", activity.AvgCadence, 85}, // zero cadence is ignored
+		{"MaxCadence", activity.MaxCadence, 90},
+		{"AvgPower", activity.AvgPower, 180}, // zero power counts
+		{"MaxPower", activity.MaxPower, 340},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.expected {
+			t.Errorf("%s = %d, expected %d", tt.name, tt.got, tt.expected)
+		}
+	}
+}
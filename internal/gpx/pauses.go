@@ -0,0 +1,58 @@
+package gpx
+
+import (
+	"math"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// detectPauses finds the stops in a track: runs of consecutive segments
+// slower than cfg.PauseSpeedThreshold lasting at least cfg.PauseMinDuration,
+// and gaps between points longer than cfg.PauseGapThreshold, which is how
+// devices record an auto-pause.
+func detectPauses(points []models.GPXPoint, cfg *config.Config) []models.Pause {
+	if !cfg.PauseDetectionEnabled {
+		return nil
+	}
+
+	var pauses []models.Pause
+	var current *models.Pause
+	var stopped float64 // seconds in the current run
+
+	flush := func() {
+		if current != nil && stopped >= float64(cfg.PauseMinDuration) {
+			current.Duration = int(math.Round(stopped))
+			pauses = append(pauses, *current)
+		}
+		current = nil
+		stopped = 0
+	}
+
+	for i := 1; i < len(points); i++ {
+		prev, point := points[i-1], points[i]
+		if prev.Time.IsZero() || point.Time.IsZero() {
+			flush()
+			continue
+		}
+		seconds := point.Time.Sub(prev.Time).Seconds()
+		if seconds <= 0 {
+			continue
+		}
+
+		speed := haversineDistance(prev.Lat, prev.Lon, point.Lat, point.Lon) / seconds * 3.6
+		isGap := cfg.PauseGapThreshold > 0 && seconds > float64(cfg.PauseGapThreshold)
+		if speed >= cfg.PauseSpeedThreshold && !isGap {
+			flush()
+			continue
+		}
+
+		if current == nil {
+			current = &models.Pause{StartTime: prev.Time, Lat: prev.Lat, Lon: prev.Lon}
+		}
+		stopped += seconds
+	}
+	flush()
+
+	return pauses
+}
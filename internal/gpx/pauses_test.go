@@ -0,0 +1,93 @@
+package gpx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+)
+
+func pauseConfig() *config.Config {
+	return &config.Config{
+		PauseDetectionEnabled: true,
+		PauseSpeedThreshold:   1.0,
+		PauseMinDuration:      30,
+		PauseGapThreshold:     60,
+	}
+}
+
+func TestDetectPauses(t *testing.T) {
+	start := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	// Standing still from point 10 to 16 (six 10s segments)
+	stopped := syntheticTrack(30, 10, 0, 0)
+	for i := 11; i < len(stopped); i++ {
+		shift := math.Min(float64(i-10), 6)
+		stopped[i].Lat -= shift * (stopped[1].Lat - stopped[0].Lat)
+	}
+
+	// The device auto-paused for two minutes after point 20
+	gap := syntheticTrack(30, 10, 0, 0)
+	for i := 21; i < len(gap); i++ {
+		gap[i].Time = gap[i].Time.Add(2 * time.Minute)
+		gap[i].Lat -= gap[1].Lat - gap[0].Lat
+	}
+
+	// A single 10s stop is shorter than the minimum duration
+	short := syntheticTrack(30, 10, 0, 0)
+	for i := 6; i < len(short); i++ {
+		short[i].Lat -= short[1].Lat - short[0].Lat
+	}
+
+	t.Run("speed", func(t *testing.T) {
+		pauses := detectPauses(stopped, pauseConfig())
+		if len(pauses) != 1 {
+			t.Fatalf("Expected 1 pause, got %d", len(pauses))
+		}
+		if p := pauses[0]; p.Duration != 60 || !p.StartTime.Equal(start.Add(100*time.Second)) || p.Lat != stopped[10].Lat {
+			t.Errorf("Unexpected pause %+v", p)
+		}
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		pauses := detectPauses(gap, pauseConfig())
+		if len(pauses) != 1 || pauses[0].Duration != 130 || !pauses[0].StartTime.Equal(start.Add(200*time.Second)) {
+			t.Errorf("Unexpected pauses %+v", pauses)
+		}
+	})
+
+	t.Run("short stop", func(t *testing.T) {
+		if pauses := detectPauses(short, pauseConfig()); len(pauses) != 0 {
+			t.Errorf("Expected no pauses, got %+v", pauses)
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cfg := pauseConfig()
+		cfg.PauseDetectionEnabled = false
+		if pauses := detectPauses(stopped, cfg); pauses != nil {
+			t.Errorf("Expected no pauses when disabled, got %+v", pauses)
+		}
+	})
+}
+
+func TestSummarizeMovingTime(t *testing.T) {
+	points := syntheticTrack(30, 10, 0, 0)
+	for i := 21; i < len(points); i++ {
+		points[i].Time = points[i].Time.Add(2 * time.Minute)
+		points[i].Lat -= points[1].Lat - points[0].Lat
+	}
+
+	activity := Summarize(points, pauseConfig())
+	if activity.ElapsedTime != 410 {
+		t.Errorf("ElapsedTime = %d, expected 410", activity.ElapsedTime)
+	}
+	if activity.MovingTime != 280 || activity.Duration != 280 {
+		t.Errorf("MovingTime = %d and Duration = %d, expected 280", activity.MovingTime, activity.Duration)
+	}
+	// Speed over moving time stays at the 10 km/h the track was built with
+	if math.Abs(activity.AvgSpeed-10) > 0.01 {
+		t.Errorf("AvgSpeed = %v, expected 10", activity.AvgSpeed)
+	}
+}
@@ -0,0 +1,54 @@
+package gpx
+
+import "health-hub/internal/models"
+
+// ApplySensorStats sets the heart rate, cadence and power averages and maxima
+// on activity from the per-point sensor readings. Heart rate and cadence are
+// averaged over non-zero readings only, so sensor dropouts and coasting do not
+// drag the average down. Power is averaged over every point once the track
+// has any power data, because zero watts while coasting is real effort data.
+func ApplySensorStats(activity *models.Activity, points []models.GPXPoint) {
+	var hr, cadence, power sensorStat
+	var hasPower bool
+	for _, point := range points {
+		if point.Power > 0 {
+			hasPower = true
+		}
+	}
+
+	for _, point := range points {
+		if point.HeartRate > 0 {
+			hr.add(point.HeartRate)
+		}
+		if point.Cadence > 0 {
+			cadence.add(point.Cadence)
+		}
+		if hasPower {
+			power.add(point.Power)
+		}
+	}
+
+	activity.AvgHeartRate, activity.MaxHeartRate = hr.avg(), hr.max
+	activity.AvgCadence, activity.MaxCadence = cadence.avg(), cadence.max
+	activity.AvgPower, activity.MaxPower = power.avg(), power.max
+}
+
+type sensorStat struct {
+	sum, count, max int
+}
+
+func (s *sensorStat) add(value int) {
+	s.sum += value
+	s.count++
+	if value > s.max {
+		s.max = value
+	}
+}
+
+// avg returns the rounded mean, or 0 without readings.
+func (s *sensorStat) avg() int {
+	if s.count == 0 {
+		return 0
+	}
+	return (s.sum + s.count/2) / s.count
+}
@@ -0,0 +1,123 @@
+package gpx
+
+import (
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// Split lengths in meters.
+const (
+	SplitKilometer = 1000.0
+	SplitMile      = 1609.344
+)
+
+// minSplitFraction drops a trailing partial split shorter than this fraction
+// of the split length, whose pace would be meaningless.
+const minSplitFraction = 0.01
+
+// computeSplits cuts the track at every multiple of length meters,
+// interpolating time and elevation between the points either side of each
+// boundary. Split times exclude the pauses, so pace is based on moving time.
+// Elevation changes use the same outlier filtering as the activity total.
+func computeSplits(points []models.GPXPoint, length float64, pauses []models.Pause, cfg *config.Config) []models.Split {
+	if len(points) < 2 || points[0].Time.IsZero() || points[len(points)-1].Time.IsZero() {
+		return nil
+	}
+	if cfg.ElevationSmoothingEnabled && len(points) >= 3 {
+		points = removeElevationOutliers(points, cfg.ElevationSmoothingWindow)
+	}
+
+	var splits []models.Split
+	current := splitBuilder{start: points[0].Time}
+	current.addHeartRate(points[0].HeartRate)
+
+	for i := 1; i < len(points); i++ {
+		prev, point := points[i-1], points[i]
+		if prev.Time.IsZero() || point.Time.IsZero() {
+			continue
+		}
+		segment := haversineDistance(prev.Lat, prev.Lon, point.Lat, point.Lon)
+		done := 0.0 // fraction of the segment already assigned to a split
+
+		for segment > 0 && current.distance+segment*(1-done) >= length {
+			f := done + (length-current.distance)/segment
+			boundary := prev.Time.Add(time.Duration(f * float64(point.Time.Sub(prev.Time))))
+			elevation := prev.Elevation + f*(point.Elevation-prev.Elevation)
+			current.climb(prev.Elevation+done*(point.Elevation-prev.Elevation), elevation)
+			current.distance = length
+
+			splits = append(splits, current.split(len(splits)+1, boundary, length, pauses))
+			current = splitBuilder{start: boundary}
+			done = f
+		}
+
+		current.distance += segment * (1 - done)
+		current.climb(prev.Elevation+done*(point.Elevation-prev.Elevation), point.Elevation)
+		current.addHeartRate(point.HeartRate)
+	}
+
+	if current.distance >= length*minSplitFraction {
+		splits = append(splits, current.split(len(splits)+1, points[len(points)-1].Time, length, pauses))
+	}
+	return splits
+}
+
+type splitBuilder struct {
+	start      time.Time
+	distance   float64
+	gain, loss float64
+	heartRate  sensorStat
+}
+
+func (b *splitBuilder) climb(from, to float64) {
+	if to > from {
+		b.gain += to - from
+	} else {
+		b.loss += from - to
+	}
+}
+
+// addHeartRate skips zero readings, as ApplySensorStats does.
+func (b *splitBuilder) addHeartRate(value int) {
+	if value > 0 {
+		b.heartRate.add(value)
+	}
+}
+
+func (b *splitBuilder) split(index int, end time.Time, length float64, pauses []models.Pause) models.Split {
+	duration := end.Sub(b.start) - pausedDuring(pauses, b.start, end)
+	s := models.Split{
+		Index:         index,
+		Distance:      b.distance,
+		Duration:      int(duration.Round(time.Second).Seconds()),
+		ElevationGain: b.gain,
+		ElevationLoss: b.loss,
+		AvgHeartRate:  b.heartRate.avg(),
+	}
+	if b.distance > 0 {
+		s.Pace = int((duration.Seconds() / (b.distance / length)) + 0.5)
+	}
+	return s
+}
+
+// pausedDuring returns how much of the time between start and end falls
+// within pauses.
+func pausedDuring(pauses []models.Pause, start, end time.Time) time.Duration {
+	var paused time.Duration
+	for _, pause := range pauses {
+		from := pause.StartTime
+		to := from.Add(time.Duration(pause.Duration) * time.Second)
+		if from.Before(start) {
+			from = start
+		}
+		if to.After(end) {
+			to = end
+		}
+		if to.After(from) {
+			paused += to.Sub(from)
+		}
+	}
+	return paused
+}
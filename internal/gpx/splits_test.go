@@ -0,0 +1,89 @@
+package gpx
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+func TestComputeSplits(t *testing.T) {
+	// 99 segments of ~27.8m at 10 km/h: two full kilometers of 6:00 and a
+	// 750m partial split, climbing 1m per point
+	points := syntheticTrack(100, 10, 1, 0)
+	for i := range points {
+		points[i].HeartRate = 140
+		if i >= 50 {
+			points[i].HeartRate = 160
+		}
+	}
+
+	splits := computeSplits(points, SplitKilometer, nil, &config.Config{})
+	if len(splits) != 3 {
+		t.Fatalf("Expected 3 splits, got %d", len(splits))
+	}
+
+	tests := []struct {
+		distance float64
+		duration int
+		gain     float64
+		hr       int
+	}{
+		{1000, 360, 36, 140},
+		{1000, 360, 36, 153}, // 13 points at 140 and 23 at 160
+		{750, 270, 27, 160},
+	}
+	for i, tt := range tests {
+		s := splits[i]
+		if s.Index != i+1 || math.Abs(s.Distance-tt.distance) > 1 || s.Duration != tt.duration {
+			t.Errorf("Split %d = %+v, expected %vm in %ds", i+1, s, tt.distance, tt.duration)
+		}
+		if s.Pace != 360 {
+			t.Errorf("Split %d pace = %d, expected 360", i+1, s.Pace)
+		}
+		if math.Abs(s.ElevationGain-tt.gain) > 0.5 || s.ElevationLoss != 0 {
+			t.Errorf("Split %d elevation = +%v/-%v, expected +%v", i+1, s.ElevationGain, s.ElevationLoss, tt.gain)
+		}
+		if math.Abs(float64(s.AvgHeartRate-tt.hr)) > 1 {
+			t.Errorf("Split %d AvgHeartRate = %d, expected about %d", i+1, s.AvgHeartRate, tt.hr)
+		}
+	}
+
+	miles := computeSplits(points, SplitMile, nil, &config.Config{})
+	if len(miles) != 2 || miles[0].Pace != 579 || math.Abs(miles[1].Distance-(2750-SplitMile)) > 1 {
+		t.Errorf("Unexpected mile splits %+v", miles)
+	}
+}
+
+func TestComputeSplitsExcludesPauses(t *testing.T) {
+	points := syntheticTrack(100, 10, 0, 0)
+	// Stopped for two minutes after point 10
+	for i := 11; i < len(points); i++ {
+		points[i].Time = points[i].Time.Add(2 * time.Minute)
+		points[i].Lat -= points[1].Lat - points[0].Lat
+	}
+	pauses := []models.Pause{{StartTime: points[10].Time, Duration: 130}}
+
+	splits := computeSplits(points, SplitKilometer, pauses, &config.Config{})
+	if len(splits) != 3 {
+		t.Fatalf("Expected 3 splits, got %d", len(splits))
+	}
+	if splits[0].Duration != 360 || splits[0].Pace != 360 {
+		t.Errorf("Expected the pause to be excluded from the first split, got %+v", splits[0])
+	}
+	if splits[1].Duration != 360 {
+		t.Errorf("Expected the second split to be unaffected, got %+v", splits[1])
+	}
+}
+
+func TestComputeSplitsWithoutTimes(t *testing.T) {
+	points := syntheticTrack(100, 10, 0, 0)
+	for i := range points {
+		points[i].Time = time.Time{}
+	}
+	if splits := computeSplits(points, SplitKilometer, nil, &config.Config{}); splits != nil {
+		t.Errorf("Expected no splits without timestamps, got %+v", splits)
+	}
+}
@@ -1,27 +1,59 @@
 package handlers
 
 import (
+	"archive/zip"
+	"bytes"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
+	"math"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"health-hub/internal/applehealth"
+	"health-hub/internal/config"
+	"health-hub/internal/export"
+	"health-hub/internal/fitbit"
+	"health-hub/internal/googlefit"
 	"health-hub/internal/gpx"
+	"health-hub/internal/health"
+	"health-hub/internal/importer"
+	"health-hub/internal/jobs"
 	"health-hub/internal/models"
+	"health-hub/internal/oura"
+	"health-hub/internal/records"
 	"health-hub/internal/storage"
 	"health-hub/internal/templates"
+	"health-hub/internal/zones"
 )
 
 type Handlers struct {
 	storage   storage.Storage
 	templates *templates.Templates
+	config    *config.Config
+	jobs      *jobs.Queue
+
+	// importMu serializes the duplicate check and save of imported
+	// activities, so that concurrent imports of the same activity cannot
+	// both be saved. It also guards duplicates, which is loaded from storage
+	// by the first import and nil until then.
+	importMu   sync.Mutex
+	duplicates *importer.DuplicateIndex
 }
 
-func NewHandlers(s storage.Storage, fs embed.FS) *Handlers {
+func NewHandlers(s storage.Storage, fs embed.FS, cfg *config.Config) *Handlers {
 	tmpl := templates.NewTemplates(fs)
 	if err := tmpl.LoadTemplates(); err != nil {
 		fmt.Printf("ERROR: Failed to load embedded templates: %v\n", err)
@@ -31,6 +63,8 @@ func NewHandlers(s storage.Storage, fs embed.FS) *Handlers {
 	return &Handlers{
 		storage:   s,
 		templates: tmpl,
+		config:    cfg,
+		jobs:      jobs.NewQueue(cfg.ImportWorkers),
 	}
 }
 
@@ -69,132 +103,1870 @@ func (h *Handlers) GetActivities(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	activities, err := h.storage.GetActivities()
+	query, err := parseActivityQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	activities, nextCursor, err := h.storage.QueryActivities(query)
+	if err == storage.ErrInvalidCursor {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		fmt.Printf("ERROR: Failed to get activities: %v\n", err)
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if activities == nil {
+		activities = []*models.Activity{}
+	}
+	if nextCursor != "" {
+		w.Header().Set("X-Next-Cursor", nextCursor)
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(activities)
 }
 
-func (h *Handlers) GetHealthMetrics(w http.ResponseWriter, r *http.Request) {
+// maxActivityPageSize caps the limit parameter on /api/activities.
+const maxActivityPageSize = 1000
+
+// parseActivityQuery reads the /api/activities query parameters: type,
+// from, to, min_distance, max_distance (meters), q (name search),
+// sort, order (asc|desc, default desc), limit and cursor.
+func parseActivityQuery(values url.Values) (storage.ActivityQuery, error) {
+	query := storage.ActivityQuery{
+		Type:   values.Get("type"),
+		Search: values.Get("q"),
+		Sort:   values.Get("sort"),
+		Desc:   true,
+		Cursor: values.Get("cursor"),
+	}
+
+	if !storage.ValidSort(query.Sort) {
+		return query, fmt.Errorf("invalid sort %q: use start_time, distance, duration or elevation", query.Sort)
+	}
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		query.Desc = false
+	default:
+		return query, fmt.Errorf("invalid order %q: use asc or desc", values.Get("order"))
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(values.Get("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from: %v", err)
+	}
+	if query.To, err = parseTimeParam(values.Get("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to: %v", err)
+	}
+
+	if value := values.Get("min_distance"); value != "" {
+		if query.MinDistance, err = strconv.ParseFloat(value, 64); err != nil || query.MinDistance < 0 {
+			return query, fmt.Errorf("invalid min_distance %q", value)
+		}
+	}
+	if value := values.Get("max_distance"); value != "" {
+		if query.MaxDistance, err = strconv.ParseFloat(value, 64); err != nil || query.MaxDistance < 0 {
+			return query, fmt.Errorf("invalid max_distance %q", value)
+		}
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+		if query.Limit > maxActivityPageSize {
+			query.Limit = maxActivityPageSize
+		}
+	}
+
+	return query, nil
+}
+
+// parseTimeParam accepts RFC 3339 timestamps or plain YYYY-MM-DD dates. A
+// date used as the end of a range covers that whole day.
+func parseTimeParam(value string, endOfRange bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a date (YYYY-MM-DD) or RFC 3339 time", value)
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// Activity handles /api/activities/{id}: GET returns the activity, PATCH
+// edits it and DELETE removes it along with its track and raw upload.
+func (h *Handlers) Activity(w http.ResponseWriter, r *http.Request) {
+	activityID := strings.TrimPrefix(r.URL.Path, "/api/activities/")
+	if id, ok := strings.CutSuffix(activityID, "/splits"); ok && id != "" && !strings.Contains(id, "/") {
+		h.activitySplits(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(activityID, "/laps"); ok && id != "" && !strings.Contains(id, "/") {
+		h.activityLaps(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(activityID, "/export"); ok && id != "" && !strings.Contains(id, "/") {
+		h.exportActivity(w, r, id)
+		return
+	}
+	if id, ok := strings.CutSuffix(activityID, "/zones"); ok && id != "" && !strings.Contains(id, "/") {
+		h.activityZones(w, r, id)
+		return
+	}
+	if activityID == "" || strings.Contains(activityID, "/") {
+		http.Error(w, "Activity ID required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		activity, err := h.storage.GetActivity(activityID)
+		if err == storage.ErrNotFound {
+			http.Error(w, "Activity not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(activity)
+
+	case http.MethodPatch:
+		h.updateActivity(w, r, activityID)
+
+	case http.MethodDelete:
+		if err := h.storage.DeleteActivity(activityID); err != nil {
+			if err == storage.ErrNotFound {
+				http.Error(w, "Activity not found", http.StatusNotFound)
+				return
+			}
+			fmt.Printf("ERROR: Failed to delete activity %s: %v\n", activityID, err)
+			http.Error(w, "Error deleting activity", http.StatusInternalServerError)
+			return
+		}
+
+		// HTMX requests come from the detail page, which no longer exists
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Redirect", "/activities")
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// activitySplits serves an activity's per-kilometer splits, or per-mile
+// splits with ?units=imperial. Without the parameter the units cookie decides.
+func (h *Handlers) activitySplits(w http.ResponseWriter, r *http.Request, activityID string) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	metrics, err := h.storage.GetHealthMetrics()
+	useImperial := false
+	switch r.URL.Query().Get("units") {
+	case "imperial":
+		useImperial = true
+	case "metric":
+	case "":
+		if cookie, err := r.Cookie("units"); err == nil && cookie.Value == "imperial" {
+			useImperial = true
+		}
+	default:
+		http.Error(w, "units must be metric or imperial", http.StatusBadRequest)
+		return
+	}
+
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	response := struct {
+		ActivityID string         `json:"activity_id"`
+		Unit       string         `json:"unit"`
+		Splits     []models.Split `json:"splits"`
+	}{
+		ActivityID: activity.ID,
+		Unit:       "km",
+		Splits:     activity.KilometerSplits,
+	}
+	if useImperial {
+		response.Unit = "mi"
+		response.Splits = activity.MileSplits
+	}
+	if response.Splits == nil {
+		response.Splits = []models.Split{}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(metrics)
+	json.NewEncoder(w).Encode(response)
 }
 
-func (h *Handlers) UploadGPX(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// hrZones is the heart rate zone setting of a request, with the heart rates
+// that were filled in from the data. Zones is nil, and Error says why, when
+// the zones cannot be set up.
+type hrZones struct {
+	zones.Config
+	Zones            []zones.Zone
+	EstimatedMaxHR   bool // MaxHR is the highest heart rate of any activity
+	RestingHRFromLog bool // RestingHR is the latest uploaded resting heart rate
+	Error            string
+}
+
+// heartRateZones reads the zone setting from the method, max_hr, lthr and
+// resting_hr query values, or without any from the hr_zones cookie set on
+// the stats page. Without a max_hr the highest heart rate of activities is used (all
+// activities when nil), and without a resting_hr the latest one uploaded.
+// Only a malformed setting is an error.
+func (h *Handlers) heartRateZones(r *http.Request, activities []*models.Activity) (hrZones, error) {
+	values := r.URL.Query()
+	if values.Get("method") == "" && values.Get("max_hr") == "" && values.Get("lthr") == "" && values.Get("resting_hr") == "" {
+		values = url.Values{}
+		if cookie, err := r.Cookie("hr_zones"); err == nil {
+			if value, err := url.QueryUnescape(cookie.Value); err == nil {
+				values, _ = url.ParseQuery(value)
+			}
+		}
+	}
+	config, err := zones.ParseConfig(values)
+	if err != nil {
+		return hrZones{}, err
+	}
+	result := hrZones{Config: config}
+
+	if config.Method != zones.MethodLTHR && config.MaxHR == 0 {
+		if activities == nil {
+			if activities, err = h.storage.GetActivities(); err != nil {
+				return hrZones{}, err
+			}
+		}
+		result.MaxHR = zones.EstimateMaxHR(activities)
+		result.EstimatedMaxHR = result.MaxHR > 0
+	}
+	if config.Method == zones.MethodReserve && config.RestingHR == 0 {
+		days, err := h.storage.GetHeartRateData()
+		if err != nil {
+			return hrZones{}, err
+		}
+		if len(days) > 0 {
+			result.RestingHR = days[len(days)-1].RestingHR
+			result.RestingHRFromLog = true
+		}
+	}
+
+	if err := result.Validate(); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Zones = result.Config.Zones()
+	}
+	return result, nil
+}
+
+// zoneColors are the Tailwind colors of zones 1 to 5, and zoneChartColors
+// the same colors for Chart.js.
+var (
+	zoneColors      = []string{"gray", "blue", "green", "orange", "red"}
+	zoneChartColors = []string{"rgba(107, 114, 128, 0.8)", "rgba(59, 130, 246, 0.8)", "rgba(16, 185, 129, 0.8)", "rgba(249, 115, 22, 0.8)", "rgba(239, 68, 68, 0.8)"}
+)
+
+func zoneColor(index int) string {
+	return zoneColors[(index-1)%len(zoneColors)]
+}
+
+// zoneSettingNote describes how the zones were set, e.g. "% of max HR 186
+// bpm (highest recorded)".
+func zoneSettingNote(setting hrZones) string {
+	switch setting.Method {
+	case zones.MethodLTHR:
+		return fmt.Sprintf("%% of LTHR %d bpm", setting.LTHR)
+	case zones.MethodReserve:
+		note := fmt.Sprintf("%% of HR reserve %d–%d bpm", setting.RestingHR, setting.MaxHR)
+		if setting.EstimatedMaxHR || setting.RestingHRFromLog {
+			note += " (from your data)"
+		}
+		return note
+	}
+	note := fmt.Sprintf("%% of max HR %d bpm", setting.MaxHR)
+	if setting.EstimatedMaxHR {
+		note += " (highest recorded)"
+	}
+	return note
+}
+
+// zoneTime is the time an activity spent in one heart rate zone.
+type zoneTime struct {
+	zones.Zone
+	Seconds int     `json:"seconds"`
+	Percent float64 `json:"percent"` // of the time with heart rate data
+}
+
+// activityZoneTimes returns the time an activity spent in each zone, from
+// its stored time at each heart rate. Activities imported before that was
+// stored have their track read instead, even without a MaxHeartRate. It
+// returns nil for activities without heart rate data.
+func (h *Handlers) activityZoneTimes(activity *models.Activity, hrZones []zones.Zone) ([]zoneTime, error) {
+	if hrZones == nil {
+		return nil, nil
+	}
+	var seconds []int
+	if activity.HeartRateTime != nil {
+		seconds = zones.SumZones(hrZones, activity.HeartRateTime)
+	} else {
+		track, err := h.storage.GetGPXTrack(activity.ID)
+		if err == storage.ErrNotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		seconds = zones.TimeInZones(hrZones, track.Points)
+	}
+
+	total := 0
+	for _, s := range seconds {
+		total += s
+	}
+	if total == 0 {
+		return nil, nil
+	}
+	times := make([]zoneTime, len(hrZones))
+	for i, zone := range hrZones {
+		times[i] = zoneTime{Zone: zone, Seconds: seconds[i], Percent: float64(seconds[i]) * 100 / float64(total)}
+	}
+	return times, nil
+}
+
+// activityZones serves the time an activity spent in each heart rate zone.
+// The zones are set as for heartRateZones; the response has no zones when
+// the activity has no heart rate data.
+func (h *Handlers) activityZones(w http.ResponseWriter, r *http.Request, activityID string) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	file, header, err := r.FormFile("gpx")
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		fmt.Printf("ERROR: Failed to read GPX file: %v\n", err)
-		http.Error(w, "Error reading file", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
 
-	data, err := ioutil.ReadAll(file)
+	setting, err := h.heartRateZones(r, nil)
 	if err != nil {
-		http.Error(w, "Error reading file data", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if setting.Error != "" {
+		http.Error(w, "Heart rate zones are not set: "+setting.Error, http.StatusBadRequest)
+		return
+	}
+	times, err := h.activityZoneTimes(activity, setting.Zones)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if times == nil {
+		times = []zoneTime{}
+	}
 
-	// Save the raw GPX file
-	filename := fmt.Sprintf("gpx_%d_%s", time.Now().UnixNano(), header.Filename)
-	if err := h.storage.SaveFile(filename, data); err != nil {
-		http.Error(w, "Error saving file", http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		ActivityID string       `json:"activity_id"`
+		Config     zones.Config `json:"config"`
+		Zones      []zoneTime   `json:"zones"`
+	}{activity.ID, setting.Config, times})
+}
+
+// manualLapRequest is a lap defined by the user. Start and end are offsets
+// from the activity start as "h:mm:ss", "mm:ss" or seconds.
+type manualLapRequest struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// activityLaps lists an activity's laps (GET), adds a manual lap covering a
+// time range (POST) or removes the manual laps (DELETE). Laps from the file
+// are never changed.
+func (h *Handlers) activityLaps(w http.ResponseWriter, r *http.Request, activityID string) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse GPX and create activity record
-	track, activity, err := gpx.ParseGPX(string(data))
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		fmt.Printf("ERROR: Failed to parse GPX file %s: %v\n", header.Filename, err)
-		http.Error(w, "Error parsing GPX file", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Set additional activity details
-	if activity.Name == "" {
-		activity.Name = strings.TrimSuffix(header.Filename, ".gpx")
+	switch r.Method {
+	case http.MethodPost:
+		var req manualLapRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+				return
+			}
+		} else {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, "Error parsing form", http.StatusBadRequest)
+				return
+			}
+			req.Start = r.PostForm.Get("start")
+			req.End = r.PostForm.Get("end")
+		}
+
+		start, err := parseOffset(req.Start)
+		if err != nil {
+			http.Error(w, "Invalid start: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		end, err := parseOffset(req.End)
+		if err != nil {
+			http.Error(w, "Invalid end: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if end <= start {
+			http.Error(w, "End must be after start", http.StatusBadRequest)
+			return
+		}
+
+		track, err := h.storage.GetGPXTrack(activity.ID)
+		if err == storage.ErrNotFound {
+			http.Error(w, "Activity has no GPS track", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		lap, err := gpx.TimeRangeLap(track.Points, activity.StartTime.Add(start), activity.StartTime.Add(end), h.config)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		activity.Laps = append(activity.Laps, lap)
+
+	case http.MethodDelete:
+		laps := activity.Laps[:0]
+		for _, lap := range activity.Laps {
+			if !lap.Manual {
+				laps = append(laps, lap)
+			}
+		}
+		activity.Laps = laps
 	}
-	activity.GPXFile = filename
 
-	// Save activity first to get the generated ID
-	if err := h.storage.SaveActivity(activity); err != nil {
-		http.Error(w, "Error saving activity", http.StatusInternalServerError)
+	if r.Method != http.MethodGet {
+		activity.Laps = sortLaps(activity.Laps)
+		if err := h.storage.UpdateActivity(activity); err != nil {
+			fmt.Printf("ERROR: Failed to update laps of activity %s: %v\n", activityID, err)
+			http.Error(w, "Error updating activity", http.StatusInternalServerError)
+			return
+		}
+		if r.Header.Get("HX-Request") == "true" {
+			w.Header().Set("HX-Refresh", "true")
+		}
+	}
+
+	laps := activity.Laps
+	if laps == nil {
+		laps = []models.Lap{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(laps)
+}
+
+// sortLaps orders laps by start time and renumbers them from 1.
+func sortLaps(laps []models.Lap) []models.Lap {
+	if len(laps) == 0 {
+		return nil
+	}
+	sort.SliceStable(laps, func(i, j int) bool {
+		return laps[i].StartTime.Before(laps[j].StartTime)
+	})
+	for i := range laps {
+		laps[i].Index = i + 1
+	}
+	return laps
+}
+
+// parseOffset parses a time offset written as "h:mm:ss", "mm:ss" or plain
+// seconds.
+func parseOffset(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, fmt.Errorf("time offset required")
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("%q is not h:mm:ss, mm:ss or seconds", value)
+	}
+
+	var seconds int
+	for _, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not h:mm:ss, mm:ss or seconds", value)
+		}
+		seconds = seconds*60 + n
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// exportActivity serves GET /api/activities/{id}/export?format=gpx|tcx|geojson|kml
+// as a file download built from the stored track.
+func (h *Handlers) exportActivity(w http.ResponseWriter, r *http.Request, activityID string) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Use the same ID for the GPX track so we can link them
-	track.ID = activity.ID
-	if err := h.storage.SaveGPXTrack(track); err != nil {
-		http.Error(w, "Error saving GPX track", http.StatusInternalServerError)
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(`<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ GPX uploaded successfully!</div>`))
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	track, err := h.activityTrack(activityID)
+	if err != nil {
+		http.Error(w, "Error loading GPS track", http.StatusInternalServerError)
+		return
+	}
+
+	var buf bytes.Buffer
+	err = export.Write(&buf, format, activity, track)
+	if err == export.ErrNoTimestamps {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Printf("ERROR: Failed to export activity %s as %s: %v\n", activityID, format, err)
+		http.Error(w, "Error exporting activity", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", export.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, export.Filename(activity, format)))
+	w.Write(buf.Bytes())
 }
 
-func (h *Handlers) UploadHealthData(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+// activityTrack loads an activity's track, or nil for activities recorded
+// without GPS.
+func (h *Handlers) activityTrack(activityID string) (*models.GPXTrack, error) {
+	track, err := h.storage.GetGPXTrack(activityID)
+	if err == storage.ErrNotFound {
+		return nil, nil
+	}
+	return track, err
+}
+
+// ExportAccount streams a ZIP of every activity in the requested format
+// (?format=gpx by default) with an activities.csv summary.
+func (h *Handlers) ExportAccount(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	file, _, err := r.FormFile("health")
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
 	if err != nil {
-		http.Error(w, "Error reading file", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	activities, err := h.storage.GetActivities()
+	if err != nil {
+		http.Error(w, "Error getting activities", http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
 
-	data, err := ioutil.ReadAll(file)
-	if err != nil {
-		http.Error(w, "Error reading file data", http.StatusInternalServerError)
-		return
+	filename := fmt.Sprintf("health-hub-export-%s.zip", time.Now().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := export.WriteArchive(w, format, activities, h.activityTrack); err != nil {
+		// The response has started, so the client sees a truncated archive
+		fmt.Printf("ERROR: Failed to export account: %v\n", err)
+	}
+}
+
+// activityPatch lists the activity fields that can be edited. Nil fields are
+// left unchanged.
+type activityPatch struct {
+	Name     *string `json:"name"`
+	Type     *string `json:"type"`
+	Calories *int    `json:"calories"`
+}
+
+// isActivityType reports whether activityType is one of gpx.ActivityTypes.
+func isActivityType(activityType string) bool {
+	for _, t := range gpx.ActivityTypes {
+		if t == activityType {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handlers) updateActivity(w http.ResponseWriter, r *http.Request, activityID string) {
+	var patch activityPatch
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+			return
+		}
+	} else {
+		// Form submissions from the activity-detail page
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Error parsing form", http.StatusBadRequest)
+			return
+		}
+		if _, ok := r.PostForm["name"]; ok {
+			name := r.PostForm.Get("name")
+			patch.Name = &name
+		}
+		if _, ok := r.PostForm["type"]; ok {
+			activityType := r.PostForm.Get("type")
+			patch.Type = &activityType
+		}
+		if value := r.PostForm.Get("calories"); value != "" {
+			calories, err := strconv.Atoi(value)
+			if err != nil {
+				http.Error(w, "Invalid calories value", http.StatusBadRequest)
+				return
+			}
+			patch.Calories = &calories
+		}
+	}
+
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			http.Error(w, "Name cannot be empty", http.StatusBadRequest)
+			return
+		}
+		activity.Name = name
+	}
+	if patch.Type != nil {
+		activityType := gpx.NormalizeActivityType(*patch.Type)
+		if activityType == "" {
+			http.Error(w, "Type cannot be empty", http.StatusBadRequest)
+			return
+		}
+		// An imported custom type may be kept, but not newly chosen
+		if activityType != activity.Type && !isActivityType(activityType) {
+			http.Error(w, fmt.Sprintf("Unknown activity type %q", *patch.Type), http.StatusBadRequest)
+			return
+		}
+		// A type chosen by the user is final; detection never overrides it
+		activity.Type = activityType
+		activity.TypeSource = models.TypeSourceUser
+		activity.TypeConfidence = 1
+	}
+	if patch.Calories != nil {
+		if *patch.Calories < 0 {
+			http.Error(w, "Calories cannot be negative", http.StatusBadRequest)
+			return
+		}
+		activity.Calories = *patch.Calories
+	}
+
+	if err := h.storage.UpdateActivity(activity); err != nil {
+		fmt.Printf("ERROR: Failed to update activity %s: %v\n", activityID, err)
+		http.Error(w, "Error updating activity", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("HX-Refresh", "true")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(activity)
+}
+
+func (h *Handlers) GetHealthMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values := r.URL.Query()
+	query, err := parseHealthMetricQuery(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bucket := values.Get("bucket")
+	if bucket == "" {
+		metrics, err := h.storage.QueryHealthMetrics(query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if metrics == nil {
+			metrics = []*models.HealthMetric{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(metrics)
+		return
+	}
+
+	// Aggregation mode: limit and order apply to the buckets, not the raw metrics
+	agg := values.Get("agg")
+	if agg == "" {
+		agg = health.AggAvg
+	}
+	loc := time.Local
+	if tz := values.Get("tz"); tz != "" {
+		if loc, err = time.LoadLocation(tz); err != nil {
+			http.Error(w, fmt.Sprintf("invalid tz %q", tz), http.StatusBadRequest)
+			return
+		}
+	}
+	limit, desc := query.Limit, query.Desc
+	query.Limit, query.Desc = 0, false
+
+	metrics, err := h.storage.QueryHealthMetrics(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	buckets, err := health.Aggregate(metrics, bucket, agg, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if desc {
+		for i, j := 0, len(buckets)-1; i < j; i, j = i+1, j-1 {
+			buckets[i], buckets[j] = buckets[j], buckets[i]
+		}
+	}
+	if limit > 0 && len(buckets) > limit {
+		buckets = buckets[:limit]
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(buckets)
+}
+
+// parseHealthMetricQuery reads the /api/health filter parameters: type,
+// source, from, to, order (asc|desc, default asc) and limit.
+func parseHealthMetricQuery(values url.Values) (storage.HealthMetricQuery, error) {
+	query := storage.HealthMetricQuery{
+		Type:   values.Get("type"),
+		Source: values.Get("source"),
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(values.Get("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from: %v", err)
+	}
+	if query.To, err = parseTimeParam(values.Get("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to: %v", err)
+	}
+
+	switch values.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Desc = true
+	default:
+		return query, fmt.Errorf("invalid order %q: use asc or desc", values.Get("order"))
+	}
+
+	if value := values.Get("limit"); value != "" {
+		if query.Limit, err = strconv.Atoi(value); err != nil || query.Limit < 1 {
+			return query, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+
+	return query, nil
+}
+
+func (h *Handlers) UploadGPX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, header, err := r.FormFile("gpx")
+	if err != nil {
+		fmt.Printf("ERROR: Failed to read GPX file: %v\n", err)
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Error reading file data", http.StatusInternalServerError)
+		return
+	}
+
+	onDuplicate, err := importer.ParseDuplicateMode(r.FormValue("on_duplicate"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Parse the GPX, FIT or TCX file and create activity record
+	track, activity, err := importer.Parse(data)
+	if err != nil {
+		fmt.Printf("ERROR: Failed to parse activity file %s: %v\n", header.Filename, err)
+		http.Error(w, fmt.Sprintf("Error parsing activity file: %v", err), http.StatusBadRequest)
+		return
+	}
+	activity.FileHash = importer.FileHash(data)
+
+	result := h.saveImport(activity, track, header.Filename, data, BulkUploadResult{FileName: header.Filename}, onDuplicate)
+	switch result.Status {
+	case "error":
+		fmt.Printf("ERROR: Failed to import %s: %s\n", header.Filename, result.Error)
+		http.Error(w, result.Error, http.StatusInternalServerError)
+		return
+	case "duplicate":
+		message := "Already imported"
+		if result.Merged {
+			message = "Merged new data into"
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<div class="p-3 bg-yellow-100 border border-yellow-400 text-yellow-800 rounded">%s: duplicate of <a href="/activity/%s" class="underline">%s</a></div>`,
+			message, url.PathEscape(result.DuplicateID), template.HTMLEscapeString(result.DuplicateOf))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(`<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ Activity uploaded successfully!</div>`))
+}
+
+// UploadHealthData imports health metrics sent as a JSON object or array, a
+// CSV file, or one of the exports recognized by their content. JSON metrics
+// are normalized to their type's canonical unit, and nothing is saved
+// unless every metric is valid.
+func (h *Handlers) UploadHealthData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	file, header, err := r.FormFile("health")
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	// Exports run to gigabytes, so ZIP archives and the Apple Health
+	// export.xml are recognized before reading the upload into memory. The
+	// export.xml DTD comes before its root element.
+	head := make([]byte, 32<<10)
+	n, _ := io.ReadFull(file, head)
+	if head = head[:n]; importer.IsZIP(head) || applehealth.IsExport(head) {
+		h.uploadHealthExport(w, r, file, header)
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Error reading file data", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		http.Error(w, "Error reading file data", http.StatusInternalServerError)
+		return
+	}
+
+	if oura.IsExport(data) {
+		h.uploadOura(w, r, data)
+		return
+	}
+	if isCSV(header.Filename, data) {
+		h.uploadHealthCSV(w, r, data)
+		return
+	}
+
+	var metrics []*models.HealthMetric
+	if isJSONArray(data) {
+		err = json.Unmarshal(data, &metrics)
+	} else {
+		var metric models.HealthMetric
+		err = json.Unmarshal(data, &metric)
+		metrics = []*models.HealthMetric{&metric}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var invalid []invalidRecord
+	for i, metric := range metrics {
+		if metric == nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: "null"})
+		} else if err := health.NormalizeMetric(metric); err != nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		rejectUpload(w, r, "metric", invalid)
+		return
+	}
+
+	for _, metric := range metrics {
+		if err := h.storage.SaveHealthMetric(metric); err != nil {
+			http.Error(w, "Error saving health metric", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeUploaded(w, r, fmt.Sprintf("Uploaded %d health metrics!", len(metrics)), metrics)
+}
+
+// isCSV reports whether an uploaded health data file is CSV rather than
+// JSON, going by its extension or else its first character.
+func isCSV(filename string, data []byte) bool {
+	if strings.EqualFold(path.Ext(filename), ".csv") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(data)
+	return len(trimmed) > 0 && trimmed[0] != '[' && trimmed[0] != '{'
+}
+
+// healthCSVFields are the form fields naming the CSV column of each health
+// metric field, and the fields giving a value for rows without one.
+var healthCSVFields = []struct {
+	label, column, fallback string
+	get                     func(m *health.CSVMapping) (column, fallback *string)
+}{
+	{"Timestamp", "timestamp_column", "", func(m *health.CSVMapping) (*string, *string) { return &m.Timestamp, nil }},
+	{"Type", "type_column", "type", func(m *health.CSVMapping) (*string, *string) { return &m.Type, &m.DefaultType }},
+	{"Value", "value_column", "", func(m *health.CSVMapping) (*string, *string) { return &m.Value, nil }},
+	{"Unit", "unit_column", "unit", func(m *health.CSVMapping) (*string, *string) { return &m.Unit, &m.DefaultUnit }},
+	{"Source", "source_column", "source", func(m *health.CSVMapping) (*string, *string) { return &m.Source, &m.DefaultSource }},
+}
+
+// uploadHealthCSV imports a CSV file of health metrics. The columns are
+// mapped by the healthCSVFields form fields and timestamp_format; fields
+// that are not sent are guessed from the header. Timestamps without a time
+// zone are read in tz (default: server local time). Uploads from the home
+// page first get a mapping step showing the guess, which sends every field
+// back with mapped=1.
+func (h *Handlers) uploadHealthCSV(w http.ResponseWriter, r *http.Request, data []byte) {
+	table, err := health.ReadCSV(data)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mapping := health.GuessMapping(table.Header)
+	for _, field := range healthCSVFields {
+		column, fallback := field.get(&mapping)
+		if values, ok := r.MultipartForm.Value[field.column]; ok {
+			*column = strings.TrimSpace(values[0])
+		}
+		if values, ok := r.MultipartForm.Value[field.fallback]; ok && fallback != nil {
+			*fallback = strings.TrimSpace(values[0])
+		}
+	}
+	mapping.TimestampFormat = r.FormValue("timestamp_format")
+
+	if r.Header.Get("HX-Request") == "true" && r.FormValue("mapped") == "" {
+		h.renderHealthCSVMapping(w, table, mapping)
+		return
+	}
+
+	loc, err := uploadLocation(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	metrics, errs := table.Metrics(mapping, loc)
+	if len(errs) > 0 {
+		http.Error(w, rejectedUpload(errs), http.StatusBadRequest)
+		return
+	}
+
+	for _, metric := range metrics {
+		if err := h.storage.SaveHealthMetric(&metric); err != nil {
+			http.Error(w, "Error saving health metric", http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Printf("INFO: Imported %d health metrics from CSV\n", len(metrics))
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(fmt.Sprintf(`<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ Uploaded %d health metrics!</div>`, len(metrics))))
+}
+
+// uploadLocation returns the time zone of an upload's dates that have none:
+// the tz form value, or server local time.
+func uploadLocation(r *http.Request) (*time.Location, error) {
+	tz := r.FormValue("tz")
+	if tz == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tz %q", tz)
+	}
+	return loc, nil
+}
+
+// uploadOura imports an Oura JSON or CSV export. Its records have IDs
+// derived from their day, so importing an overlapping export again updates
+// the days instead of adding them twice.
+func (h *Handlers) uploadOura(w http.ResponseWriter, r *http.Request, data []byte) {
+	loc, err := uploadLocation(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	export, err := oura.Parse(data, loc)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Error reading Oura export: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	result := HealthImportResult{Status: "success", Skipped: export.Skipped}
+	if err := h.saveHealthRecords(export.Sleep, export.HeartRate, export.Metrics, &result); err != nil {
+		fmt.Printf("ERROR: Oura import failed: %v\n", err)
+		http.Error(w, "Error saving Oura data", http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("INFO: Imported Oura export: %d nights, %d days of heart rate, %d metrics (%d days skipped)\n",
+		result.Sleep, result.HeartRate, result.Metrics, result.Skipped)
+
+	writeUploaded(w, r, fmt.Sprintf("Imported %d nights of sleep, %d days of heart rate data and %d health metrics from Oura!",
+		result.Sleep, result.HeartRate, result.Metrics), result)
+}
+
+// invalidRecord is a record of a JSON upload that failed validation.
+type invalidRecord struct {
+	Index int    `json:"index"` // position in the upload, from 0
+	Error string `json:"error"`
+}
+
+// rejectUpload responds to a JSON upload that was rejected because some of
+// its records are invalid: with every invalid record as JSON, or a summary
+// for the pages that names records as noun and counts them from 1.
+func rejectUpload(w http.ResponseWriter, r *http.Request, noun string, invalid []invalidRecord) {
+	if r.Header.Get("HX-Request") == "true" {
+		errs := make([]error, len(invalid))
+		for i, record := range invalid {
+			errs[i] = fmt.Errorf("%s %d: %s", noun, record.Index+1, record.Error)
+		}
+		http.Error(w, rejectedUpload(errs), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{"errors": invalid})
+}
+
+// rejectedUpload is the message for an upload that was rejected because
+// some of its records are invalid. It lists the first ten errors.
+func rejectedUpload(errs []error) string {
+	messages := make([]string, 0, len(errs))
+	for i, err := range errs {
+		if i == 10 {
+			messages = append(messages, fmt.Sprintf("...and %d more errors", len(errs)-i))
+			break
+		}
+		messages = append(messages, err.Error())
+	}
+	return "Nothing was imported:\n" + strings.Join(messages, "\n")
+}
+
+// renderHealthCSVMapping renders the mapping step of a CSV upload: a preview
+// of the file and a column choice per field. Its inputs belong to the upload
+// form on the home page, so the file is sent again along with them.
+func (h *Handlers) renderHealthCSVMapping(w http.ResponseWriter, table *health.CSVTable, mapping health.CSVMapping) {
+	type field struct {
+		Label, Name, Column, FallbackName, Fallback string
+	}
+	var fields []field
+	for _, f := range healthCSVFields {
+		column, fallback := f.get(&mapping)
+		entry := field{Label: f.label, Name: f.column, Column: *column, FallbackName: f.fallback}
+		if fallback != nil {
+			entry.Fallback = *fallback
+		}
+		fields = append(fields, entry)
+	}
+	preview := table.Rows
+	if len(preview) > 5 {
+		preview = preview[:5]
+	}
+
+	tmpl := template.Must(template.New("health-csv-mapping").Parse(`
+	<div class="p-4 bg-gray-50 border border-gray-300 rounded">
+		<p class="font-semibold text-gray-900 mb-1">Map the CSV columns</p>
+		<p class="text-sm text-gray-600 mb-3">{{len .Table.Rows}} rows. Choose the column holding each field, or enter a value used for every row.</p>
+		<div class="overflow-x-auto mb-3">
+			<table class="min-w-full text-xs text-left">
+				<thead><tr>{{range .Table.Header}}<th class="px-2 py-1 bg-gray-200 font-semibold">{{.}}</th>{{end}}</tr></thead>
+				<tbody>
+					{{range .Preview}}<tr>{{range .}}<td class="px-2 py-1 border-t border-gray-200">{{.}}</td>{{end}}</tr>{{end}}
+				</tbody>
+			</table>
+		</div>
+		{{$header := .Table.Header}}
+		{{range .Fields}}
+		<div class="flex items-center gap-2 mb-2">
+			<label class="w-24 text-sm font-medium text-gray-700">{{.Label}}</label>
+			<select name="{{.Name}}" form="health-upload" class="flex-1 border border-gray-300 rounded px-2 py-1 text-sm">
+				<option value="">(none)</option>
+				{{$column := .Column}}
+				{{range $header}}<option value="{{.}}"{{if eq . $column}} selected{{end}}>{{.}}</option>{{end}}
+			</select>
+			{{if .FallbackName}}
+			<input type="text" name="{{.FallbackName}}" value="{{.Fallback}}" form="health-upload" placeholder="or every row"
+			       class="w-32 border border-gray-300 rounded px-2 py-1 text-sm">
+			{{end}}
+		</div>
+		{{end}}
+		<div class="flex items-center gap-2 mb-3">
+			<label class="w-24 text-sm font-medium text-gray-700">Format</label>
+			<input type="text" name="timestamp_format" value="{{.Mapping.TimestampFormat}}" form="health-upload" placeholder="automatic, or a Go layout like 02/01/2006"
+			       class="flex-1 border border-gray-300 rounded px-2 py-1 text-sm">
+		</div>
+		<input type="hidden" name="mapped" value="1" form="health-upload">
+		<button type="submit" form="health-upload" class="w-full bg-green-500 hover:bg-green-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+			Import {{len .Table.Rows}} Rows
+		</button>
+	</div>`))
+
+	w.Header().Set("Content-Type", "text/html")
+	err := tmpl.Execute(w, map[string]interface{}{
+		"Table":   table,
+		"Preview": preview,
+		"Fields":  fields,
+		"Mapping": mapping,
+	})
+	if err != nil {
+		fmt.Printf("ERROR: Failed to render CSV mapping: %v\n", err)
+	}
+}
+
+// ExportHealthCSV handles /api/health/export.csv, which downloads the health
+// metrics matching the /api/health filters as CSV.
+func (h *Handlers) ExportHealthCSV(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query, err := parseHealthMetricQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metrics, err := h.storage.QueryHealthMetrics(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filename := "health-metrics.csv"
+	if query.Type != "" {
+		filename = "health-metrics-" + health.NormalizeType(query.Type) + ".csv"
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	if err := health.WriteCSV(w, metrics); err != nil {
+		fmt.Printf("ERROR: Failed to export health metrics: %v\n", err)
+	}
+}
+
+// HealthImportResult is the outcome of importing a health data export.
+type HealthImportResult struct {
+	Status     string `json:"status"` // "success" or "error"
+	Error      string `json:"error,omitempty"`
+	Metrics    int    `json:"metrics"`
+	Sleep      int    `json:"sleep"`      // nights of sleep
+	HeartRate  int    `json:"heart_rate"` // days of resting heart rate and HRV
+	Activities int    `json:"activities"` // workouts saved as activities
+	Duplicates int    `json:"duplicates"` // workouts imported before
+	Skipped    int    `json:"skipped"`    // records that are not imported
+}
+
+// uploadHealthExport imports an exported archive of health data as a
+// background job: an Apple Health export.zip or export.xml, a Fitbit export
+// or a Google Takeout archive with Fit or Fitbit data. The upload is copied
+// to a temporary file first, as the request's copy is removed when the
+// handler returns. Uploads from the home page get a status message that
+// follows the job; API clients get the job, like bulk uploads.
+func (h *Handlers) uploadHealthExport(w http.ResponseWriter, r *http.Request, file multipart.File, header *multipart.FileHeader) {
+	loc, err := uploadLocation(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	weightUnit := r.FormValue("weight_unit")
+	if weightUnit == "" {
+		weightUnit = "kg"
+	} else if weightUnit != "kg" && weightUnit != "lb" {
+		http.Error(w, fmt.Sprintf("invalid weight_unit %q (expected kg or lb)", weightUnit), http.StatusBadRequest)
+		return
+	}
+
+	tmp, err := os.CreateTemp("", "health-export-*")
+	if err != nil {
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err == nil {
+		_, err = io.Copy(tmp, file)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		fmt.Printf("ERROR: Failed to save health export upload: %v\n", err)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	job := h.jobs.Submit("health-export", []jobs.Task{{
+		Name: header.Filename,
+		Run: func() interface{} {
+			defer os.Remove(tmp.Name())
+			defer tmp.Close()
+			return h.importHealthExport(tmp, header.Size, loc, weightUnit)
+		},
+	}})
+	fmt.Printf("INFO: Queued health export import job %s for %s\n", job.ID, header.Filename)
+
+	if r.Header.Get("HX-Request") != "true" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/api/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+
+	tmpl := template.Must(template.New("health-export-job").Parse(`
+	<div id="health-job-{{.}}" class="p-3 bg-blue-100 border border-blue-400 text-blue-700 rounded">
+		Importing the export in the background. Large exports take several minutes; you can leave this page.
+	</div>
+	<script>
+		(function() {
+			const status = document.getElementById('health-job-{{.}}');
+			const events = new EventSource('/api/jobs/' + encodeURIComponent('{{.}}') + '/events');
+			events.addEventListener('done', (e) => {
+				events.close();
+				const result = JSON.parse(e.data).tasks[0].result;
+				if (result.status !== 'success') {
+					status.className = 'p-3 bg-red-100 border border-red-400 text-red-700 rounded';
+					status.textContent = 'Import failed: ' + result.error;
+					return;
+				}
+				let message = '✓ Imported ' + result.metrics + ' health metrics, ' + result.sleep + ' nights of sleep and ' +
+					result.heart_rate + ' days of heart rate data';
+				if (result.activities || result.duplicates) {
+					message += ', and ' + result.activities + ' workouts (' + result.duplicates + ' workouts were already imported)';
+				}
+				status.className = 'p-3 bg-green-100 border border-green-400 text-green-700 rounded';
+				status.textContent = message + '.';
+			});
+		})();
+	</script>`))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, job.ID)
+}
+
+// importHealthExport imports an uploaded health export, going by what the
+// archive holds. A Takeout archive can have both Fitbit and Google Fit data,
+// which are imported side by side as they have different sources. Anything
+// else is read as an Apple Health export.
+func (h *Handlers) importHealthExport(file *os.File, size int64, loc *time.Location, weightUnit string) HealthImportResult {
+	head := make([]byte, 4)
+	n, _ := file.ReadAt(head, 0)
+	if !importer.IsZIP(head[:n]) {
+		return h.importAppleHealth(file, size)
+	}
+	archive, err := zip.NewReader(file, size)
+	if err != nil {
+		return HealthImportResult{Status: "error", Error: fmt.Sprintf("reading ZIP archive: %v", err)}
+	}
+	isFitbit, isGoogleFit := fitbit.IsExport(archive), googlefit.IsExport(archive)
+	if !isFitbit && !isGoogleFit {
+		return h.importAppleHealth(file, size)
+	}
+
+	result := HealthImportResult{Status: "success"}
+	if isFitbit {
+		export, err := fitbit.ParseArchive(archive, loc, weightUnit)
+		if err == nil {
+			result.Skipped += export.Skipped
+			err = h.saveHealthRecords(export.Sleep, export.HeartRate, export.Metrics, &result)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Fitbit import failed: %v\n", err)
+			return HealthImportResult{Status: "error", Error: fmt.Sprintf("Fitbit export: %v", err)}
+		}
+	}
+	if isGoogleFit {
+		export, err := googlefit.ParseArchive(archive, loc)
+		if err == nil {
+			result.Skipped += export.Skipped
+			err = h.saveHealthRecords(export.Sleep, nil, export.Metrics, &result)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Google Fit import failed: %v\n", err)
+			return HealthImportResult{Status: "error", Error: fmt.Sprintf("Google Fit export: %v", err)}
+		}
+	}
+
+	fmt.Printf("INFO: Imported health export: %d metrics, %d nights, %d days of heart rate (%d records skipped)\n",
+		result.Metrics, result.Sleep, result.HeartRate, result.Skipped)
+	return result
+}
+
+// saveHealthRecords saves the records of an imported export, counting them
+// in result. Metrics that NormalizeMetric rejects, such as a glitch reading
+// of the tracker, are skipped rather than failing the import.
+func (h *Handlers) saveHealthRecords(nights []*models.SleepData, days []*models.HeartRateData, metrics []*models.HealthMetric, result *HealthImportResult) error {
+	for _, sleep := range nights {
+		if err := h.storage.SaveSleepData(sleep); err != nil {
+			return fmt.Errorf("saving sleep: %v", err)
+		}
+		result.Sleep++
+	}
+	for _, hr := range days {
+		if err := h.storage.SaveHeartRateData(hr); err != nil {
+			return fmt.Errorf("saving heart rate: %v", err)
+		}
+		result.HeartRate++
+	}
+	for _, metric := range metrics {
+		if health.NormalizeMetric(metric) != nil {
+			result.Skipped++
+			continue
+		}
+		if err := h.storage.SaveHealthMetric(metric); err != nil {
+			return fmt.Errorf("saving health metric: %v", err)
+		}
+		result.Metrics++
+	}
+	return nil
+}
+
+// importAppleHealth imports the metrics, sleep and workouts of an Apple
+// Health export. Metrics and nights have IDs derived from the export, so a
+// newer export of the same data replaces them; workouts go through the
+// duplicate check like uploaded activity files.
+func (h *Handlers) importAppleHealth(file *os.File, size int64) HealthImportResult {
+	var result HealthImportResult
+	invalid := 0 // metrics rejected by NormalizeMetric
+	handler := applehealth.Handler{
+		Metric: func(metric *models.HealthMetric) error {
+			if health.NormalizeMetric(metric) != nil {
+				invalid++
+				return nil
+			}
+			if err := h.storage.SaveHealthMetric(metric); err != nil {
+				return fmt.Errorf("saving health metric: %v", err)
+			}
+			result.Metrics++
+			return nil
+		},
+		Sleep: func(sleep *models.SleepData) error {
+			if err := h.storage.SaveSleepData(sleep); err != nil {
+				return fmt.Errorf("saving sleep: %v", err)
+			}
+			result.Sleep++
+			return nil
+		},
+		Workout: func(workout *applehealth.Workout) error {
+			saved := h.importWorkout(workout)
+			switch saved.Status {
+			case "success":
+				result.Activities++
+			case "duplicate":
+				result.Duplicates++
+			default:
+				return fmt.Errorf("saving workout of %s: %s", workout.Activity.StartTime.Format("2006-01-02 15:04"), saved.Error)
+			}
+			return nil
+		},
+	}
+
+	head := make([]byte, 4)
+	n, _ := file.ReadAt(head, 0)
+	var summary applehealth.Summary
+	var err error
+	if importer.IsZIP(head[:n]) {
+		summary, err = applehealth.ParseArchive(file, size, handler)
+	} else {
+		summary, err = applehealth.Parse(io.NewSectionReader(file, 0, size), handler)
+	}
+	result.Skipped = summary.Skipped + invalid
+	if err != nil {
+		fmt.Printf("ERROR: Apple Health import failed: %v\n", err)
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	fmt.Printf("INFO: Imported Apple Health export: %d metrics, %d nights, %d workouts (%d duplicates)\n",
+		result.Metrics, result.Sleep, result.Activities, result.Duplicates)
+	result.Status = "success"
+	return result
+}
+
+// importWorkout saves an Apple Health workout as an activity. The track comes
+// from the workout's route; workouts without one, or whose route cannot be
+// read, are saved from the workout's totals with an empty track.
+func (h *Handlers) importWorkout(workout *applehealth.Workout) BulkUploadResult {
+	activity, track := workout.Activity, &models.GPXTrack{}
+	var data []byte
+	if workout.Route != nil {
+		routeTrack, routeActivity, err := importer.Parse(workout.Route)
+		if err == nil {
+			workout.Apply(routeActivity)
+			activity, track, data = routeActivity, routeTrack, workout.Route
+			activity.FileHash = importer.FileHash(data)
+		} else {
+			fmt.Printf("ERROR: Failed to parse workout route %s: %v\n", workout.RouteName, err)
+		}
+	}
+	return h.saveImport(activity, track, workout.RouteName, data, BulkUploadResult{FileName: workout.RouteName}, importer.DuplicateSkip)
+}
+
+// readJSONUpload reads the body of a JSON upload: the form file named
+// field, or the request body itself when it is sent as application/json.
+func readJSONUpload(r *http.Request, field string) ([]byte, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		return ioutil.ReadAll(r.Body)
+	}
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ioutil.ReadAll(file)
+}
+
+// isJSONArray reports whether a JSON upload holds a list of records rather
+// than a single one.
+func isJSONArray(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), "[")
+}
+
+// writeUploaded responds to an upload that saved records: a status message
+// for the pages, or the saved records as JSON.
+func writeUploaded(w http.ResponseWriter, r *http.Request, message string, saved interface{}) {
+	if r.Header.Get("HX-Request") == "true" {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ %s</div>`, template.HTMLEscapeString(message))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(saved)
+}
+
+// UploadSleepData saves nights of sleep sent as a JSON object or array,
+// either as the "sleep" form file or as the request body. Nothing is saved
+// unless every night is valid. Nights without an ID replace the source's
+// earlier upload for the same date.
+func (h *Handlers) UploadSleepData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := readJSONUpload(r, "sleep")
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+
+	var nights []*models.SleepData
+	if isJSONArray(data) {
+		err = json.Unmarshal(data, &nights)
+	} else {
+		var sleep models.SleepData
+		err = json.Unmarshal(data, &sleep)
+		nights = []*models.SleepData{&sleep}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var invalid []invalidRecord
+	for i, sleep := range nights {
+		if sleep == nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: "null"})
+		} else if err := health.ValidateSleep(sleep); err != nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		rejectUpload(w, r, "night", invalid)
+		return
+	}
+
+	for _, sleep := range nights {
+		if sleep.ID == "" {
+			sleep.ID = health.DailyID("sleep", sleep.Source, sleep.Date)
+		}
+		if err := h.storage.SaveSleepData(sleep); err != nil {
+			fmt.Printf("ERROR: Failed to save sleep data: %v\n", err)
+			http.Error(w, "Error saving sleep data", http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Printf("INFO: Uploaded %d nights of sleep\n", len(nights))
+
+	writeUploaded(w, r, fmt.Sprintf("Uploaded %d nights of sleep!", len(nights)), nights)
+}
+
+// UploadHeartRateData saves days of resting heart rate and HRV sent as a
+// JSON object or array, either as the "heart_rate" form file or as the
+// request body. Nothing is saved unless every day is valid. Days without an
+// ID replace the source's earlier upload for the same date.
+func (h *Handlers) UploadHeartRateData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := readJSONUpload(r, "heart_rate")
+	if err != nil {
+		http.Error(w, "Error reading file", http.StatusBadRequest)
+		return
+	}
+
+	var days []*models.HeartRateData
+	if isJSONArray(data) {
+		err = json.Unmarshal(data, &days)
+	} else {
+		var hr models.HeartRateData
+		err = json.Unmarshal(data, &hr)
+		days = []*models.HeartRateData{&hr}
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid JSON format: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	var invalid []invalidRecord
+	for i, hr := range days {
+		if hr == nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: "null"})
+		} else if err := health.ValidateHeartRate(hr); err != nil {
+			invalid = append(invalid, invalidRecord{Index: i, Error: err.Error()})
+		}
+	}
+	if len(invalid) > 0 {
+		rejectUpload(w, r, "day", invalid)
+		return
+	}
+
+	for _, hr := range days {
+		if hr.ID == "" {
+			hr.ID = health.DailyID("hr", hr.Source, hr.Date)
+		}
+		if err := h.storage.SaveHeartRateData(hr); err != nil {
+			fmt.Printf("ERROR: Failed to save heart rate data: %v\n", err)
+			http.Error(w, "Error saving heart rate data", http.StatusInternalServerError)
+			return
+		}
+	}
+	fmt.Printf("INFO: Uploaded %d days of heart rate data\n", len(days))
+
+	writeUploaded(w, r, fmt.Sprintf("Uploaded %d days of heart rate data!", len(days)), days)
+}
+
+// parseDateRange reads the from and to parameters of the sleep and heart
+// rate endpoints. Zero times mean no bound.
+func parseDateRange(values url.Values) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(values.Get("from"), false)
+	if err != nil {
+		return from, time.Time{}, fmt.Errorf("invalid from: %v", err)
+	}
+	to, err := parseTimeParam(values.Get("to"), true)
+	if err != nil {
+		return from, to, fmt.Errorf("invalid to: %v", err)
+	}
+	return from, to, nil
+}
+
+// inDateRange reports whether date lies within from and to, either of which
+// may be zero.
+func inDateRange(date, from, to time.Time) bool {
+	return (from.IsZero() || !date.Before(from)) && (to.IsZero() || date.Before(to))
+}
+
+// GetSleepData serves the stored nights of sleep as JSON, oldest first,
+// optionally limited to dates between ?from= and ?to=.
+func (h *Handlers) GetSleepData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseDateRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	nights, err := h.storage.GetSleepData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := []*models.SleepData{}
+	for _, sleep := range nights {
+		if inDateRange(sleep.Date, from, to) {
+			result = append(result, sleep)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetHeartRateData serves the stored days of heart rate data as JSON, oldest
+// first, optionally limited to dates between ?from= and ?to=.
+func (h *Handlers) GetHeartRateData(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	from, to, err := parseDateRange(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	days, err := h.storage.GetHeartRateData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	result := []*models.HeartRateData{}
+	for _, hr := range days {
+		if inDateRange(hr.Date, from, to) {
+			result = append(result, hr)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// sleepRanges are the periods the sleep page can show, in days.
+var sleepRanges = []int{30, 90, 365}
+
+// sleepChart holds one night per point for the sleep page's charts, in
+// hours. Unstaged is sleep the source did not split into stages; nights
+// without a score have a null score.
+type sleepChart struct {
+	Labels   []string  `json:"labels"`
+	Deep     []float64 `json:"deep"`
+	REM      []float64 `json:"rem"`
+	Light    []float64 `json:"light"`
+	Unstaged []float64 `json:"unstaged"`
+	Scores   []*int    `json:"scores"`
+}
+
+// heartRateChart holds one day per point for the resting heart rate and HRV
+// chart. Days without an HRV reading have a null HRV.
+type heartRateChart struct {
+	Labels    []string   `json:"labels"`
+	RestingHR []int      `json:"resting_hr"`
+	HRV       []*float64 `json:"hrv"`
+}
+
+// Sleep renders the sleep page: nightly sleep stages, the sleep score trend
+// and resting heart rate and HRV over the last ?days= (30, 90 or 365).
+func (h *Handlers) Sleep(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := sleepRanges[0]
+	if value := r.URL.Query().Get("days"); value != "" {
+		days = 0
+		for _, d := range sleepRanges {
+			if value == strconv.Itoa(d) {
+				days = d
+			}
+		}
+		if days == 0 {
+			http.Error(w, fmt.Sprintf("invalid days %q: use 30, 90 or 365", value), http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -days)
+
+	allNights, err := h.storage.GetSleepData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	allHeartRate, err := h.storage.GetHeartRateData()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hours := func(minutes int) float64 {
+		return math.Round(float64(minutes)/60*100) / 100
+	}
+
+	var nights []*models.SleepData
+	var sleepData sleepChart
+	totalSleep, totalScore, scored := 0, 0, 0
+	for _, sleep := range allNights {
+		if sleep.Date.Before(since) {
+			continue
+		}
+		nights = append(nights, sleep)
+		totalSleep += sleep.TotalSleep
+
+		sleepData.Labels = append(sleepData.Labels, sleep.Date.Format("Jan 2"))
+		sleepData.Deep = append(sleepData.Deep, hours(sleep.DeepSleep))
+		sleepData.REM = append(sleepData.REM, hours(sleep.REMSleep))
+		sleepData.Light = append(sleepData.Light, hours(sleep.LightSleep))
+		sleepData.Unstaged = append(sleepData.Unstaged, hours(sleep.TotalSleep-sleep.DeepSleep-sleep.REMSleep-sleep.LightSleep))
+		var score *int
+		if sleep.SleepScore > 0 {
+			score = &sleep.SleepScore
+			totalScore += sleep.SleepScore
+			scored++
+		}
+		sleepData.Scores = append(sleepData.Scores, score)
+	}
+
+	var heartData heartRateChart
+	totalRestingHR, totalHRV, withHRV := 0, 0.0, 0
+	for _, hr := range allHeartRate {
+		if hr.Date.Before(since) {
+			continue
+		}
+		totalRestingHR += hr.RestingHR
+
+		heartData.Labels = append(heartData.Labels, hr.Date.Format("Jan 2"))
+		heartData.RestingHR = append(heartData.RestingHR, hr.RestingHR)
+		var hrv *float64
+		if hr.HRVariability > 0 {
+			hrv = &hr.HRVariability
+			totalHRV += hr.HRVariability
+			withHRV++
+		}
+		heartData.HRV = append(heartData.HRV, hrv)
+	}
+
+	// The table lists the most recent nights first
+	recent := make([]*models.SleepData, len(nights))
+	for i, sleep := range nights {
+		recent[len(nights)-1-i] = sleep
 	}
 
-	// Try to parse as array of health metrics
-	var metrics []models.HealthMetric
-	if err := json.Unmarshal(data, &metrics); err != nil {
-		// Try to parse as single metric
-		var metric models.HealthMetric
-		if err := json.Unmarshal(data, &metric); err != nil {
-			http.Error(w, "Invalid JSON format", http.StatusBadRequest)
-			return
-		}
-		metrics = []models.HealthMetric{metric}
+	data := struct {
+		Title          string
+		Days           int
+		Ranges         []int
+		Nights         []*models.SleepData
+		AvgSleep       int     // minutes
+		AvgScore       int     // 0 without scores
+		AvgRestingHR   int     // 0 without heart rate data
+		AvgHRV         float64 // 0 without HRV
+		SleepChart     sleepChart
+		HeartRateChart heartRateChart
+		HasHeartRate   bool
+	}{
+		Title:          "Sleep",
+		Days:           days,
+		Ranges:         sleepRanges,
+		Nights:         recent,
+		SleepChart:     sleepData,
+		HeartRateChart: heartData,
+		HasHeartRate:   len(heartData.Labels) > 0,
+	}
+	if len(nights) > 0 {
+		data.AvgSleep = totalSleep / len(nights)
+	}
+	if scored > 0 {
+		data.AvgScore = totalScore / scored
+	}
+	if len(heartData.Labels) > 0 {
+		data.AvgRestingHR = totalRestingHR / len(heartData.Labels)
+	}
+	if withHRV > 0 {
+		data.AvgHRV = totalHRV / float64(withHRV)
 	}
 
-	// Save all metrics
-	for _, metric := range metrics {
-		if err := h.storage.SaveHealthMetric(&metric); err != nil {
-			http.Error(w, "Error saving health metric", http.StatusInternalServerError)
-			return
-		}
+	tmpl := h.templates.GetTemplate("sleep")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(fmt.Sprintf(`<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ Uploaded %d health metrics!</div>`, len(metrics))))
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		fmt.Printf("Template execution error: %v\n", err)
+		http.Error(w, "Error executing template", http.StatusInternalServerError)
+		return
+	}
 }
 
 func (h *Handlers) Activities(w http.ResponseWriter, r *http.Request) {
@@ -203,7 +1975,16 @@ func (h *Handlers) Activities(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	activities, err := h.storage.GetActivities()
+	// The filter controls also work as query parameters, e.g. /activities?type=running&q=park
+	query, err := parseActivityQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.Limit = 0
+	query.Cursor = ""
+
+	activities, _, err := h.storage.QueryActivities(query)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -242,6 +2023,10 @@ func (h *Handlers) Activities(w http.ResponseWriter, r *http.Request) {
                         {{if .UseImperial}}Imperial{{else}}Metric{{end}}
                     </button>
                 </div>
+                <a href="/api/export" class="bg-indigo-500 hover:bg-indigo-700 text-white font-bold py-2 px-4 rounded transition duration-200"
+                   title="Download every activity as GPX with a CSV summary">
+                    ⬇ Export All
+                </a>
                 <a href="/" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded transition duration-200">
                     Back to Home
                 </a>
@@ -253,16 +2038,16 @@ func (h *Handlers) Activities(w http.ResponseWriter, r *http.Request) {
         <div class="bg-white rounded-lg shadow-md p-6 mb-6">
             <div class="flex flex-col md:flex-row md:items-center md:justify-between space-y-4 md:space-y-0">
                 <div class="flex-1 max-w-md">
-                    <input type="text" id="search-input" placeholder="Search activities..." 
+                    <input type="text" id="search-input" placeholder="Search activities..." value="{{.Search}}"
                            class="w-full px-4 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
                 </div>
                 <div class="flex items-center space-x-4">
                     <select id="type-filter" class="px-3 py-2 border border-gray-300 rounded-lg">
                         <option value="">All Types</option>
-                        <option value="running">Running</option>
-                        <option value="cycling">Cycling</option>
-                        <option value="walking">Walking</option>
-                        <option value="hiking">Hiking</option>
+                        <option value="running" {{if eq .Type "running"}}selected{{end}}>Running</option>
+                        <option value="cycling" {{if eq .Type "cycling"}}selected{{end}}>Cycling</option>
+                        <option value="walking" {{if eq .Type "walking"}}selected{{end}}>Walking</option>
+                        <option value="hiking" {{if eq .Type "hiking"}}selected{{end}}>Hiking</option>
                     </select>
                     <span class="text-sm text-gray-600">{{len .Activities}} activities</span>
                 </div>
@@ -468,9 +2253,13 @@ func (h *Handlers) Activities(w http.ResponseWriter, r *http.Request) {
 
 	data := struct {
 		Activities  []*models.Activity
+		Type        string
+		Search      string
 		UseImperial bool
 	}{
 		Activities:  activities,
+		Type:        strings.ToLower(query.Type),
+		Search:      query.Search,
 		UseImperial: useImperial,
 	}
 
@@ -532,6 +2321,118 @@ func (h *Handlers) StatsHealth(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(html))
 }
 
+// recordsQuery reads the activity type and year of a records request. The
+// type defaults to running, or the first type with records; year 0 means
+// all-time.
+func recordsQuery(r *http.Request, table *records.Table) (string, int, error) {
+	activityType := r.URL.Query().Get("type")
+	if activityType == "" {
+		activityType = gpx.TypeRunning
+		if types := table.Types(); len(types) > 0 && len(table.Records(activityType, 0)) == 0 {
+			activityType = types[0]
+		}
+	}
+
+	year := 0
+	if value := r.URL.Query().Get("year"); value != "" {
+		var err error
+		if year, err = strconv.Atoi(value); err != nil {
+			return "", 0, fmt.Errorf("invalid year %q", value)
+		}
+	}
+	return activityType, year, nil
+}
+
+// Records renders the personal records page.
+func (h *Handlers) Records(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	activities, err := h.storage.GetActivities()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	table := records.Compute(activities)
+
+	activityType, year, err := recordsQuery(r, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	useImperial := false
+	if cookie, err := r.Cookie("units"); err == nil && cookie.Value == "imperial" {
+		useImperial = true
+	}
+
+	types := table.Types()
+	if len(types) == 0 {
+		types = []string{activityType}
+	}
+
+	data := struct {
+		Title         string
+		Types         []string
+		Type          string
+		Years         []int
+		Year          int
+		Records       []records.Record
+		ImperialUnits bool
+	}{
+		Title:         "Records",
+		Types:         types,
+		Type:          activityType,
+		Years:         table.Years(),
+		Year:          year,
+		Records:       table.Records(activityType, year),
+		ImperialUnits: useImperial,
+	}
+
+	tmpl := h.templates.GetTemplate("records")
+	if tmpl == nil {
+		http.Error(w, "Template not found", http.StatusInternalServerError)
+		return
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base.html", data); err != nil {
+		fmt.Printf("Template execution error: %v\n", err)
+		http.Error(w, "Error executing template", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetRecords serves the personal records for ?type= (default running) and
+// ?year= (default all-time) as JSON.
+func (h *Handlers) GetRecords(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	activities, err := h.storage.GetActivities()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	table := records.Compute(activities)
+
+	activityType, year, err := recordsQuery(r, table)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result := table.Records(activityType, year)
+	if result == nil {
+		result = []records.Record{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
 func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -560,6 +2461,11 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 	var last7Days, last30Days []ActivityStat
 	var weeklyStats []WeekStat
 
+	setting, err := h.heartRateZones(r, activities)
+	if err != nil {
+		setting.Error = err.Error()
+	}
+
 	// Initialize weekly stats for last 4 weeks
 	for i := 0; i < 4; i++ {
 		weekStart := now.AddDate(0, 0, -7*(i+1))
@@ -571,6 +2477,7 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 			Distance:   0,
 			Activities: 0,
 			Duration:   0,
+			ZoneTime:   make([]int, len(setting.Zones)),
 		})
 	}
 
@@ -631,6 +2538,12 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 					weeklyStats[i].Distance += activity.Distance
 					weeklyStats[i].Activities++
 					weeklyStats[i].Duration += float64(activity.Duration)
+
+					// From the stored time at each heart rate, without reading
+					// tracks; older activities get it when recalculated
+					for z, seconds := range zones.SumZones(setting.Zones, activity.HeartRateTime) {
+						weeklyStats[i].ZoneTime[z] += seconds
+					}
 					break
 				}
 			}
@@ -717,6 +2630,39 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
             </div>
         </div>
 
+        <!-- Heart Rate Zones -->
+        <div id="hr-zones" class="bg-white rounded-lg shadow-md p-6 mb-8">
+            <div class="flex justify-between items-center mb-4">
+                <h3 class="text-xl font-semibold text-gray-900">Weekly Time in Heart Rate Zones</h3>
+                {{if .HRZoneNote}}<span class="text-sm text-gray-500">{{.HRZoneNote}}</span>{{end}}
+            </div>
+            {{if .HRZones.Zones}}
+            <canvas id="zonesChart" width="800" height="250"></canvas>
+            {{else}}
+            <p class="text-gray-600 mb-2">Heart rate zones are not set up: {{.HRZones.Error}}.</p>
+            {{end}}
+            <form id="zone-settings" class="grid grid-cols-2 md:grid-cols-5 gap-4 items-end mt-6">
+                <label class="text-sm text-gray-700">Zones from
+                    <select name="method" class="mt-1 block w-full border border-gray-300 rounded px-2 py-1">
+                        <option value="max_hr" {{if eq .HRZones.Method "max_hr"}}selected{{end}}>Max HR</option>
+                        <option value="lthr" {{if eq .HRZones.Method "lthr"}}selected{{end}}>Lactate threshold HR</option>
+                        <option value="hr_reserve" {{if eq .HRZones.Method "hr_reserve"}}selected{{end}}>HR reserve</option>
+                    </select>
+                </label>
+                <label class="text-sm text-gray-700">Max HR (bpm)
+                    <input type="number" name="max_hr" min="100" max="250" value="{{if and .HRZones.MaxHR (not .HRZones.EstimatedMaxHR)}}{{.HRZones.MaxHR}}{{end}}" placeholder="{{if .HRZones.EstimatedMaxHR}}{{.HRZones.MaxHR}}{{end}}" class="mt-1 block w-full border border-gray-300 rounded px-2 py-1">
+                </label>
+                <label class="text-sm text-gray-700">LTHR (bpm)
+                    <input type="number" name="lthr" min="80" max="230" value="{{if .HRZones.LTHR}}{{.HRZones.LTHR}}{{end}}" class="mt-1 block w-full border border-gray-300 rounded px-2 py-1">
+                </label>
+                <label class="text-sm text-gray-700">Resting HR (bpm)
+                    <input type="number" name="resting_hr" min="20" max="150" value="{{if and .HRZones.RestingHR (not .HRZones.RestingHRFromLog)}}{{.HRZones.RestingHR}}{{end}}" placeholder="{{if .HRZones.RestingHRFromLog}}{{.HRZones.RestingHR}}{{end}}" class="mt-1 block w-full border border-gray-300 rounded px-2 py-1">
+                </label>
+                <button type="submit" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-1 px-4 rounded transition duration-200">Save Zones</button>
+            </form>
+            <p class="text-xs text-gray-500 mt-2">Max HR defaults to the highest heart rate of your activities, and resting HR to the latest uploaded one.</p>
+        </div>
+
         <!-- Monthly Overview -->
         <div class="bg-white rounded-lg shadow-md p-6">
             <h3 class="text-xl font-semibold text-gray-900 mb-4">Last 30 Days Overview</h3>
@@ -808,6 +2754,48 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
             }
         });
 
+        {{if .HRZones.Zones}}
+        // Weekly Time in Zones Chart
+        new Chart(document.getElementById('zonesChart').getContext('2d'), {
+            type: 'bar',
+            data: {
+                labels: [{{range .WeeklyStats}}'{{.Week}}',{{end}}],
+                datasets: [{{range $i, $zone := .HRZones.Zones}}{
+                    label: 'Z{{$zone.Index}} {{$zone.Name}}',
+                    data: [{{range $.WeeklyStats}}{{printf "%.0f" (minutes (index .ZoneTime $i))}},{{end}}],
+                    backgroundColor: '{{index $.ZoneColors $i}}'
+                },{{end}}]
+            },
+            options: {
+                responsive: true,
+                scales: {
+                    x: { stacked: true },
+                    y: {
+                        stacked: true,
+                        beginAtZero: true,
+                        title: {
+                            display: true,
+                            text: 'Minutes'
+                        }
+                    }
+                }
+            }
+        });
+        {{end}}
+
+        // Heart rate zone settings are kept in a cookie, like the units
+        document.getElementById('zone-settings').addEventListener('submit', function(e) {
+            e.preventDefault();
+            const params = new URLSearchParams();
+            for (const [name, value] of new FormData(this)) {
+                if (value !== '') {
+                    params.set(name, value);
+                }
+            }
+            document.cookie = 'hr_zones=' + encodeURIComponent(params.toString()) + '; path=/; max-age=' + (365 * 24 * 60 * 60);
+            window.location.reload();
+        });
+
         // Monthly Overview Chart
         const ctxMonthly = document.getElementById('monthlyChart').getContext('2d');
         const monthlyData = {
@@ -861,8 +2849,13 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 		Last7Days:       last7Days,
 		Last30Days:      last30Days,
 		WeeklyStats:     weeklyStats,
+		HRZones:         setting,
+		ZoneColors:      zoneChartColors,
 		UseImperial:     useImperial,
 	}
+	if setting.Zones != nil {
+		data.HRZoneNote = zoneSettingNote(setting)
+	}
 
 	funcMap := template.FuncMap{
 		"div": func(a, b float64) float64 {
@@ -877,6 +2870,9 @@ func (h *Handlers) Stats(w http.ResponseWriter, r *http.Request) {
 		"metersToMiles": func(meters float64) float64 {
 			return meters * 0.000621371
 		},
+		"minutes": func(seconds int) float64 {
+			return float64(seconds) / 60
+		},
 	}
 
 	t, err := template.New("stats").Funcs(funcMap).Parse(tmpl)
@@ -903,6 +2899,7 @@ type WeekStat struct {
 	Distance   float64
 	Activities int
 	Duration   float64
+	ZoneTime   []int // seconds in each heart rate zone
 }
 
 type StatsData struct {
@@ -912,6 +2909,9 @@ type StatsData struct {
 	Last7Days       []ActivityStat
 	Last30Days      []ActivityStat
 	WeeklyStats     []WeekStat
+	HRZones         hrZones
+	HRZoneNote      string
+	ZoneColors      []string
 	UseImperial     bool
 }
 
@@ -943,7 +2943,7 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
         <div class="flex justify-between items-center mb-8">
             <div>
                 <h1 class="text-4xl font-bold text-gray-900 mb-2">Bulk Upload</h1>
-                <p class="text-gray-600">Upload multiple GPX files at once</p>
+                <p class="text-gray-600">Upload multiple GPX, FIT or TCX files at once</p>
             </div>
             <a href="/" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded transition duration-200">
                 Back to Home
@@ -958,27 +2958,34 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
                         <path stroke-linecap="round" stroke-linejoin="round" stroke-width="2" d="M7 16a4 4 0 01-.88-7.903A5 5 0 1115.9 6L16 6a5 5 0 011 9.9M15 13l-3-3m0 0l-3 3m3-3v12"></path>
                     </svg>
                 </div>
-                <h2 class="text-2xl font-bold text-gray-900 mb-2">Upload Your GPX Files</h2>
-                <p class="text-gray-600">Select multiple GPX files or drag and drop them here</p>
+                <h2 class="text-2xl font-bold text-gray-900 mb-2">Upload Your Activity Files</h2>
+                <p class="text-gray-600">Select multiple GPX, FIT or TCX files or drag and drop them here</p>
             </div>
 
             <!-- Drag and Drop Area -->
             <div id="drop-zone" class="border-2 border-dashed border-blue-300 rounded-lg p-8 text-center hover:border-blue-400 transition-colors cursor-pointer">
-                <form id="bulk-upload-form" hx-post="/api/upload/bulk-gpx" hx-encoding="multipart/form-data" 
-                      hx-target="#upload-results" hx-swap="innerHTML" hx-indicator="#upload-progress">
-                    <input type="file" id="file-input" name="gpx-files" accept=".gpx" multiple required 
+                <form id="bulk-upload-form">
+                    <input type="file" id="file-input" name="gpx-files" accept=".gpx,.fit,.tcx,.gz,.zip" multiple required 
                            class="hidden">
                     <div id="file-list" class="mb-4 hidden">
                         <h3 class="text-lg font-semibold text-gray-900 mb-2">Selected Files:</h3>
                         <div id="selected-files" class="space-y-2"></div>
                     </div>
                     <div id="drop-text" class="mb-6">
-                        <p class="text-xl text-gray-600 mb-2">Drop GPX files here or</p>
+                        <p class="text-xl text-gray-600 mb-2">Drop GPX, FIT or TCX files here or</p>
                         <button type="button" onclick="document.getElementById('file-input').click()" 
                                 class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-3 px-6 rounded-lg transition duration-200">
                             Select Files
                         </button>
                     </div>
+                    <div class="mb-4">
+                        <label for="on-duplicate" class="text-sm text-gray-600 mr-2">Files already imported:</label>
+                        <select id="on-duplicate" name="on_duplicate" class="px-3 py-1 border border-gray-300 rounded-lg text-sm">
+                            <option value="skip">Skip</option>
+                            <option value="merge">Merge missing data</option>
+                            <option value="keep">Import again</option>
+                        </select>
+                    </div>
                     <button type="submit" id="upload-btn" class="hidden bg-green-500 hover:bg-green-700 text-white font-bold py-3 px-8 rounded-lg transition duration-200">
                         Upload All Files
                     </button>
@@ -986,14 +2993,14 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
             </div>
 
             <!-- Progress Indicator -->
-            <div id="upload-progress" class="htmx-indicator mt-6">
+            <div id="upload-progress" class="hidden mt-6">
                 <div class="bg-blue-50 border border-blue-200 rounded-lg p-4">
                     <div class="flex items-center">
-                        <div class="animate-spin rounded-full h-6 w-6 border-b-2 border-blue-600 mr-3"></div>
-                        <span class="text-blue-800 font-medium">Processing files...</span>
+                        <div id="progress-spinner" class="animate-spin rounded-full h-6 w-6 border-b-2 border-blue-600 mr-3"></div>
+                        <span id="progress-text" class="text-blue-800 font-medium">Uploading files...</span>
                     </div>
                     <div class="mt-2 bg-white rounded-full h-2">
-                        <div class="bg-blue-600 h-2 rounded-full animate-pulse" style="width: 45%"></div>
+                        <div id="progress-bar" class="bg-blue-600 h-2 rounded-full transition-all duration-300" style="width: 0%"></div>
                     </div>
                 </div>
             </div>
@@ -1006,10 +3013,12 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
         <div class="bg-blue-50 border border-blue-200 rounded-lg p-6">
             <h3 class="text-lg font-semibold text-blue-900 mb-3">📋 Upload Instructions</h3>
             <ul class="text-blue-800 space-y-2">
-                <li>• Select multiple GPX files (you can Ctrl+click or Cmd+click to select multiple files)</li>
+                <li>• Select multiple GPX, FIT or TCX files (you can Ctrl+click or Cmd+click to select multiple files)</li>
+                <li>• Or upload a whole Strava or Garmin Connect export ZIP; names, types and descriptions come from its activities.csv</li>
                 <li>• Drag and drop files directly onto the upload area</li>
-                <li>• Each file will be processed individually with detailed progress</li>
+                <li>• Files are processed in the background; progress for each file appears here as it happens</li>
                 <li>• Invalid files will be skipped with error messages</li>
+                <li>• Files you have already imported are recognized and reported as duplicates</li>
                 <li>• Successfully uploaded activities will appear in your activity log</li>
             </ul>
         </div>
@@ -1039,7 +3048,7 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
             dropZone.classList.remove('border-blue-500', 'bg-blue-50');
             
             const files = Array.from(e.dataTransfer.files).filter(file => 
-                file.name.toLowerCase().endsWith('.gpx')
+                /\.(gpx|fit|tcx|gz|zip)$/i.test(file.name)
             );
             
             if (files.length > 0) {
@@ -1091,6 +3100,134 @@ func (h *Handlers) BulkUpload(w http.ResponseWriter, r *http.Request) {
                 fileInput.click();
             }
         });
+
+        // Upload the files as an import job, then follow its progress
+        const form = document.getElementById('bulk-upload-form');
+        const uploadProgress = document.getElementById('upload-progress');
+        const progressText = document.getElementById('progress-text');
+        const progressBar = document.getElementById('progress-bar');
+        const progressSpinner = document.getElementById('progress-spinner');
+        const uploadResults = document.getElementById('upload-results');
+
+        form.addEventListener('submit', async (e) => {
+            e.preventDefault();
+            uploadBtn.disabled = true;
+            uploadProgress.classList.remove('hidden');
+
+            let job;
+            try {
+                const response = await fetch('/api/upload/bulk-gpx', { method: 'POST', body: new FormData(form) });
+                if (!response.ok) {
+                    throw new Error(await response.text());
+                }
+                job = await response.json();
+            } catch (err) {
+                progressSpinner.classList.add('hidden');
+                progressText.textContent = 'Upload failed: ' + err.message;
+                uploadBtn.disabled = false;
+                return;
+            }
+
+            renderJob(job);
+            if (job.status === 'done') {
+                return;
+            }
+            const events = new EventSource('/api/jobs/' + encodeURIComponent(job.id) + '/events');
+            events.addEventListener('progress', (e) => renderJob(JSON.parse(e.data)));
+            events.addEventListener('done', (e) => {
+                events.close();
+                renderJob(JSON.parse(e.data));
+            });
+        });
+
+        function escapeHTML(text) {
+            const div = document.createElement('div');
+            div.textContent = text;
+            return div.innerHTML;
+        }
+
+        function formatDuration(seconds) {
+            const minutes = Math.floor((seconds % 3600) / 60);
+            return Math.floor(seconds / 3600) + ':' + String(minutes).padStart(2, '0');
+        }
+
+        function renderResult(task, index, total) {
+            const result = task.result;
+            const position = '<span class="text-sm font-medium">' + (index + 1) + '/' + total + '</span>';
+            const name = escapeHTML(task.name);
+            if (!result) {
+                const state = task.status === 'running' ? 'Processing...' : 'Waiting';
+                return '<div class="flex items-center justify-between bg-gray-50 border border-gray-200 rounded-lg p-4 text-gray-500">' +
+                    '<div><p class="font-medium text-gray-700">' + name + '</p><p class="text-sm">' + state + '</p></div>' +
+                    position + '</div>';
+            }
+            if (result.status === 'success') {
+                return '<div class="flex items-center justify-between bg-green-50 border border-green-200 rounded-lg p-4 text-green-600">' +
+                    '<div class="flex items-center"><span class="mr-3">✓</span><div>' +
+                        '<p class="font-medium text-green-900">' + name + '</p>' +
+                        '<p class="text-sm text-green-700">Activity: <a href="/activity/' + encodeURIComponent(result.activity_id) + '" class="underline">' +
+                            escapeHTML(result.activity_name) + '</a> • ' + (result.distance || 0).toFixed(1) + ' km • ' +
+                            formatDuration(result.duration || 0) + ' duration</p>' +
+                    '</div></div>' + position + '</div>';
+            }
+            if (result.status === 'duplicate') {
+                const action = result.merged ? 'Merged new data' : 'Skipped';
+                return '<div class="flex items-center justify-between bg-yellow-50 border border-yellow-200 rounded-lg p-4 text-yellow-600">' +
+                    '<div class="flex items-center"><span class="mr-3">⧉</span><div>' +
+                        '<p class="font-medium text-yellow-900">' + name + '</p>' +
+                        '<p class="text-sm text-yellow-700">' + action + ': duplicate of <a href="/activity/' + encodeURIComponent(result.duplicate_id) + '" class="underline">' +
+                            escapeHTML(result.duplicate_of) + '</a></p>' +
+                    '</div></div>' + position + '</div>';
+            }
+            return '<div class="flex items-center justify-between bg-red-50 border border-red-200 rounded-lg p-4 text-red-600">' +
+                '<div class="flex items-center"><span class="mr-3">✗</span><div>' +
+                    '<p class="font-medium text-red-900">' + name + '</p>' +
+                    '<p class="text-sm text-red-700">' + escapeHTML(result.error) + '</p>' +
+                '</div></div>' + position + '</div>';
+        }
+
+        function renderJob(job) {
+            const counts = { success: 0, duplicate: 0, error: 0 };
+            job.tasks.forEach((task) => {
+                if (task.result) {
+                    counts[task.result.status]++;
+                }
+            });
+
+            const percent = job.total ? Math.round(100 * job.completed / job.total) : 100;
+            progressBar.style.width = percent + '%';
+            if (job.status === 'done') {
+                progressSpinner.classList.add('hidden');
+                progressText.textContent = 'Processed ' + job.total + ' files';
+            } else {
+                progressText.textContent = 'Processing ' + job.completed + ' of ' + job.total + ' files...';
+            }
+
+            let html =
+                '<div class="bg-white rounded-lg shadow-md p-6">' +
+                    '<div class="flex items-center justify-between mb-6">' +
+                        '<h3 class="text-xl font-semibold text-gray-900">Upload Results</h3>' +
+                        '<div class="flex space-x-4">' +
+                            '<span class="bg-green-100 text-green-800 px-3 py-1 rounded-full text-sm font-medium">✓ ' + counts.success + ' Successful</span>' +
+                            '<span class="bg-yellow-100 text-yellow-800 px-3 py-1 rounded-full text-sm font-medium">⧉ ' + counts.duplicate + ' Duplicates</span>' +
+                            '<span class="bg-red-100 text-red-800 px-3 py-1 rounded-full text-sm font-medium">✗ ' + counts.error + ' Failed</span>' +
+                        '</div>' +
+                    '</div>' +
+                    '<div class="space-y-3 max-h-96 overflow-y-auto">';
+            job.tasks.forEach((task, index) => {
+                html += renderResult(task, index, job.total);
+            });
+            html += '</div>';
+            if (job.status === 'done') {
+                html +=
+                    '<div class="mt-6 flex justify-between items-center">' +
+                        '<button onclick="location.reload()" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded transition duration-200">Upload More Files</button>' +
+                        '<a href="/activities" class="bg-green-500 hover:bg-green-700 text-white font-bold py-2 px-4 rounded transition duration-200">View Activities</a>' +
+                    '</div>';
+            }
+            html += '</div>';
+            uploadResults.innerHTML = html;
+        }
     </script>
 </body>
 </html>`
@@ -1118,153 +3255,259 @@ func (h *Handlers) BulkUploadGPX(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var results []BulkUploadResult
-	successCount := 0
-	errorCount := 0
+	onDuplicate, err := importer.ParseDuplicateMode(r.FormValue("on_duplicate"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	for i, fileHeader := range files {
+	// List the files in export archives first so that progress counts them
+	uploads, closeUploads := openBulkUploads(files)
+	var pending sync.WaitGroup
+	pending.Add(len(uploads))
+	go func() {
+		pending.Wait()
+		closeUploads()
+	}()
+
+	tasks := make([]jobs.Task, len(uploads))
+	for i, upload := range uploads {
 		result := BulkUploadResult{
-			FileName: fileHeader.Filename,
+			FileName: upload.name,
 			Index:    i + 1,
-			Total:    len(files),
+			Total:    len(uploads),
 		}
-
-		// Open the file
-		file, err := fileHeader.Open()
-		if err != nil {
-			result.Status = "error"
-			result.Error = "Failed to open file"
-			errorCount++
-			results = append(results, result)
-			continue
+		tasks[i] = jobs.Task{
+			Name: upload.name,
+			Run: func() interface{} {
+				defer pending.Done()
+				return h.importUpload(upload, result, onDuplicate)
+			},
 		}
+	}
 
-		// Read file content
-		data, err := ioutil.ReadAll(file)
-		file.Close()
-		if err != nil {
-			result.Status = "error"
-			result.Error = "Failed to read file content"
-			errorCount++
-			results = append(results, result)
-			continue
-		}
+	job := h.jobs.Submit("import", tasks)
+	fmt.Printf("INFO: Queued import job %s with %d files\n", job.ID, job.Total)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/jobs/"+job.ID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// importUpload parses and saves one file of a bulk import, filling in result.
+// It runs on the job queue's workers.
+func (h *Handlers) importUpload(upload bulkUpload, result BulkUploadResult, onDuplicate string) BulkUploadResult {
+	if upload.err != "" {
+		result.Status = "error"
+		result.Error = upload.err
+		return result
+	}
+	data, err := upload.read()
+	if err != nil {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	// Parse the GPX, FIT or TCX file and create activity record
+	track, activity, err := importer.Parse(data)
+	if err != nil {
+		result.Status = "error"
+		result.Error = fmt.Sprintf("Invalid activity file: %v", err)
+		return result
+	}
+	activity.FileHash = importer.FileHash(data)
+	upload.metadata.Apply(activity)
+
+	return h.saveImport(activity, track, upload.name, data, result, onDuplicate)
+}
+
+// saveImport checks a parsed activity for duplicates and saves it with its
+// track and the raw file it was read from, filling in result. Activities that
+// were not read from a file of their own have no data and no raw file. Every
+// import of an activity goes through here.
+func (h *Handlers) saveImport(activity *models.Activity, track *models.GPXTrack, name string, data []byte, result BulkUploadResult, onDuplicate string) BulkUploadResult {
+	// Stored with the activity for time in zones, and merged into a
+	// duplicate without heart rate data
+	activity.HeartRateTime = zones.TimeAtHeartRates(track.Points)
+
+	// Parsing runs concurrently; checking for duplicates and saving must not.
+	// The check reads the candidates under the lock, so it sees those every
+	// other import saved, and merges into their current version.
+	h.importMu.Lock()
+	defer h.importMu.Unlock()
+
+	candidates, err := h.duplicateCandidates(activity)
+	if err != nil {
+		result.Status = "error"
+		result.Error = "Failed to check for duplicates"
+		return result
+	}
+	duplicate, merged, err := h.resolveDuplicate(activity, candidates, onDuplicate)
+	if err != nil {
+		result.Status = "error"
+		result.Error = "Failed to merge into duplicate activity"
+		return result
+	}
+	if duplicate != nil {
+		result.Status = "duplicate"
+		result.Merged = merged
+		result.DuplicateOf = duplicate.Name
+		result.DuplicateID = duplicate.ID
+		return result
+	}
 
-		// Save the raw GPX file
-		filename := fmt.Sprintf("gpx_%d_%s", time.Now().UnixNano(), fileHeader.Filename)
+	// Save the raw GPX file
+	baseName := strings.TrimSuffix(path.Base(name), ".gz")
+	if data != nil {
+		filename := fmt.Sprintf("gpx_%d_%s", time.Now().UnixNano(), baseName)
 		if err := h.storage.SaveFile(filename, data); err != nil {
 			result.Status = "error"
 			result.Error = "Failed to save file"
-			errorCount++
-			results = append(results, result)
-			continue
+			return result
 		}
+		activity.GPXFile = filename
+	}
+
+	// Set additional activity details
+	if activity.Name == "" {
+		activity.Name = importer.NameFromFilename(baseName)
+	}
+
+	// Save activity first to get the ID, then set track ID to match
+	if err := h.storage.SaveActivity(activity); err != nil {
+		result.Status = "error"
+		result.Error = "Failed to save activity"
+		return result
+	}
+	h.duplicates.Add(activity)
+
+	// Link track to activity by using the same ID
+	track.ID = activity.ID
+	if err := h.storage.SaveGPXTrack(track); err != nil {
+		result.Status = "error"
+		result.Error = "Failed to save GPS track"
+		return result
+	}
+
+	result.Status = "success"
+	result.ActivityID = activity.ID
+	result.ActivityName = activity.Name
+	result.Distance = activity.Distance / 1000 // Convert to km
+	result.Duration = activity.Duration
+	return result
+}
 
-		// Parse GPX and create activity record
-		track, activity, err := gpx.ParseGPX(string(data))
+// duplicateCandidates loads the stored activities that activity may
+// duplicate. The caller must hold importMu.
+func (h *Handlers) duplicateCandidates(activity *models.Activity) ([]*models.Activity, error) {
+	if h.duplicates == nil {
+		activities, err := h.storage.GetActivities()
 		if err != nil {
-			result.Status = "error"
-			result.Error = fmt.Sprintf("Invalid GPX format: %v", err)
-			errorCount++
-			results = append(results, result)
-			continue
+			return nil, err
 		}
+		h.duplicates = importer.NewDuplicateIndex(activities)
+	}
 
-		// Set additional activity details
-		if activity.Name == "" {
-			activity.Name = strings.TrimSuffix(fileHeader.Filename, ".gpx")
+	var candidates []*models.Activity
+	for _, id := range h.duplicates.Candidates(activity) {
+		candidate, err := h.storage.GetActivity(id)
+		if err == storage.ErrNotFound {
+			continue // deleted since it was indexed
 		}
-		activity.GPXFile = filename
-
-		// Save activity first to get the ID, then set track ID to match
-		if err := h.storage.SaveActivity(activity); err != nil {
-			result.Status = "error"
-			result.Error = "Failed to save activity"
-			errorCount++
-			results = append(results, result)
-			continue
+		if err != nil {
+			return nil, err
 		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
 
-		// Link track to activity by using the same ID
-		track.ID = activity.ID
-		if err := h.storage.SaveGPXTrack(track); err != nil {
-			result.Status = "error"
-			result.Error = "Failed to save GPS track"
-			errorCount++
-			results = append(results, result)
-			continue
+// ImportFile imports an activity file from outside an HTTP request, such as
+// the watched import folder, through the same pipeline as uploads. A file
+// that duplicates an existing activity is skipped without error.
+func (h *Handlers) ImportFile(name string, data []byte) error {
+	data, err := importer.Decompress(data)
+	if err != nil {
+		return fmt.Errorf("invalid gzip file: %v", err)
+	}
+
+	read := func() ([]byte, error) { return data, nil }
+	result := h.importUpload(bulkUpload{name: name, read: read}, BulkUploadResult{FileName: name, Index: 1, Total: 1},
+		importer.DuplicateSkip)
+	switch result.Status {
+	case "error":
+		return fmt.Errorf("%s", result.Error)
+	case "duplicate":
+		fmt.Printf("INFO: Skipped %s: duplicate of activity %s\n", name, result.DuplicateID)
+	}
+	return nil
+}
+
+// Job serves the progress of a background job: GET /api/jobs/{id} returns a
+// snapshot and GET /api/jobs/{id}/events streams one as a server-sent event
+// on every change until the job is done.
+func (h *Handlers) Job(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	jobID := strings.TrimPrefix(r.URL.Path, "/api/jobs/")
+	if id, ok := strings.CutSuffix(jobID, "/events"); ok {
+		h.jobEvents(w, r, id)
+		return
+	}
+
+	job, ok := h.jobs.Get(jobID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+func (h *Handlers) jobEvents(w http.ResponseWriter, r *http.Request, jobID string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	job, changed, ok := h.jobs.Watch(jobID)
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	for {
+		// Clients reconnect after a dropped stream; a finished job tells
+		// them to stop
+		event := "progress"
+		if job.Status == jobs.StatusDone {
+			event = "done"
+		}
+		data, err := json.Marshal(job)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to encode job %s: %v\n", jobID, err)
+			return
+		}
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+		flusher.Flush()
+		if event == "done" {
+			return
 		}
 
-		result.Status = "success"
-		result.ActivityName = activity.Name
-		result.Distance = activity.Distance / 1000 // Convert to km
-		result.Duration = activity.Duration
-		successCount++
-		results = append(results, result)
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+		job, changed, _ = h.jobs.Watch(jobID)
 	}
-
-	// Generate HTML response
-	html := fmt.Sprintf(`
-	<div class="bg-white rounded-lg shadow-md p-6">
-		<div class="flex items-center justify-between mb-6">
-			<h3 class="text-xl font-semibold text-gray-900">Upload Results</h3>
-			<div class="flex space-x-4">
-				<span class="bg-green-100 text-green-800 px-3 py-1 rounded-full text-sm font-medium">
-					✓ %d Successful
-				</span>
-				<span class="bg-red-100 text-red-800 px-3 py-1 rounded-full text-sm font-medium">
-					✗ %d Failed
-				</span>
-			</div>
-		</div>
-		<div class="space-y-3 max-h-96 overflow-y-auto">`, successCount, errorCount)
-
-	for _, result := range results {
-		if result.Status == "success" {
-			html += fmt.Sprintf(`
-			<div class="flex items-center justify-between bg-green-50 border border-green-200 rounded-lg p-4">
-				<div class="flex items-center">
-					<svg class="w-5 h-5 text-green-600 mr-3" fill="currentColor" viewBox="0 0 20 20">
-						<path fill-rule="evenodd" d="M10 18a8 8 0 100-16 8 8 0 000 16zm3.707-9.293a1 1 0 00-1.414-1.414L9 10.586 7.707 9.293a1 1 0 00-1.414 1.414l2 2a1 1 0 001.414 0l4-4z" clip-rule="evenodd"></path>
-					</svg>
-					<div>
-						<p class="font-medium text-green-900">%s</p>
-						<p class="text-sm text-green-700">Activity: %s • %.1f km • %d:%02d duration</p>
-					</div>
-				</div>
-				<span class="text-green-600 text-sm font-medium">%d/%d</span>
-			</div>`, result.FileName, result.ActivityName, result.Distance, result.Duration/3600, (result.Duration%3600)/60, result.Index, result.Total)
-		} else {
-			html += fmt.Sprintf(`
-			<div class="flex items-center justify-between bg-red-50 border border-red-200 rounded-lg p-4">
-				<div class="flex items-center">
-					<svg class="w-5 h-5 text-red-600 mr-3" fill="currentColor" viewBox="0 0 20 20">
-						<path fill-rule="evenodd" d="M10 18a8 8 0 100-16 8 8 0 000 16zM8.707 7.293a1 1 0 00-1.414 1.414L8.586 10l-1.293 1.293a1 1 0 101.414 1.414L10 11.414l1.293 1.293a1 1 0 001.414-1.414L11.414 10l1.293-1.293a1 1 0 00-1.414-1.414L10 8.586 8.707 7.293z" clip-rule="evenodd"></path>
-					</svg>
-					<div>
-						<p class="font-medium text-red-900">%s</p>
-						<p class="text-sm text-red-700">%s</p>
-					</div>
-				</div>
-				<span class="text-red-600 text-sm font-medium">%d/%d</span>
-			</div>`, result.FileName, result.Error, result.Index, result.Total)
-		}
-	}
-
-	html += `
-		</div>
-		<div class="mt-6 flex justify-between items-center">
-			<button onclick="location.reload()" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded transition duration-200">
-				Upload More Files
-			</button>
-			<a href="/activities" class="bg-green-500 hover:bg-green-700 text-white font-bold py-2 px-4 rounded transition duration-200">
-				View Activities
-			</a>
-		</div>
-	</div>`
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(html))
 }
 
 func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
@@ -1282,23 +3525,13 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get all activities and find the specific one
-	activities, err := h.storage.GetActivities()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
 		return
 	}
-
-	var activity *models.Activity
-	for _, a := range activities {
-		if a.ID == activityID {
-			activity = a
-			break
-		}
-	}
-
-	if activity == nil {
-		http.Error(w, "Activity not found", http.StatusNotFound)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -1325,6 +3558,11 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
             <div>
                 <h1 class="text-4xl font-bold text-gray-900 mb-2">{{.Activity.Name}}</h1>
                 <p class="text-gray-600">Activity Details</p>
+                {{if .NewPRs}}
+                <a href="/records?type={{.Activity.Type}}" class="inline-block mt-2 px-3 py-1 rounded-full bg-yellow-100 text-yellow-800 text-sm font-semibold">
+                    🏆 New PR: {{join .NewPRs ", "}}
+                </a>
+                {{end}}
             </div>
             <div class="flex items-center space-x-4">
                 <!-- Unit Toggle -->
@@ -1354,6 +3592,11 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
                         <span class="inline-flex items-center px-3 py-1 rounded-full text-sm font-medium bg-{{getTypeColor .Activity.Type}}-100 text-{{getTypeColor .Activity.Type}}-800">
                             {{.Activity.Type}}
                         </span>
+                        {{if eq .Activity.TypeSource "inferred"}}
+                        <span class="text-gray-500 text-sm" title="Detected from speed, cadence and elevation. Use Edit to correct it.">
+                            auto-detected ({{percent .Activity.TypeConfidence}}% confidence)
+                        </span>
+                        {{end}}
                         {{if .Activity.GPXFile}}
                         <span class="inline-flex items-center px-3 py-1 rounded-full text-sm font-medium bg-green-100 text-green-800">
                             📍 GPS Track
@@ -1361,6 +3604,9 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
                         {{end}}
                         <span class="text-gray-500 text-sm">{{.Activity.StartTime.Format "Monday, January 2, 2006 at 3:04 PM"}}</span>
                     </div>
+                    {{if .Activity.Description}}
+                    <p class="text-gray-700 mt-3 whitespace-pre-line">{{.Activity.Description}}</p>
+                    {{end}}
                 </div>
             </div>
 
@@ -1419,12 +3665,40 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
                         <span class="text-gray-600">Average Pace</span>
                         <span class="font-semibold">{{calculatePace .Activity.Duration .Activity.Distance .UseImperial}}</span>
                     </div>
+                    {{if .Activity.ElapsedTime}}
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Moving Time</span>
+                        <span class="font-semibold">{{formatDuration .Activity.MovingTime}}</span>
+                    </div>
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Elapsed Time</span>
+                        <span class="font-semibold">{{formatDuration .Activity.ElapsedTime}}{{if .Activity.Pauses}} ({{len .Activity.Pauses}} {{if eq (len .Activity.Pauses) 1}}stop{{else}}stops{{end}}){{end}}</span>
+                    </div>
+                    {{end}}
                     {{if .Activity.Calories}}
                     <div class="flex justify-between items-center py-3 border-b border-gray-100">
                         <span class="text-gray-600">Calories</span>
                         <span class="font-semibold">{{.Activity.Calories}} cal</span>
                     </div>
                     {{end}}
+                    {{if .Activity.MaxHeartRate}}
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Heart Rate</span>
+                        <span class="font-semibold">{{.Activity.AvgHeartRate}} avg / {{.Activity.MaxHeartRate}} max bpm</span>
+                    </div>
+                    {{end}}
+                    {{if .Activity.MaxCadence}}
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Cadence</span>
+                        <span class="font-semibold">{{.Activity.AvgCadence}} avg / {{.Activity.MaxCadence}} max</span>
+                    </div>
+                    {{end}}
+                    {{if .Activity.MaxPower}}
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Power</span>
+                        <span class="font-semibold">{{.Activity.AvgPower}} avg / {{.Activity.MaxPower}} max W</span>
+                    </div>
+                    {{end}}
                 </div>
             </div>
 
@@ -1458,9 +3732,176 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
                         <span class="font-semibold">{{.Activity.TotalPoints}}</span>
                     </div>
                     {{end}}
+                    {{if .Activity.Device}}
+                    <div class="flex justify-between items-center py-3 border-b border-gray-100">
+                        <span class="text-gray-600">Device</span>
+                        <span class="font-semibold">{{.Activity.Device.Name}}{{if .Activity.Device.SoftwareVersion}} <span class="text-gray-500 text-sm">v{{.Activity.Device.SoftwareVersion}}</span>{{end}}</span>
+                    </div>
+                    {{end}}
+                </div>
+            </div>
+        </div>
+
+        {{if or .Activity.Laps .Activity.GPXFile}}
+        <!-- Laps -->
+        <div class="bg-white rounded-lg shadow-md p-6 mt-8">
+            <div class="flex justify-between items-center mb-4">
+                <h3 class="text-xl font-bold text-gray-900">Laps</h3>
+                {{if .HasManualLaps}}
+                <button type="button" hx-delete="/api/activities/{{.Activity.ID}}/laps" hx-confirm="Remove all manual laps?" hx-swap="none"
+                        class="text-sm text-red-600 hover:text-red-800">Remove manual laps</button>
+                {{end}}
+            </div>
+            {{if .Activity.Laps}}
+            <div class="overflow-x-auto">
+                <table class="min-w-full divide-y divide-gray-200">
+                    <thead class="bg-gray-50">
+                        <tr>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Lap</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Distance</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Time</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Pace</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Avg Speed</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Elevation</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Avg HR</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Avg Power</th>
+                        </tr>
+                    </thead>
+                    <tbody class="divide-y divide-gray-200">
+                        {{range .Activity.Laps}}
+                        <tr>
+                            <td class="px-4 py-2 text-sm font-medium text-gray-900">{{.Index}}{{if .Manual}} <span class="text-xs text-gray-500">(manual)</span>{{end}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">
+                                {{if $.UseImperial}}{{printf "%.2f mi" (metersToMiles .Distance)}}{{else}}{{printf "%.2f km" (metersToKm .Distance)}}{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{formatDuration .Duration}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{calculatePace .Duration .Distance $.UseImperial}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">
+                                {{if $.UseImperial}}{{printf "%.1f mph" (kmhToMph .AvgSpeed)}}{{else}}{{printf "%.1f km/h" .AvgSpeed}}{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">
+                                {{if $.UseImperial}}{{printf "%.0f ft" (metersToFeet .TotalElevation)}}{{else}}{{printf "%.0f m" .TotalElevation}}{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{if .AvgHeartRate}}{{.AvgHeartRate}} bpm{{else}}–{{end}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{if .AvgPower}}{{.AvgPower}} W{{else}}–{{end}}</td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
+            </div>
+            {{end}}
+            {{if .Activity.GPXFile}}
+            <form hx-post="/api/activities/{{.Activity.ID}}/laps" hx-swap="none" class="mt-4 flex flex-wrap gap-4 items-end">
+                <div>
+                    <label for="lap-start" class="block text-sm font-medium text-gray-700 mb-1">From</label>
+                    <input type="text" id="lap-start" name="start" placeholder="mm:ss" required
+                           class="w-28 px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                </div>
+                <div>
+                    <label for="lap-end" class="block text-sm font-medium text-gray-700 mb-1">To</label>
+                    <input type="text" id="lap-end" name="end" placeholder="mm:ss" required
+                           class="w-28 px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                </div>
+                <button type="submit" class="bg-blue-500 hover:bg-blue-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+                    Add Lap
+                </button>
+                <span class="text-sm text-gray-500">Time since the start of the activity</span>
+            </form>
+            {{end}}
+        </div>
+        {{end}}
+
+        {{if .HRZones}}
+        <!-- Heart Rate Zones -->
+        <div class="bg-white rounded-lg shadow-md p-6 mt-8">
+            <div class="flex justify-between items-center mb-4">
+                <h3 class="text-xl font-bold text-gray-900">Heart Rate Zones</h3>
+                <a href="/stats#hr-zones" class="text-sm text-blue-600 hover:underline">{{.HRZoneNote}}</a>
+            </div>
+            <div class="flex h-8 rounded overflow-hidden mb-4">
+                {{range .HRZones}}{{if .Seconds}}
+                <div class="bg-{{zoneColor .Index}}-500" style="width: {{printf "%.2f" .Percent}}%" title="Z{{.Index}} {{.Name}}: {{formatDuration .Seconds}}"></div>
+                {{end}}{{end}}
+            </div>
+            <div class="grid grid-cols-2 md:grid-cols-5 gap-4">
+                {{range .HRZones}}
+                <div class="flex items-start space-x-2">
+                    <span class="mt-1 h-3 w-3 rounded-sm bg-{{zoneColor .Index}}-500 flex-shrink-0"></span>
+                    <div>
+                        <div class="text-sm font-semibold text-gray-900">Z{{.Index}} {{.Name}}</div>
+                        <div class="text-xs text-gray-500">{{if .Max}}{{.Min}}–{{.Max}}{{else}}{{.Min}}+{{end}} bpm</div>
+                        <div class="text-sm text-gray-700">{{formatDuration .Seconds}} ({{printf "%.0f" .Percent}}%)</div>
+                    </div>
                 </div>
+                {{end}}
+            </div>
+        </div>
+        {{end}}
+
+        {{if .Activity.BestEfforts}}
+        <!-- Best Efforts -->
+        <div class="bg-white rounded-lg shadow-md p-6 mt-8">
+            <h3 class="text-xl font-bold text-gray-900 mb-4">Best Efforts</h3>
+            <div class="overflow-x-auto">
+                <table class="min-w-full divide-y divide-gray-200">
+                    <thead class="bg-gray-50">
+                        <tr>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Effort</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Time</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Pace</th>
+                        </tr>
+                    </thead>
+                    <tbody class="divide-y divide-gray-200">
+                        {{range .Activity.BestEfforts}}
+                        <tr>
+                            <td class="px-4 py-2 text-sm font-medium text-gray-900">
+                                {{.Name}}{{if isNewPR .Name}} <span class="ml-1 px-2 py-0.5 rounded-full bg-yellow-100 text-yellow-800 text-xs font-semibold">PR</span>{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{if .Power}}{{.Power}} W{{else}}{{formatDuration .Duration}}{{end}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{if .Power}}–{{else}}{{calculatePace .Duration .Distance $.UseImperial}}{{end}}</td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
             </div>
         </div>
+        {{end}}
+
+        {{if .Splits}}
+        <!-- Splits -->
+        <div class="bg-white rounded-lg shadow-md p-6 mt-8">
+            <h3 class="text-xl font-bold text-gray-900 mb-4">Splits</h3>
+            <div class="overflow-x-auto">
+                <table class="min-w-full divide-y divide-gray-200">
+                    <thead class="bg-gray-50">
+                        <tr>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">{{if .UseImperial}}Mile{{else}}Km{{end}}</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Time</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Pace</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Elevation</th>
+                            <th class="px-4 py-2 text-left text-xs font-medium text-gray-500 uppercase tracking-wider">Avg HR</th>
+                        </tr>
+                    </thead>
+                    <tbody class="divide-y divide-gray-200">
+                        {{range .Splits}}
+                        <tr>
+                            <td class="px-4 py-2 text-sm font-medium text-gray-900">
+                                {{.Index}}
+                                {{if $.UseImperial}}{{if lt .Distance 1609}}<span class="text-gray-500">({{printf "%.2f mi" (metersToMiles .Distance)}})</span>{{end}}{{else}}{{if lt .Distance 999.5}}<span class="text-gray-500">({{printf "%.2f km" (metersToKm .Distance)}})</span>{{end}}{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{formatDuration .Duration}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{formatDuration .Pace}}{{if $.UseImperial}}/mi{{else}}/km{{end}}</td>
+                            <td class="px-4 py-2 text-sm text-gray-700">
+                                {{if $.UseImperial}}+{{printf "%.0f" (metersToFeet .ElevationGain)}} / -{{printf "%.0f ft" (metersToFeet .ElevationLoss)}}{{else}}+{{printf "%.0f" .ElevationGain}} / -{{printf "%.0f m" .ElevationLoss}}{{end}}
+                            </td>
+                            <td class="px-4 py-2 text-sm text-gray-700">{{if .AvgHeartRate}}{{.AvgHeartRate}} bpm{{else}}–{{end}}</td>
+                        </tr>
+                        {{end}}
+                    </tbody>
+                </table>
+            </div>
+        </div>
+        {{end}}
 
         <!-- Activity Actions -->
         <div class="bg-white rounded-lg shadow-md p-6 mt-8">
@@ -1477,11 +3918,57 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
                 <a href="/stats" class="bg-purple-500 hover:bg-purple-700 text-white font-bold py-2 px-4 rounded transition duration-200">
                     📊 View Stats
                 </a>
+                <div class="relative">
+                    <button type="button" onclick="document.getElementById('export-menu').classList.toggle('hidden')" class="bg-indigo-500 hover:bg-indigo-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+                        ⬇ Export
+                    </button>
+                    <div id="export-menu" class="hidden absolute z-10 mt-2 w-40 bg-white rounded-lg shadow-lg border border-gray-200">
+                        <a href="/api/activities/{{.Activity.ID}}/export?format=gpx" class="block px-4 py-2 text-gray-700 hover:bg-gray-100">GPX</a>
+                        <a href="/api/activities/{{.Activity.ID}}/export?format=tcx" class="block px-4 py-2 text-gray-700 hover:bg-gray-100">TCX</a>
+                        <a href="/api/activities/{{.Activity.ID}}/export?format=geojson" class="block px-4 py-2 text-gray-700 hover:bg-gray-100">GeoJSON</a>
+                        <a href="/api/activities/{{.Activity.ID}}/export?format=kml" class="block px-4 py-2 text-gray-700 hover:bg-gray-100">KML</a>
+                    </div>
+                </div>
+                <button type="button" onclick="document.getElementById('edit-form').classList.toggle('hidden')" class="bg-gray-500 hover:bg-gray-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+                    ✏️ Edit
+                </button>
+                <button type="button" hx-delete="/api/activities/{{.Activity.ID}}" hx-confirm="Delete this activity, its GPS track and the uploaded file? This cannot be undone."
+                        hx-target="#edit-result" class="bg-red-500 hover:bg-red-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+                    🗑 Delete
+                </button>
             </div>
+
+            <!-- Edit Activity -->
+            <form id="edit-form" hx-patch="/api/activities/{{.Activity.ID}}" hx-target="#edit-result" hx-swap="none" class="hidden mt-6 grid md:grid-cols-4 gap-4 items-end">
+                <div class="md:col-span-2">
+                    <label for="edit-name" class="block text-sm font-medium text-gray-700 mb-1">Name</label>
+                    <input type="text" id="edit-name" name="name" value="{{.Activity.Name}}" required
+                           class="w-full px-3 py-2 border border-gray-300 rounded-lg focus:ring-2 focus:ring-blue-500 focus:border-transparent">
+                </div>
+                <div>
+                    <label for="edit-type" class="block text-sm font-medium text-gray-700 mb-1">Type</label>
+                    <select id="edit-type" name="type" class="w-full px-3 py-2 border border-gray-300 rounded-lg">
+                        {{range .ActivityTypes}}
+                        <option value="{{.}}" {{if eq . $.Activity.Type}}selected{{end}}>{{.}}</option>
+                        {{end}}
+                    </select>
+                </div>
+                <button type="submit" class="bg-green-500 hover:bg-green-700 text-white font-bold py-2 px-4 rounded transition duration-200">
+                    Save Changes
+                </button>
+            </form>
+            <div id="edit-result" class="mt-4"></div>
         </div>
     </div>
 
     <script>
+        // Show API errors from the edit/delete controls
+        document.body.addEventListener('htmx:responseError', function(e) {
+            document.getElementById('edit-result').innerHTML =
+                '<div class="p-3 bg-red-100 border border-red-400 text-red-700 rounded"></div>';
+            document.getElementById('edit-result').firstChild.textContent = e.detail.xhr.responseText;
+        });
+
         // Unit toggle functionality
         document.getElementById('unit-toggle').addEventListener('click', function() {
             const currentUnit = this.textContent.trim();
@@ -1568,14 +4055,83 @@ func (h *Handlers) ActivityDetail(w http.ResponseWriter, r *http.Request) {
 				return "🏃"
 			}
 		},
+		"percent": func(fraction float64) int {
+			return int(fraction*100 + 0.5)
+		},
+		"zoneColor": zoneColor,
+	}
+
+	// Keep a custom type selectable even if it is not one of ours
+	activityTypes := append([]string{}, gpx.ActivityTypes...)
+	if !isActivityType(activity.Type) && activity.Type != "" {
+		activityTypes = append(activityTypes, activity.Type)
+	}
+
+	splits := activity.KilometerSplits
+	if useImperial {
+		splits = activity.MileSplits
+	}
+
+	// New PRs depend on every earlier activity of the same type
+	var newPRs []string
+	if len(activity.BestEfforts) > 0 {
+		activities, err := h.storage.GetActivities()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		newPRs = records.Compute(activities).NewPRs(activity.ID)
+	}
+	funcMap["join"] = strings.Join
+	funcMap["isNewPR"] = func(name string) bool {
+		for _, pr := range newPRs {
+			if pr == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Zones are only a summary here, so the page shows without them when
+	// they cannot be worked out
+	var zoneTimes []zoneTime
+	var zoneNote string
+	if activity.MaxHeartRate > 0 {
+		setting, err := h.heartRateZones(r, nil)
+		if err == nil && setting.Zones != nil {
+			zoneTimes, err = h.activityZoneTimes(activity, setting.Zones)
+			zoneNote = zoneSettingNote(setting)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Failed to compute heart rate zones of activity %s: %v\n", activity.ID, err)
+		}
+	}
+
+	hasManualLaps := false
+	for _, lap := range activity.Laps {
+		if lap.Manual {
+			hasManualLaps = true
+		}
 	}
 
 	data := struct {
-		Activity    *models.Activity
-		UseImperial bool
+		Activity      *models.Activity
+		ActivityTypes []string
+		Splits        []models.Split
+		HasManualLaps bool
+		NewPRs        []string
+		HRZones       []zoneTime
+		HRZoneNote    string
+		UseImperial   bool
 	}{
-		Activity:    activity,
-		UseImperial: useImperial,
+		Activity:      activity,
+		ActivityTypes: activityTypes,
+		Splits:        splits,
+		HasManualLaps: hasManualLaps,
+		NewPRs:        newPRs,
+		HRZones:       zoneTimes,
+		HRZoneNote:    zoneNote,
+		UseImperial:   useImperial,
 	}
 
 	t, err := template.New("activity-detail").Funcs(funcMap).Parse(tmpl)
@@ -1603,22 +4159,13 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get activity
-	activities, err := h.storage.GetActivities()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	activity, err := h.storage.GetActivity(activityID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "Activity not found", http.StatusNotFound)
 		return
 	}
-
-	var activity *models.Activity
-	for _, a := range activities {
-		if a.ID == activityID {
-			activity = a
-			break
-		}
-	}
-
-	if activity == nil {
-		http.Error(w, "Activity not found", http.StatusNotFound)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -1627,23 +4174,14 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get GPX track data
-	gpxTracks, err := h.storage.GetGPXTracks()
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Get GPX track data (GPX tracks use the same ID as activities)
+	track, err := h.storage.GetGPXTrack(activity.ID)
+	if err == storage.ErrNotFound {
+		http.Error(w, "GPS track data not found", http.StatusNotFound)
 		return
 	}
-
-	var track *models.GPXTrack
-	for _, t := range gpxTracks {
-		if t.ID == activity.ID { // GPX tracks use the same ID as activities
-			track = t
-			break
-		}
-	}
-
-	if track == nil {
-		http.Error(w, "GPS track data not found", http.StatusNotFound)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -1726,6 +4264,43 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
             <canvas id="elevationChart" width="800" height="200"></canvas>
         </div>
 
+        <!-- Sensor Data -->
+        {{if or .Activity.MaxHeartRate .Activity.MaxCadence .Activity.MaxPower .HasTemperature}}
+        <div class="bg-white rounded-lg shadow-md p-6 mb-6">
+            <h3 class="text-lg font-semibold text-gray-900 mb-4">Sensor Data</h3>
+            <div class="grid grid-cols-2 md:grid-cols-4 gap-4 mb-4">
+                {{if .Activity.MaxHeartRate}}
+                <div class="text-center">
+                    <div class="text-2xl font-bold text-red-600">{{.Activity.AvgHeartRate}} <span class="text-sm text-gray-500">/ {{.Activity.MaxHeartRate}}</span></div>
+                    <div class="text-sm text-gray-500">Heart Rate avg / max (bpm)</div>
+                </div>
+                {{end}}
+                {{if .Activity.MaxCadence}}
+                <div class="text-center">
+                    <div class="text-2xl font-bold text-teal-600">{{.Activity.AvgCadence}} <span class="text-sm text-gray-500">/ {{.Activity.MaxCadence}}</span></div>
+                    <div class="text-sm text-gray-500">Cadence avg / max</div>
+                </div>
+                {{end}}
+                {{if .Activity.MaxPower}}
+                <div class="text-center">
+                    <div class="text-2xl font-bold text-yellow-600">{{.Activity.AvgPower}} <span class="text-sm text-gray-500">/ {{.Activity.MaxPower}}</span></div>
+                    <div class="text-sm text-gray-500">Power avg / max (W)</div>
+                </div>
+                {{end}}
+                {{if .HasTemperature}}
+                <div class="text-center">
+                    <div class="text-2xl font-bold text-indigo-600">
+                        {{if .UseImperial}}{{printf "%.0f–%.0f" (celsiusToFahrenheit .MinTemperature) (celsiusToFahrenheit .MaxTemperature)}}{{else}}{{printf "%.0f–%.0f" .MinTemperature .MaxTemperature}}{{end}}
+                    </div>
+                    <div class="text-sm text-gray-500">Temperature ({{if .UseImperial}}°F{{else}}°C{{end}})</div>
+                </div>
+                {{end}}
+            </div>
+            <canvas id="sensorChart" width="800" height="200"></canvas>
+            <div id="sensorLegend" class="flex space-x-4 text-sm mt-2"></div>
+        </div>
+        {{end}}
+
         <!-- Track Statistics -->
         <div class="grid md:grid-cols-2 gap-6">
             <div class="bg-white rounded-lg shadow-md p-6">
@@ -1814,7 +4389,7 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
         // GPS track data
         const trackPoints = [
             {{range .Track.Points}}
-            [{{.Lat}}, {{.Lon}}, {{.Elevation}}],
+            [{{.Lat}}, {{.Lon}}, {{.Elevation}}, {{.HeartRate}}, {{.Cadence}}, {{.Power}}, {{.Temperature}}],
             {{end}}
         ];
 
@@ -1847,6 +4422,18 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
                 })
             }).addTo(map).bindPopup('Finish');
 
+            // Add a marker for each stop
+            {{range .Activity.Pauses}}
+            L.marker([{{.Lat}}, {{.Lon}}], {
+                icon: L.divIcon({
+                    className: 'custom-div-icon',
+                    html: '<div style="background-color: #F59E0B; color: white; border-radius: 50%; width: 16px; height: 16px; display: flex; align-items: center; justify-content: center; font-weight: bold; font-size: 10px;">P</div>',
+                    iconSize: [16, 16],
+                    iconAnchor: [8, 8]
+                })
+            }).addTo(map).bindPopup({{printf "Stopped at %s for %s" (.StartTime.Format "15:04:05") (formatDuration .Duration)}});
+            {{end}}
+
             // Fit map to track bounds
             map.fitBounds(track.getBounds(), { padding: [20, 20] });
 
@@ -1909,6 +4496,54 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
                 ctx.font = '14px Arial';
                 ctx.fillText('No elevation data available', width / 2 - 80, height / 2);
             }
+
+            // Sensor streams share one chart, each scaled to its own range
+            const sensorCanvas = document.getElementById('sensorChart');
+            if (sensorCanvas) {
+                const sensorCtx = sensorCanvas.getContext('2d');
+                const legend = document.getElementById('sensorLegend');
+                const streams = [
+                    { index: 3, label: 'Heart rate', color: '#EF4444' },
+                    { index: 4, label: 'Cadence', color: '#14B8A6' },
+                    { index: 5, label: 'Power', color: '#EAB308' },
+                    { index: 6, label: 'Temperature', color: '#6366F1' }
+                ];
+
+                streams.forEach(stream => {
+                    const values = trackPoints.map(p => p[stream.index]);
+                    const recorded = values.filter(v => v !== null && (stream.index === 6 || v > 0));
+                    if (recorded.length < 2) {
+                        return;
+                    }
+                    const min = Math.min(...recorded);
+                    const range = (Math.max(...recorded) - min) || 1;
+
+                    sensorCtx.strokeStyle = stream.color;
+                    sensorCtx.lineWidth = 1.5;
+                    sensorCtx.beginPath();
+                    let drawing = false;
+                    values.forEach((value, index) => {
+                        if (value === null || (stream.index !== 6 && value <= 0)) {
+                            drawing = false;
+                            return;
+                        }
+                        const x = 40 + (sensorCanvas.width - 60) * (index / (values.length - 1));
+                        const y = sensorCanvas.height - 20 - ((value - min) / range) * (sensorCanvas.height - 40);
+                        if (drawing) {
+                            sensorCtx.lineTo(x, y);
+                        } else {
+                            sensorCtx.moveTo(x, y);
+                            drawing = true;
+                        }
+                    });
+                    sensorCtx.stroke();
+
+                    const item = document.createElement('span');
+                    item.style.color = stream.color;
+                    item.textContent = '● ' + stream.label;
+                    legend.appendChild(item);
+                });
+            }
         } else {
             // No track data
             map.setView([0, 0], 2);
@@ -1964,16 +4599,41 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
 			}
 			return fmt.Sprintf("%d:%02d", minutes, seconds%60)
 		},
+		"celsiusToFahrenheit": func(celsius float64) float64 {
+			return celsius*9/5 + 32
+		},
+	}
+
+	// Temperature range, for devices that record it
+	var hasTemperature bool
+	var minTemperature, maxTemperature float64
+	for _, point := range track.Points {
+		if point.Temperature == nil {
+			continue
+		}
+		if !hasTemperature || *point.Temperature < minTemperature {
+			minTemperature = *point.Temperature
+		}
+		if !hasTemperature || *point.Temperature > maxTemperature {
+			maxTemperature = *point.Temperature
+		}
+		hasTemperature = true
 	}
 
 	data := struct {
-		Activity    *models.Activity
-		Track       *models.GPXTrack
-		UseImperial bool
+		Activity       *models.Activity
+		Track          *models.GPXTrack
+		UseImperial    bool
+		HasTemperature bool
+		MinTemperature float64
+		MaxTemperature float64
 	}{
-		Activity:    activity,
-		Track:       &enhancedTrack,
-		UseImperial: useImperial,
+		Activity:       activity,
+		Track:          &enhancedTrack,
+		UseImperial:    useImperial,
+		HasTemperature: hasTemperature,
+		MinTemperature: minTemperature,
+		MaxTemperature: maxTemperature,
 	}
 
 	t, err := template.New("gps-track").Funcs(funcMap).Parse(tmpl)
@@ -1985,16 +4645,138 @@ func (h *Handlers) GPSTrack(w http.ResponseWriter, r *http.Request) {
 	t.Execute(w, data)
 }
 
-// Helper type for bulk upload results
+// bulkUpload is one activity file of a bulk upload: an uploaded file or a
+// file in an uploaded export archive. Its content is read by the job task
+// that imports it.
+type bulkUpload struct {
+	name     string
+	read     func() ([]byte, error)    // returns the decompressed content
+	metadata *importer.ArchiveMetadata // from the archive's activities.csv
+	err      string                    // why the file could not be read
+}
+
+// openBulkUploads lists the activity files of a bulk upload. Uploads are
+// copied to temporary files, as the request's copies are removed when the
+// handler returns, and export archives are only listed. The returned function
+// removes the temporary files once every file has been read.
+func openBulkUploads(fileHeaders []*multipart.FileHeader) ([]bulkUpload, func()) {
+	var uploads []bulkUpload
+	var temp []*os.File
+	var archives []*importer.Archive
+	closeAll := func() {
+		for _, archive := range archives {
+			archive.Close()
+		}
+		for _, tmp := range temp {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}
+
+	for _, fileHeader := range fileHeaders {
+		name := fileHeader.Filename
+		tmp, err := copyUpload(fileHeader)
+		if err != nil {
+			fmt.Printf("ERROR: Failed to save upload %s: %v\n", name, err)
+			uploads = append(uploads, bulkUpload{name: name, err: "Failed to read file content"})
+			continue
+		}
+		temp = append(temp, tmp)
+
+		head := make([]byte, 4)
+		n, _ := tmp.ReadAt(head, 0)
+		if !importer.IsZIP(head[:n]) {
+			size := fileHeader.Size
+			if size > importer.MaxFileSize {
+				uploads = append(uploads, bulkUpload{name: name, err: fmt.Sprintf("File is larger than %d MB", importer.MaxFileSize>>20)})
+				continue
+			}
+			uploads = append(uploads, bulkUpload{name: name, read: func() ([]byte, error) {
+				data, err := ioutil.ReadAll(io.NewSectionReader(tmp, 0, size))
+				if err != nil {
+					return nil, errors.New("Failed to read file content")
+				}
+				if data, err = importer.Decompress(data); err != nil {
+					return nil, fmt.Errorf("Invalid gzip file: %v", err)
+				}
+				return data, nil
+			}})
+			continue
+		}
+
+		archive, err := importer.OpenArchive(tmp, fileHeader.Size)
+		if err != nil {
+			uploads = append(uploads, bulkUpload{name: name, err: err.Error()})
+			continue
+		}
+		archives = append(archives, archive)
+		if len(archive.Files) == 0 {
+			uploads = append(uploads, bulkUpload{name: name, err: "Archive contains no GPX, FIT or TCX files"})
+			continue
+		}
+		for _, f := range archive.Files {
+			uploads = append(uploads, bulkUpload{name: f.Name, read: f.Read, metadata: f.Metadata})
+		}
+	}
+	return uploads, closeAll
+}
+
+// copyUpload copies an uploaded file to a temporary file, which the caller
+// closes and removes.
+func copyUpload(fileHeader *multipart.FileHeader) (*os.File, error) {
+	file, err := fileHeader.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tmp, err := os.CreateTemp("", "bulk-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(tmp, file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	return tmp, nil
+}
+
+// BulkUploadResult is the outcome of importing one file of a bulk upload,
+// reported in the import job's progress.
 type BulkUploadResult struct {
-	FileName     string
-	Index        int
-	Total        int
-	Status       string // "success" or "error"
-	Error        string
-	ActivityName string
-	Distance     float64 // in km
-	Duration     int     // in seconds
+	FileName     string  `json:"file_name"`
+	Index        int     `json:"index"`
+	Total        int     `json:"total"`
+	Status       string  `json:"status"` // "success", "duplicate" or "error"
+	Error        string  `json:"error,omitempty"`
+	ActivityID   string  `json:"activity_id,omitempty"`
+	ActivityName string  `json:"activity_name,omitempty"`
+	Distance     float64 `json:"distance,omitempty"`     // in km
+	Duration     int     `json:"duration,omitempty"`     // in seconds
+	DuplicateOf  string  `json:"duplicate_of,omitempty"` // name of the existing activity, for duplicates
+	DuplicateID  string  `json:"duplicate_id,omitempty"`
+	Merged       bool    `json:"merged,omitempty"` // the duplicate's data was merged into the existing activity
+}
+
+// resolveDuplicate looks for an activity in candidates that activity
+// duplicates. Unless onDuplicate is importer.DuplicateKeep it returns that
+// activity, after merging activity's extra data into it for
+// importer.DuplicateMerge; merged reports whether the merge changed anything.
+// A nil duplicate means activity should be saved.
+func (h *Handlers) resolveDuplicate(activity *models.Activity, candidates []*models.Activity, onDuplicate string) (duplicate *models.Activity, merged bool, err error) {
+	if onDuplicate == importer.DuplicateKeep {
+		return nil, false, nil
+	}
+	duplicate = importer.FindDuplicate(activity, candidates)
+	if duplicate == nil || onDuplicate != importer.DuplicateMerge {
+		return duplicate, false, nil
+	}
+
+	if merged = importer.Merge(duplicate, activity); merged {
+		err = h.storage.UpdateActivity(duplicate)
+	}
+	return duplicate, merged, err
 }
 
 func (h *Handlers) RecalculateElevation(w http.ResponseWriter, r *http.Request) {
@@ -2028,7 +4810,7 @@ func (h *Handlers) RecalculateElevation(w http.ResponseWriter, r *http.Request)
 		}
 
 		// Reparse the GPX with current algorithm
-		track, newActivity, err := gpx.ParseGPX(string(gpxData))
+		track, newActivity, err := importer.Parse(gpxData)
 		if err != nil {
 			fmt.Printf("Warning: Could not parse GPX file %s: %v\n", gpxPath, err)
 			errors++
@@ -2041,6 +4823,45 @@ func (h *Handlers) RecalculateElevation(w http.ResponseWriter, r *http.Request)
 		activity.Duration = newActivity.Duration
 		activity.AvgSpeed = newActivity.AvgSpeed
 		activity.MaxSpeed = newActivity.MaxSpeed
+		activity.MovingTime = newActivity.MovingTime
+		activity.ElapsedTime = newActivity.ElapsedTime
+		activity.Pauses = newActivity.Pauses
+		activity.KilometerSplits = newActivity.KilometerSplits
+		activity.MileSplits = newActivity.MileSplits
+		activity.BestEfforts = newActivity.BestEfforts
+		activity.AvgHeartRate = newActivity.AvgHeartRate
+		activity.MaxHeartRate = newActivity.MaxHeartRate
+		activity.AvgCadence = newActivity.AvgCadence
+		activity.MaxCadence = newActivity.MaxCadence
+		activity.AvgPower = newActivity.AvgPower
+		activity.MaxPower = newActivity.MaxPower
+		activity.HeartRateTime = zones.TimeAtHeartRates(track.Points)
+		// Device and calories are only filled in; calories may have been entered by hand
+		if activity.Device == nil {
+			activity.Device = newActivity.Device
+		}
+		if activity.Calories == 0 {
+			activity.Calories = newActivity.Calories
+		}
+		// Activities uploaded before duplicate detection get their fingerprint
+		if activity.FileHash == "" {
+			activity.FileHash = importer.FileHash(gpxData)
+		}
+		// Laps come from the file again; manual laps are the user's and stay
+		laps := newActivity.Laps
+		for _, lap := range activity.Laps {
+			if lap.Manual {
+				laps = append(laps, lap)
+			}
+		}
+		activity.Laps = sortLaps(laps)
+		// Activities imported before type detection get a detected type;
+		// user-chosen types are left alone
+		if activity.TypeSource == "" {
+			activity.Type = newActivity.Type
+			activity.TypeSource = newActivity.TypeSource
+			activity.TypeConfidence = newActivity.TypeConfidence
+		}
 
 		// Save updated activity
 		if err := h.storage.SaveActivity(activity); err != nil {
@@ -2061,6 +4882,12 @@ func (h *Handlers) RecalculateElevation(w http.ResponseWriter, r *http.Request)
 		fmt.Printf("INFO: Recalculated elevation for activity %s: %.2fm\n", activity.ID, activity.TotalElevation)
 	}
 
+	// Older activities may have been given a file hash; the next import
+	// rebuilds the duplicate index
+	h.importMu.Lock()
+	h.duplicates = nil
+	h.importMu.Unlock()
+
 	w.Header().Set("Content-Type", "text/html")
 	if errors == 0 {
 		w.Write([]byte(fmt.Sprintf(`<div class="p-3 bg-green-100 border border-green-400 text-green-700 rounded">✓ Recalculated elevation for %d activities</div>`, recalculated)))
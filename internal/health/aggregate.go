@@ -0,0 +1,142 @@
+// Package health contains helpers for working with health metrics that are
+// independent of how they are stored.
+package health
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Bucket sizes accepted by Aggregate.
+const (
+	BucketHour = "hour"
+	BucketDay  = "day"
+	BucketWeek = "week"
+)
+
+// Aggregation functions accepted by Aggregate.
+const (
+	AggAvg  = "avg"
+	AggMin  = "min"
+	AggMax  = "max"
+	AggSum  = "sum"
+	AggLast = "last"
+)
+
+// Bucket is the aggregated value of one metric type over one time bucket.
+type Bucket struct {
+	Start time.Time `json:"start"`
+	Type  string    `json:"type"`
+	Value float64   `json:"value"`
+	Unit  string    `json:"unit"`
+	Count int       `json:"count"` // number of metrics in the bucket
+}
+
+// ValidBucket reports whether bucket is a supported bucket size.
+func ValidBucket(bucket string) bool {
+	return bucket == BucketHour || bucket == BucketDay || bucket == BucketWeek
+}
+
+// ValidAgg reports whether agg is a supported aggregation function.
+func ValidAgg(agg string) bool {
+	switch agg {
+	case AggAvg, AggMin, AggMax, AggSum, AggLast:
+		return true
+	}
+	return false
+}
+
+// BucketStart returns the start of the bucket containing t. Days and weeks
+// follow the calendar in loc, and weeks start on Monday.
+func BucketStart(t time.Time, bucket string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch bucket {
+	case BucketHour:
+		return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+	case BucketWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		offset := (int(day.Weekday()) + 6) % 7 // days since Monday
+		return day.AddDate(0, 0, -offset)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+}
+
+// Aggregate groups metrics by type and time bucket and reduces each group
+// with agg. Buckets are returned ordered by type, then start time; buckets
+// with no metrics are omitted.
+func Aggregate(metrics []*models.HealthMetric, bucket, agg string, loc *time.Location) ([]Bucket, error) {
+	if !ValidBucket(bucket) {
+		return nil, fmt.Errorf("invalid bucket %q: use hour, day or week", bucket)
+	}
+	if !ValidAgg(agg) {
+		return nil, fmt.Errorf("invalid agg %q: use avg, min, max, sum or last", agg)
+	}
+	if loc == nil {
+		loc = time.Local
+	}
+
+	type key struct {
+		metricType string
+		start      int64
+	}
+	type group struct {
+		bucket Bucket
+		latest time.Time
+	}
+
+	groups := make(map[key]*group)
+	for _, metric := range metrics {
+		start := BucketStart(metric.Timestamp, bucket, loc)
+		k := key{metric.Type, start.UnixNano()}
+		g, ok := groups[k]
+		if !ok {
+			g = &group{
+				bucket: Bucket{Start: start, Type: metric.Type, Unit: metric.Unit, Value: metric.Value},
+				latest: metric.Timestamp,
+			}
+			g.bucket.Count = 1
+			groups[k] = g
+			continue
+		}
+
+		g.bucket.Count++
+		switch agg {
+		case AggAvg, AggSum:
+			g.bucket.Value += metric.Value
+		case AggMin:
+			if metric.Value < g.bucket.Value {
+				g.bucket.Value = metric.Value
+			}
+		case AggMax:
+			if metric.Value > g.bucket.Value {
+				g.bucket.Value = metric.Value
+			}
+		case AggLast:
+			if !metric.Timestamp.Before(g.latest) {
+				g.bucket.Value = metric.Value
+				g.latest = metric.Timestamp
+			}
+		}
+	}
+
+	buckets := make([]Bucket, 0, len(groups))
+	for _, g := range groups {
+		if agg == AggAvg {
+			g.bucket.Value /= float64(g.bucket.Count)
+		}
+		buckets = append(buckets, g.bucket)
+	}
+
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Type != buckets[j].Type {
+			return buckets[i].Type < buckets[j].Type
+		}
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+
+	return buckets, nil
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestBucketStart(t *testing.T) {
+	loc := time.FixedZone("test", -5*3600)
+	// Wednesday 2024-05-01 03:30 UTC is Tuesday 22:30 in loc
+	ts := time.Date(2024, 5, 1, 3, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		bucket   string
+		expected time.Time
+	}{
+		{BucketHour, time.Date(2024, 4, 30, 22, 0, 0, 0, loc)},
+		{BucketDay, time.Date(2024, 4, 30, 0, 0, 0, 0, loc)},
+		{BucketWeek, time.Date(2024, 4, 29, 0, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bucket, func(t *testing.T) {
+			if got := BucketStart(ts, tt.bucket, loc); !got.Equal(tt.expected) {
+				t.Errorf("BucketStart() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	day1 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	metrics := []*models.HealthMetric{
+		{Type: "heart_rate", Value: 60, Unit: "bpm", Timestamp: day1.Add(8 * time.Hour)},
+		{Type: "heart_rate", Value: 70, Unit: "bpm", Timestamp: day1.Add(20 * time.Hour)},
+		{Type: "heart_rate", Value: 50, Unit: "bpm", Timestamp: day1.Add(2 * time.Hour)},
+		{Type: "heart_rate", Value: 55, Unit: "bpm", Timestamp: day2.Add(6 * time.Hour)},
+		{Type: "steps", Value: 4000, Unit: "count", Timestamp: day1.Add(12 * time.Hour)},
+	}
+
+	tests := []struct {
+		agg      string
+		expected []float64 // heart_rate day1, heart_rate day2, steps day1
+	}{
+		{AggAvg, []float64{60, 55, 4000}},
+		{AggMin, []float64{50, 55, 4000}},
+		{AggMax, []float64{70, 55, 4000}},
+		{AggSum, []float64{180, 55, 4000}},
+		{AggLast, []float64{70, 55, 4000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.agg, func(t *testing.T) {
+			buckets, err := Aggregate(metrics, BucketDay, tt.agg, time.UTC)
+			if err != nil {
+				t.Fatalf("Aggregate() error = %v", err)
+			}
+			if len(buckets) != len(tt.expected) {
+				t.Fatalf("Expected %d buckets, got %+v", len(tt.expected), buckets)
+			}
+			for i, expected := range tt.expected {
+				if math.Abs(buckets[i].Value-expected) > 1e-9 {
+					t.Errorf("Bucket %d (%s %v) = %v, expected %v", i, buckets[i].Type, buckets[i].Start, buckets[i].Value, expected)
+				}
+			}
+			if buckets[0].Count != 3 || buckets[0].Unit != "bpm" {
+				t.Errorf("Unexpected first bucket %+v", buckets[0])
+			}
+		})
+	}
+
+	if _, err := Aggregate(metrics, "month", AggAvg, time.UTC); err == nil {
+		t.Error("Expected an error for an unsupported bucket")
+	}
+	if _, err := Aggregate(metrics, BucketDay, "median", time.UTC); err == nil {
+		t.Error("Expected an error for an unsupported aggregation")
+	}
+}
@@ -0,0 +1,332 @@
+package health
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// CSVHeader are the columns WriteCSV writes. GuessMapping maps them without
+// any configuration, so exported files import again as they are.
+var CSVHeader = []string{"timestamp", "type", "value", "unit", "source"}
+
+// WriteCSV writes metrics as CSV with the CSVHeader columns.
+func WriteCSV(w io.Writer, metrics []*models.HealthMetric) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(CSVHeader); err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		err := writer.Write([]string{
+			metric.Timestamp.Format(time.RFC3339Nano),
+			metric.Type,
+			strconv.FormatFloat(metric.Value, 'f', -1, 64),
+			metric.Unit,
+			metric.Source,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// CSVTable is a parsed CSV file: its header row and the rows below it.
+type CSVTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+// ReadCSV parses a CSV file whose first row names the columns. Commas,
+// semicolons and tabs are accepted as delimiters, and a leading byte order
+// mark is ignored.
+func ReadCSV(data []byte) (*CSVTable, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = delimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the CSV file is empty")
+	}
+	header := make([]string, len(rows[0]))
+	for i, name := range rows[0] {
+		header[i] = strings.TrimSpace(name)
+	}
+	return &CSVTable{Header: header, Rows: rows[1:]}, nil
+}
+
+// delimiter returns the most frequent candidate delimiter in the header line.
+func delimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, candidate := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(candidate))); n > count {
+			best, count = candidate, n
+		}
+	}
+	return best
+}
+
+// CSVMapping says which CSV columns hold the fields of a health metric.
+// Columns are named by their header; an empty name means the file has no
+// such column and the matching default is used instead.
+type CSVMapping struct {
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Unit      string `json:"unit"`
+	Source    string `json:"source"`
+
+	DefaultType   string `json:"default_type"`
+	DefaultUnit   string `json:"default_unit"`
+	DefaultSource string `json:"default_source"`
+
+	// TimestampFormat is a Go time layout. When empty, RFC 3339, common date
+	// and time formats and Unix timestamps are recognized.
+	TimestampFormat string `json:"timestamp_format"`
+}
+
+// columnNames are the lowercase header names GuessMapping recognizes for
+// each field, most specific first.
+var columnNames = map[string][]string{
+	"timestamp": {"timestamp", "datetime", "date_time", "date/time", "recorded_at", "start_date", "startdate", "date", "day", "time"},
+	"type":      {"type", "metric", "metric_type", "measurement", "name"},
+	"value":     {"value", "amount", "quantity", "qty", "reading"},
+	"unit":      {"unit", "units"},
+	"source":    {"source", "source_name", "sourcename", "device", "app"},
+}
+
+// columnWithUnit matches headers like "Weight (kg)" or "Resting HR [bpm]".
+var columnWithUnit = regexp.MustCompile(`^(.*?)\s*[(\[]([^)\]]+)[)\]]$`)
+
+// GuessMapping maps columns by their header names. A file with a timestamp
+// and a single other column, like a spreadsheet with "Date" and
+// "Weight (kg)", is read as that column's values, with the type and unit
+// taken from its header.
+func GuessMapping(header []string) CSVMapping {
+	find := func(field string) string {
+		for _, name := range columnNames[field] {
+			for _, column := range header {
+				if strings.EqualFold(strings.TrimSpace(column), name) {
+					return column
+				}
+			}
+		}
+		return ""
+	}
+
+	mapping := CSVMapping{
+		Timestamp: find("timestamp"),
+		Type:      find("type"),
+		Value:     find("value"),
+		Unit:      find("unit"),
+		Source:    find("source"),
+	}
+
+	if mapping.Value == "" && mapping.Timestamp != "" && len(header) == 2 {
+		for _, column := range header {
+			if column == mapping.Timestamp || column == mapping.Type || column == mapping.Unit || column == mapping.Source {
+				continue
+			}
+			mapping.Value = column
+			if mapping.Type == "" {
+				name := column
+				if match := columnWithUnit.FindStringSubmatch(column); match != nil {
+					name = match[1]
+					if mapping.Unit == "" {
+						mapping.DefaultUnit = strings.TrimSpace(match[2])
+					}
+				}
+				mapping.DefaultType = NormalizeType(name)
+			}
+		}
+	}
+	return mapping
+}
+
+// Validate checks that the mapping names columns of header and can fill in
+// the timestamp, type and value of every metric.
+func (m CSVMapping) Validate(header []string) error {
+	columns := []struct{ field, column string }{
+		{"timestamp", m.Timestamp}, {"type", m.Type}, {"value", m.Value}, {"unit", m.Unit}, {"source", m.Source},
+	}
+	for _, c := range columns {
+		if c.column != "" && columnIndex(header, c.column) < 0 {
+			return fmt.Errorf("the file has no %q column for the %s", c.column, c.field)
+		}
+	}
+	if m.Timestamp == "" {
+		return fmt.Errorf("choose the column holding the timestamp")
+	}
+	if m.Value == "" {
+		return fmt.Errorf("choose the column holding the value")
+	}
+	if m.Type == "" && NormalizeType(m.DefaultType) == "" {
+		return fmt.Errorf("choose the column holding the metric type, or enter a type for every row")
+	}
+	return nil
+}
+
+// Metrics converts the table's rows into health metrics using mapping.
+// Timestamps without a time zone are read in loc, and values are converted
+// to their type's canonical unit by NormalizeMetric. Rows without a value
+// are skipped; every other row that cannot be read or is not plausible is
+// reported as an error naming its line, and no metrics are returned if
+// there are any.
+func (t *CSVTable) Metrics(mapping CSVMapping, loc *time.Location) ([]models.HealthMetric, []error) {
+	if err := mapping.Validate(t.Header); err != nil {
+		return nil, []error{err}
+	}
+
+	cell := func(row []string, column string) string {
+		if i := columnIndex(t.Header, column); i >= 0 && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var metrics []models.HealthMetric
+	var errs []error
+	for i, row := range t.Rows {
+		line := i + 2 // the header is line 1
+		value := cell(row, mapping.Value)
+		if value == "" {
+			continue
+		}
+
+		metric := models.HealthMetric{
+			Type:   NormalizeType(cell(row, mapping.Type)),
+			Unit:   cell(row, mapping.Unit),
+			Source: cell(row, mapping.Source),
+		}
+		if metric.Type == "" {
+			metric.Type = NormalizeType(mapping.DefaultType)
+		}
+		if metric.Unit == "" {
+			metric.Unit = mapping.DefaultUnit
+		}
+		if metric.Source == "" {
+			metric.Source = mapping.DefaultSource
+		}
+
+		var err error
+		if metric.Value, err = parseValue(value); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: invalid value %q", line, value))
+			continue
+		}
+		if metric.Timestamp, err = parseTimestamp(cell(row, mapping.Timestamp), mapping.TimestampFormat, loc); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", line, err))
+			continue
+		}
+		if metric.Type == "" {
+			errs = append(errs, fmt.Errorf("line %d: no metric type", line))
+			continue
+		}
+		if err := NormalizeMetric(&metric); err != nil {
+			errs = append(errs, fmt.Errorf("line %d: %v", line, err))
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return metrics, nil
+}
+
+func columnIndex(header []string, column string) int {
+	for i, name := range header {
+		if name == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// NormalizeType turns a metric name like "Resting Heart Rate" into the
+// snake_case type used for stored metrics, "resting_heart_rate".
+func NormalizeType(name string) string {
+	fields := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(fields, "_")
+}
+
+// parseValue parses a number, accepting a decimal comma as spreadsheets in
+// many locales write it.
+func parseValue(value string) (float64, error) {
+	if v, err := strconv.ParseFloat(value, 64); err == nil {
+		return v, nil
+	}
+	if strings.Count(value, ",") == 1 && !strings.Contains(value, ".") {
+		return strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	}
+	return 0, fmt.Errorf("invalid number %q", value)
+}
+
+// timestampLayouts are tried in order when a mapping has no TimestampFormat.
+// Slashed dates are read month first, as US apps write them.
+var timestampLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02",
+	"01/02/2006 15:04:05",
+	"01/02/2006 15:04",
+	"01/02/2006",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+func parseTimestamp(value, layout string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("no timestamp")
+	}
+	if layout != "" {
+		t, err := time.ParseInLocation(layout, value, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("timestamp %q does not match the format %q", value, layout)
+		}
+		return t, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	// Unix timestamps, in milliseconds when too large to be seconds
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && n > 0 {
+		if n > 1e11 {
+			return time.UnixMilli(n), nil
+		}
+		return time.Unix(n, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
@@ -0,0 +1,175 @@
+package health
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestWriteCSVRoundTrip(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)
+	metrics := []*models.HealthMetric{
+		{Type: "heart_rate", Value: 52, Unit: "bpm", Timestamp: ts, Source: "oura"},
+		{Type: "weight", Value: 71.35, Unit: "kg", Timestamp: ts.Add(time.Hour), Source: "scale, bathroom"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, metrics); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "timestamp,type,value,unit,source\n2024-05-01T07:30:00Z,heart_rate,52,bpm,oura\n") {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+
+	table, err := ReadCSV(buf.Bytes())
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	parsed, errs := table.Metrics(GuessMapping(table.Header), time.UTC)
+	if len(errs) > 0 {
+		t.Fatalf("Metrics() errors = %v", errs)
+	}
+	if len(parsed) != len(metrics) {
+		t.Fatalf("Expected %d metrics, got %d", len(metrics), len(parsed))
+	}
+	for i, metric := range parsed {
+		original := metrics[i]
+		if metric.Type != original.Type || metric.Value != original.Value || metric.Unit != original.Unit ||
+			metric.Source != original.Source || !metric.Timestamp.Equal(original.Timestamp) {
+			t.Errorf("Metric %d = %+v, expected %+v", i, metric, *original)
+		}
+	}
+}
+
+func TestGuessMapping(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []string
+		expected CSVMapping
+	}{
+		{
+			name:     "export",
+			header:   CSVHeader,
+			expected: CSVMapping{Timestamp: "timestamp", Type: "type", Value: "value", Unit: "unit", Source: "source"},
+		},
+		{
+			name:     "app export",
+			header:   []string{"Date/Time", "Metric", "Amount", "Units", "Device"},
+			expected: CSVMapping{Timestamp: "Date/Time", Type: "Metric", Value: "Amount", Unit: "Units", Source: "Device"},
+		},
+		{
+			name:     "spreadsheet",
+			header:   []string{"Date", "Body Weight (kg)"},
+			expected: CSVMapping{Timestamp: "Date", Value: "Body Weight (kg)", DefaultType: "body_weight", DefaultUnit: "kg"},
+		},
+		{
+			name:     "unknown",
+			header:   []string{"a", "b", "c"},
+			expected: CSVMapping{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GuessMapping(tt.header); got != tt.expected {
+				t.Errorf("GuessMapping() = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCSVTableMetrics(t *testing.T) {
+	loc := time.FixedZone("test", 2*3600)
+	data := "\ufeffDay;Steps;Note\n" +
+		"02.05.2024;8500;\n" +
+		"03.05.2024;;rest day\n" +
+		"04.05.2024;10234,5;\n"
+	table, err := ReadCSV([]byte(data))
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	if strings.Join(table.Header, "|") != "Day|Steps|Note" {
+		t.Fatalf("Header = %q", table.Header)
+	}
+
+	mapping := CSVMapping{Timestamp: "Day", Value: "Steps", DefaultType: "Steps", DefaultUnit: "count", DefaultSource: "spreadsheet"}
+	metrics, errs := table.Metrics(mapping, loc)
+	if len(errs) > 0 {
+		t.Fatalf("Metrics() errors = %v", errs)
+	}
+	// The row without a value is skipped
+	if len(metrics) != 2 {
+		t.Fatalf("Expected 2 metrics, got %+v", metrics)
+	}
+	expected := models.HealthMetric{Type: "steps", Value: 10234.5, Unit: "count", Source: "spreadsheet", Timestamp: time.Date(2024, 5, 4, 0, 0, 0, 0, loc)}
+	if got := metrics[1]; got.Type != expected.Type || got.Value != expected.Value || got.Unit != expected.Unit ||
+		got.Source != expected.Source || !got.Timestamp.Equal(expected.Timestamp) {
+		t.Errorf("Metric = %+v, expected %+v", got, expected)
+	}
+
+	// Rows that cannot be read are all reported, and nothing is imported
+	table.Rows = append(table.Rows, []string{"yesterday", "1"}, []string{"05.05.2024", "many"})
+	metrics, errs = table.Metrics(mapping, loc)
+	if metrics != nil || len(errs) != 2 {
+		t.Fatalf("Expected 2 errors and no metrics, got %v, %v", metrics, errs)
+	}
+	if !strings.Contains(errs[0].Error(), "line 5") || !strings.Contains(errs[1].Error(), "line 6") {
+		t.Errorf("Errors = %v, expected line numbers 5 and 6", errs)
+	}
+
+	if _, errs := table.Metrics(CSVMapping{Timestamp: "Day", Value: "Steps"}, loc); len(errs) != 1 {
+		t.Errorf("Expected an error for a mapping without a type, got %v", errs)
+	}
+	if _, errs := table.Metrics(CSVMapping{Timestamp: "Date", Value: "Steps", DefaultType: "steps"}, loc); len(errs) != 1 {
+		t.Errorf("Expected an error for a missing column, got %v", errs)
+	}
+}
+
+func TestTableMetricsNormalizes(t *testing.T) {
+	table, err := ReadCSV([]byte("Date,Weight (lb)\n2024-05-01,180\n2024-05-02,18000\n"))
+	if err != nil {
+		t.Fatalf("ReadCSV() error = %v", err)
+	}
+	mapping := GuessMapping(table.Header)
+	if _, errs := table.Metrics(mapping, time.UTC); len(errs) != 1 || !strings.Contains(errs[0].Error(), "line 3") {
+		t.Fatalf("Expected an error for line 3, got %v", errs)
+	}
+
+	table.Rows = table.Rows[:1]
+	metrics, errs := table.Metrics(mapping, time.UTC)
+	if len(errs) > 0 {
+		t.Fatalf("Metrics() errors = %v", errs)
+	}
+	if got := metrics[0]; got.Type != "weight" || got.Value != 81.6466 || got.Unit != "kg" {
+		t.Errorf("Metric = %s %v %s, expected weight 81.6466 kg", got.Type, got.Value, got.Unit)
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	loc := time.FixedZone("test", -5*3600)
+	tests := []struct {
+		value, layout string
+		expected      time.Time
+	}{
+		{"2024-05-01T07:30:00Z", "", time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)},
+		{"2024-05-01 07:30:00 +0200", "", time.Date(2024, 5, 1, 5, 30, 0, 0, time.UTC)},
+		{"2024-05-01 07:30", "", time.Date(2024, 5, 1, 7, 30, 0, 0, loc)},
+		{"05/01/2024", "", time.Date(2024, 5, 1, 0, 0, 0, 0, loc)},
+		{"1714548600", "", time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)},
+		{"1714548600000", "", time.Date(2024, 5, 1, 7, 30, 0, 0, time.UTC)},
+		{"01/05/2024", "02/01/2006", time.Date(2024, 5, 1, 0, 0, 0, 0, loc)},
+	}
+
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.value, tt.layout, loc)
+		if err != nil || !got.Equal(tt.expected) {
+			t.Errorf("parseTimestamp(%q, %q) = %v, %v, expected %v", tt.value, tt.layout, got, err, tt.expected)
+		}
+	}
+	if _, err := parseTimestamp("2024-05-01", "02/01/2006", loc); err == nil {
+		t.Error("Expected an error for a timestamp not matching the format")
+	}
+}
@@ -0,0 +1,207 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"health-hub/internal/models"
+)
+
+// CustomPrefix starts the types of metrics that are not in the registry.
+// Their values are stored as uploaded, in whatever unit they come in.
+const CustomPrefix = "custom_"
+
+// MetricType is a known type of health metric. Values are stored in its
+// canonical Unit and must lie between Min and Max in it, which only rules
+// out values that cannot be right, such as a weight sent in grams.
+type MetricType struct {
+	Name      string
+	Unit      string
+	Min, Max  float64
+	dimension string
+}
+
+// metricTypes is the registry of known metric types, covering what the
+// importers produce and the usual manual entries.
+var metricTypes = map[string]MetricType{}
+
+func init() {
+	for _, t := range []MetricType{
+		{"heart_rate", "bpm", minRestingHR, maxHeartRate, "frequency"},
+		{"resting_heart_rate", "bpm", minRestingHR, maxRestingHR, "frequency"},
+		{"walking_heart_rate", "bpm", minRestingHR, maxHeartRate, "frequency"},
+		{"hrv", "ms", 0, maxHRV, "time"},
+		{"respiratory_rate", "breaths/min", 1, 80, "frequency"},
+		{"oxygen_saturation", "%", 50, 100, "percent"},
+		{"vo2_max", "mL/kg/min", 5, 100, "vo2"},
+		{"steps", "count", 0, 200000, "count"},
+		{"flights_climbed", "count", 0, 1000, "count"},
+		{"heart_points", "count", 0, 1000, "count"},
+		{"distance", "m", 0, 1000000, "length"},
+		{"distance_walking_running", "m", 0, 1000000, "length"},
+		{"distance_cycling", "m", 0, 1000000, "length"},
+		{"calories", "kcal", 0, 20000, "energy"},
+		{"active_energy", "kcal", 0, 20000, "energy"},
+		{"basal_energy", "kcal", 0, 20000, "energy"},
+		{"exercise_time", "min", 0, maxSleepMinutes, "time"},
+		{"stand_time", "min", 0, maxSleepMinutes, "time"},
+		{"move_minutes", "min", 0, maxSleepMinutes, "time"},
+		{"sleep_duration", "min", 0, maxSleepMinutes, "time"},
+		{"sleep_score", "score", 0, 100, "score"},
+		{"readiness_score", "score", 0, 100, "score"},
+		{"weight", "kg", 2, 500, "mass"},
+		{"lean_body_mass", "kg", 1, 300, "mass"},
+		{"body_fat", "%", 1, 75, "percent"},
+		{"bmi", "count", 8, 100, "count"},
+		{"height", "cm", 40, 280, "length"},
+		{"body_temperature", "°C", 30, 45, "temperature"},
+		{"wrist_temperature", "°C", 25, 45, "temperature"},
+		{"temperature_deviation", "°C", -5, 5, "temperature difference"},
+		{"blood_pressure_systolic", "mmHg", 50, 300, "pressure"},
+		{"blood_pressure_diastolic", "mmHg", 20, 200, "pressure"},
+		{"water", "mL", 0, 20000, "volume"},
+	} {
+		metricTypes[t.Name] = t
+	}
+}
+
+// typeAliases are other names for registered types, as spreadsheets and
+// other apps write them.
+var typeAliases = map[string]string{
+	"hr":                     "heart_rate",
+	"pulse":                  "heart_rate",
+	"resting_hr":             "resting_heart_rate",
+	"heart_rate_variability": "hrv",
+	"step_count":             "steps",
+	"body_weight":            "weight",
+	"body_mass":              "weight",
+	"body_fat_percentage":    "body_fat",
+	"spo2":                   "oxygen_saturation",
+	"sleep":                  "sleep_duration",
+	"time_asleep":            "sleep_duration",
+	"temperature":            "body_temperature",
+}
+
+// unit converts a value to the base unit of its dimension: value*factor +
+// offset.
+type unit struct {
+	factor, offset float64
+}
+
+// units are the units accepted for each dimension, by their lowercase
+// names. Canonical units are among them.
+var units = map[string]map[string]unit{
+	"frequency": {
+		"bpm": {1, 0}, "beats/min": {1, 0}, "count/min": {1, 0}, "/min": {1, 0},
+		"breaths/min": {1, 0}, "brpm": {1, 0},
+	},
+	"time": {
+		"ms": {0.001, 0}, "s": {1, 0}, "sec": {1, 0}, "seconds": {1, 0},
+		"min": {60, 0}, "mins": {60, 0}, "minutes": {60, 0},
+		"h": {3600, 0}, "hr": {3600, 0}, "hrs": {3600, 0}, "hour": {3600, 0}, "hours": {3600, 0},
+	},
+	"percent": {"%": {1, 0}, "percent": {1, 0}},
+	"vo2":     {"ml/kg/min": {1, 0}, "ml/min·kg": {1, 0}, "ml/(kg·min)": {1, 0}},
+	"count": {
+		"count": {1, 0}, "steps": {1, 0}, "floors": {1, 0}, "points": {1, 0},
+		"kg/m²": {1, 0}, "kg/m2": {1, 0},
+	},
+	"score": {"score": {1, 0}, "points": {1, 0}, "%": {1, 0}},
+	"length": {
+		"m": {1, 0}, "meters": {1, 0}, "metres": {1, 0}, "km": {1000, 0}, "cm": {0.01, 0}, "mm": {0.001, 0},
+		"mi": {1609.344, 0}, "miles": {1609.344, 0}, "yd": {0.9144, 0}, "ft": {0.3048, 0}, "in": {0.0254, 0},
+	},
+	"energy": {"kcal": {1, 0}, "cal": {1, 0}, "calories": {1, 0}, "kj": {1 / 4.184, 0}},
+	"mass": {
+		"kg": {1, 0}, "kgs": {1, 0}, "g": {0.001, 0},
+		"lb": {0.45359237, 0}, "lbs": {0.45359237, 0}, "pounds": {0.45359237, 0},
+		"st": {6.35029318, 0}, "stone": {6.35029318, 0}, "oz": {0.028349523125, 0},
+	},
+	"temperature": {
+		"°c": {1, 0}, "c": {1, 0}, "degc": {1, 0}, "celsius": {1, 0},
+		"°f": {5.0 / 9, -32 * 5.0 / 9}, "f": {5.0 / 9, -32 * 5.0 / 9}, "degf": {5.0 / 9, -32 * 5.0 / 9}, "fahrenheit": {5.0 / 9, -32 * 5.0 / 9},
+		"k": {1, -273.15},
+	},
+	// A difference of temperatures converts without the offset
+	"temperature difference": {
+		"°c": {1, 0}, "c": {1, 0}, "degc": {1, 0}, "celsius": {1, 0}, "k": {1, 0},
+		"°f": {5.0 / 9, 0}, "f": {5.0 / 9, 0}, "degf": {5.0 / 9, 0}, "fahrenheit": {5.0 / 9, 0},
+	},
+	"pressure": {"mmhg": {1, 0}, "kpa": {7.50061683, 0}},
+	"volume": {
+		"ml": {0.001, 0}, "l": {1, 0}, "fl oz": {0.0295735295625, 0}, "fl_oz_us": {0.0295735295625, 0}, "oz": {0.0295735295625, 0},
+	},
+}
+
+// LookupMetricType returns the registered type of a metric type name, which
+// may be an alias or written like "Resting Heart Rate".
+func LookupMetricType(name string) (MetricType, bool) {
+	name = NormalizeType(name)
+	if alias, ok := typeAliases[name]; ok {
+		name = alias
+	}
+	t, ok := metricTypes[name]
+	return t, ok
+}
+
+// Convert converts a value of the metric type from unit to its canonical
+// unit. An empty unit is taken to be the canonical one. Converted values
+// are rounded to four decimals, which is finer than any device measures.
+func (t MetricType) Convert(value float64, from string) (float64, error) {
+	key := strings.ToLower(strings.TrimSpace(from))
+	if key == "" {
+		return value, nil
+	}
+	dimension := units[t.dimension]
+	f, ok := dimension[key]
+	if !ok {
+		return 0, fmt.Errorf("unit %q cannot be converted to %s for %s", from, t.Unit, t.Name)
+	}
+	c := dimension[strings.ToLower(t.Unit)]
+	if f == c {
+		return value, nil
+	}
+	return math.Round((value*f.factor+f.offset-c.offset)/c.factor*1e4) / 1e4, nil
+}
+
+// NormalizeMetric checks a metric before it is saved and brings it into the
+// registry's terms: the type is normalized and resolved from aliases, and
+// the value converted to the type's canonical unit and checked against its
+// range. Types outside the registry are rejected unless they start with
+// CustomPrefix.
+func NormalizeMetric(metric *models.HealthMetric) error {
+	if metric.Timestamp.IsZero() {
+		return errors.New("timestamp is required")
+	}
+	if math.IsNaN(metric.Value) || math.IsInf(metric.Value, 0) {
+		return errors.New("value must be a number")
+	}
+
+	name := NormalizeType(metric.Type)
+	if name == "" {
+		return errors.New("type is required")
+	}
+	t, ok := LookupMetricType(name)
+	if !ok {
+		if strings.HasPrefix(name, CustomPrefix) {
+			metric.Type = name
+			return nil
+		}
+		return fmt.Errorf("unknown metric type %q (prefix types of your own with %q)", metric.Type, CustomPrefix)
+	}
+
+	value, err := t.Convert(metric.Value, metric.Unit)
+	if err != nil {
+		return err
+	}
+	if value < t.Min || value > t.Max {
+		if strings.EqualFold(strings.TrimSpace(metric.Unit), t.Unit) || metric.Unit == "" {
+			return fmt.Errorf("%s must be between %g and %g %s, got %g", t.Name, t.Min, t.Max, t.Unit, value)
+		}
+		return fmt.Errorf("%s must be between %g and %g %s, got %g %s (%.4g %s)", t.Name, t.Min, t.Max, t.Unit, metric.Value, metric.Unit, value, t.Unit)
+	}
+	metric.Type, metric.Value, metric.Unit = t.Name, value, t.Unit
+	return nil
+}
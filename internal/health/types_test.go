@@ -0,0 +1,53 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestNormalizeMetric(t *testing.T) {
+	ts := time.Date(2024, 5, 2, 7, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name         string
+		metric       models.HealthMetric
+		expectedType string
+		value        float64
+		unit         string
+		valid        bool
+	}{
+		{"canonical", models.HealthMetric{Type: "weight", Value: 82, Unit: "kg"}, "weight", 82, "kg", true},
+		{"pounds", models.HealthMetric{Type: "weight", Value: 180, Unit: "lb"}, "weight", 81.6466, "kg", true},
+		{"no unit", models.HealthMetric{Type: "heart_rate", Value: 62}, "heart_rate", 62, "bpm", true},
+		{"hours", models.HealthMetric{Type: "sleep_duration", Value: 8.5, Unit: "hours"}, "sleep_duration", 510, "min", true},
+		{"alias", models.HealthMetric{Type: "Sleep", Value: 7, Unit: "h"}, "sleep_duration", 420, "min", true},
+		{"fahrenheit", models.HealthMetric{Type: "body_temperature", Value: 98.6, Unit: "°F"}, "body_temperature", 37, "°C", true},
+		{"fahrenheit difference", models.HealthMetric{Type: "temperature_deviation", Value: -0.9, Unit: "degF"}, "temperature_deviation", -0.5, "°C", true},
+		{"unit case", models.HealthMetric{Type: "Resting Heart Rate", Value: 52, Unit: "BPM"}, "resting_heart_rate", 52, "bpm", true},
+		{"custom", models.HealthMetric{Type: "custom_mood", Value: 4, Unit: "stars"}, "custom_mood", 4, "stars", true},
+		{"unknown type", models.HealthMetric{Type: "mood", Value: 4}, "", 0, "", false},
+		{"wrong unit", models.HealthMetric{Type: "weight", Value: 82, Unit: "bpm"}, "", 0, "", false},
+		{"out of range", models.HealthMetric{Type: "weight", Value: 82000, Unit: "kg"}, "", 0, "", false},
+		{"grams", models.HealthMetric{Type: "weight", Value: 82000}, "", 0, "", false},
+		{"no type", models.HealthMetric{Value: 82}, "", 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metric := tt.metric
+			metric.Timestamp = ts
+			err := NormalizeMetric(&metric)
+			if (err == nil) != tt.valid {
+				t.Fatalf("NormalizeMetric() error = %v, expected valid %v", err, tt.valid)
+			}
+			if tt.valid && (metric.Type != tt.expectedType || metric.Value != tt.value || metric.Unit != tt.unit) {
+				t.Errorf("NormalizeMetric() = %s %v %s, expected %s %v %s", metric.Type, metric.Value, metric.Unit, tt.expectedType, tt.value, tt.unit)
+			}
+		})
+	}
+
+	if err := NormalizeMetric(&models.HealthMetric{Type: "steps", Value: 100}); err == nil {
+		t.Error("Expected an error for a metric without a timestamp")
+	}
+}
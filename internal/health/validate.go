@@ -0,0 +1,98 @@
+package health
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Plausible ranges for uploaded sleep and heart rate data. They only catch
+// values that cannot be right, such as seconds sent as minutes.
+const (
+	maxSleepMinutes = 24 * 60
+	minRestingHR    = 20
+	maxRestingHR    = 150
+	maxHeartRate    = 250
+	maxHRV          = 500 // ms
+)
+
+// validID checks an uploaded record ID, which names the record's file in
+// file storage. Records without an ID get one from DailyID.
+func validID(id string) error {
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return fmt.Errorf("id must contain only letters, digits, _ and -, got %q", id)
+		}
+	}
+	return nil
+}
+
+// ValidateSleep checks a night of sleep before it is saved.
+func ValidateSleep(sleep *models.SleepData) error {
+	if err := validID(sleep.ID); err != nil {
+		return err
+	}
+	if sleep.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if !sleep.Bedtime.IsZero() && !sleep.WakeTime.IsZero() && !sleep.WakeTime.After(sleep.Bedtime) {
+		return errors.New("wake_time must be after bedtime")
+	}
+	for _, field := range []struct {
+		name    string
+		minutes int
+	}{
+		{"total_sleep", sleep.TotalSleep},
+		{"deep_sleep", sleep.DeepSleep},
+		{"rem_sleep", sleep.REMSleep},
+		{"light_sleep", sleep.LightSleep},
+	} {
+		if field.minutes < 0 || field.minutes > maxSleepMinutes {
+			return fmt.Errorf("%s must be between 0 and %d minutes, got %d", field.name, maxSleepMinutes, field.minutes)
+		}
+	}
+	if sleep.TotalSleep == 0 {
+		return errors.New("total_sleep is required")
+	}
+	// Some sources count unstaged sleep towards the total only, so the stages
+	// may add up to less than the total but never to more
+	if stages := sleep.DeepSleep + sleep.REMSleep + sleep.LightSleep; stages > sleep.TotalSleep {
+		return fmt.Errorf("sleep stages add up to %d minutes, more than total_sleep (%d)", stages, sleep.TotalSleep)
+	}
+	if sleep.SleepScore < 0 || sleep.SleepScore > 100 {
+		return fmt.Errorf("sleep_score must be between 0 and 100, got %d", sleep.SleepScore)
+	}
+	return nil
+}
+
+// ValidateHeartRate checks a day of heart rate data before it is saved.
+func ValidateHeartRate(hr *models.HeartRateData) error {
+	if err := validID(hr.ID); err != nil {
+		return err
+	}
+	if hr.Date.IsZero() {
+		return errors.New("date is required")
+	}
+	if hr.RestingHR < minRestingHR || hr.RestingHR > maxRestingHR {
+		return fmt.Errorf("resting_hr must be between %d and %d bpm, got %d", minRestingHR, maxRestingHR, hr.RestingHR)
+	}
+	if hr.MaxHR != 0 && (hr.MaxHR < hr.RestingHR || hr.MaxHR > maxHeartRate) {
+		return fmt.Errorf("max_hr must be between resting_hr and %d bpm, got %d", maxHeartRate, hr.MaxHR)
+	}
+	if hr.HRVariability < 0 || hr.HRVariability > maxHRV {
+		return fmt.Errorf("hr_variability must be between 0 and %d ms, got %g", maxHRV, hr.HRVariability)
+	}
+	return nil
+}
+
+// DailyID returns the ID of a source's record for a day, such as
+// "sleep_oura_20240502", so that uploading a day again replaces it.
+func DailyID(prefix, source string, date time.Time) string {
+	id := prefix + "_"
+	if source := NormalizeType(source); source != "" {
+		id += source + "_"
+	}
+	return id + date.Format("20060102")
+}
@@ -0,0 +1,82 @@
+package health
+
+import (
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestValidateSleep(t *testing.T) {
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	bedtime := day.Add(-time.Hour)
+	tests := []struct {
+		name  string
+		sleep models.SleepData
+		valid bool
+	}{
+		{"staged", models.SleepData{Date: day, TotalSleep: 450, DeepSleep: 90, REMSleep: 100, LightSleep: 260, SleepScore: 82}, true},
+		{"unstaged", models.SleepData{Date: day, Bedtime: bedtime, WakeTime: bedtime.Add(8 * time.Hour), TotalSleep: 420}, true},
+		{"no date", models.SleepData{TotalSleep: 420}, false},
+		{"no total", models.SleepData{Date: day}, false},
+		{"seconds", models.SleepData{Date: day, TotalSleep: 27000}, false},
+		{"negative stage", models.SleepData{Date: day, TotalSleep: 420, DeepSleep: -5}, false},
+		{"stages over total", models.SleepData{Date: day, TotalSleep: 400, DeepSleep: 100, REMSleep: 100, LightSleep: 250}, false},
+		{"score", models.SleepData{Date: day, TotalSleep: 420, SleepScore: 101}, false},
+		{"wake before bed", models.SleepData{Date: day, Bedtime: bedtime, WakeTime: bedtime.Add(-time.Hour), TotalSleep: 420}, false},
+		{"id", models.SleepData{ID: "sleep_oura-20240502", Date: day, TotalSleep: 420}, true},
+		{"path in id", models.SleepData{ID: "../../escaped", Date: day, TotalSleep: 420}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSleep(&tt.sleep); (err == nil) != tt.valid {
+				t.Errorf("ValidateSleep() error = %v, expected valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestValidateHeartRate(t *testing.T) {
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		hr    models.HeartRateData
+		valid bool
+	}{
+		{"complete", models.HeartRateData{Date: day, RestingHR: 52, MaxHR: 181, HRVariability: 48.5}, true},
+		{"resting only", models.HeartRateData{Date: day, RestingHR: 60}, true},
+		{"no date", models.HeartRateData{RestingHR: 52}, false},
+		{"no resting", models.HeartRateData{Date: day, HRVariability: 40}, false},
+		{"resting too high", models.HeartRateData{Date: day, RestingHR: 190}, false},
+		{"max below resting", models.HeartRateData{Date: day, RestingHR: 60, MaxHR: 55}, false},
+		{"negative hrv", models.HeartRateData{Date: day, RestingHR: 60, HRVariability: -1}, false},
+		{"path in id", models.HeartRateData{ID: "hr/../../escaped", Date: day, RestingHR: 60}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateHeartRate(&tt.hr); (err == nil) != tt.valid {
+				t.Errorf("ValidateHeartRate() error = %v, expected valid %v", err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestDailyID(t *testing.T) {
+	day := time.Date(2024, 5, 2, 23, 30, 0, 0, time.UTC)
+	tests := []struct {
+		source, expected string
+	}{
+		{"oura", "sleep_oura_20240502"},
+		{"Withings Scale", "sleep_withings_scale_20240502"},
+		{"../x", "sleep_x_20240502"},
+		{"", "sleep_20240502"},
+	}
+
+	for _, tt := range tests {
+		if got := DailyID("sleep", tt.source, day); got != tt.expected {
+			t.Errorf("DailyID(%q) = %q, expected %q", tt.source, got, tt.expected)
+		}
+	}
+}
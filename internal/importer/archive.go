@@ -0,0 +1,396 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+// Limits on unpacking uploads, so that a ZIP or gzip bomb cannot exhaust
+// memory or disk.
+const (
+	// MaxFileSize is the largest activity file read, after decompression.
+	MaxFileSize = 128 << 20
+	// MaxNestedArchiveSize is the largest archive unpacked from another.
+	MaxNestedArchiveSize = 4 << 30
+	// MaxUnpackedSize is how much one import may unpack to temporary files,
+	// nested archives and their activity files together.
+	MaxUnpackedSize = 8 << 30
+	// MaxArchiveDepth is how many archives deep files are read. Garmin
+	// exports nest one level.
+	MaxArchiveDepth = 2
+)
+
+// ArchiveFile is an activity file in an export archive. Its content is only
+// read by Read, so that listing a large export takes little memory.
+type ArchiveFile struct {
+	Name      string // path within the archive
+	Metadata  *ArchiveMetadata
+	entry     *zip.File
+	extracted *io.SectionReader // content copied out of a nested archive
+}
+
+// Read returns the file's content, decompressed when it is gzipped. It may
+// be called concurrently for different files of an archive.
+func (f ArchiveFile) Read() ([]byte, error) {
+	var content []byte
+	var err error
+	if f.extracted != nil {
+		if content, err = readLimited(f.extracted, MaxFileSize); err != nil {
+			return nil, fmt.Errorf("%s: %v", f.Name, err)
+		}
+	} else if content, err = readZipEntry(f.entry); err != nil {
+		return nil, err
+	}
+	if content, err = Decompress(content); err != nil {
+		return nil, fmt.Errorf("%s: %v", f.Name, err)
+	}
+	return content, nil
+}
+
+// Archive is an opened Strava or Garmin Connect export ZIP.
+type Archive struct {
+	Files []ArchiveFile
+
+	// extracted holds the activity files of nested archives, which are
+	// removed once listed, one after another.
+	extracted     *os.File
+	extractedSize int64
+	// unpacked counts the bytes written to temporary files, up to maxUnpacked.
+	unpacked    int64
+	maxUnpacked int64
+}
+
+// ArchiveMetadata is what an export's activities.csv says about a file; nil
+// for files it does not list.
+type ArchiveMetadata struct {
+	Name        string
+	Type        string
+	Description string
+}
+
+// Apply overrides the activity's name, type and description with those from
+// the export, which reflect the user's edits on the original service.
+func (m *ArchiveMetadata) Apply(activity *models.Activity) {
+	if m == nil {
+		return
+	}
+	if m.Name != "" {
+		activity.Name = m.Name
+	}
+	if activityType := gpx.NormalizeActivityType(m.Type); activityType != "" {
+		activity.Type = activityType
+		activity.TypeSource = models.TypeSourceFile
+		activity.TypeConfidence = 1
+	}
+	if m.Description != "" {
+		activity.Description = m.Description
+	}
+}
+
+// IsZIP reports whether data is a ZIP archive.
+func IsZIP(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("PK\x03\x04"))
+}
+
+// IsGzip reports whether data is gzip-compressed.
+func IsGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// Decompress returns the content of gzip-compressed data, and any other data
+// unchanged. Content larger than MaxFileSize is an error.
+func Decompress(data []byte) ([]byte, error) {
+	if !IsGzip(data) {
+		return data, nil
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return readLimited(reader, MaxFileSize)
+}
+
+// readLimited reads r to the end, failing once it has read more than limit
+// bytes.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > limit {
+		return nil, fmt.Errorf("larger than %d MB", limit>>20)
+	}
+	return content, nil
+}
+
+// activityExtensions are the file names, with an optional .gz suffix, read
+// from archives. Everything else in an export (photos, profile data) is
+// skipped.
+var activityExtensions = []string{".gpx", ".fit", ".tcx"}
+
+// OpenArchive lists the activity files in a Strava or Garmin Connect export
+// ZIP. Strava exports list every activity in activities.csv with its name,
+// type and description; Garmin exports nest further ZIPs of FIT files, which
+// are unpacked to temporary files and listed too. The archive must stay
+// readable until the files have been read and the Archive closed.
+func OpenArchive(r io.ReaderAt, size int64) (*Archive, error) {
+	return openArchive(r, size, MaxUnpackedSize)
+}
+
+func openArchive(r io.ReaderAt, size, maxUnpacked int64) (*Archive, error) {
+	archive := &Archive{maxUnpacked: maxUnpacked}
+	metadata := make(map[string]*ArchiveMetadata)
+	if err := archive.list(r, size, "", 1, metadata); err != nil {
+		archive.Close()
+		return nil, err
+	}
+
+	// activities.csv may come after the files it describes
+	for i := range archive.Files {
+		archive.Files[i].Metadata = lookupMetadata(metadata, archive.Files[i].Name)
+	}
+	return archive, nil
+}
+
+// list adds the activity files of a ZIP at the given depth to the archive,
+// with prefix before their names, and the entries of its activities.csv to
+// metadata.
+func (a *Archive) list(r io.ReaderAt, size int64, prefix string, depth int, metadata map[string]*ArchiveMetadata) error {
+	reader, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid ZIP archive: %v", err)
+	}
+
+	for _, entry := range reader.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		name := strings.ToLower(entry.Name)
+
+		switch {
+		case path.Base(name) == "activities.csv":
+			content, err := readZipEntry(entry)
+			if err != nil {
+				return err
+			}
+			entries, err := readActivitiesCSV(content)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", entry.Name, err)
+			}
+			for filename, m := range entries {
+				metadata[strings.ToLower(prefix)+filename] = m
+			}
+
+		case strings.HasSuffix(name, ".zip"):
+			if depth >= MaxArchiveDepth {
+				return fmt.Errorf("%s: archives are nested more than %d deep", prefix+entry.Name, MaxArchiveDepth)
+			}
+			if err := a.listNested(entry, prefix, depth, metadata); err != nil {
+				return err
+			}
+
+		case IsActivityFile(name):
+			file := ArchiveFile{Name: prefix + entry.Name, entry: entry}
+			if depth > 1 {
+				if err := a.extract(&file); err != nil {
+					return fmt.Errorf("%s%v", prefix, err)
+				}
+			}
+			a.Files = append(a.Files, file)
+		}
+	}
+	return nil
+}
+
+// listNested unpacks a nested archive to a temporary file, lists it, and
+// removes the file again before the next entry is read.
+func (a *Archive) listNested(entry *zip.File, prefix string, depth int, metadata map[string]*ArchiveMetadata) error {
+	rc, err := entry.Open()
+	if err != nil {
+		return fmt.Errorf("%s%s: %v", prefix, entry.Name, err)
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "archive-*.zip")
+	if err != nil {
+		return err
+	}
+	defer removeTemp(tmp)
+	n, err := a.copyUnpacked(tmp, rc, MaxNestedArchiveSize)
+	if err != nil {
+		return fmt.Errorf("%s%s: %v", prefix, entry.Name, err)
+	}
+	if n > MaxNestedArchiveSize {
+		return fmt.Errorf("%s%s: larger than %d MB", prefix, entry.Name, MaxNestedArchiveSize>>20)
+	}
+
+	if err := a.list(tmp, n, prefix+entry.Name+"/", depth+1, metadata); err != nil {
+		return fmt.Errorf("%s%s: %v", prefix, entry.Name, err)
+	}
+	return nil
+}
+
+// extract copies an activity file out of a nested archive, which is removed
+// once listed, to the archive's temporary file of extracted files. A file
+// larger than MaxFileSize is cut short there and fails in Read.
+func (a *Archive) extract(file *ArchiveFile) error {
+	if a.extracted == nil {
+		tmp, err := os.CreateTemp("", "archive-files-*")
+		if err != nil {
+			return err
+		}
+		a.extracted = tmp
+	}
+
+	rc, err := file.entry.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.entry.Name, err)
+	}
+	defer rc.Close()
+	n, err := a.copyUnpacked(a.extracted, rc, MaxFileSize)
+	if err != nil {
+		return fmt.Errorf("%s: %v", file.entry.Name, err)
+	}
+
+	file.extracted = io.NewSectionReader(a.extracted, a.extractedSize, n)
+	file.entry = nil
+	a.extractedSize += n
+	return nil
+}
+
+// copyUnpacked copies at most limit+1 bytes from r to a temporary file,
+// failing once the import has unpacked more than maxUnpacked bytes.
+func (a *Archive) copyUnpacked(tmp *os.File, r io.Reader, limit int64) (int64, error) {
+	n, err := io.Copy(tmp, io.LimitReader(r, min(limit, a.maxUnpacked-a.unpacked)+1))
+	a.unpacked += n
+	if err != nil {
+		return n, err
+	}
+	if a.unpacked > a.maxUnpacked {
+		return n, fmt.Errorf("the archive unpacks to more than %d MB", a.maxUnpacked>>20)
+	}
+	return n, nil
+}
+
+func removeTemp(tmp *os.File) error {
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// Close removes the temporary file of files extracted from nested archives.
+func (a *Archive) Close() error {
+	if a.extracted == nil {
+		return nil
+	}
+	err := removeTemp(a.extracted)
+	a.extracted = nil
+	return err
+}
+
+// lookupMetadata finds the activities.csv entry for an archive path. The CSV
+// paths are relative to the export root, which may itself be a folder in the
+// archive, so leading folders are dropped until a path matches.
+func lookupMetadata(metadata map[string]*ArchiveMetadata, name string) *ArchiveMetadata {
+	name = strings.ToLower(name)
+	for {
+		if m, ok := metadata[name]; ok {
+			return m
+		}
+		i := strings.Index(name, "/")
+		if i < 0 {
+			return nil
+		}
+		name = name[i+1:]
+	}
+}
+
+// IsActivityFile reports whether a file name has a GPX, FIT or TCX
+// extension, optionally followed by .gz.
+func IsActivityFile(name string) bool {
+	name = strings.TrimSuffix(strings.ToLower(name), ".gz")
+	for _, ext := range activityExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func readZipEntry(entry *zip.File) ([]byte, error) {
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	defer rc.Close()
+
+	content, err := readLimited(rc, MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", entry.Name, err)
+	}
+	return content, nil
+}
+
+// readActivitiesCSV reads Strava's activities.csv, keyed by the lower-cased
+// archive path in its Filename column. Strava repeats some column names, so
+// the first column with each name is used.
+func readActivitiesCSV(content []byte) (map[string]*ArchiveMetadata, error) {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Excel-saved CSVs start with a byte order mark
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		if _, ok := columns[name]; !ok {
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["Filename"]; !ok {
+		return nil, fmt.Errorf("no Filename column")
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	metadata := make(map[string]*ArchiveMetadata)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		filename := field(record, "Filename")
+		if filename == "" {
+			continue // manual entries have no file
+		}
+		metadata[strings.ToLower(filename)] = &ArchiveMetadata{
+			Name:        field(record, "Activity Name"),
+			Type:        field(record, "Activity Type"),
+			Description: field(record, "Activity Description"),
+		}
+	}
+	return metadata, nil
+}
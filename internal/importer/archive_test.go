@@ -0,0 +1,213 @@
+package importer
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"health-hub/internal/models"
+)
+
+func zipArchive(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func gzipped(t *testing.T, content []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	writer.Write(content)
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	gpxContent := []byte(`<gpx version="1.1"></gpx>`)
+	csv := "\ufeffActivity ID,Activity Date,Activity Name,Activity Type,Activity Description,Filename,Activity Type\n" +
+		"1,\"Mar 2, 2024\",Lunch Run,Run,\"Easy, with strides\",activities/1.gpx.gz,Ignored\n" +
+		"2,\"Mar 3, 2024\",Manual Swim,Swim,,,\n" +
+		"3,\"Mar 4, 2024\",Commute,Ride,,activities/3.gpx,\n"
+
+	nested := zipArchive(t, map[string][]byte{"4.gpx": gpxContent})
+	data := zipArchive(t, map[string][]byte{
+		"export_123/activities.csv":       []byte(csv),
+		"export_123/activities/1.gpx.gz":  gzipped(t, gpxContent),
+		"export_123/activities/3.gpx":     gpxContent,
+		"export_123/uploads/garmin.zip":   nested,
+		"export_123/media/photo.jpg":      []byte("not an activity"),
+		"export_123/profile/profile.json": []byte("{}"),
+	})
+
+	archive, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenArchive() error: %v", err)
+	}
+	defer archive.Close()
+	byName := make(map[string]ArchiveFile)
+	for _, file := range archive.Files {
+		byName[file.Name] = file
+	}
+	if len(byName) != 3 {
+		t.Fatalf("Expected 3 activity files, got %d: %v", len(archive.Files), archive.Files)
+	}
+
+	lunch, ok := byName["export_123/activities/1.gpx.gz"]
+	if !ok {
+		t.Fatal("Expected the gzipped GPX file")
+	}
+	if content, err := lunch.Read(); err != nil || !bytes.Equal(content, gpxContent) {
+		t.Errorf("Expected decompressed content, got %q, %v", content, err)
+	}
+	expected := ArchiveMetadata{Name: "Lunch Run", Type: "Run", Description: "Easy, with strides"}
+	if lunch.Metadata == nil || *lunch.Metadata != expected {
+		t.Errorf("Metadata = %+v, expected %+v", lunch.Metadata, expected)
+	}
+
+	if commute := byName["export_123/activities/3.gpx"]; commute.Metadata == nil || commute.Metadata.Name != "Commute" {
+		t.Errorf("Unexpected metadata for 3.gpx: %+v", commute.Metadata)
+	}
+	garmin, ok := byName["export_123/uploads/garmin.zip/4.gpx"]
+	if !ok || garmin.Metadata != nil {
+		t.Errorf("Expected the nested file without metadata, got %+v", garmin)
+	}
+	if content, err := garmin.Read(); err != nil || !bytes.Equal(content, gpxContent) {
+		t.Errorf("Expected the nested file's content, got %q, %v", content, err)
+	}
+}
+
+func TestOpenArchiveInvalid(t *testing.T) {
+	open := func(data []byte) error {
+		archive, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+		if err == nil {
+			archive.Close()
+		}
+		return err
+	}
+	if err := open([]byte("PK\x03\x04 truncated")); err == nil {
+		t.Error("Expected an error for a truncated archive")
+	}
+	if err := open(zipArchive(t, map[string][]byte{"activities.csv": []byte("Activity Name\nRun\n")})); err == nil {
+		t.Error("Expected an error for an activities.csv without a Filename column")
+	}
+
+	nested := zipArchive(t, map[string][]byte{"1.gpx": []byte("<gpx/>")})
+	for i := 1; i < MaxArchiveDepth; i++ {
+		nested = zipArchive(t, map[string][]byte{"nested.zip": nested})
+	}
+	if err := open(nested); err != nil {
+		t.Errorf("Expected archives nested %d deep to open, got %v", MaxArchiveDepth, err)
+	}
+	if err := open(zipArchive(t, map[string][]byte{"nested.zip": nested})); err == nil {
+		t.Errorf("Expected an error for archives nested more than %d deep", MaxArchiveDepth)
+	}
+}
+
+func TestOpenArchiveTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TMPDIR", dir)
+	tempFiles := func() []string {
+		entries, _ := os.ReadDir(dir)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	gpxContent := []byte(`<gpx version="1.1"></gpx>`)
+	photo := make([]byte, 4096)
+	rand.Read(photo) // incompressible
+	withPhoto := zipArchive(t, map[string][]byte{"2.fit": gpxContent, "photo.jpg": photo})
+	data := zipArchive(t, map[string][]byte{
+		"garmin/1.zip": zipArchive(t, map[string][]byte{"1.gpx": gpxContent}),
+		"garmin/2.zip": withPhoto,
+	})
+
+	archive, err := OpenArchive(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("OpenArchive() error: %v", err)
+	}
+	// Only the extracted activity files are left, not the nested archives
+	if names := tempFiles(); len(names) != 1 || !strings.HasPrefix(names[0], "archive-files-") {
+		t.Errorf("Temporary files after OpenArchive() = %v", names)
+	}
+	for _, file := range archive.Files {
+		if content, err := file.Read(); err != nil || !bytes.Equal(content, gpxContent) {
+			t.Errorf("%s: Read() = %q, %v", file.Name, content, err)
+		}
+	}
+	archive.Close()
+	if names := tempFiles(); len(names) != 0 {
+		t.Errorf("Temporary files after Close() = %v", names)
+	}
+
+	// Each nested archive fits the import's limit, but not all of them
+	if archive, err := openArchive(bytes.NewReader(data), int64(len(data)), int64(len(withPhoto))); err == nil {
+		archive.Close()
+		t.Error("Expected an error for an archive unpacking to more than the limit")
+	}
+	if names := tempFiles(); len(names) != 0 {
+		t.Errorf("Temporary files after a failed OpenArchive() = %v", names)
+	}
+}
+
+func TestArchiveMetadataApply(t *testing.T) {
+	activity := &models.Activity{Name: "Morning Run", Type: "walking", TypeSource: models.TypeSourceInferred}
+	metadata := &ArchiveMetadata{Name: "Tempo Tuesday", Type: "Run", Description: "3x2k"}
+	metadata.Apply(activity)
+
+	if activity.Name != "Tempo Tuesday" || activity.Description != "3x2k" {
+		t.Errorf("Expected name and description from the export, got %+v", activity)
+	}
+	if activity.Type != "running" || activity.TypeSource != models.TypeSourceFile {
+		t.Errorf("Type = %s (%s), expected running from the file", activity.Type, activity.TypeSource)
+	}
+
+	// Files the CSV does not list keep what was parsed
+	var none *ArchiveMetadata
+	none.Apply(activity)
+	if activity.Name != "Tempo Tuesday" {
+		t.Errorf("Expected nil metadata to change nothing, got %+v", activity)
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	content := []byte(`<gpx version="1.1"></gpx>`)
+	for name, data := range map[string][]byte{"plain": content, "gzipped": gzipped(t, content)} {
+		got, err := Decompress(data)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("Decompress(%s) = %q, %v", name, got, err)
+		}
+	}
+	if _, err := Decompress([]byte{0x1f, 0x8b, 0}); err == nil {
+		t.Error("Expected an error for a corrupt gzip stream")
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	if content, err := readLimited(strings.NewReader("12345"), 5); err != nil || string(content) != "12345" {
+		t.Errorf("readLimited() = %q, %v", content, err)
+	}
+	if _, err := readLimited(strings.NewReader("123456"), 5); err == nil {
+		t.Error("Expected an error for content over the limit")
+	}
+}
@@ -0,0 +1,199 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// What to do with an upload that duplicates an existing activity.
+const (
+	DuplicateSkip  = "skip"  // reject the upload (default)
+	DuplicateMerge = "merge" // fill in data the existing activity is missing
+	DuplicateKeep  = "keep"  // save it as a separate activity anyway
+)
+
+// Tolerances for recognizing the same activity recorded in another file,
+// such as the FIT original and a Strava GPX export.
+const (
+	duplicateStartTolerance    = time.Minute
+	duplicateDistanceTolerance = 0.02 // fraction of the distance
+	duplicateMinDistanceDelta  = 50.0 // meters, for short activities
+	duplicatePointsTolerance   = 0.10 // fraction of the point count
+)
+
+// ParseDuplicateMode validates a duplicate mode, defaulting to DuplicateSkip.
+func ParseDuplicateMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return DuplicateSkip, nil
+	case DuplicateSkip, DuplicateMerge, DuplicateKeep:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown duplicate mode %q (expected skip, merge or keep)", mode)
+}
+
+// FileHash fingerprints a raw uploaded file.
+func FileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FindDuplicate returns the activity in existing that activity duplicates,
+// or nil. An activity is a duplicate when its file hash matches, or when it
+// starts within a minute of another activity and has nearly the same distance
+// and number of points.
+func FindDuplicate(activity *models.Activity, existing []*models.Activity) *models.Activity {
+	if activity.FileHash != "" {
+		for _, other := range existing {
+			if other.FileHash == activity.FileHash {
+				return other
+			}
+		}
+	}
+
+	if activity.StartTime.IsZero() {
+		return nil
+	}
+	for _, other := range existing {
+		if similar(activity, other) {
+			return other
+		}
+	}
+	return nil
+}
+
+func similar(a, b *models.Activity) bool {
+	if b.StartTime.IsZero() {
+		return false
+	}
+	if d := a.StartTime.Sub(b.StartTime); d > duplicateStartTolerance || d < -duplicateStartTolerance {
+		return false
+	}
+
+	tolerance := math.Max(duplicateDistanceTolerance*math.Max(a.Distance, b.Distance), duplicateMinDistanceDelta)
+	if math.Abs(a.Distance-b.Distance) > tolerance {
+		return false
+	}
+
+	// Indoor activities have no points to compare
+	if a.TotalPoints > 0 && b.TotalPoints > 0 {
+		larger := math.Max(float64(a.TotalPoints), float64(b.TotalPoints))
+		if math.Abs(float64(a.TotalPoints-b.TotalPoints)) > duplicatePointsTolerance*larger {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge copies data that existing lacks from duplicate, such as sensor stats,
+// laps or the device from a richer file of the same activity. User edits and
+// everything existing already has are kept. It reports whether anything
+// changed.
+func Merge(existing, duplicate *models.Activity) bool {
+	changed := false
+	fillInt := func(dst *int, src int) {
+		if *dst == 0 && src != 0 {
+			*dst = src
+			changed = true
+		}
+	}
+
+	fillInt(&existing.Calories, duplicate.Calories)
+	fillInt(&existing.AvgHeartRate, duplicate.AvgHeartRate)
+	fillInt(&existing.MaxHeartRate, duplicate.MaxHeartRate)
+	fillInt(&existing.AvgCadence, duplicate.AvgCadence)
+	fillInt(&existing.MaxCadence, duplicate.MaxCadence)
+	fillInt(&existing.AvgPower, duplicate.AvgPower)
+	fillInt(&existing.MaxPower, duplicate.MaxPower)
+	if len(existing.HeartRateTime) == 0 && len(duplicate.HeartRateTime) > 0 {
+		existing.HeartRateTime = duplicate.HeartRateTime
+		changed = true
+	}
+
+	if len(existing.Laps) == 0 && len(duplicate.Laps) > 0 {
+		existing.Laps = duplicate.Laps
+		changed = true
+	}
+	if existing.Device == nil && duplicate.Device != nil {
+		existing.Device = duplicate.Device
+		changed = true
+	}
+	if len(existing.BestEfforts) == 0 && len(duplicate.BestEfforts) > 0 {
+		existing.BestEfforts = duplicate.BestEfforts
+		changed = true
+	}
+	// A type from the file beats a guess, but never the user's choice
+	if existing.TypeSource == models.TypeSourceInferred && duplicate.TypeSource == models.TypeSourceFile {
+		existing.Type = duplicate.Type
+		existing.TypeSource = duplicate.TypeSource
+		existing.TypeConfidence = duplicate.TypeConfidence
+		changed = true
+	}
+	return changed
+}
+
+// DuplicateIndex narrows the activities FindDuplicate has to compare an
+// import against to those with the same file hash or a nearby start time. It
+// only holds IDs; callers load the candidates' current versions themselves.
+type DuplicateIndex struct {
+	byHash  map[string]string  // file hash -> activity ID
+	byStart map[int64][]string // start time bucket -> activity IDs
+}
+
+// NewDuplicateIndex indexes activities.
+func NewDuplicateIndex(activities []*models.Activity) *DuplicateIndex {
+	index := &DuplicateIndex{byHash: map[string]string{}, byStart: map[int64][]string{}}
+	for _, activity := range activities {
+		index.Add(activity)
+	}
+	return index
+}
+
+// startBucket groups start times into buckets as wide as the start time
+// tolerance, so a duplicate is always in the same or a neighbouring bucket.
+func startBucket(start time.Time) int64 {
+	return start.Truncate(duplicateStartTolerance).Unix()
+}
+
+// Add indexes a saved activity.
+func (ix *DuplicateIndex) Add(activity *models.Activity) {
+	if activity.FileHash != "" {
+		ix.byHash[activity.FileHash] = activity.ID
+	}
+	if !activity.StartTime.IsZero() {
+		bucket := startBucket(activity.StartTime)
+		ix.byStart[bucket] = append(ix.byStart[bucket], activity.ID)
+	}
+}
+
+// Candidates returns the IDs of the indexed activities that activity may
+// duplicate, a file hash match first.
+func (ix *DuplicateIndex) Candidates(activity *models.Activity) []string {
+	var ids []string
+	seen := map[string]bool{}
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if id, ok := ix.byHash[activity.FileHash]; ok && activity.FileHash != "" {
+		add(id)
+	}
+	if !activity.StartTime.IsZero() {
+		bucket := startBucket(activity.StartTime)
+		width := int64(duplicateStartTolerance / time.Second)
+		for _, b := range []int64{bucket - width, bucket, bucket + width} {
+			for _, id := range ix.byStart[b] {
+				add(id)
+			}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,114 @@
+package importer
+
+import (
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestFindDuplicate(t *testing.T) {
+	start := time.Date(2024, 3, 2, 7, 30, 0, 0, time.UTC)
+	existing := []*models.Activity{
+		{ID: "a", FileHash: "abc", StartTime: start.Add(-24 * time.Hour), Distance: 5000, TotalPoints: 1000},
+		{ID: "b", StartTime: start, Distance: 10000, TotalPoints: 3600},
+		{ID: "indoor", StartTime: start.Add(6 * time.Hour), Distance: 20000},
+	}
+
+	tests := []struct {
+		name     string
+		activity *models.Activity
+		expected string
+	}{
+		{"same file", &models.Activity{FileHash: "abc"}, "a"},
+		{"other export of the same activity", &models.Activity{StartTime: start.Add(2 * time.Second), Distance: 10080, TotalPoints: 3400}, "b"},
+		{"indoor without points", &models.Activity{StartTime: start.Add(6 * time.Hour), Distance: 20100}, "indoor"},
+		{"different start", &models.Activity{StartTime: start.Add(5 * time.Minute), Distance: 10000, TotalPoints: 3600}, ""},
+		{"different distance", &models.Activity{StartTime: start, Distance: 12000, TotalPoints: 3600}, ""},
+		{"different point count", &models.Activity{StartTime: start, Distance: 10000, TotalPoints: 1800}, ""},
+		{"no start time", &models.Activity{Distance: 10000, TotalPoints: 3600}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FindDuplicate(tt.activity, existing)
+			gotID := ""
+			if got != nil {
+				gotID = got.ID
+			}
+			if gotID != tt.expected {
+				t.Errorf("FindDuplicate() = %q, expected %q", gotID, tt.expected)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	existing := &models.Activity{
+		Type: "running", TypeSource: models.TypeSourceUser, Calories: 300, MaxHeartRate: 170,
+	}
+	duplicate := &models.Activity{
+		Type: "walking", TypeSource: models.TypeSourceFile, Calories: 250, AvgHeartRate: 150, MaxHeartRate: 180,
+		Device:        &models.Device{Manufacturer: "Garmin"},
+		Laps:          []models.Lap{{Index: 1}},
+		HeartRateTime: map[int]int{150: 600},
+	}
+
+	if !Merge(existing, duplicate) {
+		t.Fatal("Expected Merge to report changes")
+	}
+	if existing.Type != "running" || existing.Calories != 300 || existing.MaxHeartRate != 170 {
+		t.Errorf("Expected existing values to be kept, got %+v", existing)
+	}
+	if existing.AvgHeartRate != 150 || existing.Device == nil || len(existing.Laps) != 1 || existing.HeartRateTime[150] != 600 {
+		t.Errorf("Expected missing values to be filled in, got %+v", existing)
+	}
+	if Merge(existing, duplicate) {
+		t.Error("Expected a second Merge to change nothing")
+	}
+}
+
+func TestParseDuplicateMode(t *testing.T) {
+	if mode, err := ParseDuplicateMode(""); err != nil || mode != DuplicateSkip {
+		t.Errorf("ParseDuplicateMode(\"\") = %q, %v", mode, err)
+	}
+	if _, err := ParseDuplicateMode("replace"); err == nil {
+		t.Error("Expected an error for an unknown mode")
+	}
+}
+
+func TestDuplicateIndexCandidates(t *testing.T) {
+	start := time.Date(2024, 3, 2, 7, 30, 50, 0, time.UTC)
+	index := NewDuplicateIndex([]*models.Activity{
+		{ID: "a", FileHash: "abc", StartTime: start.Add(-24 * time.Hour)},
+		{ID: "b", StartTime: start},
+		{ID: "c", StartTime: start.Add(5 * time.Minute)},
+	})
+	index.Add(&models.Activity{ID: "d", FileHash: "def", StartTime: start.Add(-40 * time.Second)})
+
+	tests := []struct {
+		name     string
+		activity *models.Activity
+		expected []string
+	}{
+		{"same file", &models.Activity{FileHash: "abc"}, []string{"a"}},
+		{"hash and start time", &models.Activity{FileHash: "def", StartTime: start}, []string{"d", "b"}},
+		{"start across a bucket boundary", &models.Activity{StartTime: start.Add(20 * time.Second)}, []string{"b", "d"}},
+		{"nothing nearby", &models.Activity{StartTime: start.Add(time.Hour)}, nil},
+		{"no hash or start time", &models.Activity{Distance: 5000}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := index.Candidates(tt.activity)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Candidates() = %v, expected %v", got, tt.expected)
+			}
+			for i := range got {
+				if got[i] != tt.expected[i] {
+					t.Errorf("Candidates() = %v, expected %v", got, tt.expected)
+				}
+			}
+		})
+	}
+}
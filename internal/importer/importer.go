@@ -0,0 +1,80 @@
+// Package importer decodes uploaded activity files, picking the decoder from
+// the file content rather than its name.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"health-hub/internal/config"
+	"health-hub/internal/fit"
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+	"health-hub/internal/tcx"
+)
+
+// Supported activity file formats.
+const (
+	FormatGPX = "gpx"
+	FormatFIT = "fit"
+	FormatTCX = "tcx"
+)
+
+// ErrUnknownFormat is returned for files that are not a supported activity
+// file.
+var ErrUnknownFormat = errors.New("expected a GPX, FIT or TCX file")
+
+// DetectFormat identifies an activity file from its content. It returns ""
+// for unrecognized data.
+func DetectFormat(data []byte) string {
+	if fit.IsFIT(data) {
+		return FormatFIT
+	}
+
+	// XML formats are told apart by their root element
+	head := data
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	if bytes.Contains(head, []byte("<gpx")) {
+		return FormatGPX
+	}
+	if bytes.Contains(head, []byte("<TrainingCenterDatabase")) {
+		return FormatTCX
+	}
+	return ""
+}
+
+// Parse decodes an activity file using the current configuration.
+func Parse(data []byte) (*models.GPXTrack, *models.Activity, error) {
+	cfg := config.Load()
+	return ParseWithConfig(data, cfg)
+}
+
+// ParseWithConfig decodes an activity file of any supported format, which
+// may be gzipped as in Strava exports.
+func ParseWithConfig(data []byte, cfg *config.Config) (*models.GPXTrack, *models.Activity, error) {
+	data, err := Decompress(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch DetectFormat(data) {
+	case FormatFIT:
+		return fit.ParseFITWithConfig(data, cfg)
+	case FormatGPX:
+		return gpx.ParseGPXWithConfig(string(data), cfg)
+	case FormatTCX:
+		return tcx.ParseTCXWithConfig(string(data), cfg)
+	}
+	return nil, nil, ErrUnknownFormat
+}
+
+// NameFromFilename derives an activity name from an uploaded file's name,
+// for files that do not name the activity themselves.
+func NameFromFilename(filename string) string {
+	base := strings.TrimSuffix(filepath.Base(filename), ".gz")
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
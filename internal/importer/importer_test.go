@@ -0,0 +1,48 @@
+package importer
+
+import "testing"
+
+func TestDetectFormat(t *testing.T) {
+	fitHeader := []byte{14, 0x20, 0x34, 0x08, 0, 0, 0, 0, '.', 'F', 'I', 'T', 0, 0}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"FIT header", fitHeader, FormatFIT},
+		{"GPX", []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<gpx version="1.1" creator="Strava">`), FormatGPX},
+		{"GPX without declaration", []byte(`<gpx version="1.1">`), FormatGPX},
+		{"TCX", []byte(`<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2">`), FormatTCX},
+		{"other XML", []byte(`<?xml version="1.0"?><kml></kml>`), ""},
+		{"JSON", []byte(`[{"type": "steps"}]`), ""},
+		{"empty", nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFormat(tt.data); got != tt.expected {
+				t.Errorf("DetectFormat() = %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+
+	if _, _, err := Parse([]byte("hello")); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestNameFromFilename(t *testing.T) {
+	tests := map[string]string{
+		"Morning_Ride.fit":      "Morning_Ride",
+		"evening run.GPX":       "evening run",
+		"exports/2024/lap.fit":  "lap",
+		"no-extension":          "no-extension",
+		"activities/123.fit.gz": "123",
+	}
+	for filename, expected := range tests {
+		if got := NameFromFilename(filename); got != expected {
+			t.Errorf("NameFromFilename(%q) = %q, expected %q", filename, got, expected)
+		}
+	}
+}
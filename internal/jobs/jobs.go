@@ -0,0 +1,212 @@
+// Package jobs runs long imports in the background. A job is a list of tasks,
+// such as one per uploaded file, that a pool of workers runs concurrently
+// while clients poll or stream the job's progress.
+package jobs
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+)
+
+// retention is how long finished jobs stay available to clients.
+const retention = time.Hour
+
+// Task is one unit of work in a job. Run returns the task's result, which is
+// reported as is in the job's progress and so should encode to JSON.
+type Task struct {
+	Name string
+	Run  func() interface{}
+}
+
+// ErrorResult is the result of a task that panicked, in the shape of the
+// import results that report failures.
+type ErrorResult struct {
+	Status string `json:"status"` // always "error"
+	Error  string `json:"error"`
+}
+
+// TaskProgress is the state of one task of a job.
+type TaskProgress struct {
+	Name   string      `json:"name"`
+	Status string      `json:"status"` // queued, running or done
+	Result interface{} `json:"result,omitempty"`
+}
+
+// Job is a snapshot of a job's progress.
+type Job struct {
+	ID         string         `json:"id"`
+	Kind       string         `json:"kind"`
+	Status     string         `json:"status"`
+	Total      int            `json:"total"`
+	Completed  int            `json:"completed"`
+	Tasks      []TaskProgress `json:"tasks"`
+	CreatedAt  time.Time      `json:"created_at"`
+	FinishedAt *time.Time     `json:"finished_at,omitempty"`
+}
+
+// job is the queue's live record of a job.
+type job struct {
+	Job
+	runs    []func() interface{}
+	changed chan struct{} // closed and replaced on every change
+}
+
+type work struct {
+	job   *job
+	index int
+}
+
+// Queue runs the tasks of submitted jobs on a fixed pool of workers, in
+// submission order.
+type Queue struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+	work chan work
+}
+
+// NewQueue starts a queue with the given number of workers, at least one.
+func NewQueue(workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	q := &Queue{
+		jobs: make(map[string]*job),
+		work: make(chan work),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	return q
+}
+
+// Submit queues a job of the given kind and returns it without waiting for
+// any task to run.
+func (q *Queue) Submit(kind string, tasks []Task) Job {
+	now := time.Now()
+	j := &job{
+		Job: Job{
+			Kind:      kind,
+			Status:    StatusQueued,
+			Total:     len(tasks),
+			Tasks:     make([]TaskProgress, len(tasks)),
+			CreatedAt: now,
+		},
+		runs:    make([]func() interface{}, len(tasks)),
+		changed: make(chan struct{}),
+	}
+	for i, task := range tasks {
+		j.Tasks[i] = TaskProgress{Name: task.Name, Status: StatusQueued}
+		j.runs[i] = task.Run
+	}
+	if len(tasks) == 0 {
+		j.Status = StatusDone
+		j.FinishedAt = &now
+	}
+
+	q.mu.Lock()
+	q.prune(now)
+	j.ID = fmt.Sprintf("job_%d", now.UnixNano())
+	for q.jobs[j.ID] != nil {
+		j.ID += "_"
+	}
+	q.jobs[j.ID] = j
+	snapshot := j.snapshot()
+	q.mu.Unlock()
+
+	// Feed the workers without blocking the caller behind earlier jobs
+	go func() {
+		for i := range tasks {
+			q.work <- work{job: j, index: i}
+		}
+	}()
+	return snapshot
+}
+
+// Get returns a snapshot of the job with the given ID.
+func (q *Queue) Get(id string) (Job, bool) {
+	snapshot, _, ok := q.Watch(id)
+	return snapshot, ok
+}
+
+// Watch returns a snapshot of the job with the given ID and a channel that is
+// closed when the job next changes.
+func (q *Queue) Watch(id string) (Job, <-chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, nil, false
+	}
+	return j.snapshot(), j.changed, true
+}
+
+func (q *Queue) worker() {
+	for w := range q.work {
+		q.mu.Lock()
+		run, name := w.job.runs[w.index], w.job.Tasks[w.index].Name
+		w.job.runs[w.index] = nil // let the task's data be collected once it has run
+		w.job.Status = StatusRunning
+		w.job.Tasks[w.index].Status = StatusRunning
+		w.job.notify()
+		q.mu.Unlock()
+
+		result := runTask(name, run)
+
+		q.mu.Lock()
+		w.job.Tasks[w.index].Status = StatusDone
+		w.job.Tasks[w.index].Result = result
+		w.job.Completed++
+		if w.job.Completed == w.job.Total {
+			now := time.Now()
+			w.job.Status = StatusDone
+			w.job.FinishedAt = &now
+		}
+		w.job.notify()
+		q.mu.Unlock()
+	}
+}
+
+// runTask runs a task, turning a panic into an ErrorResult: tasks run outside
+// any request, where a panic would take down the server, and the job must
+// still finish.
+func runTask(name string, run func() interface{}) (result interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("ERROR: Task %s panicked: %v\n%s", name, r, debug.Stack())
+			result = ErrorResult{Status: "error", Error: fmt.Sprintf("Internal error: %v", r)}
+		}
+	}()
+	return run()
+}
+
+// prune forgets jobs that finished more than retention ago. The caller holds
+// q.mu.
+func (q *Queue) prune(now time.Time) {
+	for id, j := range q.jobs {
+		if j.FinishedAt != nil && now.Sub(*j.FinishedAt) > retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// snapshot copies the job for use outside the queue's lock.
+func (j *job) snapshot() Job {
+	snapshot := j.Job
+	snapshot.Tasks = append([]TaskProgress(nil), j.Tasks...)
+	return snapshot
+}
+
+// notify wakes everyone watching the job.
+func (j *job) notify() {
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
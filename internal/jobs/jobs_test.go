@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitDone watches a job until it finishes.
+func waitDone(t *testing.T, q *Queue, id string) Job {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		job, changed, ok := q.Watch(id)
+		if !ok {
+			t.Fatalf("Job %s not found", id)
+		}
+		if job.Status == StatusDone {
+			return job
+		}
+		select {
+		case <-changed:
+		case <-timeout:
+			t.Fatalf("Job %s did not finish: %+v", id, job)
+		}
+	}
+}
+
+func TestQueue(t *testing.T) {
+	q := NewQueue(3)
+
+	var running, maxRunning int32
+	release := make(chan struct{})
+	var tasks []Task
+	for i := 0; i < 6; i++ {
+		i := i
+		tasks = append(tasks, Task{
+			Name: fmt.Sprintf("file%d.gpx", i),
+			Run: func() interface{} {
+				n := atomic.AddInt32(&running, 1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				<-release
+				atomic.AddInt32(&running, -1)
+				return i * 10
+			},
+		})
+	}
+
+	submitted := q.Submit("import", tasks)
+	if submitted.ID == "" || submitted.Total != 6 || submitted.Status != StatusQueued {
+		t.Fatalf("Unexpected submitted job %+v", submitted)
+	}
+	close(release)
+
+	job := waitDone(t, q, submitted.ID)
+	if job.Completed != 6 || job.FinishedAt == nil {
+		t.Errorf("Expected all tasks completed, got %+v", job)
+	}
+	for i, task := range job.Tasks {
+		if task.Status != StatusDone || task.Result != i*10 || task.Name != fmt.Sprintf("file%d.gpx", i) {
+			t.Errorf("Task %d = %+v", i, task)
+		}
+	}
+	if maxRunning > 3 {
+		t.Errorf("Ran %d tasks at once with 3 workers", maxRunning)
+	}
+}
+
+func TestQueuePanic(t *testing.T) {
+	q := NewQueue(1)
+	job := waitDone(t, q, q.Submit("import", []Task{
+		{Name: "bad.fit", Run: func() interface{} { panic("index out of range") }},
+		{Name: "good.gpx", Run: func() interface{} { return "ok" }},
+	}).ID)
+
+	if job.Completed != 2 {
+		t.Errorf("Expected both tasks completed, got %+v", job)
+	}
+	expected := ErrorResult{Status: "error", Error: "Internal error: index out of range"}
+	if job.Tasks[0].Result != expected {
+		t.Errorf("Panicked task result = %+v, expected %+v", job.Tasks[0].Result, expected)
+	}
+	if job.Tasks[1].Result != "ok" {
+		t.Errorf("Expected the next task to run, got %+v", job.Tasks[1])
+	}
+}
+
+func TestQueueEmptyJob(t *testing.T) {
+	q := NewQueue(1)
+	job := q.Submit("import", nil)
+	if job.Status != StatusDone {
+		t.Errorf("Expected an empty job to be done, got %s", job.Status)
+	}
+	if _, ok := q.Get(job.ID); !ok {
+		t.Error("Expected the empty job to be retrievable")
+	}
+	if _, ok := q.Get("job_missing"); ok {
+		t.Error("Expected an unknown ID not to be found")
+	}
+}
+
+func TestQueuePrune(t *testing.T) {
+	q := NewQueue(1)
+	job := waitDone(t, q, q.Submit("import", []Task{{Name: "a", Run: func() interface{} { return nil }}}).ID)
+
+	q.mu.Lock()
+	q.prune(job.FinishedAt.Add(retention / 2))
+	q.mu.Unlock()
+	if _, ok := q.Get(job.ID); !ok {
+		t.Fatal("Expected a recent job to be kept")
+	}
+
+	q.mu.Lock()
+	q.prune(job.FinishedAt.Add(2 * retention))
+	q.mu.Unlock()
+	if _, ok := q.Get(job.ID); ok {
+		t.Error("Expected an old job to be pruned")
+	}
+}
@@ -3,39 +3,140 @@ package models
 import "time"
 
 type Activity struct {
-	ID            string    `json:"id"`
-	Name          string    `json:"name"`
-	Type          string    `json:"type"` // "running", "cycling", "walking", etc.
-	StartTime     time.Time `json:"start_time"`
-	EndTime       time.Time `json:"end_time"`
-	Duration      int       `json:"duration"`       // seconds
-	Distance      float64   `json:"distance"`       // meters
-	Calories      int       `json:"calories"`
-	GPXFile       string    `json:"gpx_file,omitempty"`
-	TotalElevation float64  `json:"total_elevation"` // meters
-	MaxSpeed      float64   `json:"max_speed"`       // km/h
-	AvgSpeed      float64   `json:"avg_speed"`       // km/h
-	TotalPoints   int       `json:"total_points"`    // number of GPS points
-	CreatedAt     time.Time `json:"created_at"`
+	ID              string       `json:"id"`
+	Name            string       `json:"name"`
+	Type            string       `json:"type"` // "running", "cycling", "walking", etc.
+	Description     string       `json:"description,omitempty"`
+	TypeSource      string       `json:"type_source,omitempty"`     // how Type was determined, see TypeSource constants
+	TypeConfidence  float64      `json:"type_confidence,omitempty"` // 0-1, 1 for types from the file or the user
+	StartTime       time.Time    `json:"start_time"`
+	EndTime         time.Time    `json:"end_time"`
+	Duration        int          `json:"duration"`               // seconds, moving time when known
+	MovingTime      int          `json:"moving_time,omitempty"`  // seconds, excluding pauses
+	ElapsedTime     int          `json:"elapsed_time,omitempty"` // seconds, start to finish
+	Pauses          []Pause      `json:"pauses,omitempty"`
+	Distance        float64      `json:"distance"` // meters
+	Calories        int          `json:"calories"`
+	GPXFile         string       `json:"gpx_file,omitempty"`
+	FileHash        string       `json:"file_hash,omitempty"`       // SHA-256 of the uploaded file, for duplicate detection
+	TotalElevation  float64      `json:"total_elevation"`           // meters
+	MaxSpeed        float64      `json:"max_speed"`                 // km/h
+	AvgSpeed        float64      `json:"avg_speed"`                 // km/h, over moving time
+	TotalPoints     int          `json:"total_points"`              // number of GPS points
+	AvgHeartRate    int          `json:"avg_heart_rate,omitempty"`  // bpm
+	MaxHeartRate    int          `json:"max_heart_rate,omitempty"`  // bpm
+	AvgCadence      int          `json:"avg_cadence,omitempty"`     // rpm or steps/min
+	MaxCadence      int          `json:"max_cadence,omitempty"`     // rpm or steps/min
+	AvgPower        int          `json:"avg_power,omitempty"`       // watts
+	MaxPower        int          `json:"max_power,omitempty"`       // watts
+	HeartRateTime   map[int]int  `json:"heart_rate_time,omitempty"` // seconds at each heart rate (bpm), for time in any zones
+	Laps            []Lap        `json:"laps,omitempty"`
+	KilometerSplits []Split      `json:"kilometer_splits,omitempty"`
+	MileSplits      []Split      `json:"mile_splits,omitempty"`
+	BestEfforts     []BestEffort `json:"best_efforts,omitempty"`
+	Device          *Device      `json:"device,omitempty"` // recording device, when the file names one
+	CreatedAt       time.Time    `json:"created_at"`
 }
 
+// Pause is a stop during an activity, detected from slow speed or a gap in
+// the recording.
+type Pause struct {
+	StartTime time.Time `json:"start_time"`
+	Duration  int       `json:"duration"` // seconds
+	Lat       float64   `json:"lat"`
+	Lon       float64   `json:"lon"`
+}
+
+// Lap is one lap of an activity, as marked on the recording device, taken
+// from a GPX track segment or defined by the user from a time range.
+type Lap struct {
+	Index          int       `json:"index"` // 1-based
+	StartTime      time.Time `json:"start_time"`
+	Duration       int       `json:"duration"`        // seconds, timer time
+	ElapsedTime    int       `json:"elapsed_time"`    // seconds, including pauses
+	Distance       float64   `json:"distance"`        // meters
+	AvgSpeed       float64   `json:"avg_speed"`       // km/h
+	MaxSpeed       float64   `json:"max_speed"`       // km/h
+	TotalElevation float64   `json:"total_elevation"` // meters
+	Calories       int       `json:"calories,omitempty"`
+	AvgHeartRate   int       `json:"avg_heart_rate,omitempty"`
+	MaxHeartRate   int       `json:"max_heart_rate,omitempty"`
+	AvgCadence     int       `json:"avg_cadence,omitempty"`
+	AvgPower       int       `json:"avg_power,omitempty"`
+	MaxPower       int       `json:"max_power,omitempty"`
+	Manual         bool      `json:"manual,omitempty"` // defined by the user
+}
+
+// Split covers one kilometer or mile of an activity; the last split of an
+// activity is usually shorter.
+type Split struct {
+	Index         int     `json:"index"`          // 1-based
+	Distance      float64 `json:"distance"`       // meters
+	Duration      int     `json:"duration"`       // seconds, excluding pauses
+	Pace          int     `json:"pace"`           // seconds per kilometer or mile
+	ElevationGain float64 `json:"elevation_gain"` // meters
+	ElevationLoss float64 `json:"elevation_loss"` // meters
+	AvgHeartRate  int     `json:"avg_heart_rate,omitempty"`
+}
+
+// BestEffort is the fastest time over a standard distance within an
+// activity, or for power, the best average over a fixed duration.
+type BestEffort struct {
+	Name      string    `json:"name"`               // e.g. "5k" or "20 min power"
+	Distance  float64   `json:"distance,omitempty"` // meters, for distance efforts
+	Duration  int       `json:"duration"`           // seconds
+	Power     int       `json:"power,omitempty"`    // watts, for power efforts
+	StartTime time.Time `json:"start_time"`         // when the effort began
+}
+
+// Device identifies the device that recorded an activity.
+type Device struct {
+	Manufacturer    string `json:"manufacturer,omitempty"`
+	Product         string `json:"product,omitempty"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	SoftwareVersion string `json:"software_version,omitempty"`
+}
+
+// Name returns a display name such as "Garmin Edge 530".
+func (d *Device) Name() string {
+	switch {
+	case d.Product == "":
+		return d.Manufacturer
+	case d.Manufacturer == "":
+		return d.Product
+	}
+	return d.Manufacturer + " " + d.Product
+}
+
+// Values of Activity.TypeSource.
+const (
+	TypeSourceFile     = "file"     // declared in the uploaded file
+	TypeSourceInferred = "inferred" // guessed from the track data
+	TypeSourceUser     = "user"     // set by the user, never overwritten
+)
+
 type GPXTrack struct {
-	ID           string      `json:"id"`
-	Name         string      `json:"name"`
-	Points       []GPXPoint  `json:"points"`
-	CreatedAt    time.Time   `json:"created_at"`
-	StartLat     float64     `json:"start_lat,omitempty"`
-	StartLon     float64     `json:"start_lon,omitempty"`
-	EndLat       float64     `json:"end_lat,omitempty"`
-	EndLon       float64     `json:"end_lon,omitempty"`
-	TotalPoints  int         `json:"total_points,omitempty"`
-	MinElevation float64     `json:"min_elevation,omitempty"`
-	MaxElevation float64     `json:"max_elevation,omitempty"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Points       []GPXPoint `json:"points"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartLat     float64    `json:"start_lat,omitempty"`
+	StartLon     float64    `json:"start_lon,omitempty"`
+	EndLat       float64    `json:"end_lat,omitempty"`
+	EndLon       float64    `json:"end_lon,omitempty"`
+	TotalPoints  int        `json:"total_points,omitempty"`
+	MinElevation float64    `json:"min_elevation,omitempty"`
+	MaxElevation float64    `json:"max_elevation,omitempty"`
+	Segments     []int      `json:"segments,omitempty"` // index in Points where each track segment starts, when there are several
 }
 
 type GPXPoint struct {
-	Lat       float64   `json:"lat"`
-	Lon       float64   `json:"lon"`
-	Elevation float64   `json:"elevation,omitempty"`
-	Time      time.Time `json:"time,omitempty"`
-}
\ No newline at end of file
+	Lat         float64   `json:"lat"`
+	Lon         float64   `json:"lon"`
+	Elevation   float64   `json:"elevation,omitempty"`
+	Time        time.Time `json:"time,omitempty"`
+	HeartRate   int       `json:"heart_rate,omitempty"`  // bpm
+	Cadence     int       `json:"cadence,omitempty"`     // rpm or steps/min, as recorded by the device
+	Power       int       `json:"power,omitempty"`       // watts
+	Temperature *float64  `json:"temperature,omitempty"` // °C; nil when not recorded
+}
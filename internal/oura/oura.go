@@ -0,0 +1,393 @@
+// Package oura reads the data export of the Oura Ring app: the JSON export,
+// in both the older format (sleep and readiness keyed by summary_date) and
+// the current one (daily_sleep, sleep and daily_readiness keyed by day), and
+// the trends CSV with one row per day.
+package oura
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"health-hub/internal/health"
+	"health-hub/internal/models"
+)
+
+// Source is the source of everything imported from an Oura export.
+const Source = "oura"
+
+// ErrNotExport is returned for files that are not an Oura export.
+var ErrNotExport = errors.New("not an Oura export")
+
+// Metric types of the daily values that are saved as health metrics.
+const (
+	TypeReadiness   = "readiness_score"
+	TypeTemperature = "temperature_deviation"
+)
+
+// Export is the data of an Oura export, one record per day and kind. IDs are
+// derived from the day, so importing the same days again replaces them.
+type Export struct {
+	Sleep     []*models.SleepData
+	HeartRate []*models.HeartRateData
+	Metrics   []*models.HealthMetric
+	// Skipped counts days whose sleep or heart rate did not pass validation,
+	// such as nights the ring was not worn long enough to score.
+	Skipped int
+}
+
+// IsExport reports whether an uploaded file is an Oura JSON or CSV export.
+func IsExport(data []byte) bool {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if bytes.HasPrefix(data, []byte("{")) {
+		var keys map[string]json.RawMessage
+		if json.Unmarshal(data, &keys) != nil {
+			return false
+		}
+		for _, key := range []string{"sleep", "readiness", "daily_sleep", "daily_readiness"} {
+			if value, ok := keys[key]; ok && bytes.HasPrefix(bytes.TrimSpace(value), []byte("[")) {
+				return true
+			}
+		}
+		return false
+	}
+
+	header := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		header = data[:i]
+	}
+	header = bytes.ToLower(header)
+	return bytes.Contains(header, []byte("sleep score")) || bytes.Contains(header, []byte("readiness score"))
+}
+
+// day collects what an export says about one day. The night of sleep is
+// the one that ends on the day.
+type day struct {
+	date              string // YYYY-MM-DD
+	bedtime, wake     time.Time
+	total, deep, rem  float64 // seconds
+	light             float64 // seconds
+	sleepScore        int
+	readiness         int
+	restingHR         float64
+	hrv               float64 // ms
+	temperature       float64 // deviation from baseline, °C
+	hasSleep, hasTemp bool
+}
+
+// Parse reads an Oura JSON or CSV export. Days are read as midnight in the
+// time zone of their bedtimes, or in loc when the export has none.
+func Parse(data []byte, loc *time.Location) (*Export, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	var days map[string]*day
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		days, err = parseJSON(data)
+	} else {
+		days, err = parseCSV(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make([]string, 0, len(days))
+	for date := range days {
+		dates = append(dates, date)
+	}
+	sort.Strings(dates)
+
+	export := &Export{}
+	for _, date := range dates {
+		export.add(days[date], loc)
+	}
+	return export, nil
+}
+
+// add converts a day into its records, leaving out what it has no data for.
+func (e *Export) add(d *day, loc *time.Location) {
+	if !d.wake.IsZero() {
+		loc = d.wake.Location()
+	}
+	date, err := time.ParseInLocation("2006-01-02", d.date, loc)
+	if err != nil {
+		return
+	}
+	minutes := func(seconds float64) int {
+		return int(math.Round(seconds / 60))
+	}
+
+	if d.hasSleep {
+		sleep := &models.SleepData{
+			ID:         health.DailyID("sleep", Source, date),
+			Date:       date,
+			Bedtime:    d.bedtime,
+			WakeTime:   d.wake,
+			TotalSleep: minutes(d.total),
+			DeepSleep:  minutes(d.deep),
+			REMSleep:   minutes(d.rem),
+			LightSleep: minutes(d.light),
+			SleepScore: d.sleepScore,
+			Source:     Source,
+		}
+		// Rounding each stage can add up to a minute or two more than the
+		// rounded total
+		if stages := sleep.DeepSleep + sleep.REMSleep + sleep.LightSleep; stages > sleep.TotalSleep && stages-sleep.TotalSleep <= 2 {
+			sleep.TotalSleep = stages
+		}
+		if health.ValidateSleep(sleep) == nil {
+			e.Sleep = append(e.Sleep, sleep)
+		} else {
+			e.Skipped++
+		}
+	}
+
+	if d.restingHR > 0 {
+		hr := &models.HeartRateData{
+			ID:            health.DailyID("hr", Source, date),
+			RestingHR:     int(math.Round(d.restingHR)),
+			HRVariability: d.hrv,
+			Date:          date,
+			Source:        Source,
+		}
+		if health.ValidateHeartRate(hr) == nil {
+			e.HeartRate = append(e.HeartRate, hr)
+		} else {
+			e.Skipped++
+		}
+	}
+
+	if d.readiness > 0 {
+		e.Metrics = append(e.Metrics, metric(TypeReadiness, float64(d.readiness), "score", date))
+	}
+	if d.hasTemp {
+		e.Metrics = append(e.Metrics, metric(TypeTemperature, d.temperature, "°C", date))
+	}
+}
+
+func metric(metricType string, value float64, unit string, date time.Time) *models.HealthMetric {
+	return &models.HealthMetric{
+		ID:        health.DailyID("health_"+metricType, Source, date),
+		Type:      metricType,
+		Value:     value,
+		Unit:      unit,
+		Timestamp: date,
+		Source:    Source,
+	}
+}
+
+// jsonExport covers both JSON formats. Older exports date each night and
+// readiness by the evening it began (summary_date); newer ones by the day it
+// ends (day).
+type jsonExport struct {
+	Sleep          []jsonSleep     `json:"sleep"`
+	Readiness      []jsonReadiness `json:"readiness"`
+	DailySleep     []jsonScore     `json:"daily_sleep"`
+	DailyReadiness []jsonReadiness `json:"daily_readiness"`
+}
+
+// jsonSleep is a sleep period. Durations are in seconds.
+type jsonSleep struct {
+	SummaryDate  string `json:"summary_date"`
+	Day          string `json:"day"`
+	BedtimeStart string `json:"bedtime_start"`
+	BedtimeEnd   string `json:"bedtime_end"`
+
+	// Older format
+	Score            int      `json:"score"`
+	Total            float64  `json:"total"`
+	Deep             float64  `json:"deep"`
+	REM              float64  `json:"rem"`
+	Light            float64  `json:"light"`
+	HRLowest         float64  `json:"hr_lowest"`
+	RMSSD            float64  `json:"rmssd"`
+	TemperatureDelta *float64 `json:"temperature_delta"`
+
+	// Newer format
+	TotalSleepDuration float64 `json:"total_sleep_duration"`
+	DeepSleepDuration  float64 `json:"deep_sleep_duration"`
+	REMSleepDuration   float64 `json:"rem_sleep_duration"`
+	LightSleepDuration float64 `json:"light_sleep_duration"`
+	LowestHeartRate    float64 `json:"lowest_heart_rate"`
+	AverageHRV         float64 `json:"average_hrv"`
+}
+
+type jsonReadiness struct {
+	SummaryDate          string   `json:"summary_date"`
+	Day                  string   `json:"day"`
+	Score                int      `json:"score"`
+	TemperatureDeviation *float64 `json:"temperature_deviation"`
+}
+
+type jsonScore struct {
+	Day   string `json:"day"`
+	Score int    `json:"score"`
+}
+
+func parseJSON(data []byte) (map[string]*day, error) {
+	var export jsonExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid Oura export: %v", err)
+	}
+	if export.Sleep == nil && export.Readiness == nil && export.DailySleep == nil && export.DailyReadiness == nil {
+		return nil, ErrNotExport
+	}
+
+	days := make(map[string]*day)
+	get := func(date string) *day {
+		if days[date] == nil {
+			days[date] = &day{date: date}
+		}
+		return days[date]
+	}
+
+	// Naps are periods too; the longest sleep of a day is its night
+	longest := make(map[string]float64)
+	for _, s := range export.Sleep {
+		total := s.Total + s.TotalSleepDuration
+		wake, _ := time.Parse(time.RFC3339, s.BedtimeEnd)
+		date := dayOf(s.Day, s.SummaryDate, wake)
+		if date == "" || total <= longest[date] {
+			continue
+		}
+		longest[date] = total
+
+		d := get(date)
+		d.hasSleep = true
+		d.bedtime, _ = time.Parse(time.RFC3339, s.BedtimeStart)
+		d.wake = wake
+		d.total = total
+		d.deep = s.Deep + s.DeepSleepDuration
+		d.rem = s.REM + s.REMSleepDuration
+		d.light = s.Light + s.LightSleepDuration
+		d.restingHR = s.HRLowest + s.LowestHeartRate
+		d.hrv = s.RMSSD + s.AverageHRV
+		if s.Score > 0 {
+			d.sleepScore = s.Score
+		}
+		if s.TemperatureDelta != nil {
+			d.temperature, d.hasTemp = *s.TemperatureDelta, true
+		}
+	}
+
+	for _, s := range export.DailySleep {
+		if s.Day != "" && s.Score > 0 {
+			get(s.Day).sleepScore = s.Score
+		}
+	}
+
+	for _, r := range append(export.Readiness, export.DailyReadiness...) {
+		date := dayOf(r.Day, r.SummaryDate, time.Time{})
+		if date == "" {
+			continue
+		}
+		d := get(date)
+		if r.Score > 0 {
+			d.readiness = r.Score
+		}
+		if r.TemperatureDeviation != nil {
+			d.temperature, d.hasTemp = *r.TemperatureDeviation, true
+		}
+	}
+	return days, nil
+}
+
+// dayOf returns the day a record belongs to: the day its sleep ended, its
+// day, or the day after its summary date.
+func dayOf(day, summaryDate string, wake time.Time) string {
+	switch {
+	case !wake.IsZero():
+		return wake.Format("2006-01-02")
+	case day != "":
+		return day
+	case summaryDate != "":
+		t, err := time.Parse("2006-01-02", summaryDate)
+		if err != nil {
+			return ""
+		}
+		return t.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	return ""
+}
+
+// csvColumns are the trends CSV columns that are read, by their header in
+// snake_case. Older exports say "time" where newer ones say "duration".
+var csvColumns = map[string]string{
+	"date":                      "date",
+	"bedtime_start":             "bedtime_start",
+	"bedtime_end":               "bedtime_end",
+	"sleep_score":               "sleep_score",
+	"total_sleep_time":          "total",
+	"total_sleep_duration":      "total",
+	"deep_sleep_time":           "deep",
+	"deep_sleep_duration":       "deep",
+	"rem_sleep_time":            "rem",
+	"rem_sleep_duration":        "rem",
+	"light_sleep_time":          "light",
+	"light_sleep_duration":      "light",
+	"lowest_resting_heart_rate": "resting_hr",
+	"average_hrv":               "hrv",
+	"temperature_deviation_c":   "temperature",
+	"readiness_score":           "readiness",
+}
+
+func parseCSV(data []byte) (map[string]*day, error) {
+	table, err := health.ReadCSV(data)
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, name := range table.Header {
+		if field, ok := csvColumns[health.NormalizeType(name)]; ok {
+			columns[field] = i
+		}
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, ErrNotExport
+	}
+
+	days := make(map[string]*day)
+	for _, row := range table.Rows {
+		value := func(field string) string {
+			if i, ok := columns[field]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+		number := func(field string) (float64, bool) {
+			v, err := strconv.ParseFloat(value(field), 64)
+			return v, err == nil
+		}
+
+		wake, _ := time.Parse(time.RFC3339, value("bedtime_end"))
+		date := dayOf(value("date"), "", wake)
+		if _, err := time.Parse("2006-01-02", date); err != nil {
+			continue
+		}
+		d := &day{date: date, wake: wake}
+		d.bedtime, _ = time.Parse(time.RFC3339, value("bedtime_start"))
+		if total, ok := number("total"); ok && total > 0 {
+			d.hasSleep = true
+			d.total = total
+			d.deep, _ = number("deep")
+			d.rem, _ = number("rem")
+			d.light, _ = number("light")
+		}
+		if score, ok := number("sleep_score"); ok {
+			d.sleepScore = int(score)
+		}
+		if score, ok := number("readiness"); ok {
+			d.readiness = int(score)
+		}
+		d.restingHR, _ = number("resting_hr")
+		d.hrv, _ = number("hrv")
+		d.temperature, d.hasTemp = number("temperature")
+		days[date] = d
+	}
+	return days, nil
+}
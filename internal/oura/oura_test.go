@@ -0,0 +1,121 @@
+package oura
+
+import (
+	"testing"
+	"time"
+)
+
+// An export in the older format: nights and readiness are dated by the
+// evening before, and the nap on the same night is ignored.
+const exportV1 = `{
+  "sleep": [
+    {"summary_date": "2024-05-01", "bedtime_start": "2024-05-01T23:10:00+02:00", "bedtime_end": "2024-05-02T07:00:00+02:00",
+     "score": 84, "total": 25200, "deep": 5400, "rem": 6300, "light": 13500, "hr_lowest": 48, "rmssd": 61, "temperature_delta": -0.12},
+    {"summary_date": "2024-05-01", "bedtime_start": "2024-05-02T13:00:00+02:00", "bedtime_end": "2024-05-02T13:40:00+02:00",
+     "score": 0, "total": 1800, "deep": 0, "rem": 0, "light": 1800, "hr_lowest": 55, "rmssd": 40}
+  ],
+  "readiness": [{"summary_date": "2024-05-01", "score": 79}],
+  "activity": [{"summary_date": "2024-05-01", "steps": 9000}]
+}`
+
+// An export in the newer format, with the sleep score and the temperature
+// in their own lists.
+const exportV2 = `{
+  "daily_sleep": [{"day": "2024-05-02", "score": 84}],
+  "sleep": [
+    {"day": "2024-05-02", "type": "long_sleep", "bedtime_start": "2024-05-01T23:10:00+02:00", "bedtime_end": "2024-05-02T07:00:00+02:00",
+     "total_sleep_duration": 25200, "deep_sleep_duration": 5400, "rem_sleep_duration": 6300, "light_sleep_duration": 13500,
+     "lowest_heart_rate": 48, "average_hrv": 61}
+  ],
+  "daily_readiness": [{"day": "2024-05-02", "score": 79, "temperature_deviation": -0.12}]
+}`
+
+const exportCSV = "date,Sleep Score,Total Sleep Duration,Deep Sleep Duration,REM Sleep Duration,Light Sleep Duration," +
+	"Bedtime Start,Bedtime End,Lowest Resting Heart Rate,Average HRV,Temperature Deviation (°C),Readiness Score,Steps\n" +
+	"2024-05-02,84,25200,5400,6300,13500,2024-05-01T23:10:00+02:00,2024-05-02T07:00:00+02:00,48,61,-0.12,79,9000\n" +
+	"2024-05-03,,,,,,,,,,,,4000\n"
+
+func TestParse(t *testing.T) {
+	loc := time.FixedZone("CEST", 2*3600)
+	expectedDate := time.Date(2024, 5, 2, 0, 0, 0, 0, loc)
+
+	for name, data := range map[string]string{"v1": exportV1, "v2": exportV2, "csv": exportCSV} {
+		t.Run(name, func(t *testing.T) {
+			if !IsExport([]byte(data)) {
+				t.Fatal("IsExport() = false")
+			}
+			export, err := Parse([]byte(data), time.UTC)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if len(export.Sleep) != 1 {
+				t.Fatalf("Expected 1 night, got %d", len(export.Sleep))
+			}
+			sleep := export.Sleep[0]
+			if sleep.ID != "sleep_oura_20240502" || !sleep.Date.Equal(expectedDate) || sleep.Source != Source {
+				t.Errorf("Night = %s %v %s, expected sleep_oura_20240502 on %v", sleep.ID, sleep.Date, sleep.Source, expectedDate)
+			}
+			if sleep.TotalSleep != 420 || sleep.DeepSleep != 90 || sleep.REMSleep != 105 || sleep.LightSleep != 225 || sleep.SleepScore != 84 {
+				t.Errorf("Night = %+v", sleep)
+			}
+
+			if len(export.HeartRate) != 1 {
+				t.Fatalf("Expected 1 day of heart rate, got %d", len(export.HeartRate))
+			}
+			if hr := export.HeartRate[0]; hr.ID != "hr_oura_20240502" || hr.RestingHR != 48 || hr.HRVariability != 61 {
+				t.Errorf("Heart rate = %+v", hr)
+			}
+
+			metrics := make(map[string]float64)
+			for _, metric := range export.Metrics {
+				metrics[metric.Type] = metric.Value
+				if !metric.Timestamp.Equal(expectedDate) || metric.Source != Source {
+					t.Errorf("Metric %+v, expected timestamp %v", metric, expectedDate)
+				}
+			}
+			if len(metrics) != 2 || metrics[TypeReadiness] != 79 || metrics[TypeTemperature] != -0.12 {
+				t.Errorf("Metrics = %v", metrics)
+			}
+		})
+	}
+}
+
+func TestParseSkipsInvalidDays(t *testing.T) {
+	data := `{"sleep": [
+		{"day": "2024-05-02", "total_sleep_duration": 3000, "deep_sleep_duration": 4000, "lowest_heart_rate": 0},
+		{"day": "2024-05-03", "total_sleep_duration": 25200, "lowest_heart_rate": 12}
+	]}`
+	export, err := Parse([]byte(data), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(export.Sleep) != 1 || len(export.HeartRate) != 0 || export.Skipped != 2 {
+		t.Errorf("Expected 1 night and 2 skipped, got %d nights, %d days of heart rate, %d skipped",
+			len(export.Sleep), len(export.HeartRate), export.Skipped)
+	}
+	// Without bedtimes, days are read in the given location
+	if got := export.Sleep[0].Date; !got.Equal(time.Date(2024, 5, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Date = %v", got)
+	}
+}
+
+func TestIsExport(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want bool
+	}{
+		{"health metrics", `[{"type": "weight", "value": 80}]`, false},
+		{"health metric", `{"type": "sleep", "value": 8}`, false},
+		{"object with sleep value", `{"sleep": 8}`, false},
+		{"metrics CSV", "timestamp,type,value\n2024-05-01,steps,100\n", false},
+		{"readiness", `{"readiness": []}`, true},
+	}
+
+	for _, tt := range tests {
+		if got := IsExport([]byte(tt.data)); got != tt.want {
+			t.Errorf("IsExport(%s) = %v, expected %v", tt.name, got, tt.want)
+		}
+	}
+}
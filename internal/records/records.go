@@ -0,0 +1,141 @@
+// Package records tracks personal records: the best effort over each
+// standard distance and the best 20-minute power, all-time and per year, for
+// each activity type.
+package records
+
+import (
+	"sort"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Record is a best effort together with the activity it was set in.
+type Record struct {
+	models.BestEffort
+	ActivityID   string    `json:"activity_id"`
+	ActivityName string    `json:"activity_name"`
+	ActivityType string    `json:"activity_type"`
+	Date         time.Time `json:"date"` // activity start
+}
+
+// Table holds the records of a set of activities.
+type Table struct {
+	allTime map[string]map[string]Record         // type -> effort name -> record
+	yearly  map[int]map[string]map[string]Record // year -> type -> effort name -> record
+	newPRs  map[string][]string                  // activity ID -> efforts that set an all-time record
+}
+
+// Compute builds the record table from activities. Activities are replayed in
+// start order so that each activity's new PRs are those it set at the time,
+// which later activities may since have beaten. Ties keep the earlier record.
+func Compute(activities []*models.Activity) *Table {
+	sorted := make([]*models.Activity, len(activities))
+	copy(sorted, activities)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartTime.Before(sorted[j].StartTime)
+	})
+
+	t := &Table{
+		allTime: make(map[string]map[string]Record),
+		yearly:  make(map[int]map[string]map[string]Record),
+		newPRs:  make(map[string][]string),
+	}
+	for _, activity := range sorted {
+		year := activity.StartTime.Year()
+		for _, effort := range activity.BestEfforts {
+			record := Record{
+				BestEffort:   effort,
+				ActivityID:   activity.ID,
+				ActivityName: activity.Name,
+				ActivityType: activity.Type,
+				Date:         activity.StartTime,
+			}
+
+			if update(t.allTime, activity.Type, record) {
+				t.newPRs[activity.ID] = append(t.newPRs[activity.ID], effort.Name)
+			}
+			if t.yearly[year] == nil {
+				t.yearly[year] = make(map[string]map[string]Record)
+			}
+			update(t.yearly[year], activity.Type, record)
+		}
+	}
+	return t
+}
+
+// update stores record if it beats the current record for its type and
+// effort, and reports whether it did.
+func update(byType map[string]map[string]Record, activityType string, record Record) bool {
+	if byType[activityType] == nil {
+		byType[activityType] = make(map[string]Record)
+	}
+	current, ok := byType[activityType][record.Name]
+	if ok && !Better(record.BestEffort, current.BestEffort) {
+		return false
+	}
+	byType[activityType][record.Name] = record
+	return true
+}
+
+// Better reports whether effort a beats effort b: more power for power
+// efforts, a shorter time for distance efforts.
+func Better(a, b models.BestEffort) bool {
+	if a.Power > 0 || b.Power > 0 {
+		return a.Power > b.Power
+	}
+	return a.Duration < b.Duration
+}
+
+// Records returns the records for an activity type, all-time when year is 0,
+// with distance efforts shortest first followed by power efforts.
+func (t *Table) Records(activityType string, year int) []Record {
+	byType := t.allTime
+	if year != 0 {
+		byType = t.yearly[year]
+	}
+
+	var records []Record
+	for _, record := range byType[activityType] {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if (a.Power > 0) != (b.Power > 0) {
+			return b.Power > 0
+		}
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Name < b.Name
+	})
+	return records
+}
+
+// Types returns the activity types that have records, sorted by name.
+func (t *Table) Types() []string {
+	var types []string
+	for activityType, records := range t.allTime {
+		if len(records) > 0 {
+			types = append(types, activityType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Years returns the years that have records, most recent first.
+func (t *Table) Years() []int {
+	var years []int
+	for year := range t.yearly {
+		years = append(years, year)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(years)))
+	return years
+}
+
+// NewPRs returns the names of the efforts in which the activity set an
+// all-time record for its type when it was recorded.
+func (t *Table) NewPRs(activityID string) []string {
+	return t.newPRs[activityID]
+}
@@ -0,0 +1,89 @@
+package records
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func run(id string, start time.Time, fiveK, oneK int) *models.Activity {
+	return &models.Activity{
+		ID:        id,
+		Name:      "Run " + id,
+		Type:      "running",
+		StartTime: start,
+		BestEfforts: []models.BestEffort{
+			{Name: "5k", Distance: 5000, Duration: fiveK},
+			{Name: "1k", Distance: 1000, Duration: oneK},
+		},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	jan2023 := time.Date(2023, 1, 10, 8, 0, 0, 0, time.UTC)
+	activities := []*models.Activity{
+		// Deliberately out of order; records replay by start time
+		run("c", jan2023.AddDate(1, 0, 0), 1500, 290),
+		run("a", jan2023, 1600, 280),
+		run("b", jan2023.AddDate(0, 6, 0), 1550, 300),
+		{
+			ID: "ride", Type: "cycling", StartTime: jan2023,
+			BestEfforts: []models.BestEffort{{Name: "20 min power", Duration: 1200, Power: 250}},
+		},
+	}
+	table := Compute(activities)
+
+	allTime := table.Records("running", 0)
+	if len(allTime) != 2 || allTime[0].Name != "1k" || allTime[1].Name != "5k" {
+		t.Fatalf("Unexpected all-time records %+v", allTime)
+	}
+	if allTime[0].ActivityID != "a" || allTime[1].ActivityID != "c" {
+		t.Errorf("Expected 1k from a and 5k from c, got %s and %s", allTime[0].ActivityID, allTime[1].ActivityID)
+	}
+
+	year2024 := table.Records("running", 2024)
+	if len(year2024) != 2 || year2024[0].Duration != 290 || year2024[1].Duration != 1500 {
+		t.Errorf("Unexpected 2024 records %+v", year2024)
+	}
+	if got := table.Records("cycling", 0); len(got) != 1 || got[0].Power != 250 {
+		t.Errorf("Unexpected cycling records %+v", got)
+	}
+
+	tests := map[string][]string{
+		"a": {"5k", "1k"}, // the first run sets every record
+		"b": {"5k"},
+		"c": {"5k"},
+	}
+	for id, expected := range tests {
+		if got := table.NewPRs(id); !reflect.DeepEqual(got, expected) {
+			t.Errorf("NewPRs(%s) = %v, expected %v", id, got, expected)
+		}
+	}
+
+	if got := table.Types(); !reflect.DeepEqual(got, []string{"cycling", "running"}) {
+		t.Errorf("Types() = %v", got)
+	}
+	if got := table.Years(); !reflect.DeepEqual(got, []int{2024, 2023}) {
+		t.Errorf("Years() = %v", got)
+	}
+}
+
+func TestBetter(t *testing.T) {
+	tests := []struct {
+		a, b     models.BestEffort
+		expected bool
+	}{
+		{models.BestEffort{Duration: 100}, models.BestEffort{Duration: 110}, true},
+		{models.BestEffort{Duration: 110}, models.BestEffort{Duration: 100}, false},
+		{models.BestEffort{Duration: 100}, models.BestEffort{Duration: 100}, false},
+		{models.BestEffort{Duration: 1200, Power: 260}, models.BestEffort{Duration: 1200, Power: 250}, true},
+		{models.BestEffort{Duration: 1200, Power: 240}, models.BestEffort{Duration: 1200, Power: 250}, false},
+	}
+	for _, tt := range tests {
+		if got := Better(tt.a, tt.b); got != tt.expected {
+			t.Errorf("Better(%+v, %+v) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
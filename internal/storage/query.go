@@ -0,0 +1,227 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded or
+// was issued for a different sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Activity sort fields accepted by ActivityQuery.Sort.
+const (
+	SortByStartTime = "start_time"
+	SortByDistance  = "distance"
+	SortByDuration  = "duration"
+	SortByElevation = "elevation"
+)
+
+// ActivityQuery filters, sorts and paginates activities. Zero values mean
+// "no filter".
+type ActivityQuery struct {
+	Type        string    // exact activity type, case-insensitive
+	From        time.Time // start time on or after
+	To          time.Time // start time before
+	MinDistance float64   // meters
+	MaxDistance float64   // meters
+	Search      string    // case-insensitive substring of the name
+	Sort        string    // one of the SortBy constants, defaults to start_time
+	Desc        bool
+	Limit       int    // 0 returns every match
+	Cursor      string // NextCursor from a previous page
+}
+
+// ValidSort reports whether sort is an accepted ActivityQuery.Sort value.
+func ValidSort(sort string) bool {
+	switch sort {
+	case "", SortByStartTime, SortByDistance, SortByDuration, SortByElevation:
+		return true
+	}
+	return false
+}
+
+func (q ActivityQuery) sortField() string {
+	if q.Sort == "" {
+		return SortByStartTime
+	}
+	return q.Sort
+}
+
+// activityCursor is the position of the last activity on a page: its sort
+// key plus the ID that breaks ties between equal keys.
+type activityCursor struct {
+	Sort  string  `json:"s"`
+	Desc  bool    `json:"d,omitempty"`
+	Int   int64   `json:"i,omitempty"`
+	Float float64 `json:"f,omitempty"`
+	ID    string  `json:"id"`
+}
+
+func newActivityCursor(q ActivityQuery, activity *models.Activity) activityCursor {
+	c := activityCursor{Sort: q.sortField(), Desc: q.Desc, ID: activity.ID}
+	switch c.Sort {
+	case SortByStartTime:
+		c.Int = unixNano(activity.StartTime)
+	case SortByDuration:
+		c.Int = int64(activity.Duration)
+	case SortByDistance:
+		c.Float = activity.Distance
+	case SortByElevation:
+		c.Float = activity.TotalElevation
+	}
+	return c
+}
+
+func (c activityCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeActivityCursor(q ActivityQuery) (*activityCursor, error) {
+	if q.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c activityCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != q.sortField() || c.Desc != q.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// compare orders two cursors by sort key, then ID.
+func (c activityCursor) compare(other activityCursor) int {
+	switch {
+	case c.Int < other.Int, c.Float < other.Float:
+		return -1
+	case c.Int > other.Int, c.Float > other.Float:
+		return 1
+	}
+	return strings.Compare(c.ID, other.ID)
+}
+
+func (q ActivityQuery) matches(activity *models.Activity) bool {
+	if q.Type != "" && !strings.EqualFold(activity.Type, q.Type) {
+		return false
+	}
+	if !q.From.IsZero() && activity.StartTime.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !activity.StartTime.Before(q.To) {
+		return false
+	}
+	if q.MinDistance > 0 && activity.Distance < q.MinDistance {
+		return false
+	}
+	if q.MaxDistance > 0 && activity.Distance > q.MaxDistance {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(activity.Name), strings.ToLower(q.Search)) {
+		return false
+	}
+	return true
+}
+
+// queryActivities applies q to an in-memory list. Backends that cannot
+// filter natively load everything and use this.
+func queryActivities(all []*models.Activity, q ActivityQuery) ([]*models.Activity, string, error) {
+	after, err := decodeActivityCursor(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var matched []*models.Activity
+	for _, activity := range all {
+		if q.matches(activity) {
+			matched = append(matched, activity)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		cmp := newActivityCursor(q, matched[i]).compare(newActivityCursor(q, matched[j]))
+		if q.Desc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	if after != nil {
+		start := len(matched)
+		for i, activity := range matched {
+			cmp := newActivityCursor(q, activity).compare(*after)
+			if (!q.Desc && cmp > 0) || (q.Desc && cmp < 0) {
+				start = i
+				break
+			}
+		}
+		matched = matched[start:]
+	}
+
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+		return matched, newActivityCursor(q, matched[len(matched)-1]).encode(), nil
+	}
+	return matched, "", nil
+}
+
+// HealthMetricQuery filters health metrics. Results are ordered by
+// timestamp; zero values mean "no filter".
+type HealthMetricQuery struct {
+	Type   string    // exact metric type, e.g. "heart_rate"
+	Source string    // exact source, e.g. "oura"
+	From   time.Time // timestamp on or after
+	To     time.Time // timestamp before
+	Desc   bool      // newest first
+	Limit  int       // 0 returns every match
+}
+
+func (q HealthMetricQuery) matches(metric *models.HealthMetric) bool {
+	if q.Type != "" && metric.Type != q.Type {
+		return false
+	}
+	if q.Source != "" && metric.Source != q.Source {
+		return false
+	}
+	if !q.From.IsZero() && metric.Timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !metric.Timestamp.Before(q.To) {
+		return false
+	}
+	return true
+}
+
+// queryHealthMetrics applies q to an in-memory list.
+func queryHealthMetrics(all []*models.HealthMetric, q HealthMetricQuery) []*models.HealthMetric {
+	var matched []*models.HealthMetric
+	for _, metric := range all {
+		if q.matches(metric) {
+			matched = append(matched, metric)
+		}
+	}
+
+	sort.SliceStable(matched, func(i, j int) bool {
+		if q.Desc {
+			return matched[i].Timestamp.After(matched[j].Timestamp)
+		}
+		return matched[i].Timestamp.Before(matched[j].Timestamp)
+	})
+
+	if q.Limit > 0 && len(matched) > q.Limit {
+		matched = matched[:q.Limit]
+	}
+	return matched
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// queryBackends returns a fresh instance of every backend, covering both the
+// in-memory and the SQL query implementations.
+func queryBackends(t *testing.T) map[string]Storage {
+	return map[string]Storage{
+		"file":   NewFileStorage(t.TempDir()),
+		"sqlite": newTestSQLiteStorage(t),
+	}
+}
+
+func activityIDs(activities []*models.Activity) []string {
+	ids := make([]string, len(activities))
+	for i, activity := range activities {
+		ids[i] = activity.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestQueryActivities(t *testing.T) {
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	fixtures := []*models.Activity{
+		{ID: "a", Name: "Morning Run", Type: "running", StartTime: base, Distance: 5000, Duration: 1500, TotalElevation: 40},
+		{ID: "b", Name: "Commute ride", Type: "cycling", StartTime: base.AddDate(0, 0, 1), Distance: 12000, Duration: 2400, TotalElevation: 80},
+		{ID: "c", Name: "Long run", Type: "Running", StartTime: base.AddDate(0, 0, 2), Distance: 21000, Duration: 6600, TotalElevation: 150},
+		{ID: "d", Name: "Evening walk", Type: "walking", StartTime: base.AddDate(0, 0, 3), Distance: 3000, Duration: 2000, TotalElevation: 10},
+		{ID: "e", Name: "100% effort_run", Type: "running", StartTime: base.AddDate(0, 0, 4), Distance: 5000, Duration: 1400, TotalElevation: 20},
+	}
+
+	tests := []struct {
+		name     string
+		query    ActivityQuery
+		expected []string
+	}{
+		{"default sort is start time ascending", ActivityQuery{}, []string{"a", "b", "c", "d", "e"}},
+		{"descending", ActivityQuery{Desc: true}, []string{"e", "d", "c", "b", "a"}},
+		{"type is case-insensitive", ActivityQuery{Type: "running"}, []string{"a", "c", "e"}},
+		{"date range", ActivityQuery{From: base.AddDate(0, 0, 1), To: base.AddDate(0, 0, 3)}, []string{"b", "c"}},
+		{"distance range", ActivityQuery{MinDistance: 4000, MaxDistance: 12000}, []string{"a", "b", "e"}},
+		{"name search", ActivityQuery{Search: "RUN"}, []string{"a", "c", "e"}},
+		{"search wildcards are literal", ActivityQuery{Search: "0% e"}, []string{"e"}},
+		{"sort by distance breaks ties by ID", ActivityQuery{Sort: SortByDistance}, []string{"d", "a", "e", "b", "c"}},
+		{"sort by duration descending", ActivityQuery{Sort: SortByDuration, Desc: true}, []string{"c", "b", "d", "a", "e"}},
+		{"sort by elevation", ActivityQuery{Sort: SortByElevation}, []string{"d", "e", "a", "b", "c"}},
+	}
+
+	for name, s := range queryBackends(t) {
+		for _, fixture := range fixtures {
+			activity := *fixture
+			if err := s.SaveActivity(&activity); err != nil {
+				t.Fatalf("%s: SaveActivity() error = %v", name, err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				activities, next, err := s.QueryActivities(tt.query)
+				if err != nil {
+					t.Fatalf("QueryActivities() error = %v", err)
+				}
+				if got := activityIDs(activities); !equalIDs(got, tt.expected) {
+					t.Errorf("QueryActivities() = %v, expected %v", got, tt.expected)
+				}
+				if next != "" {
+					t.Errorf("Expected no next cursor without a limit, got %q", next)
+				}
+			})
+		}
+
+		t.Run(name+"/pagination", func(t *testing.T) {
+			q := ActivityQuery{Sort: SortByDistance, Desc: true, Limit: 2}
+			var pages [][]string
+			for {
+				activities, next, err := s.QueryActivities(q)
+				if err != nil {
+					t.Fatalf("QueryActivities() error = %v", err)
+				}
+				pages = append(pages, activityIDs(activities))
+				if next == "" {
+					break
+				}
+				q.Cursor = next
+			}
+
+			expected := [][]string{{"c", "b"}, {"e", "a"}, {"d"}}
+			if len(pages) != len(expected) {
+				t.Fatalf("Expected %d pages, got %v", len(expected), pages)
+			}
+			for i := range expected {
+				if !equalIDs(pages[i], expected[i]) {
+					t.Errorf("Page %d = %v, expected %v", i+1, pages[i], expected[i])
+				}
+			}
+		})
+
+		t.Run(name+"/cursor for another sort is rejected", func(t *testing.T) {
+			_, next, _ := s.QueryActivities(ActivityQuery{Limit: 1})
+			if _, _, err := s.QueryActivities(ActivityQuery{Limit: 1, Sort: SortByDistance, Cursor: next}); err != ErrInvalidCursor {
+				t.Errorf("Expected ErrInvalidCursor, got %v", err)
+			}
+			if _, _, err := s.QueryActivities(ActivityQuery{Cursor: "not-a-cursor"}); err != ErrInvalidCursor {
+				t.Errorf("Expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryHealthMetrics(t *testing.T) {
+	base := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	fixtures := []*models.HealthMetric{
+		{ID: "m1", Type: "heart_rate", Value: 60, Source: "oura", Timestamp: base},
+		{ID: "m2", Type: "heart_rate", Value: 65, Source: "fitbit", Timestamp: base.Add(time.Hour)},
+		{ID: "m3", Type: "steps", Value: 5000, Source: "fitbit", Timestamp: base.Add(2 * time.Hour)},
+		{ID: "m4", Type: "heart_rate", Value: 58, Source: "oura", Timestamp: base.AddDate(0, 0, 1)},
+	}
+
+	tests := []struct {
+		name     string
+		query    HealthMetricQuery
+		expected []string
+	}{
+		{"everything in time order", HealthMetricQuery{}, []string{"m1", "m2", "m3", "m4"}},
+		{"by type", HealthMetricQuery{Type: "heart_rate"}, []string{"m1", "m2", "m4"}},
+		{"by source", HealthMetricQuery{Source: "fitbit"}, []string{"m2", "m3"}},
+		{"time range", HealthMetricQuery{From: base.Add(time.Hour), To: base.AddDate(0, 0, 1)}, []string{"m2", "m3"}},
+		{"latest first with limit", HealthMetricQuery{Type: "heart_rate", Desc: true, Limit: 2}, []string{"m4", "m2"}},
+	}
+
+	for name, s := range queryBackends(t) {
+		for _, fixture := range fixtures {
+			metric := *fixture
+			if err := s.SaveHealthMetric(&metric); err != nil {
+				t.Fatalf("%s: SaveHealthMetric() error = %v", name, err)
+			}
+		}
+
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				metrics, err := s.QueryHealthMetrics(tt.query)
+				if err != nil {
+					t.Fatalf("QueryHealthMetrics() error = %v", err)
+				}
+				got := make([]string, len(metrics))
+				for i, metric := range metrics {
+					got[i] = metric.ID
+				}
+				if !equalIDs(got, tt.expected) {
+					t.Errorf("QueryHealthMetrics() = %v, expected %v", got, tt.expected)
+				}
+			})
+		}
+	}
+}
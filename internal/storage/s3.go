@@ -3,10 +3,12 @@ package storage
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"health-hub/internal/models"
@@ -60,6 +62,43 @@ func (s3s *S3Storage) SaveActivity(activity *models.Activity) error {
 	return s3s.backupToS3("activities", activity.ID+".json")
 }
 
+func (s3s *S3Storage) UpdateActivity(activity *models.Activity) error {
+	if err := s3s.FileStorage.UpdateActivity(activity); err != nil {
+		return err
+	}
+
+	return s3s.backupToS3("activities", activity.ID+".json")
+}
+
+func (s3s *S3Storage) DeleteActivity(id string) error {
+	// Look up through S3 so an activity that only exists in the backup can still be deleted
+	activity, err := s3s.GetActivity(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s3s.FileStorage.DeleteActivity(id); err != nil {
+		return err
+	}
+
+	keys := []string{
+		fmt.Sprintf("data/activities/%s.json", id),
+		fmt.Sprintf("data/gpx/%s.json", id),
+	}
+	if activity.GPXFile != "" {
+		keys = append(keys, fmt.Sprintf("uploads/%s", activity.GPXFile))
+	}
+	return s3s.deleteFromS3(keys...)
+}
+
+func (s3s *S3Storage) DeleteHealthMetric(id string) error {
+	if err := s3s.FileStorage.DeleteHealthMetric(id); err != nil && err != ErrNotFound {
+		return err
+	}
+
+	return s3s.deleteFromS3(fmt.Sprintf("data/health/%s.json", id))
+}
+
 func (s3s *S3Storage) SaveHealthMetric(metric *models.HealthMetric) error {
 	// Save locally first
 	if err := s3s.FileStorage.SaveHealthMetric(metric); err != nil {
@@ -70,6 +109,22 @@ func (s3s *S3Storage) SaveHealthMetric(metric *models.HealthMetric) error {
 	return s3s.backupToS3("health", metric.ID+".json")
 }
 
+func (s3s *S3Storage) SaveSleepData(sleep *models.SleepData) error {
+	if err := s3s.FileStorage.SaveSleepData(sleep); err != nil {
+		return err
+	}
+
+	return s3s.backupToS3("sleep", sleep.ID+".json")
+}
+
+func (s3s *S3Storage) SaveHeartRateData(hr *models.HeartRateData) error {
+	if err := s3s.FileStorage.SaveHeartRateData(hr); err != nil {
+		return err
+	}
+
+	return s3s.backupToS3("heart_rate", hr.ID+".json")
+}
+
 func (s3s *S3Storage) SaveGPXTrack(track *models.GPXTrack) error {
 	// Save locally first
 	if err := s3s.FileStorage.SaveGPXTrack(track); err != nil {
@@ -80,6 +135,84 @@ func (s3s *S3Storage) SaveGPXTrack(track *models.GPXTrack) error {
 	return s3s.backupToS3("gpx", track.ID+".json")
 }
 
+func (s3s *S3Storage) GetActivity(id string) (*models.Activity, error) {
+	activity, err := s3s.FileStorage.GetActivity(id)
+	if err == ErrNotFound {
+		// Not cached locally, try restoring from the S3 backup
+		if err := s3s.restoreFromS3("activities", id); err != nil {
+			return nil, err
+		}
+		return s3s.FileStorage.GetActivity(id)
+	}
+	return activity, err
+}
+
+func (s3s *S3Storage) GetHealthMetric(id string) (*models.HealthMetric, error) {
+	metric, err := s3s.FileStorage.GetHealthMetric(id)
+	if err == ErrNotFound {
+		if err := s3s.restoreFromS3("health", id); err != nil {
+			return nil, err
+		}
+		return s3s.FileStorage.GetHealthMetric(id)
+	}
+	return metric, err
+}
+
+func (s3s *S3Storage) GetGPXTrack(id string) (*models.GPXTrack, error) {
+	track, err := s3s.FileStorage.GetGPXTrack(id)
+	if err == ErrNotFound {
+		if err := s3s.restoreFromS3("gpx", id); err != nil {
+			return nil, err
+		}
+		return s3s.FileStorage.GetGPXTrack(id)
+	}
+	return track, err
+}
+
+// restoreFromS3 downloads a single backed-up record into the local data
+// directory. A missing object is reported as ErrNotFound.
+func (s3s *S3Storage) restoreFromS3(folder, id string) error {
+	localPath, err := s3s.recordPath(folder, id)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("data/%s/%s.json", folder, id)
+	output, err := s3s.s3Client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s3s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return ErrNotFound
+		}
+		return err
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(output.Body)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(localPath, data, 0644)
+}
+
+// deleteFromS3 removes backed-up objects. Deleting a key that does not
+// exist is not an error in S3.
+func (s3s *S3Storage) deleteFromS3(keys ...string) error {
+	for _, key := range keys {
+		_, err := s3s.s3Client.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String(s3s.bucket),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s3s *S3Storage) backupToS3(folder, filename string) error {
 	localPath := filepath.Join(s3s.basePath, folder, filename)
 	data, err := os.ReadFile(localPath)
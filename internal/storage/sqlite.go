@@ -0,0 +1,808 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"health-hub/internal/models"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStorage keeps activities, health metrics, sleep, heart rate and GPS
+// tracks in a single SQLite database. Each record is stored as JSON alongside the columns we
+// filter and sort on, and track points live in their own table so a track can
+// be loaded without touching any other. Raw uploads are still written to disk.
+type SQLiteStorage struct {
+	db       *sql.DB
+	basePath string
+}
+
+// migrations are applied in order; PRAGMA user_version records how many have
+// already run against a database.
+var migrations = []string{
+	`CREATE TABLE activities (
+		id              TEXT PRIMARY KEY,
+		name            TEXT NOT NULL DEFAULT '',
+		type            TEXT NOT NULL DEFAULT '',
+		start_time      INTEGER NOT NULL DEFAULT 0,
+		distance        REAL NOT NULL DEFAULT 0,
+		duration        INTEGER NOT NULL DEFAULT 0,
+		total_elevation REAL NOT NULL DEFAULT 0,
+		created_at      INTEGER NOT NULL DEFAULT 0,
+		data            TEXT NOT NULL
+	);
+	CREATE INDEX idx_activities_start_time ON activities(start_time);
+	CREATE INDEX idx_activities_type_start_time ON activities(type, start_time);
+
+	CREATE TABLE health_metrics (
+		id         TEXT PRIMARY KEY,
+		type       TEXT NOT NULL DEFAULT '',
+		value      REAL NOT NULL DEFAULT 0,
+		unit       TEXT NOT NULL DEFAULT '',
+		timestamp  INTEGER NOT NULL DEFAULT 0,
+		source     TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX idx_health_metrics_timestamp ON health_metrics(timestamp);
+	CREATE INDEX idx_health_metrics_type_timestamp ON health_metrics(type, timestamp);
+
+	CREATE TABLE gpx_tracks (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0,
+		data       TEXT NOT NULL
+	);
+
+	CREATE TABLE track_points (
+		track_id  TEXT NOT NULL REFERENCES gpx_tracks(id) ON DELETE CASCADE,
+		seq       INTEGER NOT NULL,
+		lat       REAL NOT NULL,
+		lon       REAL NOT NULL,
+		elevation REAL NOT NULL DEFAULT 0,
+		time      INTEGER,
+		PRIMARY KEY (track_id, seq)
+	) WITHOUT ROWID;`,
+
+	`ALTER TABLE track_points ADD COLUMN cadence INTEGER NOT NULL DEFAULT 0;`,
+
+	`ALTER TABLE track_points ADD COLUMN heart_rate INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE track_points ADD COLUMN power INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE track_points ADD COLUMN temperature REAL;`,
+
+	`CREATE TABLE sleep_data (
+		id         TEXT PRIMARY KEY,
+		date       INTEGER NOT NULL DEFAULT 0,
+		source     TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX idx_sleep_data_date ON sleep_data(date);`,
+
+	`CREATE TABLE heart_rate_data (
+		id         TEXT PRIMARY KEY,
+		date       INTEGER NOT NULL DEFAULT 0,
+		source     TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL DEFAULT 0,
+		data       TEXT NOT NULL
+	);
+	CREATE INDEX idx_heart_rate_data_date ON heart_rate_data(date);`,
+}
+
+// pointColumns are the track_points columns read by scanPoint, in order.
+const pointColumns = `track_id, lat, lon, elevation, time, cadence, heart_rate, power, temperature`
+
+// NewSQLiteStorage opens (creating if needed) the database at dbPath and
+// brings its schema up to date. Uploaded files are kept under basePath.
+func NewSQLiteStorage(basePath, dbPath string) (*SQLiteStorage, error) {
+	os.MkdirAll(basePath, 0755)
+	os.MkdirAll(filepath.Join(basePath, "uploads"), 0755)
+
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_txlock=immediate", dbPath)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+
+	s := &SQLiteStorage{db: db, basePath: basePath}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate SQLite database: %v", err)
+	}
+
+	return s, nil
+}
+
+func (s *SQLiteStorage) migrate() error {
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %v", i+1, err)
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close releases the underlying database handle.
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
+
+// Empty reports whether the database holds no activities, metrics, sleep,
+// heart rate or tracks.
+func (s *SQLiteStorage) Empty() (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM activities) +
+		(SELECT COUNT(*) FROM health_metrics) +
+		(SELECT COUNT(*) FROM sleep_data) +
+		(SELECT COUNT(*) FROM heart_rate_data) +
+		(SELECT COUNT(*) FROM gpx_tracks)`).Scan(&n)
+	return n == 0, err
+}
+
+// ImportFrom copies every activity, health metric, night of sleep, day of
+// heart rate data and GPS track from src, keeping their IDs and creation
+// times. It is used to move an existing JSON data directory into a fresh
+// database. The copy is one transaction, so an import that fails leaves the
+// database empty and is tried again on the next start.
+func (s *SQLiteStorage) ImportFrom(src Storage) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	count := 0
+
+	activities, err := src.GetActivities()
+	if err != nil {
+		return 0, err
+	}
+	for _, activity := range activities {
+		if err := putActivity(tx, activity); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	metrics, err := src.GetHealthMetrics()
+	if err != nil {
+		return 0, err
+	}
+	for _, metric := range metrics {
+		if err := putHealthMetric(tx, metric); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	nights, err := src.GetSleepData()
+	if err != nil {
+		return 0, err
+	}
+	for _, sleep := range nights {
+		if err := putSleepData(tx, sleep); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	days, err := src.GetHeartRateData()
+	if err != nil {
+		return 0, err
+	}
+	for _, hr := range days {
+		if err := putHeartRateData(tx, hr); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	tracks, err := src.GetGPXTracks()
+	if err != nil {
+		return 0, err
+	}
+	for _, track := range tracks {
+		if err := putGPXTrack(tx, track); err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// execer is what records are written through: the database, or the
+// transaction of an import.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func (s *SQLiteStorage) SaveActivity(activity *models.Activity) error {
+	if activity.ID == "" {
+		activity.ID = fmt.Sprintf("activity_%d", time.Now().UnixNano())
+	}
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
+
+	return putActivity(s.db, activity)
+}
+
+// UpdateActivity overwrites an existing activity, returning ErrNotFound if
+// there is nothing to update.
+func (s *SQLiteStorage) UpdateActivity(activity *models.Activity) error {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM activities WHERE id = ?)`, activity.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return s.SaveActivity(activity)
+}
+
+func (s *SQLiteStorage) DeleteActivity(id string) error {
+	activity, err := s.GetActivity(id)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM activities WHERE id = ?`, id); err != nil {
+		return err
+	}
+	// Track points go with the track through ON DELETE CASCADE
+	if _, err := tx.Exec(`DELETE FROM gpx_tracks WHERE id = ?`, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if activity.GPXFile != "" && activity.GPXFile == filepath.Base(activity.GPXFile) {
+		err := os.Remove(filepath.Join(s.basePath, "uploads", activity.GPXFile))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func putActivity(ex execer, activity *models.Activity) error {
+	data, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`INSERT OR REPLACE INTO activities
+		(id, name, type, start_time, distance, duration, total_elevation, created_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		activity.ID, activity.Name, activity.Type, unixNano(activity.StartTime),
+		activity.Distance, activity.Duration, activity.TotalElevation,
+		unixNano(activity.CreatedAt), string(data))
+	return err
+}
+
+func (s *SQLiteStorage) GetActivity(id string) (*models.Activity, error) {
+	var activity models.Activity
+	if err := s.getJSON(`SELECT data FROM activities WHERE id = ?`, id, &activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
+func (s *SQLiteStorage) GetActivities() ([]*models.Activity, error) {
+	rows, err := s.db.Query(`SELECT data FROM activities ORDER BY start_time, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []*models.Activity
+	for rows.Next() {
+		var activity models.Activity
+		if err := scanJSON(rows, &activity); err != nil {
+			return nil, err
+		}
+		activities = append(activities, &activity)
+	}
+
+	return activities, rows.Err()
+}
+
+// activitySortColumns maps ActivityQuery sort fields to indexed columns.
+var activitySortColumns = map[string]string{
+	SortByStartTime: "start_time",
+	SortByDistance:  "distance",
+	SortByDuration:  "duration",
+	SortByElevation: "total_elevation",
+}
+
+func (s *SQLiteStorage) QueryActivities(q ActivityQuery) ([]*models.Activity, string, error) {
+	after, err := decodeActivityCursor(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var where []string
+	var args []interface{}
+	if q.Type != "" {
+		where = append(where, "type = ? COLLATE NOCASE")
+		args = append(args, q.Type)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "start_time >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "start_time < ?")
+		args = append(args, q.To.UnixNano())
+	}
+	if q.MinDistance > 0 {
+		where = append(where, "distance >= ?")
+		args = append(args, q.MinDistance)
+	}
+	if q.MaxDistance > 0 {
+		where = append(where, "distance <= ?")
+		args = append(args, q.MaxDistance)
+	}
+	if q.Search != "" {
+		where = append(where, `name LIKE ? ESCAPE '\'`)
+		args = append(args, "%"+likeEscaper.Replace(q.Search)+"%")
+	}
+
+	column := activitySortColumns[q.sortField()]
+	if column == "" {
+		column = "start_time"
+	}
+	direction, op := "ASC", ">"
+	if q.Desc {
+		direction, op = "DESC", "<"
+	}
+	if after != nil {
+		var key interface{} = after.Int
+		if q.sortField() == SortByDistance || q.sortField() == SortByElevation {
+			key = after.Float
+		}
+		where = append(where, fmt.Sprintf("(%s %s ? OR (%s = ? AND id %s ?))", column, op, column, op))
+		args = append(args, key, key, after.ID)
+	}
+
+	query := "SELECT data FROM activities"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, id %s", column, direction, direction)
+	if q.Limit > 0 {
+		// Fetch one extra row to learn whether there is a next page
+		query += " LIMIT ?"
+		args = append(args, q.Limit+1)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var activities []*models.Activity
+	for rows.Next() {
+		var activity models.Activity
+		if err := scanJSON(rows, &activity); err != nil {
+			return nil, "", err
+		}
+		activities = append(activities, &activity)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if q.Limit > 0 && len(activities) > q.Limit {
+		activities = activities[:q.Limit]
+		return activities, newActivityCursor(q, activities[len(activities)-1]).encode(), nil
+	}
+	return activities, "", nil
+}
+
+// likeEscaper escapes LIKE wildcards so search terms match literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *SQLiteStorage) SaveHealthMetric(metric *models.HealthMetric) error {
+	if metric.ID == "" {
+		metric.ID = fmt.Sprintf("health_%d", time.Now().UnixNano())
+	}
+	metric.CreatedAt = time.Now()
+
+	return putHealthMetric(s.db, metric)
+}
+
+func putHealthMetric(ex execer, metric *models.HealthMetric) error {
+	data, err := json.Marshal(metric)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`INSERT OR REPLACE INTO health_metrics
+		(id, type, value, unit, timestamp, source, created_at, data)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		metric.ID, metric.Type, metric.Value, metric.Unit, unixNano(metric.Timestamp),
+		metric.Source, unixNano(metric.CreatedAt), string(data))
+	return err
+}
+
+func (s *SQLiteStorage) GetHealthMetric(id string) (*models.HealthMetric, error) {
+	var metric models.HealthMetric
+	if err := s.getJSON(`SELECT data FROM health_metrics WHERE id = ?`, id, &metric); err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
+func (s *SQLiteStorage) QueryHealthMetrics(q HealthMetricQuery) ([]*models.HealthMetric, error) {
+	var where []string
+	var args []interface{}
+	if q.Type != "" {
+		where = append(where, "type = ?")
+		args = append(args, q.Type)
+	}
+	if q.Source != "" {
+		where = append(where, "source = ?")
+		args = append(args, q.Source)
+	}
+	if !q.From.IsZero() {
+		where = append(where, "timestamp >= ?")
+		args = append(args, q.From.UnixNano())
+	}
+	if !q.To.IsZero() {
+		where = append(where, "timestamp < ?")
+		args = append(args, q.To.UnixNano())
+	}
+
+	query := "SELECT data FROM health_metrics"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	if q.Desc {
+		query += " ORDER BY timestamp DESC, id DESC"
+	} else {
+		query += " ORDER BY timestamp, id"
+	}
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []*models.HealthMetric
+	for rows.Next() {
+		var metric models.HealthMetric
+		if err := scanJSON(rows, &metric); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, &metric)
+	}
+
+	return metrics, rows.Err()
+}
+
+func (s *SQLiteStorage) DeleteHealthMetric(id string) error {
+	result, err := s.db.Exec(`DELETE FROM health_metrics WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLiteStorage) GetHealthMetrics() ([]*models.HealthMetric, error) {
+	rows, err := s.db.Query(`SELECT data FROM health_metrics ORDER BY timestamp, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var metrics []*models.HealthMetric
+	for rows.Next() {
+		var metric models.HealthMetric
+		if err := scanJSON(rows, &metric); err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, &metric)
+	}
+
+	return metrics, rows.Err()
+}
+
+func (s *SQLiteStorage) SaveSleepData(sleep *models.SleepData) error {
+	if sleep.ID == "" {
+		sleep.ID = fmt.Sprintf("sleep_%d", time.Now().UnixNano())
+	}
+	sleep.CreatedAt = time.Now()
+
+	return putSleepData(s.db, sleep)
+}
+
+func putSleepData(ex execer, sleep *models.SleepData) error {
+	data, err := json.Marshal(sleep)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`INSERT OR REPLACE INTO sleep_data (id, date, source, created_at, data) VALUES (?, ?, ?, ?, ?)`,
+		sleep.ID, unixNano(sleep.Date), sleep.Source, unixNano(sleep.CreatedAt), string(data))
+	return err
+}
+
+func (s *SQLiteStorage) GetSleepData() ([]*models.SleepData, error) {
+	rows, err := s.db.Query(`SELECT data FROM sleep_data ORDER BY date, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var nights []*models.SleepData
+	for rows.Next() {
+		var sleep models.SleepData
+		if err := scanJSON(rows, &sleep); err != nil {
+			return nil, err
+		}
+		nights = append(nights, &sleep)
+	}
+
+	return nights, rows.Err()
+}
+
+func (s *SQLiteStorage) SaveHeartRateData(hr *models.HeartRateData) error {
+	if hr.ID == "" {
+		hr.ID = fmt.Sprintf("hr_%d", time.Now().UnixNano())
+	}
+	hr.CreatedAt = time.Now()
+
+	return putHeartRateData(s.db, hr)
+}
+
+func putHeartRateData(ex execer, hr *models.HeartRateData) error {
+	data, err := json.Marshal(hr)
+	if err != nil {
+		return err
+	}
+
+	_, err = ex.Exec(`INSERT OR REPLACE INTO heart_rate_data (id, date, source, created_at, data) VALUES (?, ?, ?, ?, ?)`,
+		hr.ID, unixNano(hr.Date), hr.Source, unixNano(hr.CreatedAt), string(data))
+	return err
+}
+
+func (s *SQLiteStorage) GetHeartRateData() ([]*models.HeartRateData, error) {
+	rows, err := s.db.Query(`SELECT data FROM heart_rate_data ORDER BY date, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []*models.HeartRateData
+	for rows.Next() {
+		var hr models.HeartRateData
+		if err := scanJSON(rows, &hr); err != nil {
+			return nil, err
+		}
+		days = append(days, &hr)
+	}
+
+	return days, rows.Err()
+}
+
+func (s *SQLiteStorage) SaveGPXTrack(track *models.GPXTrack) error {
+	if track.ID == "" {
+		track.ID = fmt.Sprintf("gpx_%d", time.Now().UnixNano())
+	}
+	track.CreatedAt = time.Now()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := putGPXTrack(tx, track); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// putGPXTrack writes a track and its points within tx.
+func putGPXTrack(tx *sql.Tx, track *models.GPXTrack) error {
+	// Points are stored as rows, so keep them out of the JSON column
+	header := *track
+	header.Points = nil
+	data, err := json.Marshal(&header)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO gpx_tracks (id, name, created_at, data) VALUES (?, ?, ?, ?)`,
+		track.ID, track.Name, unixNano(track.CreatedAt), string(data)); err != nil {
+		return err
+	}
+
+	// INSERT OR REPLACE on the parent does not cascade, so clear old points explicitly
+	if _, err := tx.Exec(`DELETE FROM track_points WHERE track_id = ?`, track.ID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO track_points (track_id, seq, lat, lon, elevation, time, cadence, heart_rate, power, temperature) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, point := range track.Points {
+		var pointTime interface{}
+		if !point.Time.IsZero() {
+			pointTime = point.Time.UnixNano()
+		}
+		if _, err := stmt.Exec(track.ID, i, point.Lat, point.Lon, point.Elevation, pointTime, point.Cadence, point.HeartRate, point.Power, point.Temperature); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStorage) GetGPXTrack(id string) (*models.GPXTrack, error) {
+	var track models.GPXTrack
+	if err := s.getJSON(`SELECT data FROM gpx_tracks WHERE id = ?`, id, &track); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT `+pointColumns+` FROM track_points WHERE track_id = ? ORDER BY seq`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	track.Points = []models.GPXPoint{}
+	for rows.Next() {
+		var trackID string
+		point, err := scanPoint(rows, &trackID)
+		if err != nil {
+			return nil, err
+		}
+		track.Points = append(track.Points, point)
+	}
+
+	return &track, rows.Err()
+}
+
+func (s *SQLiteStorage) GetGPXTracks() ([]*models.GPXTrack, error) {
+	rows, err := s.db.Query(`SELECT data FROM gpx_tracks ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []*models.GPXTrack
+	byID := make(map[string]*models.GPXTrack)
+	for rows.Next() {
+		var track models.GPXTrack
+		if err := scanJSON(rows, &track); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		track.Points = []models.GPXPoint{}
+		tracks = append(tracks, &track)
+		byID[track.ID] = &track
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	pointRows, err := s.db.Query(`SELECT ` + pointColumns + ` FROM track_points ORDER BY track_id, seq`)
+	if err != nil {
+		return nil, err
+	}
+	defer pointRows.Close()
+
+	for pointRows.Next() {
+		var trackID string
+		point, err := scanPoint(pointRows, &trackID)
+		if err != nil {
+			return nil, err
+		}
+		if track, ok := byID[trackID]; ok {
+			track.Points = append(track.Points, point)
+		}
+	}
+
+	return tracks, pointRows.Err()
+}
+
+func (s *SQLiteStorage) SaveFile(filename string, data []byte) error {
+	return os.WriteFile(filepath.Join(s.basePath, "uploads", filename), data, 0644)
+}
+
+// getJSON loads the JSON data column of a single row, returning ErrNotFound
+// when the query matches nothing.
+func (s *SQLiteStorage) getJSON(query string, id string, v interface{}) error {
+	var data string
+	if err := s.db.QueryRow(query, id).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// scanPoint reads one track_points row selected as pointColumns.
+func scanPoint(rows *sql.Rows, trackID *string) (models.GPXPoint, error) {
+	var point models.GPXPoint
+	var pointTime sql.NullInt64
+	var temperature sql.NullFloat64
+	if err := rows.Scan(trackID, &point.Lat, &point.Lon, &point.Elevation, &pointTime, &point.Cadence, &point.HeartRate, &point.Power, &temperature); err != nil {
+		return point, err
+	}
+	if temperature.Valid {
+		point.Temperature = &temperature.Float64
+	}
+	if pointTime.Valid {
+		point.Time = time.Unix(0, pointTime.Int64).UTC()
+	}
+	return point, nil
+}
+
+func scanJSON(rows *sql.Rows, v interface{}) error {
+	var data string
+	if err := rows.Scan(&data); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+// unixNano stores the zero time as 0 rather than a large negative number.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
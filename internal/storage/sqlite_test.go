@@ -0,0 +1,273 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func newTestSQLiteStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+	dir := t.TempDir()
+	s, err := NewSQLiteStorage(dir, filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error = %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStorageActivities(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	start := time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)
+	activity := &models.Activity{
+		Name:      "Morning Run",
+		Type:      "running",
+		StartTime: start,
+		Distance:  5000,
+		Duration:  1500,
+	}
+	if err := s.SaveActivity(activity); err != nil {
+		t.Fatalf("SaveActivity() error = %v", err)
+	}
+	if activity.ID == "" {
+		t.Fatal("SaveActivity() did not assign an ID")
+	}
+
+	activities, err := s.GetActivities()
+	if err != nil {
+		t.Fatalf("GetActivities() error = %v", err)
+	}
+	if len(activities) != 1 {
+		t.Fatalf("Expected 1 activity, got %d", len(activities))
+	}
+	got := activities[0]
+	if got.ID != activity.ID || got.Name != "Morning Run" || !got.StartTime.Equal(start) || got.Distance != 5000 {
+		t.Errorf("GetActivities() returned %+v", got)
+	}
+
+	// Saving again with the same ID replaces the record
+	activity.Name = "Renamed Run"
+	if err := s.SaveActivity(activity); err != nil {
+		t.Fatalf("SaveActivity() error = %v", err)
+	}
+	activities, _ = s.GetActivities()
+	if len(activities) != 1 || activities[0].Name != "Renamed Run" {
+		t.Errorf("Expected a single renamed activity, got %+v", activities)
+	}
+}
+
+func TestSQLiteStorageGPXTracks(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	start := time.Date(2024, 3, 1, 7, 30, 0, 0, time.UTC)
+	temperature := 0.0
+	track := &models.GPXTrack{
+		ID:   "activity_1",
+		Name: "Loop",
+		Points: []models.GPXPoint{
+			{Lat: 40.0, Lon: -74.0, Elevation: 10, Time: start},
+			{Lat: 40.1, Lon: -74.1, Elevation: 12, Time: start.Add(10 * time.Second), HeartRate: 142, Cadence: 88, Power: 230, Temperature: &temperature},
+			{Lat: 40.2, Lon: -74.2},
+		},
+	}
+	if err := s.SaveGPXTrack(track); err != nil {
+		t.Fatalf("SaveGPXTrack() error = %v", err)
+	}
+
+	// Re-saving a shorter track must not leave stale points behind
+	track.Points = track.Points[:2]
+	if err := s.SaveGPXTrack(track); err != nil {
+		t.Fatalf("SaveGPXTrack() error = %v", err)
+	}
+
+	tracks, err := s.GetGPXTracks()
+	if err != nil {
+		t.Fatalf("GetGPXTracks() error = %v", err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("Expected 1 track, got %d", len(tracks))
+	}
+	if len(tracks[0].Points) != 2 {
+		t.Fatalf("Expected 2 points, got %d", len(tracks[0].Points))
+	}
+	if p := tracks[0].Points[1]; p.Lat != 40.1 || p.Elevation != 12 || !p.Time.Equal(start.Add(10*time.Second)) {
+		t.Errorf("Unexpected second point %+v", p)
+	}
+	if p := tracks[0].Points[1]; p.HeartRate != 142 || p.Cadence != 88 || p.Power != 230 || p.Temperature == nil || *p.Temperature != 0 {
+		t.Errorf("Sensor data not preserved: %+v", p)
+	}
+	if p := tracks[0].Points[0]; p.Temperature != nil {
+		t.Errorf("Expected no temperature on the first point, got %v", *p.Temperature)
+	}
+}
+
+func TestSQLiteStorageImportFrom(t *testing.T) {
+	dir := t.TempDir()
+	files := NewFileStorage(dir)
+	files.SaveActivity(&models.Activity{ID: "activity_1", Name: "Ride", Type: "cycling"})
+	files.SaveHealthMetric(&models.HealthMetric{Type: "weight", Value: 80, Unit: "kg"})
+	files.SaveGPXTrack(&models.GPXTrack{ID: "activity_1", Points: []models.GPXPoint{{Lat: 1, Lon: 2}}})
+	files.SaveSleepData(&models.SleepData{ID: "sleep_1", Date: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), TotalSleep: 420})
+	files.SaveHeartRateData(&models.HeartRateData{ID: "hr_1", Date: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), RestingHR: 52})
+
+	s := newTestSQLiteStorage(t)
+	empty, err := s.Empty()
+	if err != nil || !empty {
+		t.Fatalf("Empty() = %v, %v; expected true", empty, err)
+	}
+
+	imported, err := s.ImportFrom(files)
+	if err != nil {
+		t.Fatalf("ImportFrom() error = %v", err)
+	}
+	if imported != 5 {
+		t.Errorf("Expected 5 imported records, got %d", imported)
+	}
+
+	activities, _ := s.GetActivities()
+	if len(activities) != 1 || activities[0].ID != "activity_1" {
+		t.Errorf("Unexpected activities after import: %+v", activities)
+	}
+	metrics, _ := s.GetHealthMetrics()
+	if len(metrics) != 1 || metrics[0].Value != 80 {
+		t.Errorf("Unexpected metrics after import: %+v", metrics)
+	}
+	nights, _ := s.GetSleepData()
+	if len(nights) != 1 || nights[0].TotalSleep != 420 {
+		t.Errorf("Unexpected sleep after import: %+v", nights)
+	}
+	days, _ := s.GetHeartRateData()
+	if len(days) != 1 || days[0].RestingHR != 52 {
+		t.Errorf("Unexpected heart rate data after import: %+v", days)
+	}
+}
+
+// failingSleepStorage fails part way through an import, after activities,
+// metrics and tracks have been copied.
+type failingSleepStorage struct {
+	*FileStorage
+}
+
+func (failingSleepStorage) GetSleepData() ([]*models.SleepData, error) {
+	return nil, errors.New("disk error")
+}
+
+func TestSQLiteStorageImportFromRollsBack(t *testing.T) {
+	files := NewFileStorage(t.TempDir())
+	files.SaveActivity(&models.Activity{ID: "activity_1", Name: "Ride", Type: "cycling"})
+	files.SaveGPXTrack(&models.GPXTrack{ID: "activity_1", Points: []models.GPXPoint{{Lat: 1, Lon: 2}}})
+
+	s := newTestSQLiteStorage(t)
+	if _, err := s.ImportFrom(failingSleepStorage{files}); err == nil {
+		t.Fatal("ImportFrom() expected an error")
+	}
+	if empty, err := s.Empty(); err != nil || !empty {
+		t.Errorf("Empty() = %v, %v after a failed import; expected true", empty, err)
+	}
+}
+
+func TestSQLiteStorageSleepData(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	s.SaveSleepData(&models.SleepData{ID: "sleep_2", Date: day.AddDate(0, 0, 1), TotalSleep: 400})
+	s.SaveSleepData(&models.SleepData{ID: "sleep_1", Date: day, TotalSleep: 420, DeepSleep: 60})
+
+	// Saving again with the same ID replaces the night
+	if err := s.SaveSleepData(&models.SleepData{ID: "sleep_1", Date: day, TotalSleep: 430, DeepSleep: 70}); err != nil {
+		t.Fatalf("SaveSleepData() error = %v", err)
+	}
+
+	nights, err := s.GetSleepData()
+	if err != nil {
+		t.Fatalf("GetSleepData() error = %v", err)
+	}
+	if len(nights) != 2 || nights[0].ID != "sleep_1" || nights[0].TotalSleep != 430 || !nights[0].Date.Equal(day) {
+		t.Errorf("GetSleepData() = %+v, expected sleep_1 updated and first", nights)
+	}
+}
+
+func TestSQLiteStorageHeartRateData(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	day := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	s.SaveHeartRateData(&models.HeartRateData{ID: "hr_2", Date: day.AddDate(0, 0, 1), RestingHR: 50})
+	s.SaveHeartRateData(&models.HeartRateData{ID: "hr_1", Date: day, RestingHR: 55, HRVariability: 40})
+
+	if err := s.SaveHeartRateData(&models.HeartRateData{ID: "hr_1", Date: day, RestingHR: 54, HRVariability: 42.5}); err != nil {
+		t.Fatalf("SaveHeartRateData() error = %v", err)
+	}
+	if err := s.SaveHeartRateData(&models.HeartRateData{Date: day.AddDate(0, 0, 2), RestingHR: 51}); err != nil {
+		t.Fatalf("SaveHeartRateData() without ID error = %v", err)
+	}
+
+	days, err := s.GetHeartRateData()
+	if err != nil {
+		t.Fatalf("GetHeartRateData() error = %v", err)
+	}
+	if len(days) != 3 || days[0].ID != "hr_1" || days[0].RestingHR != 54 || days[0].HRVariability != 42.5 || days[2].ID == "" {
+		t.Errorf("GetHeartRateData() = %+v, expected hr_1 updated and first", days)
+	}
+}
+
+func TestSQLiteStorageGetByID(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	s.SaveActivity(&models.Activity{ID: "activity_1", Name: "Ride"})
+	s.SaveGPXTrack(&models.GPXTrack{ID: "activity_1", Points: []models.GPXPoint{{Lat: 1, Lon: 2}, {Lat: 3, Lon: 4}}})
+	metric := &models.HealthMetric{Type: "steps", Value: 9000}
+	s.SaveHealthMetric(metric)
+
+	activity, err := s.GetActivity("activity_1")
+	if err != nil || activity.Name != "Ride" {
+		t.Errorf("GetActivity() = %+v, %v", activity, err)
+	}
+	track, err := s.GetGPXTrack("activity_1")
+	if err != nil || len(track.Points) != 2 || track.Points[1].Lat != 3 {
+		t.Errorf("GetGPXTrack() = %+v, %v", track, err)
+	}
+	got, err := s.GetHealthMetric(metric.ID)
+	if err != nil || got.Value != 9000 {
+		t.Errorf("GetHealthMetric() = %+v, %v", got, err)
+	}
+
+	if _, err := s.GetActivity("missing"); err != ErrNotFound {
+		t.Errorf("GetActivity(missing) error = %v, expected ErrNotFound", err)
+	}
+	if _, err := s.GetGPXTrack("missing"); err != ErrNotFound {
+		t.Errorf("GetGPXTrack(missing) error = %v, expected ErrNotFound", err)
+	}
+}
+
+func TestSQLiteStorageDelete(t *testing.T) {
+	s := newTestSQLiteStorage(t)
+
+	s.SaveActivity(&models.Activity{ID: "activity_1", Name: "Ride"})
+	s.SaveGPXTrack(&models.GPXTrack{ID: "activity_1", Points: []models.GPXPoint{{Lat: 1, Lon: 2}}})
+	metric := &models.HealthMetric{Type: "steps", Value: 9000}
+	s.SaveHealthMetric(metric)
+
+	if err := s.DeleteActivity("activity_1"); err != nil {
+		t.Fatalf("DeleteActivity() error = %v", err)
+	}
+	if _, err := s.GetGPXTrack("activity_1"); err != ErrNotFound {
+		t.Errorf("Track still present after delete: %v", err)
+	}
+	var points int
+	s.db.QueryRow(`SELECT COUNT(*) FROM track_points`).Scan(&points)
+	if points != 0 {
+		t.Errorf("Expected track points to be removed, %d left", points)
+	}
+
+	if err := s.DeleteHealthMetric(metric.ID); err != nil {
+		t.Fatalf("DeleteHealthMetric() error = %v", err)
+	}
+	if err := s.DeleteHealthMetric(metric.ID); err != ErrNotFound {
+		t.Errorf("Second DeleteHealthMetric() error = %v, expected ErrNotFound", err)
+	}
+}
@@ -2,21 +2,51 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 
 	"health-hub/internal/models"
 )
 
+// ErrNotFound is returned by the Get-by-ID methods when no record has the
+// requested ID.
+var ErrNotFound = errors.New("not found")
+
 type Storage interface {
 	SaveActivity(activity *models.Activity) error
+	UpdateActivity(activity *models.Activity) error
+	GetActivity(id string) (*models.Activity, error)
 	GetActivities() ([]*models.Activity, error)
+	// QueryActivities returns one page of activities matching q and the
+	// cursor for the next page, which is empty on the last page.
+	QueryActivities(q ActivityQuery) ([]*models.Activity, string, error)
+	// DeleteActivity removes an activity together with its GPS track and
+	// raw uploaded file.
+	DeleteActivity(id string) error
 	SaveHealthMetric(metric *models.HealthMetric) error
+	GetHealthMetric(id string) (*models.HealthMetric, error)
 	GetHealthMetrics() ([]*models.HealthMetric, error)
+	QueryHealthMetrics(q HealthMetricQuery) ([]*models.HealthMetric, error)
+	DeleteHealthMetric(id string) error
+	// SaveSleepData saves one night of sleep, replacing any stored with
+	// the same ID.
+	SaveSleepData(sleep *models.SleepData) error
+	// GetSleepData returns every stored night of sleep, oldest first.
+	GetSleepData() ([]*models.SleepData, error)
+	// SaveHeartRateData saves one day's resting heart rate and HRV,
+	// replacing any stored with the same ID.
+	SaveHeartRateData(hr *models.HeartRateData) error
+	// GetHeartRateData returns every stored day of heart rate data, oldest
+	// first.
+	GetHeartRateData() ([]*models.HeartRateData, error)
 	SaveGPXTrack(track *models.GPXTrack) error
+	GetGPXTrack(id string) (*models.GPXTrack, error)
 	GetGPXTracks() ([]*models.GPXTrack, error)
 	SaveFile(filename string, data []byte) error
 }
@@ -29,6 +59,8 @@ func NewFileStorage(basePath string) *FileStorage {
 	os.MkdirAll(basePath, 0755)
 	os.MkdirAll(filepath.Join(basePath, "activities"), 0755)
 	os.MkdirAll(filepath.Join(basePath, "health"), 0755)
+	os.MkdirAll(filepath.Join(basePath, "sleep"), 0755)
+	os.MkdirAll(filepath.Join(basePath, "heart_rate"), 0755)
 	os.MkdirAll(filepath.Join(basePath, "gpx"), 0755)
 	os.MkdirAll(filepath.Join(basePath, "uploads"), 0755)
 	
@@ -39,12 +71,55 @@ func (fs *FileStorage) SaveActivity(activity *models.Activity) error {
 	if activity.ID == "" {
 		activity.ID = fmt.Sprintf("activity_%d", time.Now().UnixNano())
 	}
-	activity.CreatedAt = time.Now()
+	if activity.CreatedAt.IsZero() {
+		activity.CreatedAt = time.Now()
+	}
 	
 	filename := filepath.Join(fs.basePath, "activities", activity.ID+".json")
 	return fs.saveJSON(filename, activity)
 }
 
+// UpdateActivity overwrites an existing activity, returning ErrNotFound if
+// there is nothing to update.
+func (fs *FileStorage) UpdateActivity(activity *models.Activity) error {
+	filename, err := fs.recordPath("activities", activity.ID)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	return fs.SaveActivity(activity)
+}
+
+func (fs *FileStorage) DeleteActivity(id string) error {
+	activity, err := fs.GetActivity(id)
+	if err != nil {
+		return err
+	}
+
+	filename, _ := fs.recordPath("activities", id)
+	if err := os.Remove(filename); err != nil {
+		return err
+	}
+
+	// The track and raw upload may never have been written, so a missing file is fine
+	if trackFile, err := fs.recordPath("gpx", id); err == nil {
+		if err := os.Remove(trackFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return fs.deleteUpload(activity.GPXFile)
+}
+
+func (fs *FileStorage) GetActivity(id string) (*models.Activity, error) {
+	var activity models.Activity
+	if err := fs.loadRecord("activities", id, &activity); err != nil {
+		return nil, err
+	}
+	return &activity, nil
+}
+
 func (fs *FileStorage) GetActivities() ([]*models.Activity, error) {
 	var activities []*models.Activity
 	
@@ -65,6 +140,14 @@ func (fs *FileStorage) GetActivities() ([]*models.Activity, error) {
 	return activities, nil
 }
 
+func (fs *FileStorage) QueryActivities(q ActivityQuery) ([]*models.Activity, string, error) {
+	activities, err := fs.GetActivities()
+	if err != nil {
+		return nil, "", err
+	}
+	return queryActivities(activities, q)
+}
+
 func (fs *FileStorage) SaveHealthMetric(metric *models.HealthMetric) error {
 	if metric.ID == "" {
 		metric.ID = fmt.Sprintf("health_%d", time.Now().UnixNano())
@@ -75,6 +158,14 @@ func (fs *FileStorage) SaveHealthMetric(metric *models.HealthMetric) error {
 	return fs.saveJSON(filename, metric)
 }
 
+func (fs *FileStorage) GetHealthMetric(id string) (*models.HealthMetric, error) {
+	var metric models.HealthMetric
+	if err := fs.loadRecord("health", id, &metric); err != nil {
+		return nil, err
+	}
+	return &metric, nil
+}
+
 func (fs *FileStorage) GetHealthMetrics() ([]*models.HealthMetric, error) {
 	var metrics []*models.HealthMetric
 	
@@ -95,6 +186,100 @@ func (fs *FileStorage) GetHealthMetrics() ([]*models.HealthMetric, error) {
 	return metrics, nil
 }
 
+func (fs *FileStorage) QueryHealthMetrics(q HealthMetricQuery) ([]*models.HealthMetric, error) {
+	metrics, err := fs.GetHealthMetrics()
+	if err != nil {
+		return nil, err
+	}
+	return queryHealthMetrics(metrics, q), nil
+}
+
+func (fs *FileStorage) DeleteHealthMetric(id string) error {
+	filename, err := fs.recordPath("health", id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(filename); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+func (fs *FileStorage) SaveSleepData(sleep *models.SleepData) error {
+	if sleep.ID == "" {
+		sleep.ID = fmt.Sprintf("sleep_%d", time.Now().UnixNano())
+	}
+	sleep.CreatedAt = time.Now()
+
+	filename, err := fs.recordPath("sleep", sleep.ID)
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", sleep.ID)
+	}
+	return fs.saveJSON(filename, sleep)
+}
+
+func (fs *FileStorage) GetSleepData() ([]*models.SleepData, error) {
+	var nights []*models.SleepData
+
+	files, err := ioutil.ReadDir(filepath.Join(fs.basePath, "sleep"))
+	if err != nil {
+		return nights, nil
+	}
+
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			var sleep models.SleepData
+			if err := fs.loadJSON(filepath.Join(fs.basePath, "sleep", file.Name()), &sleep); err == nil {
+				nights = append(nights, &sleep)
+			}
+		}
+	}
+
+	sort.SliceStable(nights, func(i, j int) bool {
+		return nights[i].Date.Before(nights[j].Date)
+	})
+	return nights, nil
+}
+
+func (fs *FileStorage) SaveHeartRateData(hr *models.HeartRateData) error {
+	if hr.ID == "" {
+		hr.ID = fmt.Sprintf("hr_%d", time.Now().UnixNano())
+	}
+	hr.CreatedAt = time.Now()
+
+	filename, err := fs.recordPath("heart_rate", hr.ID)
+	if err != nil {
+		return fmt.Errorf("invalid ID %q", hr.ID)
+	}
+	return fs.saveJSON(filename, hr)
+}
+
+func (fs *FileStorage) GetHeartRateData() ([]*models.HeartRateData, error) {
+	var days []*models.HeartRateData
+
+	files, err := ioutil.ReadDir(filepath.Join(fs.basePath, "heart_rate"))
+	if err != nil {
+		return days, nil
+	}
+
+	for _, file := range files {
+		if filepath.Ext(file.Name()) == ".json" {
+			var hr models.HeartRateData
+			if err := fs.loadJSON(filepath.Join(fs.basePath, "heart_rate", file.Name()), &hr); err == nil {
+				days = append(days, &hr)
+			}
+		}
+	}
+
+	sort.SliceStable(days, func(i, j int) bool {
+		return days[i].Date.Before(days[j].Date)
+	})
+	return days, nil
+}
+
 func (fs *FileStorage) SaveGPXTrack(track *models.GPXTrack) error {
 	if track.ID == "" {
 		track.ID = fmt.Sprintf("gpx_%d", time.Now().UnixNano())
@@ -105,6 +290,14 @@ func (fs *FileStorage) SaveGPXTrack(track *models.GPXTrack) error {
 	return fs.saveJSON(filename, track)
 }
 
+func (fs *FileStorage) GetGPXTrack(id string) (*models.GPXTrack, error) {
+	var track models.GPXTrack
+	if err := fs.loadRecord("gpx", id, &track); err != nil {
+		return nil, err
+	}
+	return &track, nil
+}
+
 func (fs *FileStorage) GetGPXTracks() ([]*models.GPXTrack, error) {
 	var tracks []*models.GPXTrack
 	
@@ -129,6 +322,18 @@ func (fs *FileStorage) SaveFile(filename string, data []byte) error {
 	return ioutil.WriteFile(filepath.Join(fs.basePath, "uploads", filename), data, 0644)
 }
 
+// deleteUpload removes a raw uploaded file if it exists.
+func (fs *FileStorage) deleteUpload(filename string) error {
+	if filename == "" || filename != filepath.Base(filename) {
+		return nil
+	}
+	err := os.Remove(filepath.Join(fs.basePath, "uploads", filename))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
 func (fs *FileStorage) saveJSON(filename string, v interface{}) error {
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
@@ -137,6 +342,31 @@ func (fs *FileStorage) saveJSON(filename string, v interface{}) error {
 	return ioutil.WriteFile(filename, data, 0644)
 }
 
+// recordPath returns the JSON file for a record ID. IDs that could escape the
+// folder can never have been saved, so they are reported as ErrNotFound.
+func (fs *FileStorage) recordPath(folder, id string) (string, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return "", ErrNotFound
+	}
+	return filepath.Join(fs.basePath, folder, id+".json"), nil
+}
+
+// loadRecord reads a single record by ID, returning ErrNotFound when its
+// file does not exist.
+func (fs *FileStorage) loadRecord(folder, id string, v interface{}) error {
+	filename, err := fs.recordPath(folder, id)
+	if err != nil {
+		return err
+	}
+	if err := fs.loadJSON(filename, v); err != nil {
+		if os.IsNotExist(err) {
+			return ErrNotFound
+		}
+		return err
+	}
+	return nil
+}
+
 func (fs *FileStorage) loadJSON(filename string, v interface{}) error {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"health-hub/internal/models"
+)
+
+func TestFileStorageGetByID(t *testing.T) {
+	fs := NewFileStorage(t.TempDir())
+
+	fs.SaveActivity(&models.Activity{ID: "activity_1", Name: "Hike"})
+	fs.SaveGPXTrack(&models.GPXTrack{ID: "activity_1", Points: []models.GPXPoint{{Lat: 1, Lon: 2}}})
+
+	activity, err := fs.GetActivity("activity_1")
+	if err != nil || activity.Name != "Hike" {
+		t.Errorf("GetActivity() = %+v, %v", activity, err)
+	}
+	track, err := fs.GetGPXTrack("activity_1")
+	if err != nil || len(track.Points) != 1 {
+		t.Errorf("GetGPXTrack() = %+v, %v", track, err)
+	}
+
+	for _, id := range []string{"missing", "", "../activities/activity_1", ".hidden"} {
+		if _, err := fs.GetActivity(id); err != ErrNotFound {
+			t.Errorf("GetActivity(%q) error = %v, expected ErrNotFound", id, err)
+		}
+	}
+}
+
+func TestFileStorageDeleteActivity(t *testing.T) {
+	dir := t.TempDir()
+	fs := NewFileStorage(dir)
+
+	fs.SaveFile("gpx_1_run.gpx", []byte("<gpx/>"))
+	activity := &models.Activity{ID: "activity_1", Name: "Run", GPXFile: "gpx_1_run.gpx"}
+	fs.SaveActivity(activity)
+	fs.SaveGPXTrack(&models.GPXTrack{ID: "activity_1"})
+
+	createdAt := activity.CreatedAt
+	activity.Name = "Updated"
+	if err := fs.UpdateActivity(activity); err != nil {
+		t.Fatalf("UpdateActivity() error = %v", err)
+	}
+	if got, _ := fs.GetActivity("activity_1"); !got.CreatedAt.Equal(createdAt) || got.Name != "Updated" {
+		t.Errorf("UpdateActivity() should keep CreatedAt, got %+v", got)
+	}
+	if err := fs.UpdateActivity(&models.Activity{ID: "missing"}); err != ErrNotFound {
+		t.Errorf("UpdateActivity(missing) error = %v, expected ErrNotFound", err)
+	}
+
+	if err := fs.DeleteActivity("activity_1"); err != nil {
+		t.Fatalf("DeleteActivity() error = %v", err)
+	}
+	if _, err := fs.GetActivity("activity_1"); err != ErrNotFound {
+		t.Errorf("Activity still present after delete: %v", err)
+	}
+	if _, err := fs.GetGPXTrack("activity_1"); err != ErrNotFound {
+		t.Errorf("Track still present after delete: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "uploads", "gpx_1_run.gpx")); !os.IsNotExist(err) {
+		t.Errorf("Raw upload still present after delete: %v", err)
+	}
+	if err := fs.DeleteActivity("activity_1"); err != ErrNotFound {
+		t.Errorf("Second DeleteActivity() error = %v, expected ErrNotFound", err)
+	}
+}
+
+func TestFileStorageSaveInvalidID(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	fs := NewFileStorage(dir)
+
+	if err := fs.SaveSleepData(&models.SleepData{ID: "../../escaped", TotalSleep: 420}); err == nil {
+		t.Error("Expected an error for a sleep ID outside the data directory")
+	}
+	if err := fs.SaveHeartRateData(&models.HeartRateData{ID: "../escaped", RestingHR: 52}); err == nil {
+		t.Error("Expected an error for a heart rate ID outside the data directory")
+	}
+	for _, name := range []string{"escaped.json", filepath.Join("data", "escaped.json")} {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(dir), name)); !os.IsNotExist(err) {
+			t.Errorf("%s was written outside the data directory", name)
+		}
+	}
+}
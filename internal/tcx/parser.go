@@ -0,0 +1,219 @@
+// Package tcx parses Garmin Training Center (TCX) files into the same track
+// and activity models produced by the gpx package.
+package tcx
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/gpx"
+	"health-hub/internal/models"
+)
+
+// TCX XML structure
+type TrainingCenterDatabase struct {
+	XMLName    xml.Name   `xml:"TrainingCenterDatabase"`
+	Activities []Activity `xml:"Activities>Activity"`
+}
+
+type Activity struct {
+	Sport   string  `xml:"Sport,attr"` // "Running", "Biking" or "Other"
+	Laps    []Lap   `xml:"Lap"`
+	Creator Creator `xml:"Creator"`
+}
+
+type Lap struct {
+	StartTime        string       `xml:"StartTime,attr"`
+	TotalTimeSeconds float64      `xml:"TotalTimeSeconds"`
+	DistanceMeters   float64      `xml:"DistanceMeters"`
+	MaximumSpeed     float64      `xml:"MaximumSpeed"` // m/s
+	Calories         int          `xml:"Calories"`
+	AverageHeartRate int          `xml:"AverageHeartRateBpm>Value"`
+	MaximumHeartRate int          `xml:"MaximumHeartRateBpm>Value"`
+	Cadence          int          `xml:"Cadence"`
+	Trackpoints      []Trackpoint `xml:"Track>Trackpoint"`
+	Extensions       LapExtension `xml:"Extensions>LX"`
+}
+
+// LapExtension is the Garmin ActivityExtension lap data.
+type LapExtension struct {
+	AvgSpeed      float64 `xml:"AvgSpeed"` // m/s
+	AvgRunCadence int     `xml:"AvgRunCadence"`
+	AvgWatts      int     `xml:"AvgWatts"`
+	MaxWatts      int     `xml:"MaxWatts"`
+}
+
+type Trackpoint struct {
+	Time       string              `xml:"Time"`
+	Position   *Position           `xml:"Position"`
+	Altitude   float64             `xml:"AltitudeMeters"`
+	HeartRate  int                 `xml:"HeartRateBpm>Value"`
+	Cadence    int                 `xml:"Cadence"`
+	Extensions TrackpointExtension `xml:"Extensions>TPX"`
+}
+
+type Position struct {
+	Lat float64 `xml:"LatitudeDegrees"`
+	Lon float64 `xml:"LongitudeDegrees"`
+}
+
+// TrackpointExtension is the Garmin ActivityExtension trackpoint data.
+type TrackpointExtension struct {
+	Watts      int `xml:"Watts"`
+	RunCadence int `xml:"RunCadence"`
+}
+
+type Creator struct {
+	Name    string  `xml:"Name"`
+	UnitID  string  `xml:"UnitId"`
+	Version Version `xml:"Version"`
+}
+
+type Version struct {
+	Major int `xml:"VersionMajor"`
+	Minor int `xml:"VersionMinor"`
+}
+
+// ParseTCX parses a TCX file using the current configuration.
+func ParseTCX(content string) (*models.GPXTrack, *models.Activity, error) {
+	cfg := config.Load()
+	return ParseTCXWithConfig(content, cfg)
+}
+
+// ParseTCXWithConfig parses the first activity of a TCX file. Stats are
+// computed from the trackpoints the same way as for GPX files, including
+// elevation smoothing; lap totals fill in distance and time for indoor
+// activities.
+func ParseTCXWithConfig(content string, cfg *config.Config) (*models.GPXTrack, *models.Activity, error) {
+	var db TrainingCenterDatabase
+	if err := xml.Unmarshal([]byte(content), &db); err != nil {
+		return nil, nil, err
+	}
+	if len(db.Activities) == 0 {
+		return nil, nil, errors.New("TCX file has no activities")
+	}
+	tcxActivity := db.Activities[0]
+
+	track := &models.GPXTrack{
+		Points: []models.GPXPoint{},
+	}
+
+	var records []models.GPXPoint // every trackpoint, with or without a position
+	var laps []models.Lap
+	var lapDistance, lapTime float64
+	var calories int
+
+	for i, tcxLap := range tcxActivity.Laps {
+		var lapPoints []models.GPXPoint
+		for _, tp := range tcxLap.Trackpoints {
+			point := models.GPXPoint{
+				Elevation: tp.Altitude,
+				HeartRate: tp.HeartRate,
+				Cadence:   tp.Cadence,
+				Power:     tp.Extensions.Watts,
+			}
+			if point.Cadence == 0 {
+				point.Cadence = tp.Extensions.RunCadence
+			}
+			if t, err := time.Parse(time.RFC3339, tp.Time); err == nil {
+				point.Time = t
+			}
+
+			records = append(records, point)
+			if tp.Position != nil {
+				point.Lat = tp.Position.Lat
+				point.Lon = tp.Position.Lon
+				track.Points = append(track.Points, point)
+				lapPoints = append(lapPoints, point)
+			}
+		}
+
+		laps = append(laps, lap(tcxLap, i+1, lapPoints, cfg))
+		lapDistance += tcxLap.DistanceMeters
+		lapTime += tcxLap.TotalTimeSeconds
+		calories += tcxLap.Calories
+	}
+
+	if len(records) == 0 {
+		return nil, nil, errors.New("TCX file has no trackpoints")
+	}
+
+	activity := gpx.Summarize(track.Points, cfg)
+	// Indoor activities have sensor data without positions
+	gpx.ApplySensorStats(activity, records)
+	gpx.ApplyRecordTimes(activity, records)
+	if len(track.Points) == 0 {
+		// Without GPS there is nothing to detect pauses from, so trust the
+		// laps' timer time and distance; power efforts come from the records
+		activity.BestEfforts = gpx.BestEfforts(records)
+		if lapTime > 0 {
+			activity.MovingTime = int(lapTime)
+			activity.Duration = activity.MovingTime
+		}
+		activity.Distance = lapDistance
+		if activity.Duration > 0 {
+			activity.AvgSpeed = activity.Distance / float64(activity.Duration) * 3.6
+		}
+	}
+	activity.Calories = calories
+
+	if !strings.EqualFold(tcxActivity.Sport, "Other") {
+		if activityType := gpx.NormalizeActivityType(tcxActivity.Sport); activityType != "" {
+			activity.Type = activityType
+			activity.TypeSource = models.TypeSourceFile
+			activity.TypeConfidence = 1
+		}
+	}
+	gpx.DetectType(activity, track.Points)
+
+	activity.Laps = laps
+	if creator := tcxActivity.Creator; creator.Name != "" {
+		activity.Device = &models.Device{Product: creator.Name, SerialNumber: creator.UnitID}
+		if creator.Version.Major > 0 || creator.Version.Minor > 0 {
+			activity.Device.SoftwareVersion = fmt.Sprintf("%d.%02d", creator.Version.Major, creator.Version.Minor)
+		}
+	}
+
+	return track, activity, nil
+}
+
+func lap(tcxLap Lap, index int, points []models.GPXPoint, cfg *config.Config) models.Lap {
+	l := models.Lap{
+		Index:          index,
+		Duration:       int(tcxLap.TotalTimeSeconds),
+		ElapsedTime:    int(tcxLap.TotalTimeSeconds),
+		Distance:       tcxLap.DistanceMeters,
+		MaxSpeed:       tcxLap.MaximumSpeed * 3.6,
+		TotalElevation: gpx.ElevationGain(points, cfg),
+		Calories:       tcxLap.Calories,
+		AvgHeartRate:   tcxLap.AverageHeartRate,
+		MaxHeartRate:   tcxLap.MaximumHeartRate,
+		AvgCadence:     tcxLap.Cadence,
+		AvgPower:       tcxLap.Extensions.AvgWatts,
+		MaxPower:       tcxLap.Extensions.MaxWatts,
+	}
+	if l.AvgCadence == 0 {
+		l.AvgCadence = tcxLap.Extensions.AvgRunCadence
+	}
+
+	if tcxLap.Extensions.AvgSpeed > 0 {
+		l.AvgSpeed = tcxLap.Extensions.AvgSpeed * 3.6
+	} else if tcxLap.TotalTimeSeconds > 0 {
+		l.AvgSpeed = tcxLap.DistanceMeters / tcxLap.TotalTimeSeconds * 3.6
+	}
+
+	if t, err := time.Parse(time.RFC3339, tcxLap.StartTime); err == nil {
+		l.StartTime = t
+		// TCX only records timer time; elapsed time runs to the last trackpoint
+		if len(tcxLap.Trackpoints) > 0 {
+			if end, err := time.Parse(time.RFC3339, tcxLap.Trackpoints[len(tcxLap.Trackpoints)-1].Time); err == nil && end.After(t) {
+				l.ElapsedTime = int(end.Sub(t).Seconds())
+			}
+		}
+	}
+	return l
+}
@@ -0,0 +1,166 @@
+package tcx
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"health-hub/internal/config"
+	"health-hub/internal/models"
+)
+
+// runTCX builds a two-lap run: 20 trackpoints per lap, 10s apart, heading
+// north at ~10 km/h while climbing 1m per point.
+func runTCX() string {
+	start := time.Date(2024, 4, 6, 9, 0, 0, 0, time.UTC)
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Running">
+      <Id>2024-04-06T09:00:00Z</Id>
+`)
+	for lap := 0; lap < 2; lap++ {
+		lapStart := start.Add(time.Duration(lap) * 200 * time.Second)
+		fmt.Fprintf(&b, `      <Lap StartTime="%s">
+        <TotalTimeSeconds>195.0</TotalTimeSeconds>
+        <DistanceMeters>555.6</DistanceMeters>
+        <MaximumSpeed>3.1</MaximumSpeed>
+        <Calories>%d</Calories>
+        <AverageHeartRateBpm><Value>%d</Value></AverageHeartRateBpm>
+        <MaximumHeartRateBpm><Value>%d</Value></MaximumHeartRateBpm>
+        <Intensity>Active</Intensity>
+        <TriggerMethod>Distance</TriggerMethod>
+        <Track>
+`, lapStart.Format(time.RFC3339), 40+lap*5, 150+lap*5, 160+lap*5)
+		for i := 0; i < 20; i++ {
+			n := lap*20 + i
+			fmt.Fprintf(&b, `          <Trackpoint>
+            <Time>%s</Time>
+            <Position><LatitudeDegrees>%f</LatitudeDegrees><LongitudeDegrees>7.0</LongitudeDegrees></Position>
+            <AltitudeMeters>%d</AltitudeMeters>
+            <HeartRateBpm><Value>%d</Value></HeartRateBpm>
+            <Extensions><ns3:TPX><ns3:RunCadence>86</ns3:RunCadence></ns3:TPX></Extensions>
+          </Trackpoint>
+`, lapStart.Add(time.Duration(i)*10*time.Second).Format(time.RFC3339), 45+float64(n)*0.00025, 200+n, 140+n%20)
+		}
+		b.WriteString(`        </Track>
+        <Extensions><ns3:LX><ns3:AvgSpeed>2.85</ns3:AvgSpeed><ns3:AvgRunCadence>86</ns3:AvgRunCadence></ns3:LX></Extensions>
+      </Lap>
+`)
+	}
+	b.WriteString(`      <Creator xsi:type="Device_t" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+        <Name>Forerunner 935</Name>
+        <UnitId>3912345678</UnitId>
+        <Version><VersionMajor>23</VersionMajor><VersionMinor>0</VersionMinor></Version>
+      </Creator>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`)
+	return b.String()
+}
+
+func TestParseTCX(t *testing.T) {
+	cfg := &config.Config{ElevationSmoothingEnabled: true, ElevationSmoothingWindow: 5, ElevationMinGain: 3.0}
+	track, activity, err := ParseTCXWithConfig(runTCX(), cfg)
+	if err != nil {
+		t.Fatalf("ParseTCXWithConfig() error = %v", err)
+	}
+
+	if len(track.Points) != 40 {
+		t.Fatalf("Expected 40 points, got %d", len(track.Points))
+	}
+	if p := track.Points[0]; p.Lat != 45 || p.Lon != 7 || p.Elevation != 200 || p.HeartRate != 140 || p.Cadence != 86 {
+		t.Errorf("Unexpected first point %+v", p)
+	}
+
+	if activity.Type != "running" || activity.TypeSource != models.TypeSourceFile {
+		t.Errorf("Expected running from the Sport attribute, got %q from %q", activity.Type, activity.TypeSource)
+	}
+	if activity.Calories != 85 {
+		t.Errorf("Calories = %d, expected the lap total 85", activity.Calories)
+	}
+	if activity.Duration != 390 || activity.MaxHeartRate != 159 {
+		t.Errorf("Unexpected duration %d and max HR %d", activity.Duration, activity.MaxHeartRate)
+	}
+	// Steady 1m climbs from 200 to 239; the median window flattens the two
+	// points at each end, so smoothing shows up as 37 instead of the raw 39
+	if math.Abs(activity.TotalElevation-37) > 1e-9 {
+		t.Errorf("TotalElevation = %v, expected 37", activity.TotalElevation)
+	}
+
+	if len(activity.Laps) != 2 {
+		t.Fatalf("Expected 2 laps, got %d", len(activity.Laps))
+	}
+	lap := activity.Laps[1]
+	if lap.Index != 2 || lap.Duration != 195 || lap.ElapsedTime != 190 || lap.Distance != 555.6 {
+		t.Errorf("Unexpected lap totals %+v", lap)
+	}
+	if math.Abs(lap.AvgSpeed-10.26) > 1e-9 || math.Abs(lap.MaxSpeed-11.16) > 1e-9 {
+		t.Errorf("Unexpected lap speeds %+v", lap)
+	}
+	if lap.AvgHeartRate != 155 || lap.MaxHeartRate != 165 || lap.AvgCadence != 86 || lap.Calories != 45 {
+		t.Errorf("Unexpected lap sensors %+v", lap)
+	}
+	if math.Abs(lap.TotalElevation-17) > 1e-9 {
+		t.Errorf("Lap TotalElevation = %v, expected 17", lap.TotalElevation)
+	}
+
+	if activity.Device == nil || activity.Device.Name() != "Forerunner 935" || activity.Device.SoftwareVersion != "23.00" {
+		t.Errorf("Unexpected device %+v", activity.Device)
+	}
+}
+
+func TestParseTCXIndoorActivity(t *testing.T) {
+	indoor := `<?xml version="1.0" encoding="UTF-8"?>
+<TrainingCenterDatabase xmlns="http://www.garmin.com/xmlschemas/TrainingCenterDatabase/v2" xmlns:ns3="http://www.garmin.com/xmlschemas/ActivityExtension/v2">
+  <Activities>
+    <Activity Sport="Biking">
+      <Id>2024-04-07T18:00:00Z</Id>
+      <Lap StartTime="2024-04-07T18:00:00Z">
+        <TotalTimeSeconds>120</TotalTimeSeconds>
+        <DistanceMeters>1000</DistanceMeters>
+        <Calories>30</Calories>
+        <Track>
+          <Trackpoint><Time>2024-04-07T18:00:00Z</Time><HeartRateBpm><Value>110</Value></HeartRateBpm><Cadence>85</Cadence><Extensions><ns3:TPX><ns3:Watts>180</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+          <Trackpoint><Time>2024-04-07T18:01:00Z</Time><HeartRateBpm><Value>120</Value></HeartRateBpm><Cadence>90</Cadence><Extensions><ns3:TPX><ns3:Watts>220</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+          <Trackpoint><Time>2024-04-07T18:02:00Z</Time><HeartRateBpm><Value>130</Value></HeartRateBpm><Cadence>95</Cadence><Extensions><ns3:TPX><ns3:Watts>260</ns3:Watts></ns3:TPX></Extensions></Trackpoint>
+        </Track>
+      </Lap>
+    </Activity>
+  </Activities>
+</TrainingCenterDatabase>`
+
+	track, activity, err := ParseTCXWithConfig(indoor, &config.Config{})
+	if err != nil {
+		t.Fatalf("ParseTCXWithConfig() error = %v", err)
+	}
+	if len(track.Points) != 0 {
+		t.Errorf("Expected no track points without positions, got %d", len(track.Points))
+	}
+	if activity.Type != "cycling" || activity.Distance != 1000 || activity.Duration != 120 || math.Abs(activity.AvgSpeed-30) > 1e-9 {
+		t.Errorf("Unexpected type %q, distance %v, duration %d, speed %v", activity.Type, activity.Distance, activity.Duration, activity.AvgSpeed)
+	}
+	if activity.AvgHeartRate != 120 || activity.AvgCadence != 90 || activity.AvgPower != 220 || activity.MaxPower != 260 {
+		t.Errorf("Unexpected sensor stats %+v", activity)
+	}
+}
+
+func TestParseTCXErrors(t *testing.T) {
+	tests := map[string]string{
+		"invalid XML":   `<TrainingCenterDatabase><Activities>`,
+		"no activities": `<TrainingCenterDatabase><Activities></Activities></TrainingCenterDatabase>`,
+		"no trackpoints": `<TrainingCenterDatabase><Activities><Activity Sport="Running">
+			<Lap StartTime="2024-04-07T18:00:00Z"><TotalTimeSeconds>60</TotalTimeSeconds></Lap>
+		</Activity></Activities></TrainingCenterDatabase>`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := ParseTCXWithConfig(content, &config.Config{}); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
@@ -24,11 +24,13 @@ func (t *Templates) LoadTemplates() error {
 	// Define template functions
 	funcMap := template.FuncMap{
 		"formatDuration": formatDuration,
+		"formatPace":     formatPace,
+		"formatMinutes":  formatMinutes,
 		"divf":           divf,
 	}
 
 	// Define pages that need templates
-	pages := []string{"home", "activities", "stats", "bulk-upload", "activity-detail", "gps-track"}
+	pages := []string{"home", "activities", "stats", "bulk-upload", "activity-detail", "gps-track", "records", "sleep"}
 
 	for _, page := range pages {
 		// Parse both base and page template together from embedded filesystem
@@ -65,6 +67,28 @@ func formatDuration(seconds int) string {
 	return fmt.Sprintf("%d:%02d", minutes, secs)
 }
 
+// formatPace formats the pace of covering meters in seconds as "m:ss/km" or
+// "m:ss/mi".
+func formatPace(seconds int, meters float64, imperial bool) string {
+	if meters <= 0 {
+		return "N/A"
+	}
+	distance, unit := meters/1000, "/km"
+	if imperial {
+		distance, unit = meters/1609.344, "/mi"
+	}
+	pace := int(float64(seconds)/distance + 0.5)
+	return fmt.Sprintf("%d:%02d%s", pace/60, pace%60, unit)
+}
+
+// formatMinutes formats a duration in minutes as "7h 05m".
+func formatMinutes(minutes int) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+}
+
 func divf(a, b float64) float64 {
 	if b == 0 {
 		return 0
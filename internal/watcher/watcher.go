@@ -0,0 +1,145 @@
+// Package watcher imports activity files that appear in a directory, such as
+// a folder that watches sync into with Syncthing.
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"health-hub/internal/importer"
+)
+
+// Subfolders of the watched directory that processed files are moved to.
+const (
+	ArchiveDir = "imported" // files imported successfully
+	ErrorDir   = "failed"   // files that failed, each with a reason file
+)
+
+// ReasonSuffix is appended to a failed file's name for the file explaining
+// why it failed.
+const ReasonSuffix = ".error.txt"
+
+// settleTime is how long a file must go unmodified before it is imported, so
+// files still being written are left for the next scan.
+const settleTime = 5 * time.Second
+
+// ImportFunc imports one activity file. An error moves the file to ErrorDir.
+type ImportFunc func(name string, data []byte) error
+
+// Watcher polls a directory for new activity files.
+type Watcher struct {
+	dir        string
+	interval   time.Duration
+	importFile ImportFunc
+	now        func() time.Time
+}
+
+// New returns a watcher that scans dir every interval, at least a second, and
+// passes new GPX, FIT and TCX files to importFile.
+func New(dir string, interval time.Duration, importFile ImportFunc) *Watcher {
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return &Watcher{
+		dir:        dir,
+		interval:   interval,
+		importFile: importFile,
+		now:        time.Now,
+	}
+}
+
+// Run scans the directory, creating it if needed, until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) {
+	if err := os.MkdirAll(w.dir, 0755); err != nil {
+		fmt.Printf("ERROR: Failed to create watched folder %s: %v\n", w.dir, err)
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		if _, _, err := w.Scan(); err != nil {
+			fmt.Printf("ERROR: Failed to scan watched folder %s: %v\n", w.dir, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Scan imports the activity files currently in the directory, moving each to
+// ArchiveDir or ErrorDir. Subfolders, hidden files (including Syncthing's
+// temporary files) and other file types are left alone.
+func (w *Watcher) Scan() (imported, failed int, err error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~syncthing~") ||
+			!importer.IsActivityFile(name) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || w.now().Sub(info.ModTime()) < settleTime {
+			continue // removed meanwhile, or still being written
+		}
+
+		path := filepath.Join(w.dir, name)
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = w.importFile(name, data)
+		}
+		if err != nil {
+			fmt.Printf("ERROR: Failed to import watched file %s: %v\n", name, err)
+			if moveErr := w.fail(name, err); moveErr != nil {
+				return imported, failed, moveErr
+			}
+			failed++
+			continue
+		}
+
+		fmt.Printf("INFO: Imported watched file %s\n", name)
+		if _, err := w.move(name, ArchiveDir); err != nil {
+			return imported, failed, err
+		}
+		imported++
+	}
+	return imported, failed, nil
+}
+
+// fail moves a file to ErrorDir and writes the reason next to it.
+func (w *Watcher) fail(name string, reason error) error {
+	moved, err := w.move(name, ErrorDir)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("%s: %v\n", w.now().Format(time.RFC3339), reason)
+	return os.WriteFile(moved+ReasonSuffix, []byte(message), 0644)
+}
+
+// move moves a file into a subfolder, renaming it if the subfolder already
+// holds a file of that name, and returns its new path.
+func (w *Watcher) move(name, subdir string) (string, error) {
+	dir := filepath.Join(w.dir, subdir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	target := filepath.Join(dir, name)
+	if _, err := os.Stat(target); err == nil {
+		// The same file name synced again, e.g. a watch reusing names
+		ext := filepath.Ext(name)
+		target = filepath.Join(dir, fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), w.now().UnixNano(), ext))
+	}
+	if err := os.Rename(filepath.Join(w.dir, name), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("content of "+filepath.Base(path)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func listDir(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestScan(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	old := now.Add(-time.Minute)
+
+	writeFile(t, filepath.Join(dir, "run.gpx"), old)
+	writeFile(t, filepath.Join(dir, "ride.FIT"), old)
+	writeFile(t, filepath.Join(dir, "broken.tcx"), old)
+	writeFile(t, filepath.Join(dir, "syncing.gpx"), now.Add(-time.Second))
+	writeFile(t, filepath.Join(dir, ".syncthing.walk.gpx.tmp"), old)
+	writeFile(t, filepath.Join(dir, "notes.txt"), old)
+
+	var seen []string
+	w := New(dir, time.Minute, func(name string, data []byte) error {
+		seen = append(seen, name)
+		if string(data) != "content of "+name {
+			t.Errorf("Unexpected data for %s: %q", name, data)
+		}
+		if name == "broken.tcx" {
+			return errors.New("invalid TCX file")
+		}
+		return nil
+	})
+	w.now = func() time.Time { return now }
+
+	imported, failed, err := w.Scan()
+	if err != nil {
+		t.Fatalf("Scan() error: %v", err)
+	}
+	if imported != 2 || failed != 1 {
+		t.Errorf("Scan() = %d imported, %d failed, expected 2 and 1", imported, failed)
+	}
+	sort.Strings(seen)
+	if expected := []string{"broken.tcx", "ride.FIT", "run.gpx"}; !reflect.DeepEqual(seen, expected) {
+		t.Errorf("Imported %v, expected %v", seen, expected)
+	}
+
+	if got, expected := listDir(t, dir), []string{".syncthing.walk.gpx.tmp", ErrorDir, ArchiveDir, "notes.txt", "syncing.gpx"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Watched folder holds %v, expected %v", got, expected)
+	}
+	if got, expected := listDir(t, filepath.Join(dir, ArchiveDir)), []string{"ride.FIT", "run.gpx"}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("Archive holds %v, expected %v", got, expected)
+	}
+	reason, err := os.ReadFile(filepath.Join(dir, ErrorDir, "broken.tcx"+ReasonSuffix))
+	if err != nil || !strings.Contains(string(reason), "invalid TCX file") {
+		t.Errorf("Expected the failure reason, got %q, %v", reason, err)
+	}
+
+	// Once written, the file left behind is picked up by the next scan
+	now = now.Add(time.Minute)
+	if imported, _, _ := w.Scan(); imported != 1 {
+		t.Errorf("Expected the settled file to be imported, got %d", imported)
+	}
+}
+
+func TestScanRenamesRepeatedNames(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := New(dir, time.Minute, func(string, []byte) error { return nil })
+	w.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		writeFile(t, filepath.Join(dir, "activity.fit"), now.Add(-time.Minute))
+		if _, _, err := w.Scan(); err != nil {
+			t.Fatalf("Scan() error: %v", err)
+		}
+		now = now.Add(time.Second)
+	}
+
+	archived := listDir(t, filepath.Join(dir, ArchiveDir))
+	if len(archived) != 2 || archived[0] != "activity.fit" || !strings.HasPrefix(archived[1], "activity_") {
+		t.Errorf("Expected both files archived under distinct names, got %v", archived)
+	}
+}
@@ -0,0 +1,252 @@
+// Package zones divides heart rate into five training zones, from a maximum
+// heart rate, a lactate threshold heart rate (LTHR) or the heart rate
+// reserve between resting and maximum, and measures the time an activity
+// spent in each.
+package zones
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+// Methods of setting the zones.
+const (
+	MethodMaxHR   = "max_hr"     // percentages of maximum heart rate
+	MethodLTHR    = "lthr"       // percentages of lactate threshold heart rate (Friel)
+	MethodReserve = "hr_reserve" // percentages of heart rate reserve (Karvonen)
+)
+
+// Names of the five zones, easiest first.
+var Names = []string{"Recovery", "Endurance", "Tempo", "Threshold", "VO2 max"}
+
+// bounds are the lower bounds of zones 2 to 5 for each method, as fractions
+// of the method's reference heart rate. Zone 1 takes everything below.
+var bounds = map[string][]float64{
+	MethodMaxHR:   {0.60, 0.70, 0.80, 0.90},
+	MethodLTHR:    {0.85, 0.90, 0.95, 1.00},
+	MethodReserve: {0.60, 0.70, 0.80, 0.90},
+}
+
+// maxGap is the longest interval between two track points that counts
+// towards a zone. Longer ones are pauses, or the device stopped recording.
+const maxGap = 30 * time.Second
+
+// Config is how the zones are set. MaxHR is used by MethodMaxHR and
+// MethodReserve, LTHR by MethodLTHR and RestingHR by MethodReserve.
+type Config struct {
+	Method    string `json:"method"`
+	MaxHR     int    `json:"max_hr,omitempty"`
+	LTHR      int    `json:"lthr,omitempty"`
+	RestingHR int    `json:"resting_hr,omitempty"`
+}
+
+// ParseConfig reads a config from the method, max_hr, lthr and resting_hr
+// values of a query or cookie. Heart rates that are not given are left at
+// zero, to be filled in before Validate.
+func ParseConfig(values url.Values) (Config, error) {
+	c := Config{Method: values.Get("method")}
+	if c.Method == "" {
+		c.Method = MethodMaxHR
+	}
+	if _, ok := bounds[c.Method]; !ok {
+		return c, fmt.Errorf("method must be %s, %s or %s", MethodMaxHR, MethodLTHR, MethodReserve)
+	}
+	for _, field := range []struct {
+		name  string
+		value *int
+	}{
+		{"max_hr", &c.MaxHR}, {"lthr", &c.LTHR}, {"resting_hr", &c.RestingHR},
+	} {
+		if v := values.Get(field.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return c, fmt.Errorf("invalid %s %q", field.name, v)
+			}
+			*field.value = n
+		}
+	}
+	return c, nil
+}
+
+// Encode writes the config as query values, the inverse of ParseConfig.
+func (c Config) Encode() string {
+	values := url.Values{"method": {c.Method}}
+	if c.MaxHR > 0 {
+		values.Set("max_hr", strconv.Itoa(c.MaxHR))
+	}
+	if c.LTHR > 0 {
+		values.Set("lthr", strconv.Itoa(c.LTHR))
+	}
+	if c.RestingHR > 0 {
+		values.Set("resting_hr", strconv.Itoa(c.RestingHR))
+	}
+	return values.Encode()
+}
+
+// Validate checks that the config has the heart rates its method needs.
+func (c Config) Validate() error {
+	switch c.Method {
+	case MethodMaxHR:
+		return checkHR("max_hr", c.MaxHR, 100, 250)
+	case MethodLTHR:
+		return checkHR("lthr", c.LTHR, 80, 230)
+	case MethodReserve:
+		if err := checkHR("max_hr", c.MaxHR, 100, 250); err != nil {
+			return err
+		}
+		if err := checkHR("resting_hr", c.RestingHR, 20, 150); err != nil {
+			return err
+		}
+		if c.RestingHR >= c.MaxHR {
+			return errors.New("resting_hr must be below max_hr")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown method %q", c.Method)
+}
+
+func checkHR(name string, bpm, min, max int) error {
+	if bpm == 0 {
+		return fmt.Errorf("%s is required", name)
+	}
+	if bpm < min || bpm > max {
+		return fmt.Errorf("%s must be between %d and %d bpm, got %d", name, min, max, bpm)
+	}
+	return nil
+}
+
+// Zone is one heart rate zone. Min is inclusive and Max exclusive; the top
+// zone has no Max.
+type Zone struct {
+	Index int    `json:"index"` // 1-based
+	Name  string `json:"name"`
+	Min   int    `json:"min"`           // bpm
+	Max   int    `json:"max,omitempty"` // bpm
+}
+
+// Zones returns the five zones of a valid config.
+func (c Config) Zones() []Zone {
+	fractions := bounds[c.Method]
+	lower := make([]int, len(fractions))
+	for i, f := range fractions {
+		var bpm float64
+		switch c.Method {
+		case MethodMaxHR:
+			bpm = f * float64(c.MaxHR)
+		case MethodLTHR:
+			bpm = f * float64(c.LTHR)
+		case MethodReserve:
+			bpm = float64(c.RestingHR) + f*float64(c.MaxHR-c.RestingHR)
+		}
+		lower[i] = int(math.Round(bpm))
+	}
+
+	zones := make([]Zone, len(Names))
+	for i, name := range Names {
+		zones[i] = Zone{Index: i + 1, Name: name}
+		if i > 0 {
+			zones[i].Min = lower[i-1]
+		}
+		if i < len(lower) {
+			zones[i].Max = lower[i]
+		}
+	}
+	return zones
+}
+
+// Of returns the index into zones of the zone a heart rate is in.
+func Of(zones []Zone, bpm int) int {
+	for i := len(zones) - 1; i > 0; i-- {
+		if bpm >= zones[i].Min {
+			return i
+		}
+	}
+	return 0
+}
+
+// TimeInZones returns the seconds a track spent in each zone. Each interval
+// between two points counts towards the zone of the heart rate at its
+// start; intervals without a heart rate and gaps longer than maxGap are
+// left out.
+func TimeInZones(zones []Zone, points []models.GPXPoint) []int {
+	seconds := make([]float64, len(zones))
+	eachInterval(points, func(bpm int, dt time.Duration) {
+		seconds[Of(zones, bpm)] += dt.Seconds()
+	})
+	return round(seconds)
+}
+
+// TimeAtHeartRates returns the seconds a track spent at each heart rate,
+// counted like TimeInZones. Stored with an activity, it gives the time in
+// any zones without reading the track again; it is nil for a track without
+// heart rate data.
+func TimeAtHeartRates(points []models.GPXPoint) map[int]int {
+	seconds := make(map[int]float64)
+	eachInterval(points, func(bpm int, dt time.Duration) {
+		seconds[bpm] += dt.Seconds()
+	})
+
+	var result map[int]int
+	for bpm, s := range seconds {
+		if s := int(math.Round(s)); s > 0 {
+			if result == nil {
+				result = make(map[int]int)
+			}
+			result[bpm] = s
+		}
+	}
+	return result
+}
+
+// SumZones adds up the seconds of TimeAtHeartRates in each zone.
+func SumZones(zones []Zone, heartRateTime map[int]int) []int {
+	result := make([]int, len(zones))
+	for bpm, s := range heartRateTime {
+		result[Of(zones, bpm)] += s
+	}
+	return result
+}
+
+// eachInterval calls f with the heart rate at the start and the length of
+// each interval between two points that counts towards a zone.
+func eachInterval(points []models.GPXPoint, f func(bpm int, dt time.Duration)) {
+	for i := 0; i+1 < len(points); i++ {
+		p := points[i]
+		if p.HeartRate <= 0 || p.Time.IsZero() || points[i+1].Time.IsZero() {
+			continue
+		}
+		dt := points[i+1].Time.Sub(p.Time)
+		if dt <= 0 || dt > maxGap {
+			continue
+		}
+		f(p.HeartRate, dt)
+	}
+}
+
+func round(seconds []float64) []int {
+	result := make([]int, len(seconds))
+	for i, s := range seconds {
+		result[i] = int(math.Round(s))
+	}
+	return result
+}
+
+// EstimateMaxHR returns the highest maximum heart rate of the activities, as
+// an estimate of the maximum heart rate when none is configured. Readings
+// above 220 bpm are taken to be sensor glitches. It returns 0 when no
+// activity has heart rate data.
+func EstimateMaxHR(activities []*models.Activity) int {
+	max := 0
+	for _, activity := range activities {
+		if activity.MaxHeartRate > max && activity.MaxHeartRate <= 220 {
+			max = activity.MaxHeartRate
+		}
+	}
+	return max
+}
@@ -0,0 +1,138 @@
+package zones
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"health-hub/internal/models"
+)
+
+func TestZones(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		expected []int // lower bounds of zones 2 to 5
+	}{
+		{"max HR", Config{Method: MethodMaxHR, MaxHR: 190}, []int{114, 133, 152, 171}},
+		{"LTHR", Config{Method: MethodLTHR, LTHR: 170}, []int{145, 153, 162, 170}},
+		{"HR reserve", Config{Method: MethodReserve, MaxHR: 190, RestingHR: 50}, []int{134, 148, 162, 176}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			zones := tt.config.Zones()
+			if len(zones) != 5 || zones[0].Min != 0 || zones[4].Max != 0 {
+				t.Fatalf("Zones() = %+v", zones)
+			}
+			for i, min := range tt.expected {
+				if zones[i+1].Min != min || zones[i].Max != min {
+					t.Errorf("Zone %d starts at %d bpm (zone %d ends at %d), expected %d", i+2, zones[i+1].Min, i+1, zones[i].Max, min)
+				}
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		valid  bool
+	}{
+		{"max HR", Config{Method: MethodMaxHR, MaxHR: 185}, true},
+		{"no max HR", Config{Method: MethodMaxHR}, false},
+		{"LTHR without LTHR", Config{Method: MethodLTHR, MaxHR: 185}, false},
+		{"reserve without resting", Config{Method: MethodReserve, MaxHR: 185}, false},
+		{"resting above max", Config{Method: MethodReserve, MaxHR: 120, RestingHR: 130}, false},
+		{"implausible max", Config{Method: MethodMaxHR, MaxHR: 300}, false},
+		{"unknown method", Config{Method: "power", MaxHR: 185}, false},
+	}
+
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err == nil) != tt.valid {
+			t.Errorf("Validate(%s) error = %v, expected valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	original := Config{Method: MethodReserve, MaxHR: 188, RestingHR: 48}
+	values, _ := url.ParseQuery(original.Encode())
+	parsed, err := ParseConfig(values)
+	if err != nil || parsed != original {
+		t.Errorf("ParseConfig(Encode()) = %+v, %v, expected %+v", parsed, err, original)
+	}
+
+	if c, err := ParseConfig(url.Values{}); err != nil || c.Method != MethodMaxHR {
+		t.Errorf("ParseConfig() = %+v, %v, expected method %s", c, err, MethodMaxHR)
+	}
+	if _, err := ParseConfig(url.Values{"method": {"power"}}); err == nil {
+		t.Error("Expected an error for an unknown method")
+	}
+	if _, err := ParseConfig(url.Values{"max_hr": {"fast"}}); err == nil {
+		t.Error("Expected an error for a max_hr that is not a number")
+	}
+}
+
+func TestTimeInZones(t *testing.T) {
+	zones := Config{Method: MethodMaxHR, MaxHR: 200}.Zones() // zones 2-5 from 120, 140, 160, 180
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	at := func(seconds, bpm int) models.GPXPoint {
+		return models.GPXPoint{Time: start.Add(time.Duration(seconds) * time.Second), HeartRate: bpm}
+	}
+	points := []models.GPXPoint{
+		at(0, 100),   // 10 s in zone 1
+		at(10, 130),  // 20 s in zone 2
+		at(30, 0),    // no heart rate: not counted
+		at(40, 165),  // 5 s in zone 4
+		at(45, 185),  // a pause: not counted
+		at(300, 185), // 15 s in zone 5
+		at(315, 150), // the last point starts no interval
+	}
+
+	got := TimeInZones(zones, points)
+	expected := []int{10, 20, 0, 5, 15}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("TimeInZones() = %v, expected %v", got, expected)
+			break
+		}
+	}
+}
+
+func TestTimeAtHeartRates(t *testing.T) {
+	zones := Config{Method: MethodMaxHR, MaxHR: 200}.Zones()
+	start := time.Date(2024, 5, 1, 7, 0, 0, 0, time.UTC)
+	at := func(seconds, bpm int) models.GPXPoint {
+		return models.GPXPoint{Time: start.Add(time.Duration(seconds) * time.Second), HeartRate: bpm}
+	}
+	points := []models.GPXPoint{at(0, 100), at(10, 130), at(30, 0), at(40, 165), at(45, 185), at(300, 185), at(315, 150)}
+
+	seconds := TimeAtHeartRates(points)
+	if len(seconds) != 4 || seconds[100] != 10 || seconds[130] != 20 || seconds[165] != 5 || seconds[185] != 15 {
+		t.Errorf("TimeAtHeartRates() = %v", seconds)
+	}
+	// Summed into zones, they match the time in zones from the track
+	got, expected := SumZones(zones, seconds), TimeInZones(zones, points)
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("SumZones() = %v, expected %v", got, expected)
+			break
+		}
+	}
+
+	if seconds := TimeAtHeartRates([]models.GPXPoint{at(0, 0), at(10, 0)}); seconds != nil {
+		t.Errorf("Expected nil without heart rate data, got %v", seconds)
+	}
+}
+
+func TestEstimateMaxHR(t *testing.T) {
+	activities := []*models.Activity{{MaxHeartRate: 176}, {MaxHeartRate: 241}, {MaxHeartRate: 183}, {}}
+	if got := EstimateMaxHR(activities); got != 183 {
+		t.Errorf("EstimateMaxHR() = %d, expected 183", got)
+	}
+}
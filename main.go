@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"log"
@@ -12,6 +13,7 @@ import (
 	"health-hub/internal/config"
 	"health-hub/internal/handlers"
 	"health-hub/internal/storage"
+	"health-hub/internal/watcher"
 )
 
 //go:embed templates
@@ -24,7 +26,16 @@ func main() {
 	var store storage.Storage
 	var err error
 	
-	if cfg.UseS3 && cfg.S3Bucket != "" {
+	if cfg.StorageBackend == "sqlite" {
+		store, err = openSQLiteStorage(cfg)
+		if err != nil {
+			log.Fatalf("Failed to initialize SQLite storage: %v", err)
+		}
+		log.Printf("Using SQLite storage at %s", cfg.DatabasePath())
+		if cfg.UseS3 || cfg.S3Bucket != "" {
+			log.Println("WARNING: USE_S3 and S3_BUCKET are ignored with STORAGE_BACKEND=sqlite")
+		}
+	} else if cfg.UseS3 && cfg.S3Bucket != "" {
 		store, err = storage.NewS3Storage(cfg.DataPath, cfg.S3Bucket)
 		if err != nil {
 			log.Printf("Failed to initialize S3 storage: %v, falling back to file storage", err)
@@ -38,7 +49,14 @@ func main() {
 	}
 
 	// Initialize handlers with embedded templates
-	h := handlers.NewHandlers(store, templateFS)
+	h := handlers.NewHandlers(store, templateFS, cfg)
+
+	// Import files synced into the watched folder
+	if cfg.WatchDir != "" {
+		w := watcher.New(cfg.WatchDir, time.Duration(cfg.WatchInterval)*time.Second, h.ImportFile)
+		go w.Run(context.Background())
+		log.Printf("Watching %s for activity files every %ds", cfg.WatchDir, cfg.WatchInterval)
+	}
 
 	// Setup routes
 	mux := http.NewServeMux()
@@ -51,16 +69,27 @@ func main() {
 	mux.HandleFunc("/upload", h.Upload)
 	mux.HandleFunc("/activities", h.Activities)
 	mux.HandleFunc("/stats", h.Stats)
+	mux.HandleFunc("/records", h.Records)
+	mux.HandleFunc("/sleep", h.Sleep)
 	mux.HandleFunc("/bulk-upload", h.BulkUpload)
 	mux.HandleFunc("/activity/", h.ActivityDetail)
 	mux.HandleFunc("/gps-track/", h.GPSTrack)
 	mux.HandleFunc("/api/activities", h.GetActivities)
+	mux.HandleFunc("/api/activities/", h.Activity)
 	mux.HandleFunc("/api/health", h.GetHealthMetrics)
+	mux.HandleFunc("/api/health/export.csv", h.ExportHealthCSV)
+	mux.HandleFunc("/api/sleep", h.GetSleepData)
+	mux.HandleFunc("/api/heart-rate", h.GetHeartRateData)
 	mux.HandleFunc("/api/upload/gpx", h.UploadGPX)
 	mux.HandleFunc("/api/upload/health", h.UploadHealthData)
+	mux.HandleFunc("/api/upload/sleep", h.UploadSleepData)
+	mux.HandleFunc("/api/upload/heart-rate", h.UploadHeartRateData)
 	mux.HandleFunc("/api/upload/bulk-gpx", h.BulkUploadGPX)
+	mux.HandleFunc("/api/jobs/", h.Job)
 	mux.HandleFunc("/api/stats/activities", h.StatsActivities)
 	mux.HandleFunc("/api/stats/health", h.StatsHealth)
+	mux.HandleFunc("/api/records", h.GetRecords)
+	mux.HandleFunc("/api/export", h.ExportAccount)
 	mux.HandleFunc("/api/recalculate", h.RecalculateElevation)
 
 	fmt.Printf("=== Health Hub Server ===\n")
@@ -76,6 +105,32 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+cfg.Port, loggingMiddleware(mux)))
 }
 
+// openSQLiteStorage opens the configured database. When the database is new
+// and the data directory already holds JSON records, they are copied in so
+// switching backends does not hide existing activities.
+func openSQLiteStorage(cfg *config.Config) (*storage.SQLiteStorage, error) {
+	store, err := storage.NewSQLiteStorage(cfg.DataPath, cfg.DatabasePath())
+	if err != nil {
+		return nil, err
+	}
+
+	empty, err := store.Empty()
+	if err != nil {
+		return nil, err
+	}
+	if empty {
+		imported, err := store.ImportFrom(storage.NewFileStorage(cfg.DataPath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to import JSON data: %v", err)
+		}
+		if imported > 0 {
+			log.Printf("Imported %d records from JSON files into SQLite", imported)
+		}
+	}
+
+	return store, nil
+}
+
 // loggingMiddleware logs HTTP requests with method, path, status code, and response time
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -113,6 +168,13 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.ResponseWriter.WriteHeader(code)
 }
 
+// Flush passes flushes through for streamed responses such as job progress
+func (lrw *loggingResponseWriter) Flush() {
+	if flusher, ok := lrw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
 func showTailscaleInfo(port string) error {
 	// Try to get Tailscale IP
 	cmd := exec.Command("tailscale", "ip", "-4")